@@ -20,6 +20,7 @@
 package control
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -50,11 +51,21 @@ type RtmgrClient struct {
 	rtClient *rtmgrclient.RoutingManager
 }
 
-func (rc *RtmgrClient) SubscriptionRequestCreate(subRouteAction SubRouteInfo) error {
+//-----------------------------------------------------------------------------
+// Request to rtmgr ends when ctx is cancelled or at its deadline but waits for
+// response rtmgrRequestTimeout at the most
+//-----------------------------------------------------------------------------
+func rtmgrRequestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(rtmgrRequestTimeout.Load()))
+}
+
+func (rc *RtmgrClient) SubscriptionRequestCreate(ctx context.Context, subRouteAction SubRouteInfo) error {
 	subID := int32(subRouteAction.SubID)
 	xapp.Logger.Debug("CREATE %s ongoing", subRouteAction.String())
 	createData := rtmgr_models.XappSubscriptionData{&subRouteAction.EpList.Endpoints[0].Addr, &subRouteAction.EpList.Endpoints[0].Port, &subID}
-	createHandle := rtmgrhandle.NewProvideXappSubscriptionHandleParamsWithTimeout(2 * time.Second)
+	ctx, cancel := rtmgrRequestContext(ctx)
+	defer cancel()
+	createHandle := rtmgrhandle.NewProvideXappSubscriptionHandleParamsWithContext(ctx)
 	createHandle.WithXappSubscriptionData(&createData)
 	_, err := rc.rtClient.Handle.ProvideXappSubscriptionHandle(createHandle)
 	if err != nil && !(strings.Contains(err.Error(), "status 200")) {
@@ -64,13 +75,15 @@ func (rc *RtmgrClient) SubscriptionRequestCreate(subRouteAction SubRouteInfo) er
 	return nil
 }
 
-func (rc *RtmgrClient) SubscriptionRequestUpdate(subRouteAction SubRouteInfo) error {
+func (rc *RtmgrClient) SubscriptionRequestUpdate(ctx context.Context, subRouteAction SubRouteInfo) error {
 	xapp.Logger.Debug("UPDATE %s ongoing", subRouteAction.String())
 	var updateData rtmgr_models.XappList
 	for i := range subRouteAction.EpList.Endpoints {
 		updateData = append(updateData, &rtmgr_models.XappElement{Address: &subRouteAction.EpList.Endpoints[i].Addr, Port: &subRouteAction.EpList.Endpoints[i].Port})
 	}
-	updateHandle := rtmgrhandle.NewUpdateXappSubscriptionHandleParamsWithTimeout(2 * time.Second)
+	ctx, cancel := rtmgrRequestContext(ctx)
+	defer cancel()
+	updateHandle := rtmgrhandle.NewUpdateXappSubscriptionHandleParamsWithContext(ctx)
 	updateHandle.WithSubscriptionID(subRouteAction.SubID)
 	updateHandle.WithXappList(updateData)
 	_, err := rc.rtClient.Handle.UpdateXappSubscriptionHandle(updateHandle)
@@ -82,11 +95,13 @@ func (rc *RtmgrClient) SubscriptionRequestUpdate(subRouteAction SubRouteInfo) er
 
 }
 
-func (rc *RtmgrClient) SubscriptionRequestDelete(subRouteAction SubRouteInfo) error {
+func (rc *RtmgrClient) SubscriptionRequestDelete(ctx context.Context, subRouteAction SubRouteInfo) error {
 	subID := int32(subRouteAction.SubID)
 	xapp.Logger.Debug("DELETE %s ongoing", subRouteAction.String())
 	deleteData := rtmgr_models.XappSubscriptionData{&subRouteAction.EpList.Endpoints[0].Addr, &subRouteAction.EpList.Endpoints[0].Port, &subID}
-	deleteHandle := rtmgrhandle.NewDeleteXappSubscriptionHandleParamsWithTimeout(2 * time.Second)
+	ctx, cancel := rtmgrRequestContext(ctx)
+	defer cancel()
+	deleteHandle := rtmgrhandle.NewDeleteXappSubscriptionHandleParamsWithContext(ctx)
 	deleteHandle.WithXappSubscriptionData(&deleteData)
 	_, _, err := rc.rtClient.Handle.DeleteXappSubscriptionHandle(deleteHandle)
 	if err != nil && !(strings.Contains(err.Error(), "status 200")) {
@@ -20,9 +20,16 @@
 package control
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
@@ -58,13 +65,19 @@ func idstring(err error, entries ...fmt.Stringer) string {
 	return retval
 }
 
+// xapp-frame does not define code for REST Subscription Request rejected due quota
+const subscribeTooManyRequestsCode = http.StatusTooManyRequests
+
+// Nor for idempotency key reused for a different request
+const idempotencyKeyConflictCode = http.StatusUnprocessableEntity
+
 //-----------------------------------------------------------------------------
 //
 //-----------------------------------------------------------------------------
 
 var e2tSubReqTimeout time.Duration
 var e2tSubDelReqTime time.Duration
-var e2tRecvMsgTimeout time.Duration
+var rtmgrRequestTimeout atomic.Int64 // time.Duration, read while config is reloaded
 var waitRouteCleanup_ms time.Duration
 var e2tMaxSubReqTryCount uint64    // Initial try + retry
 var e2tMaxSubDelReqTryCount uint64 // Initial try + retry
@@ -73,22 +86,46 @@ var readSubsFromDb string
 var dbRetryForever string
 var dbTryCount int
 var e2IEOrderCheckValue uint8
+var notificationMaxTryCount uint64 // Initial try + retry
+var notificationRetryDelay time.Duration
+var notificationMaxRetryDelay time.Duration
+var idempotencyKeyRetention time.Duration
+var restDuplicateTtl time.Duration
+var restOngoingRequestTimeout time.Duration
+var rmrRequestTimeout time.Duration
+var subscriptionLeaseCheckInterval time.Duration
+var e2CleanupMaxTryCount uint64 // Background retries only
+var e2CleanupRetryDelay time.Duration
+var e2CleanupMaxRetryDelay time.Duration
+var restQueryFilter atomic.Pointer[SubscriptionFilter] // Replaced when config is reloaded
+
+// Maximum time shutdown waits for cancelled REST subscription processing to end
+var shutdownWaitTime = 5 * time.Second
 
 type Control struct {
 	*xapp.RMRClient
-	e2ap              *E2ap
-	registry          *Registry
-	tracker           *Tracker
-	restDuplicateCtrl *DuplicateCtrl
-	e2IfState         *E2IfState
-	e2IfStateDb       XappRnibInterface
-	e2SubsDb          Sdlnterface
-	restSubsDb        Sdlnterface
-	CntRecvMsg        uint64
-	ResetTestFlag     bool
-	Counters          map[string]xapp.Counter
-	LoggerLevel       int
-	UTTesting         bool
+	e2ap                 *E2ap
+	registry             *Registry
+	tracker              *Tracker
+	restDuplicateCtrl    *DuplicateCtrl
+	notificationOutbox   *NotificationOutbox
+	e2NodeAdmission      *E2NodeAdmission
+	lifecycleListener    XappLifecycleListener
+	notificationSender   atomic.Pointer[NotificationSender] // Replaced when config is reloaded
+	e2IfState            *E2IfState
+	e2IfStateDb          XappRnibInterface
+	e2SubsDb             Sdlnterface
+	restSubsDb           Sdlnterface
+	restDuplicateDb      Sdlnterface
+	notificationOutboxDb Sdlnterface
+	CntRecvMsg           uint64
+	ResetTestFlag        bool
+	Counters             map[string]xapp.Counter
+	Gauges               map[string]xapp.Gauge
+	LoggerLevel          int
+	UTTesting            bool
+	ctx                  context.Context    // Cancelled when submgr shuts down
+	cancel               context.CancelFunc //
 }
 
 type RMRMeid struct {
@@ -99,6 +136,7 @@ type RMRMeid struct {
 
 type SubmgrRestartTestEvent struct{}
 type SubmgrRestartUpEvent struct{}
+type AdmissionCancelledEvent struct{}
 type PackSubscriptionRequestErrortEvent struct {
 	ErrorInfo ErrorInfo
 }
@@ -130,6 +168,8 @@ func NewControl() *Control {
 	registry := new(Registry)
 	registry.Initialize()
 	registry.rtmgrClient = &rtmgrClient
+	registry.quarantineDb = CreateQuarantineSdl()
+	registry.e2CleanupDb = CreateE2CleanupSdl()
 
 	tracker := new(Tracker)
 	tracker.Init()
@@ -137,27 +177,46 @@ func NewControl() *Control {
 	restDuplicateCtrl := new(DuplicateCtrl)
 	restDuplicateCtrl.Init()
 
+	notificationOutbox := new(NotificationOutbox)
+
+	e2NodeAdmission := new(E2NodeAdmission)
+
 	e2IfState := new(E2IfState)
 
 	c := &Control{e2ap: new(E2ap),
-		registry:          registry,
-		tracker:           tracker,
-		restDuplicateCtrl: restDuplicateCtrl,
-		e2IfState:         e2IfState,
-		e2IfStateDb:       CreateXappRnibIfInstance(),
-		e2SubsDb:          CreateSdl(),
-		restSubsDb:        CreateRESTSdl(),
-		Counters:          xapp.Metric.RegisterCounterGroup(GetMetricsOpts(), "SUBMGR"),
-		LoggerLevel:       1,
-	}
+		registry:             registry,
+		tracker:              tracker,
+		restDuplicateCtrl:    restDuplicateCtrl,
+		notificationOutbox:   notificationOutbox,
+		e2NodeAdmission:      e2NodeAdmission,
+		e2IfState:            e2IfState,
+		e2IfStateDb:          CreateXappRnibIfInstance(),
+		e2SubsDb:             CreateSdl(),
+		restSubsDb:           CreateRESTSdl(),
+		restDuplicateDb:      CreateRestDuplicateSdl(),
+		notificationOutboxDb: CreateNotificationOutboxSdl(),
+		Counters:             xapp.Metric.RegisterCounterGroup(GetMetricsOpts(), "SUBMGR"),
+		Gauges:               xapp.Metric.RegisterGaugeGroup(GetGaugeOpts(), "SUBMGR"),
+		LoggerLevel:          1,
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	e2IfState.Init(c)
+	restDuplicateCtrl.control = c
+	notificationOutbox.Init(c, c.sendNotification)
+	e2NodeAdmission.Init(c)
 	c.ReadConfigParameters("")
 
 	// Register REST handler for testing support
 	xapp.Resource.InjectRoute("/ric/v1/symptomdata", c.SymptomDataHandler, "GET")
 	xapp.Resource.InjectRoute("/ric/v1/test/{testId}", c.TestRestHandler, "POST")
+	xapp.Resource.InjectRoute("/ric/v1/test/{testId:.+}", c.TestRestHandler, "POST")
 	xapp.Resource.InjectRoute("/ric/v1/restsubscriptions", c.GetAllRestSubscriptions, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/subscriptions", c.RESTSubscriptionWithIdempotencyKeyHandler, "POST")
+	xapp.Resource.InjectRoute("/ric/v1/subscriptions", c.GetSubscriptions, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/subscriptions/{subscriptionId}/lease", c.RenewRESTSubscriptionLeaseHandler, "PUT")
+	xapp.Resource.InjectRoute("/ric/v1/subscriptions/validate", c.ValidateRESTSubscriptionRequestHandler, "POST")
+	xapp.Resource.InjectRoute("/ric/v1/subscriptions/{subscriptionId}/deletion", c.GetRESTSubscriptionDeletion, "GET")
 
 	xapp.Resource.InjectRoute("/ric/v1/get_all_e2nodes", c.GetAllE2Nodes, "GET")
 	xapp.Resource.InjectRoute("/ric/v1/get_e2node_rest_subscriptions/{ranName}", c.GetAllE2NodeRestSubscriptions, "GET")
@@ -169,6 +228,14 @@ func NewControl() *Control {
 	xapp.Resource.InjectRoute("/ric/v1/delete_all_e2node_subscriptions/{ranName}", c.DeleteAllE2nodeSubscriptions, "DELETE")
 	xapp.Resource.InjectRoute("/ric/v1/delete_all_xapp_subscriptions/{xappServiceName}", c.DeleteAllXappSubscriptions, "DELETE")
 
+	xapp.Resource.InjectRoute("/ric/v1/get_undelivered_notifications", c.GetUndeliveredNotifications, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/replay_undelivered_notification/{notificationId}", c.ReplayUndeliveredNotification, "POST")
+	xapp.Resource.InjectRoute("/ric/v1/replay_all_undelivered_notifications", c.ReplayAllUndeliveredNotifications, "POST")
+	xapp.Resource.InjectRoute("/ric/v1/get_subscription_quota_usage", c.GetSubscriptionQuotaUsage, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/get_e2node_queues", c.GetE2NodeQueues, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/get_pending_e2_cleanups", c.GetPendingE2Cleanups, "GET")
+	xapp.Resource.InjectRoute("/ric/v1/get_policy_history/{ranName}/{e2SubId}", c.GetPolicyHistory, "GET")
+
 	if readSubsFromDb == "true" {
 		// Read subscriptions from db
 		err := c.ReadE2Subscriptions()
@@ -179,6 +246,26 @@ func NewControl() *Control {
 		if err != nil {
 			xapp.Logger.Error("ReadRESTSubscriptions() failed %s", err.Error())
 		}
+		err = c.ReadRestDuplicateEntries()
+		if err != nil {
+			xapp.Logger.Error("ReadRestDuplicateEntries() failed %s", err.Error())
+		}
+		err = c.ReadUndeliveredNotifications()
+		if err != nil {
+			xapp.Logger.Error("ReadUndeliveredNotifications() failed %s", err.Error())
+		}
+	}
+	go restDuplicateCtrl.Run()
+	go notificationOutbox.Run()
+	go c.RunLeaseReaper()
+	go c.RunE2CleanupRetries()
+
+	// Subscriptions of undeployed xApps are deleted
+	c.lifecycleListener = NewXappLifecycleListener(xappLifecycleListenerType)
+	if c.lifecycleListener != nil {
+		if err := c.lifecycleListener.Start(c.HandleXappLifecycleEvent); err != nil {
+			xapp.Logger.Error("Starting xApp lifecycle listener failed: %s", err.Error())
+		}
 	}
 
 	go func() {
@@ -207,7 +294,13 @@ func (c *Control) RESTQueryHandler() (models.SubscriptionList, error) {
 
 	c.CntRecvMsg++
 
-	return c.registry.QueryHandler()
+	// xapp-frame does not pass query parameters of the request, so filter comes from config
+	filter := restQueryFilter.Load()
+	if filter == nil {
+		filter = &SubscriptionFilter{}
+	}
+	subscriptions, _, err := c.registry.QueryE2Subscriptions(filter)
+	return subscriptions, err
 }
 
 //-------------------------------------------------------------------
@@ -217,16 +310,28 @@ func (c *Control) ReadE2Subscriptions() error {
 	var err error
 	var subIds []uint32
 	var register map[uint32]*Subscription
+	var ranRegister map[e2SubsKey]*Subscription
+	var quarantine map[e2SubsKey]time.Time
+	var cleanups map[e2SubsKey]*E2CleanupInfo
 	for i := 0; dbRetryForever == "true" || i < dbTryCount; i++ {
 		xapp.Logger.Debug("Reading E2 subscriptions from db")
-		subIds, register, err = c.ReadAllSubscriptionsFromSdl()
+		subIds, register, ranRegister, err = c.ReadAllSubscriptionsFromSdl()
+		if err == nil {
+			quarantine, err = c.registry.ReadAllQuarantinesFromSdl()
+		}
+		if err == nil {
+			cleanups, err = c.registry.ReadAllE2CleanupsFromSdl()
+		}
 		if err != nil {
 			xapp.Logger.Error("%v", err)
 			<-time.After(1 * time.Second)
 		} else {
 			c.registry.subIds = subIds
-			c.registry.register = register
-			go c.HandleUncompletedSubscriptions(register)
+			c.registry.restoreRegister(register, ranRegister)
+			c.registry.restoreE2Cleanups(cleanups)
+			c.registry.restoreQuarantine(quarantine, time.Now())
+			c.registry.rebuildMergeIndex()
+			go c.HandleUncompletedSubscriptions(c.registry.getAllSubs())
 			return nil
 		}
 	}
@@ -266,6 +371,93 @@ func (c *Control) ReadRESTSubscriptions() error {
 	return err
 }
 
+//-------------------------------------------------------------------
+//
+//-------------------------------------------------------------------
+func (c *Control) ReadRestDuplicateEntries() error {
+
+	xapp.Logger.Debug("ReadRestDuplicateEntries()")
+	var err error
+	var entries map[string]RestDuplicateEntryInfo
+	for i := 0; dbRetryForever == "true" || i < dbTryCount; i++ {
+		xapp.Logger.Debug("Reading REST request md5sums from db")
+		entries, err = c.ReadAllRestDuplicateEntriesFromSdl()
+		if err != nil {
+			xapp.Logger.Error("%v", err)
+			<-time.After(1 * time.Second)
+		} else {
+			c.restDuplicateCtrl.Restore(entries)
+			c.reconcileIdempotencyKeys(time.Now())
+			return nil
+		}
+	}
+	xapp.Logger.Debug("Continuing without retring")
+	return err
+}
+
+//-------------------------------------------------------------------
+// Retention of idempotency key is stored with REST subscription. Keys
+// of duplicate detection are made to match REST subscriptions read
+// from db, and keys of expired retention are removed from both
+//-------------------------------------------------------------------
+func (c *Control) reconcileIdempotencyKeys(now time.Time) {
+
+	c.registry.mutex.Lock()
+	restSubscriptions := make(map[string]*RESTSubscription)
+	for restSubId, restSubscription := range c.registry.restSubscriptions {
+		if IsIdempotencyKey(restSubscription.lastReqMd5sum) {
+			restSubscriptions[restSubId] = restSubscription
+		}
+	}
+	c.registry.mutex.Unlock()
+
+	keys := make(map[string]RestDuplicateEntryInfo)
+	for restSubId, restSubscription := range restSubscriptions {
+		md5sum := restSubscription.lastReqMd5sum
+		expiry := restSubscription.idempotencyKeyExpiry
+		if expiry.IsZero() {
+			// Stored without retention, which is then taken from duplicate detection
+			expiry = c.restDuplicateCtrl.GetPreviousRequestExpiry(md5sum)
+		}
+		if expiry.IsZero() || now.After(expiry) {
+			xapp.Logger.Debug("Retention of idempotency key %s of restSubId %s expired", md5sum, restSubId)
+			restSubscription.lastReqMd5sum = ""
+			restSubscription.idempotencyKeyExpiry = time.Time{}
+			c.WriteRESTSubscriptionToDb(restSubId, restSubscription)
+			continue
+		}
+		if restSubscription.idempotencyKeyExpiry.IsZero() {
+			restSubscription.idempotencyKeyExpiry = expiry
+			c.WriteRESTSubscriptionToDb(restSubId, restSubscription)
+		}
+		keys[md5sum] = RestDuplicateEntryInfo{RestSubsId: restSubId, Expiry: expiry}
+	}
+	c.restDuplicateCtrl.ReconcileIdempotencyKeys(keys)
+}
+
+//-------------------------------------------------------------------
+//
+//-------------------------------------------------------------------
+func (c *Control) ReadUndeliveredNotifications() error {
+
+	xapp.Logger.Debug("ReadUndeliveredNotifications()")
+	var err error
+	var notifications map[string]*NotificationInfo
+	for i := 0; dbRetryForever == "true" || i < dbTryCount; i++ {
+		xapp.Logger.Debug("Reading undelivered notifications from db")
+		notifications, err = c.ReadAllNotificationsFromSdl()
+		if err != nil {
+			xapp.Logger.Error("%v", err)
+			<-time.After(1 * time.Second)
+		} else {
+			c.notificationOutbox.Restore(notifications)
+			return nil
+		}
+	}
+	xapp.Logger.Debug("Continuing without retring")
+	return err
+}
+
 //-------------------------------------------------------------------
 //
 //-------------------------------------------------------------------
@@ -292,12 +484,13 @@ func (c *Control) ReadConfigParameters(f string) {
 	}
 	xapp.Logger.Debug("e2tSubDelReqTime= %v", e2tSubDelReqTime)
 
-	e2tRecvMsgTimeout = viper.GetDuration("controls.e2tRecvMsgTimeout_ms") * 1000000
-	if e2tRecvMsgTimeout == 0 {
-		e2tRecvMsgTimeout = 2000 * 1000000
-		xapp.Logger.Debug("WARNING: Using hard coded default value for e2tRecvMsgTimeout")
+	rtmgrTimeout := viper.GetDuration("controls.rtmgrRequestTimeout_ms") * 1000000
+	if rtmgrTimeout == 0 {
+		rtmgrTimeout = 2000 * 1000000
+		xapp.Logger.Debug("WARNING: Using hard coded default value for rtmgrRequestTimeout")
 	}
-	xapp.Logger.Debug("e2tRecvMsgTimeout= %v", e2tRecvMsgTimeout)
+	rtmgrRequestTimeout.Store(int64(rtmgrTimeout))
+	xapp.Logger.Debug("rtmgrRequestTimeout= %v", rtmgrTimeout)
 
 	e2tMaxSubReqTryCount = viper.GetUint64("controls.e2tMaxSubReqTryCount")
 	if e2tMaxSubReqTryCount == 0 {
@@ -350,6 +543,184 @@ func (c *Control) ReadConfigParameters(f string) {
 	}
 	xapp.Logger.Debug("waitRouteCleanup= %v", waitRouteCleanup_ms)
 
+	// Tries of REST notification delivery to xApp before notification is moved to dead letter list
+	notificationMaxTryCount = viper.GetUint64("controls.notificationMaxTryCount")
+	if notificationMaxTryCount == 0 {
+		notificationMaxTryCount = 5
+		xapp.Logger.Debug("WARNING: Using hard coded default value for notificationMaxTryCount")
+	}
+	xapp.Logger.Debug("notificationMaxTryCount= %v", notificationMaxTryCount)
+
+	// Delay of the first notification retry. Delay is doubled after every failed try.
+	notificationRetryDelay = viper.GetDuration("controls.notificationRetryDelay_ms") * 1000000
+	if notificationRetryDelay == 0 {
+		notificationRetryDelay = 1000 * 1000000
+		xapp.Logger.Debug("WARNING: Using hard coded default value for notificationRetryDelay_ms")
+	}
+	xapp.Logger.Debug("notificationRetryDelay= %v", notificationRetryDelay)
+
+	notificationMaxRetryDelay = viper.GetDuration("controls.notificationMaxRetryDelay_ms") * 1000000
+	if notificationMaxRetryDelay == 0 {
+		notificationMaxRetryDelay = 60000 * 1000000
+		xapp.Logger.Debug("WARNING: Using hard coded default value for notificationMaxRetryDelay_ms")
+	}
+	xapp.Logger.Debug("notificationMaxRetryDelay= %v", notificationMaxRetryDelay)
+
+	// HMAC signing and mTLS of REST notifications. Notifications are sent over plain http if neither is configured.
+	notificationSecurity := &NotificationSecurityConfig{
+		HmacSecrets: viper.GetStringMapString("controls.notificationHmacSecrets"),
+		TlsCertFile: viper.GetString("controls.notificationTlsCertFile"),
+		TlsKeyFile:  viper.GetString("controls.notificationTlsKeyFile"),
+		TlsCaFile:   viper.GetString("controls.notificationTlsCaFile"),
+	}
+	notificationSender, err := NewNotificationSender(notificationSecurity)
+	if err != nil {
+		xapp.Logger.Error("NewNotificationSender() failed: %s. Previous notification security configuration is kept", err.Error())
+		if c.notificationSender.Load() == nil {
+			notificationSender, _ = NewNotificationSender(&NotificationSecurityConfig{})
+			c.notificationSender.Store(notificationSender)
+		}
+	} else {
+		c.notificationSender.Store(notificationSender)
+	}
+	// Filter of E2 subscription query in port 8088 in query parameter format, e.g. "state=active"
+	filter, err := ParseRestQueryFilter(viper.GetString("controls.restQueryFilter"))
+	if err != nil {
+		xapp.Logger.Error("Invalid restQueryFilter: %s. Subscription query is not filtered", err.Error())
+		filter = &SubscriptionFilter{}
+	}
+	restQueryFilter.Store(filter)
+	xapp.Logger.Debug("restQueryFilter= %+v", filter)
+
+	// Time how long idempotency key supplied by xApp refers to the REST subscription created with the key
+	idempotencyKeyRetention = viper.GetDuration("controls.idempotencyKeyRetention_s") * time.Second
+	if idempotencyKeyRetention == 0 {
+		idempotencyKeyRetention = 86400 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for idempotencyKeyRetention_s")
+	}
+	xapp.Logger.Debug("idempotencyKeyRetention= %v", idempotencyKeyRetention)
+
+	// Time how long md5sum of successfully processed REST Subscription Request is remembered for retransmission detection
+	restDuplicateTtl = viper.GetDuration("controls.restDuplicateTtl_s") * time.Second
+	if restDuplicateTtl == 0 {
+		restDuplicateTtl = 86400 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for restDuplicateTtl_s")
+	}
+	xapp.Logger.Debug("restDuplicateTtl= %v", restDuplicateTtl)
+
+	// Ongoing REST Subscription Request older than this is considered stale and does not block retransmissions anymore
+	restOngoingRequestTimeout = viper.GetDuration("controls.restOngoingRequestTimeout_s") * time.Second
+	if restOngoingRequestTimeout == 0 {
+		restOngoingRequestTimeout = 300 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for restOngoingRequestTimeout_s")
+	}
+	xapp.Logger.Debug("restOngoingRequestTimeout= %v", restOngoingRequestTimeout)
+
+	// Maximum processing time of RIC Subscription Request and Delete Request received from xApp via RMR
+	rmrRequestTimeout = viper.GetDuration("controls.rmrRequestTimeout_s") * time.Second
+	if rmrRequestTimeout == 0 {
+		rmrRequestTimeout = 60 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for rmrRequestTimeout_s")
+	}
+	xapp.Logger.Debug("rmrRequestTimeout= %v", rmrRequestTimeout)
+
+	// Interval of checking expired leases of REST subscriptions
+	subscriptionLeaseCheckInterval = viper.GetDuration("controls.subscriptionLeaseCheckInterval_s") * time.Second
+	if subscriptionLeaseCheckInterval == 0 {
+		subscriptionLeaseCheckInterval = 10 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for subscriptionLeaseCheckInterval_s")
+	}
+	xapp.Logger.Debug("subscriptionLeaseCheckInterval= %v", subscriptionLeaseCheckInterval)
+
+	// Source of xApp lifecycle events: "appmgr", "rest" or "" when disabled
+	xappLifecycleListenerType = viper.GetString("controls.xappLifecycleListener")
+	appMgrUrl = viper.GetString("controls.appmgrUrl")
+	if appMgrUrl == "" {
+		appMgrUrl = "http://service-ricplt-appmgr-http.ricplt:8080/ric/v1"
+		xapp.Logger.Debug("WARNING: Using hard coded default value for appmgrUrl")
+	}
+	xappLifecycleCallbackUrl = viper.GetString("controls.xappLifecycleCallbackUrl")
+	if xappLifecycleCallbackUrl == "" {
+		xappLifecycleCallbackUrl = "http://service-ricplt-submgr-http.ricplt:8080" + appMgrCallbackPath
+		xapp.Logger.Debug("WARNING: Using hard coded default value for xappLifecycleCallbackUrl")
+	}
+	xapp.Logger.Debug("xappLifecycleListener= %v, appmgrUrl= %v, xappLifecycleCallbackUrl= %v", xappLifecycleListenerType, appMgrUrl, xappLifecycleCallbackUrl)
+
+	xapp.Logger.Debug("notificationHmacSecrets configured for %v xApps, notificationTlsCertFile= %v", len(notificationSecurity.HmacSecrets), notificationSecurity.TlsCertFile)
+
+	// Maximum number of E2 subscriptions per xApp, E2 node and RAN function of E2 node. 0 is unlimited
+	subscriptionQuotas := ReadSubscriptionQuotaConfig()
+	setSubscriptionQuotas(subscriptionQuotas)
+	xapp.Logger.Debug("subscriptionQuotas= %+v", subscriptionQuotas)
+
+	// Start of instance id range allocated per RAN name for subscriptions without RMR route. 0 is the whole range
+	start := uint32(viper.GetInt("controls.perRanInstanceIdStart"))
+	if start == 1 || start > maxInstanceId {
+		xapp.Logger.Error("Invalid perRanInstanceIdStart %v. Whole range used for all subscriptions", viper.GetInt("controls.perRanInstanceIdStart"))
+		start = 0
+	}
+	perRanInstanceIdStart.Store(start)
+	xapp.Logger.Debug("perRanInstanceIdStart= %v", start)
+
+	// Quarantine time of instance ids of deleted E2 subscriptions. 0 is no quarantine
+	instanceIdQuarantineTime := viper.GetDuration("controls.instanceIdQuarantineTime_ms") * 1000000
+	if instanceIdQuarantineTime < 0 {
+		xapp.Logger.Error("Invalid instanceIdQuarantineTime_ms %v. Quarantine disabled", viper.GetInt("controls.instanceIdQuarantineTime_ms"))
+		instanceIdQuarantineTime = 0
+	}
+	setInstanceIdQuarantineTime(instanceIdQuarantineTime)
+	xapp.Logger.Debug("instanceIdQuarantineTime= %v", instanceIdQuarantineTime)
+
+	// Detection of conflicting POLICY and INSERT subscriptions and priorities of xApps
+	actionConflictConfig := ReadActionConflictConfig()
+	setActionConflictConfig(actionConflictConfig)
+	xapp.Logger.Debug("actionConflictConfig= %+v", actionConflictConfig)
+
+	// RIC Requestor ID sent to E2 nodes, per RIC instance and optionally per xApp
+	ricRequestorIdConfig := ReadRicRequestorIdConfig()
+	setRicRequestorIdConfig(ricRequestorIdConfig)
+	xapp.Logger.Debug("ricRequestorIdConfig= %+v", ricRequestorIdConfig)
+
+	// Merging of E2 subscriptions and default sharing of subscriptions per xApp
+	subscriptionSharingConfig := ReadSubscriptionSharingConfig()
+	setSubscriptionSharingConfig(subscriptionSharingConfig)
+	xapp.Logger.Debug("subscriptionSharingConfig= %+v", subscriptionSharingConfig)
+
+	// Pacing of E2 Subscription Requests per E2 node. 0 is unlimited
+	e2NodeAdmissionConfig := E2NodeAdmissionConfig{
+		MaxOutstanding: viper.GetInt("controls.e2NodeMaxOutstandingSubReqs"),
+		Rate:           viper.GetFloat64("controls.e2NodeSubReqRate"),
+		Burst:          viper.GetInt("controls.e2NodeSubReqBurst"),
+	}
+	setE2NodeAdmissionConfig(e2NodeAdmissionConfig)
+	xapp.Logger.Debug("e2NodeMaxOutstandingSubReqs= %v, e2NodeSubReqRate= %v, e2NodeSubReqBurst= %v",
+		e2NodeAdmissionConfig.MaxOutstanding, e2NodeAdmissionConfig.Rate, e2NodeAdmissionConfig.burst())
+
+	// Retry policies of E2 Subscription Requests failed by E2 node with given cause
+	e2RetryPolicies := ReadE2RetryPolicyConfig()
+	setE2RetryPolicies(e2RetryPolicies)
+	xapp.Logger.Debug("e2SubReqRetryPolicies= %+v", e2RetryPolicies)
+
+	// Background retries of RIC Subscription Delete Request after E2 node has rejected delete or not responded. 0 disables retries
+	viper.SetDefault("controls.e2SubDelCleanupMaxTryCount", 5)
+	e2CleanupMaxTryCount = viper.GetUint64("controls.e2SubDelCleanupMaxTryCount")
+	xapp.Logger.Debug("e2SubDelCleanupMaxTryCount= %v", e2CleanupMaxTryCount)
+
+	// Delay of the first background retry. Delay is doubled after every failed try.
+	e2CleanupRetryDelay = viper.GetDuration("controls.e2SubDelCleanupRetryDelay_s") * time.Second
+	if e2CleanupRetryDelay == 0 {
+		e2CleanupRetryDelay = 30 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for e2SubDelCleanupRetryDelay_s")
+	}
+	xapp.Logger.Debug("e2SubDelCleanupRetryDelay= %v", e2CleanupRetryDelay)
+
+	e2CleanupMaxRetryDelay = viper.GetDuration("controls.e2SubDelCleanupMaxRetryDelay_s") * time.Second
+	if e2CleanupMaxRetryDelay == 0 {
+		e2CleanupMaxRetryDelay = 600 * time.Second
+		xapp.Logger.Debug("WARNING: Using hard coded default value for e2SubDelCleanupMaxRetryDelay_s")
+	}
+	xapp.Logger.Debug("e2SubDelCleanupMaxRetryDelay= %v", e2CleanupMaxRetryDelay)
+
 	viper.SetDefault("controls.checkE2IEOrder", 1)
 	e2IEOrderCheckValue = uint8(viper.GetUint("controls.checkE2IEOrder"))
 	c.e2ap.SetE2IEOrderCheck(e2IEOrderCheckValue)
@@ -359,16 +730,23 @@ func (c *Control) ReadConfigParameters(f string) {
 //-------------------------------------------------------------------
 //
 //-------------------------------------------------------------------
-func (c *Control) HandleUncompletedSubscriptions(register map[uint32]*Subscription) {
+func (c *Control) HandleUncompletedSubscriptions(allSubs []*Subscription) {
 
-	xapp.Logger.Debug("HandleUncompletedSubscriptions. len(register) = %v", len(register))
-	for subId, subs := range register {
+	xapp.Logger.Debug("HandleUncompletedSubscriptions. len(allSubs) = %v", len(allSubs))
+	for _, subs := range allSubs {
+		subId := subs.ReqId.InstanceId
 		if subs.SubRespRcvd == false {
 			// If policy subscription has already been made successfully unsuccessful update should not be deleted.
 			if subs.PolicyUpdate == false {
 				subs.NoRespToXapp = true
 				xapp.Logger.Debug("SendSubscriptionDeleteReq. subId = %v", subId)
 				c.SendSubscriptionDeleteReq(subs, false)
+			} else if subs.Policy.AckedSubReqMsg != nil && subs.Policy.Version != subs.Policy.AckedVersion {
+				// Update was not acknowledged before restart. Acknowledged policy is restored
+				c.registry.rollbackPolicy(subs, subs.SubReqMsg, subs.Policy.Version, "", PolicyOutcomeRestart, time.Now())
+				if err := c.WriteSubscriptionToDb(subs); err != nil {
+					xapp.Logger.Error("%v", err)
+				}
 			}
 		}
 	}
@@ -380,8 +758,63 @@ func (c *Control) ReadyCB(data interface{}) {
 	}
 }
 
+//-------------------------------------------------------------------
+// Ongoing subscription processing is cancelled when submgr shuts down.
+// Cancelled REST subscription processing is given time to notify xApps
+//-------------------------------------------------------------------
+func (c *Control) Shutdown() {
+	xapp.Logger.Info("Shutdown: cancelling ongoing subscription processing")
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.registry == nil {
+		return
+	}
+	timer := time.NewTimer(shutdownWaitTime)
+	defer timer.Stop()
+	for _, done := range c.registry.GetRESTSubscriptionProcessingDone() {
+		select {
+		case <-done:
+		case <-timer.C:
+			xapp.Logger.Error("Shutdown: REST subscription processing not ended in %v", shutdownWaitTime)
+			return
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// SIGTERM shuts submgr down also when xApp framework does not call
+// the shutdown callback
+//-------------------------------------------------------------------
+func (c *Control) shutdownOnSignal(sigs <-chan os.Signal, exit func()) {
+	sig := <-sigs
+	xapp.Logger.Info("Shutdown: received signal %v", sig)
+	c.Shutdown()
+	exit()
+}
+
+//-------------------------------------------------------------------
+// Signal is raised again with default handling, so that the process
+// terminates as it would without submgr handling the signal
+//-------------------------------------------------------------------
+func reraiseSigterm() {
+	signal.Reset(syscall.SIGTERM)
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+}
+
+func (c *Control) rootContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
 func (c *Control) Run() {
 	xapp.SetReadyCB(c.ReadyCB, nil)
+	xapp.SetShutdownCB(c.Shutdown)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	go c.shutdownOnSignal(sigs, reraiseSigterm)
 	xapp.AddConfigChangeListener(c.ReadConfigParameters)
 	xapp.Run(c)
 }
@@ -445,12 +878,119 @@ func (c *Control) GetOrCreateRestSubscription(p *models.SubscriptionParams, md5s
 //
 //-------------------------------------------------------------------
 func (c *Control) RESTSubscriptionHandler(params interface{}) (*models.SubscriptionResponse, int) {
+	subResp, code, err := c.handleRESTSubscriptionRequest(params.(*models.SubscriptionParams), &RESTSubscriptionRequestExtensions{NotifyQuotaRejection: true})
+	if err != nil {
+		xapp.Logger.Error("RESTSubscriptionHandler() request rejected with status %v: %s", code, err.Error())
+	}
+	return subResp, code
+}
+
+//-------------------------------------------------------------------
+// REST Subscription Request with idempotency key. Key can be given in
+// Idempotency-Key header or in IdempotencyKey field of the request body.
+// Retry policies can be given in E2RetryPolicies field of
+// E2SubscriptionDirectives, lease in LeaseDuration_s field and request
+// for delete completion notifications in NotifyDeleteCompletion field.
+// Sharing of subscriptions can be given in Sharing field of
+// E2SubscriptionDirectives.
+//-------------------------------------------------------------------
+func (c *Control) RESTSubscriptionWithIdempotencyKeyHandler(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("RESTSubscriptionWithIdempotencyKeyHandler() called")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() reading body failed: %s", err.Error())
+		w.WriteHeader(common.SubscribeBadRequestCode)
+		return
+	}
+	p := &models.SubscriptionParams{}
+	extensionFields := struct {
+		IdempotencyKey           string
+		LeaseDuration_s          int64
+		NotifyDeleteCompletion   bool
+		E2SubscriptionDirectives *struct {
+			E2RetryPolicies []E2RetryPolicy
+			Sharing         string
+		}
+	}{}
+	if err := json.Unmarshal(body, p); err != nil {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() json.Unmarshal error: %s", err.Error())
+		w.WriteHeader(common.SubscribeBadRequestCode)
+		return
+	}
+	if err := json.Unmarshal(body, &extensionFields); err != nil {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() json.Unmarshal error: %s", err.Error())
+		w.WriteHeader(common.SubscribeBadRequestCode)
+		return
+	}
+	if err := p.Validate(strfmt.Default); err != nil {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() invalid request: %s", err.Error())
+		w.WriteHeader(common.SubscribeBadRequestCode)
+		return
+	}
+
+	if extensionFields.LeaseDuration_s < 0 {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() invalid LeaseDuration_s %v", extensionFields.LeaseDuration_s)
+		w.WriteHeader(common.SubscribeBadRequestCode)
+		return
+	}
+
+	extensions := &RESTSubscriptionRequestExtensions{}
+	extensions.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if extensions.IdempotencyKey == "" {
+		extensions.IdempotencyKey = extensionFields.IdempotencyKey
+	}
+	extensions.LeaseDuration = time.Duration(extensionFields.LeaseDuration_s) * time.Second
+	extensions.NotifyDeleteCompletion = extensionFields.NotifyDeleteCompletion
+	if extensionFields.E2SubscriptionDirectives != nil && extensionFields.E2SubscriptionDirectives.E2RetryPolicies != nil {
+		extensions.E2RetryPolicies = ValidateE2RetryPolicies(extensionFields.E2SubscriptionDirectives.E2RetryPolicies, "E2SubscriptionDirectives")
+	}
+	if extensionFields.E2SubscriptionDirectives != nil {
+		if extensions.Sharing, err = ParseSubscriptionSharing(extensionFields.E2SubscriptionDirectives.Sharing); err != nil {
+			xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() %s", err.Error())
+			http.Error(w, err.Error(), common.SubscribeBadRequestCode)
+			return
+		}
+	}
+
+	subResp, code, err := c.handleRESTSubscriptionRequest(p, extensions)
+	if subResp == nil {
+		if err != nil {
+			http.Error(w, err.Error(), code)
+		} else {
+			w.WriteHeader(code)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(subResp); err != nil {
+		xapp.Logger.Error("RESTSubscriptionWithIdempotencyKeyHandler() w.Write failure: %s", err.Error())
+	}
+}
+
+//-------------------------------------------------------------------
+// Fields of REST Subscription Request which are not part of xapp-frame
+// SubscriptionParams. Supported only via port 8080.
+//-------------------------------------------------------------------
+type RESTSubscriptionRequestExtensions struct {
+	IdempotencyKey         string
+	LeaseDuration          time.Duration // 0 means no lease
+	E2RetryPolicies        []E2RetryPolicy
+	NotifyDeleteCompletion bool
+	Sharing                SubscriptionSharing
+	NotifyQuotaRejection   bool // Exceeded quota is reported in failure notifications as response cannot carry the cause
+}
+
+//-------------------------------------------------------------------
+// Returned error tells cause of rejection when it is given to xApp
+//-------------------------------------------------------------------
+func (c *Control) handleRESTSubscriptionRequest(p *models.SubscriptionParams, extensions *RESTSubscriptionRequestExtensions) (*models.SubscriptionResponse, int, error) {
 
 	c.CntRecvMsg++
 	c.UpdateCounter(cRestSubReqFromXapp)
 
 	subResp := models.SubscriptionResponse{}
-	p := params.(*models.SubscriptionParams)
 
 	if c.LoggerLevel > 2 {
 		c.PrintRESTSubscriptionRequest(p)
@@ -463,65 +1003,131 @@ func (c *Control) RESTSubscriptionHandler(params interface{}) (*models.Subscript
 			xapp.Logger.Error("E2 Node for ranName %v UNDER RESET", *p.Meid)
 		}
 		c.UpdateCounter(cRestReqRejDueE2Down)
-		return nil, common.SubscribeServiceUnavailableCode
+		return nil, common.SubscribeServiceUnavailableCode, nil
 	}
 
 	if p.ClientEndpoint == nil {
 		err := fmt.Errorf("ClientEndpoint == nil")
 		xapp.Logger.Error("%v", err)
 		c.UpdateCounter(cRestSubFailToXapp)
-		return nil, common.SubscribeBadRequestCode
+		return nil, common.SubscribeBadRequestCode, nil
 	}
 
 	e2SubscriptionDirectives, err := c.GetE2SubscriptionDirectives(p)
 	if err != nil {
 		xapp.Logger.Error("%s", err)
 		c.UpdateCounter(cRestSubFailToXapp)
-		return nil, common.SubscribeBadRequestCode
+		return nil, common.SubscribeBadRequestCode, nil
 	}
+	e2SubscriptionDirectives.E2RetryPolicies = extensions.E2RetryPolicies
+	e2SubscriptionDirectives.Sharing = extensions.Sharing
 	_, xAppRmrEndpoint, err := ConstructEndpointAddresses(*p.ClientEndpoint)
 	if err != nil {
 		xapp.Logger.Error("%s", err.Error())
 		c.UpdateCounter(cRestSubFailToXapp)
-		return nil, common.SubscribeBadRequestCode
+		return nil, common.SubscribeBadRequestCode, nil
 	}
 
-	md5sum, err := CalculateRequestMd5sum(params)
-	if err != nil {
-		xapp.Logger.Error("Failed to generate md5sum from incoming request - %s", err.Error())
+	// Idempotency key given by xApp is used instead of md5sum of the request to detect retransmissions.
+	// md5sum of the request is still needed to detect reuse of the key for a different request
+	var md5sum string
+	var payloadMd5sum string
+	if extensions.IdempotencyKey != "" {
+		md5sum, err = IdempotencyKeyToMd5sum(extensions.IdempotencyKey)
+		if err != nil {
+			xapp.Logger.Error("%s", err.Error())
+			c.UpdateCounter(cRestSubFailToXapp)
+			return nil, common.SubscribeBadRequestCode, nil
+		}
+		payloadMd5sum, err = CalculateRequestMd5sum(p)
+		if err != nil {
+			xapp.Logger.Error("Failed to generate md5sum from incoming request - %s", err.Error())
+		}
+		if err := c.restDuplicateCtrl.CheckIdempotencyKeyPayload(md5sum, payloadMd5sum); err != nil {
+			xapp.Logger.Error("%s", err.Error())
+			c.UpdateCounter(cRestSubFailToXapp)
+			return nil, idempotencyKeyConflictCode, err
+		}
+	} else {
+		md5sum, err = CalculateRequestMd5sum(p)
+		if err != nil {
+			xapp.Logger.Error("Failed to generate md5sum from incoming request - %s", err.Error())
+		}
 	}
 
 	restSubscription, restSubId, err := c.GetOrCreateRestSubscription(p, md5sum, xAppRmrEndpoint, p.ClientEndpoint.Host)
 	if err != nil {
 		xapp.Logger.Error("Subscription with id in REST request does not exist")
-		return nil, common.SubscribeNotFoundCode
+		return nil, common.SubscribeNotFoundCode, nil
 	}
 
 	subResp.SubscriptionID = &restSubId
 	subReqList := e2ap.SubscriptionRequestList{}
-	err = c.e2ap.FillSubscriptionReqMsgs(params, &subReqList, restSubscription)
+	err = c.e2ap.FillSubscriptionReqMsgs(p, &subReqList, restSubscription)
 	if err != nil {
 		xapp.Logger.Error("%s", err.Error())
 		c.restDuplicateCtrl.DeleteLastKnownRestSubsIdBasedOnMd5sum(md5sum)
 		c.registry.DeleteRESTSubscription(&restSubId)
 		c.UpdateCounter(cRestSubFailToXapp)
-		return nil, common.SubscribeBadRequestCode
+		return nil, common.SubscribeBadRequestCode, nil
 	}
 
-	duplicate := c.restDuplicateCtrl.IsDuplicateToOngoingTransaction(restSubId, md5sum)
+	duplicate, err := c.restDuplicateCtrl.IsDuplicateToOngoingTransactionWithPayload(restSubId, md5sum, payloadMd5sum)
+	if err != nil {
+		xapp.Logger.Error("%s", err.Error())
+		c.registry.DeleteRESTSubscription(&restSubId)
+		c.UpdateCounter(cRestSubFailToXapp)
+		return nil, idempotencyKeyConflictCode, err
+	}
 	if duplicate {
 		err := fmt.Errorf("Retransmission blocker direct ACK for request of restSubsId %s restSubId MD5sum %s as retransmission", restSubId, md5sum)
 		xapp.Logger.Debug("%s", err)
 		c.registry.DeleteRESTSubscription(&restSubId)
 		c.UpdateCounter(cRestSubRespToXapp)
-		return &subResp, common.SubscribeCreatedCode
+		return &subResp, common.SubscribeCreatedCode, nil
 	}
 
+	// Quotas are checked beforehand only for new REST subscriptions. They are enforced also when E2 subscriptions are allocated
+	if p.SubscriptionID == "" && len(restSubscription.InstanceIds) == 0 {
+		functionIds := make([]int64, 0, len(subReqList.E2APSubscriptionRequests))
+		for _, subReqMsg := range subReqList.E2APSubscriptionRequests {
+			functionIds = append(functionIds, int64(subReqMsg.FunctionId))
+		}
+		if err := c.registry.CheckSubscriptionQuotas(XappRmrServiceName(p.ClientEndpoint.Host), *p.Meid, functionIds); err != nil {
+			xapp.Logger.Error("%s", err.Error())
+			c.restDuplicateCtrl.TransactionComplete(md5sum)
+			c.UpdateCounter(cRestReqRejDueQuota)
+			if extensions.NotifyQuotaRejection {
+				c.WriteRESTSubscriptionToDb(restSubId, restSubscription)
+				go c.sendQuotaRejectionNotifications(restSubscription, &subReqList, p.ClientEndpoint, &restSubId, err)
+				return &subResp, common.SubscribeCreatedCode, nil
+			}
+			c.registry.DeleteRESTSubscription(&restSubId)
+			return nil, subscribeTooManyRequestsCode, err
+		}
+	}
+
+	if extensions.LeaseDuration > 0 {
+		if _, err := c.registry.SetRESTSubscriptionLease(restSubId, extensions.LeaseDuration, time.Now()); err != nil {
+			xapp.Logger.Error("%s", err.Error())
+		}
+	}
+
+	if extensions.NotifyDeleteCompletion {
+		restSubscription.deleteNotifyEndpoint = p.ClientEndpoint
+	}
+	restSubscription.clientEndpoint = p.ClientEndpoint
+
 	c.WriteRESTSubscriptionToDb(restSubId, restSubscription)
-	go c.processSubscriptionRequests(restSubscription, &subReqList, p.ClientEndpoint, p.Meid, &restSubId, xAppRmrEndpoint, md5sum, e2SubscriptionDirectives)
+	// Processing is cancelled when submgr shuts down or xApp is removed
+	ctx, processing := c.registry.StartRESTSubscriptionProcessing(restSubscription, c.rootContext())
+	go func() {
+		defer c.registry.EndRESTSubscriptionProcessing(restSubscription, processing)
+		c.processSubscriptionRequests(ctx, restSubscription, &subReqList, p.ClientEndpoint, p.Meid, &restSubId, xAppRmrEndpoint, md5sum, e2SubscriptionDirectives)
+	}()
 
 	c.UpdateCounter(cRestSubRespToXapp)
-	return &subResp, common.SubscribeCreatedCode
+	return &subResp, common.SubscribeCreatedCode, nil
 }
 
 //-------------------------------------------------------------------
@@ -563,7 +1169,7 @@ func (c *Control) GetE2SubscriptionDirectives(p *models.SubscriptionParams) (*E2
 //
 //-------------------------------------------------------------------
 
-func (c *Control) processSubscriptionRequests(restSubscription *RESTSubscription, subReqList *e2ap.SubscriptionRequestList,
+func (c *Control) processSubscriptionRequests(ctx context.Context, restSubscription *RESTSubscription, subReqList *e2ap.SubscriptionRequestList,
 	clientEndpoint *models.SubscriptionParamsClientEndpoint, meid *string, restSubId *string, xAppRmrEndpoint string, md5sum string, e2SubscriptionDirectives *E2SubscriptionDirectives) {
 
 	c.SubscriptionProcessingStartDelay()
@@ -579,18 +1185,19 @@ func (c *Control) processSubscriptionRequests(restSubscription *RESTSubscription
 		subReqMsg := subReqList.E2APSubscriptionRequests[index]
 		xAppEventInstanceID = (int64)(subReqMsg.RequestId.Id)
 
-		trans := c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(xAppRmrEndpoint), *restSubId, subReqMsg.RequestId, &xapp.RMRMeid{RanName: *meid})
+		trans := c.tracker.NewXappTransaction(ctx, xapp.NewRmrEndpoint(xAppRmrEndpoint), *restSubId, subReqMsg.RequestId, &xapp.RMRMeid{RanName: *meid})
 		if trans == nil {
 			// Send notification to xApp that prosessing of a Subscription Request has failed.
 			err := fmt.Errorf("Tracking failure")
 			errorInfo.ErrorCause = err.Error()
+			errorInfo.SetCode(ErrorCodeSubmgrTrackingFailure)
 			c.sendUnsuccesfullResponseNotification(restSubId, restSubscription, xAppEventInstanceID, err, clientEndpoint, trans, errorInfo)
 			continue
 		}
 
 		xapp.Logger.Debug("Handle SubscriptionRequest index=%v, %s", index, idstring(nil, trans))
 
-		subRespMsg, errorInfo, err := c.handleSubscriptionRequest(trans, &subReqMsg, meid, *restSubId, e2SubscriptionDirectives)
+		trans, subRespMsg, errorInfo, err := c.handleSubscriptionRequestWithRetryPolicy(ctx, trans, &subReqMsg, meid, *restSubId, e2SubscriptionDirectives)
 
 		xapp.Logger.Debug("Handled SubscriptionRequest index=%v, %s", index, idstring(nil, trans))
 		trans.Release()
@@ -611,6 +1218,22 @@ func (c *Control) processSubscriptionRequests(restSubscription *RESTSubscription
 	}
 }
 
+//-------------------------------------------------------------------
+// Quota rejection of a request which cannot be rejected with cause in
+// response is given to xApp in failure notification of each E2 request
+//-------------------------------------------------------------------
+func (c *Control) sendQuotaRejectionNotifications(restSubscription *RESTSubscription, subReqList *e2ap.SubscriptionRequestList,
+	clientEndpoint *models.SubscriptionParamsClientEndpoint, restSubId *string, err error) {
+
+	c.SubscriptionProcessingStartDelay()
+	for _, subReqMsg := range subReqList.E2APSubscriptionRequests {
+		errorInfo := &ErrorInfo{}
+		errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+		errorInfo.SetCode(ErrorCodeSubmgrQuotaExceeded)
+		c.sendUnsuccesfullResponseNotification(restSubId, restSubscription, int64(subReqMsg.RequestId.Id), err, clientEndpoint, nil, errorInfo)
+	}
+}
+
 //-------------------------------------------------------------------
 //
 //------------------------------------------------------------------
@@ -627,20 +1250,27 @@ func (c *Control) SubscriptionProcessingStartDelay() {
 //-------------------------------------------------------------------
 //
 //------------------------------------------------------------------
-func (c *Control) handleSubscriptionRequest(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, meid *string,
+func (c *Control) handleSubscriptionRequest(ctx context.Context, trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, meid *string,
 	restSubId string, e2SubscriptionDirectives *E2SubscriptionDirectives) (*e2ap.E2APSubscriptionResponse, *ErrorInfo, error) {
 
 	errorInfo := ErrorInfo{}
 
+	if ctx.Err() != nil {
+		err := requestCancelledError(ctx, &errorInfo)
+		xapp.Logger.Debug("XAPP-SubReq: %s", idstring(err, trans))
+		return nil, &errorInfo, err
+	}
+
 	err := c.tracker.Track(trans)
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubReq Tracking error: %s", idstring(err, trans))
 		errorInfo.ErrorCause = err.Error()
+		errorInfo.SetCode(ErrorCodeSubmgrTrackingFailure)
 		err = fmt.Errorf("Tracking failure")
 		return nil, &errorInfo, err
 	}
 
-	subs, errorInfo, err := c.registry.AssignToSubscription(trans, subReqMsg, c.ResetTestFlag, c, e2SubscriptionDirectives.CreateRMRRoute)
+	subs, errorInfo, err := c.registry.AssignToSubscription(ctx, trans, subReqMsg, c.ResetTestFlag, c, e2SubscriptionDirectives.CreateRMRRoute, e2SubscriptionDirectives.Sharing)
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubReq Assign error: %s", idstring(err, trans))
 		return nil, &errorInfo, err
@@ -649,10 +1279,12 @@ func (c *Control) handleSubscriptionRequest(trans *TransactionXapp, subReqMsg *e
 	//
 	// Wake subs request
 	//
-	subs.OngoingReqCount++
-	go c.handleSubscriptionCreate(subs, trans, e2SubscriptionDirectives, 0)
-	event, _ := trans.WaitEvent(0) //blocked wait as timeout is handled in subs side
-	subs.OngoingReqCount--
+	// Result is always waited for, also when the request is cancelled, as
+	// the subscription is removed in its event loop. E2 response is not
+	// waited for after all requests of the subscription have been cancelled
+	done, result := newResultWaiter()
+	c.postSubscriptionCreate(subs, trans, e2SubscriptionDirectives, 0, done)
+	event := <-result
 
 	err = nil
 	if event != nil {
@@ -663,14 +1295,17 @@ func (c *Control) handleSubscriptionRequest(trans *TransactionXapp, subReqMsg *e
 				errorInfo = c.e2ap.CheckActionNotAdmittedList(xapp.RIC_SUB_RESP, themsg.ActionNotAdmittedList, c)
 				return themsg, &errorInfo, nil
 			} else {
-				c.registry.RemoveFromSubscription(subs, trans, waitRouteCleanup_ms, c)
+				c.registry.RemoveFromSubscription(ctx, subs, trans, waitRouteCleanup_ms, c)
 				c.RemoveSubscriptionFromDb(subs)
 				err = fmt.Errorf("E2 interface down")
 				errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
+				errorInfo.SetCode(ErrorCodeE2InterfaceDown)
 			}
 		case *e2ap.E2APSubscriptionFailure:
-			err = fmt.Errorf("RICSubscriptionFailure. E2NodeCause: (Cause:%v, Value %v)", themsg.Cause.Content, themsg.Cause.Value)
+			err = &E2SubscriptionFailureError{Cause: themsg.Cause, PolicyUpdate: subs.PolicyUpdate}
 			errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
+			errorInfo.SetCode(ErrorCodeE2SubscriptionFailure)
+			errorInfo.SetE2Cause(themsg.Cause)
 		case *PackSubscriptionRequestErrortEvent:
 			err = fmt.Errorf("E2 RICSubscriptionRequest pack failure")
 			errorInfo = themsg.ErrorInfo
@@ -684,12 +1319,19 @@ func (c *Control) handleSubscriptionRequest(trans *TransactionXapp, subReqMsg *e
 		default:
 			err = fmt.Errorf("Unexpected E2 subscription response received")
 			errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
+			errorInfo.SetCode(ErrorCodeSubmgrUnexpectedE2Response)
 			break
 		}
+	} else if ctx.Err() != nil {
+		// Subscription has already been removed in its event loop
+		err = requestCancelledError(ctx, &errorInfo)
+		xapp.Logger.Debug("XAPP-SubReq: %s", idstring(err, trans, subs))
+		return nil, &errorInfo, err
 	} else {
 		// Timer expiry
 		err = fmt.Errorf("E2 RICSubscriptionResponse timeout")
 		errorInfo.SetInfo(err.Error(), "", models.SubscriptionInstanceTimeoutTypeE2Timeout)
+		errorInfo.SetCode(ErrorCodeE2SubscriptionTimeout)
 		if subs.PolicyUpdate == true {
 			return nil, &errorInfo, err
 		}
@@ -699,12 +1341,22 @@ func (c *Control) handleSubscriptionRequest(trans *TransactionXapp, subReqMsg *e
 	// If policy type subscription fails we cannot remove it only internally. Once subscription has been created
 	// successfully, it must be deleted on both sides.
 	if subs.PolicyUpdate == false {
-		c.registry.RemoveFromSubscription(subs, trans, waitRouteCleanup_ms, c)
+		c.registry.RemoveFromSubscription(ctx, subs, trans, waitRouteCleanup_ms, c)
 	}
 
 	return nil, &errorInfo, err
 }
 
+//-------------------------------------------------------------------
+// Error of subscription request whose processing has been cancelled
+//-------------------------------------------------------------------
+func requestCancelledError(ctx context.Context, errorInfo *ErrorInfo) error {
+	err := fmt.Errorf("Subscription request cancelled: %s", ctx.Err().Error())
+	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+	errorInfo.SetCode(ErrorCodeSubmgrRequestCancelled)
+	return err
+}
+
 //-------------------------------------------------------------------
 //
 //-------------------------------------------------------------------
@@ -717,32 +1369,23 @@ func (c *Control) sendUnsuccesfullResponseNotification(restSubId *string, restSu
 		// Submgr is default source of error
 		errorInfo.ErrorSource = models.SubscriptionInstanceErrorSourceSUBMGR
 	}
-	resp := &models.SubscriptionResponse{
-		SubscriptionID: restSubId,
-		SubscriptionInstances: []*models.SubscriptionInstance{
-			&models.SubscriptionInstance{E2EventInstanceID: &e2EventInstanceID,
-				ErrorCause:          errorInfo.ErrorCause,
-				ErrorSource:         errorInfo.ErrorSource,
-				TimeoutType:         errorInfo.TimeoutType,
-				XappEventInstanceID: &xAppEventInstanceID},
-		},
+	resp := &SubscriptionNotification{
+		SubscriptionID:        restSubId,
+		SubscriptionInstances: []*NotificationInstance{newNotificationInstance(e2EventInstanceID, xAppEventInstanceID, errorInfo)},
 	}
 	// Mark REST subscription request processed.
 	restSubscription.SetProcessed(err)
 	c.UpdateRESTSubscriptionInDB(*restSubId, restSubscription, false)
 	if trans != nil {
-		xapp.Logger.Debug("Sending unsuccessful REST notification: ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v, %s",
-			errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID, idstring(nil, trans))
+		xapp.Logger.Debug("Sending unsuccessful REST notification: ErrorCode:%s, ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v, %s",
+			errorInfo.ErrorCode, errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID, idstring(nil, trans))
 	} else {
-		xapp.Logger.Debug("Sending unsuccessful REST notification: ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v",
-			errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID)
+		xapp.Logger.Debug("Sending unsuccessful REST notification: ErrorCode:%s, ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v",
+			errorInfo.ErrorCode, errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID)
 	}
 
 	c.UpdateCounter(cRestSubFailNotifToXapp)
-	err = xapp.Subscription.Notify(resp, *clientEndpoint)
-	if err != nil {
-		xapp.Logger.Error("xapp.Subscription.Notify failed %s", err.Error())
-	}
+	c.notificationOutbox.Send(*restSubId, resp, *clientEndpoint)
 
 	// E2 is down. Delete completely processed request safely now
 	if c.e2IfState.IsE2ConnectionUp(&restSubscription.Meid) == false && restSubscription.SubReqOngoing == false {
@@ -758,29 +1401,20 @@ func (c *Control) sendSuccesfullResponseNotification(restSubId *string, restSubs
 	clientEndpoint *models.SubscriptionParamsClientEndpoint, trans *TransactionXapp, errorInfo *ErrorInfo) {
 
 	// Store successfully processed InstanceId for deletion
-	restSubscription.AddE2InstanceId((uint32)(e2EventInstanceID))
-	restSubscription.AddXappIdToE2Id(xAppEventInstanceID, e2EventInstanceID)
+	c.registry.AddRESTSubscriptionInstance(restSubscription, xAppEventInstanceID, e2EventInstanceID)
 
 	// Send notification to xApp that a Subscription Request has been processed.
-	resp := &models.SubscriptionResponse{
-		SubscriptionID: restSubId,
-		SubscriptionInstances: []*models.SubscriptionInstance{
-			&models.SubscriptionInstance{E2EventInstanceID: &e2EventInstanceID,
-				ErrorCause:          errorInfo.ErrorCause,
-				ErrorSource:         errorInfo.ErrorSource,
-				XappEventInstanceID: &xAppEventInstanceID},
-		},
+	resp := &SubscriptionNotification{
+		SubscriptionID:        restSubId,
+		SubscriptionInstances: []*NotificationInstance{newNotificationInstance(e2EventInstanceID, xAppEventInstanceID, errorInfo)},
 	}
 	// Mark REST subscription request processesd.
 	restSubscription.SetProcessed(nil)
 	c.UpdateRESTSubscriptionInDB(*restSubId, restSubscription, false)
-	xapp.Logger.Debug("Sending successful REST notification: ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v, %s",
-		errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID, idstring(nil, trans))
+	xapp.Logger.Debug("Sending successful REST notification: ErrorCode:%s, ErrorCause:%s, ErrorSource:%s, TimeoutType:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v, %s",
+		errorInfo.ErrorCode, errorInfo.ErrorCause, errorInfo.ErrorSource, errorInfo.TimeoutType, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID, idstring(nil, trans))
 	c.UpdateCounter(cRestSubNotifToXapp)
-	err := xapp.Subscription.Notify(resp, *clientEndpoint)
-	if err != nil {
-		xapp.Logger.Error("xapp.Subscription.Notify failed %s", err.Error())
-	}
+	c.notificationOutbox.Send(*restSubId, resp, *clientEndpoint)
 
 	// E2 is down. Delete completely processed request safely now
 	if c.e2IfState.IsE2ConnectionUp(&restSubscription.Meid) == false && restSubscription.SubReqOngoing == false {
@@ -789,6 +1423,13 @@ func (c *Control) sendSuccesfullResponseNotification(restSubId *string, restSubs
 	}
 }
 
+//-------------------------------------------------------------------
+//
+//-------------------------------------------------------------------
+func (c *Control) sendNotification(notification *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+	return c.notificationSender.Load().Notify(notification, clientEndpoint)
+}
+
 //-------------------------------------------------------------------
 //
 //-------------------------------------------------------------------
@@ -808,6 +1449,21 @@ func (c *Control) RESTSubscriptionDeleteHandler(restSubId string) int {
 			return common.UnsubscribeNoContentCode
 		} else {
 			if restSubscription.SubReqOngoing == true {
+				if done := c.registry.CancelRESTSubscriptionProcessing(restSubId); done != nil {
+					// Subscription can be deleted when cancelled processing has ended
+					xapp.Logger.Debug("Handling of the REST Subscription Request cancelled %s", restSubId)
+					go func() {
+						<-done
+						restSubscription, err := c.registry.GetRESTSubscription(restSubId, true)
+						if err != nil {
+							xapp.Logger.Error("%s", err.Error())
+							return
+						}
+						c.deleteRESTSubscription(restSubId, restSubscription)
+					}()
+					c.UpdateCounter(cRestSubDelRespToXapp)
+					return common.UnsubscribeNoContentCode
+				}
 				err := fmt.Errorf("Handling of the REST Subscription Request still ongoing %s", restSubId)
 				xapp.Logger.Error("%s", err.Error())
 				c.UpdateCounter(cRestSubDelFailToXapp)
@@ -820,43 +1476,68 @@ func (c *Control) RESTSubscriptionDeleteHandler(restSubId string) int {
 		}
 	}
 
+	c.deleteRESTSubscription(restSubId, restSubscription)
+
+	c.UpdateCounter(cRestSubDelRespToXapp)
+	return common.UnsubscribeNoContentCode
+}
+
+//-------------------------------------------------------------------
+// Deletes E2 subscriptions of REST subscription in background
+//-------------------------------------------------------------------
+func (c *Control) deleteRESTSubscription(restSubId string, restSubscription *RESTSubscription) {
+
 	xAppRmrEndPoint := restSubscription.xAppRmrEndPoint
+	deletions := c.registry.StartRESTSubscriptionDeletion(restSubId)
 	go func() {
-		xapp.Logger.Debug("Deleteting handler: processing instances = %v", restSubscription.InstanceIds)
-		for _, instanceId := range restSubscription.InstanceIds {
-			xAppEventInstanceID, err := c.SubscriptionDeleteHandler(&restSubId, &xAppRmrEndPoint, &restSubscription.Meid, instanceId, 0)
+		// Undelivered notifications are not needed anymore. Delete completion notifications are sent after this
+		c.notificationOutbox.DeleteRestSubscriptionNotifications(restSubId)
+		xapp.Logger.Debug("Deleteting handler: processing instances = %v", deletions)
+		for i := range deletions {
+			instanceId := deletions[i].E2EventInstanceID
+			c.registry.SetRESTSubscriptionDeletionState(restSubId, instanceId, &SubsDeleteOutcome{State: subsDeleteStateOngoing})
+			xAppEventInstanceID, outcome, err := c.SubscriptionDeleteHandler(c.rootContext(), &restSubId, &xAppRmrEndPoint, &restSubscription.Meid, instanceId, 0)
 
 			if err != nil {
 				xapp.Logger.Error("%s", err.Error())
 			}
+			if outcome != nil {
+				c.registry.SetRESTSubscriptionDeletionState(restSubId, instanceId, outcome)
+				if restSubscription.deleteNotifyEndpoint != nil {
+					c.sendDeleteCompletedNotification(restSubId, restSubscription.deleteNotifyEndpoint, &deletions[i], outcome)
+				}
+			}
 			xapp.Logger.Debug("Deleteting instanceId = %v", instanceId)
-			restSubscription.DeleteXappIdToE2Id(xAppEventInstanceID)
-			restSubscription.DeleteE2InstanceId(instanceId)
+			c.registry.DeleteRESTSubscriptionInstance(restSubscription, xAppEventInstanceID, instanceId)
 		}
 		c.restDuplicateCtrl.DeleteLastKnownRestSubsIdBasedOnMd5sum(restSubscription.lastReqMd5sum)
 		c.registry.DeleteRESTSubscription(&restSubId)
 		c.RemoveRESTSubscriptionFromDb(restSubId)
+		// Deletion state is kept until delete completion notifications have been delivered
+		c.registry.CompleteRESTSubscriptionDeletion(restSubId)
+		c.releaseRESTSubscriptionDeletion(restSubId)
 	}()
-
-	c.UpdateCounter(cRestSubDelRespToXapp)
-	return common.UnsubscribeNoContentCode
 }
 
 //-------------------------------------------------------------------
 //
 //-------------------------------------------------------------------
-func (c *Control) SubscriptionDeleteHandler(restSubId *string, endPoint *string, meid *string, instanceId uint32, waitRouteCleanupTime time.Duration) (int64, error) {
+func (c *Control) SubscriptionDeleteHandler(ctx context.Context, restSubId *string, endPoint *string, meid *string, instanceId uint32, waitRouteCleanupTime time.Duration) (int64, *SubsDeleteOutcome, error) {
 
 	var xAppEventInstanceID int64
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{instanceId})
+	var ranName string
+	if meid != nil {
+		ranName = *meid
+	}
+	subs, err := c.registry.GetE2NodeSubscription(ranName, instanceId)
 	if err != nil {
 		xapp.Logger.Debug("Subscription Delete Handler subscription for restSubId=%v, E2EventInstanceID=%v not found %s",
 			restSubId, instanceId, idstring(err, nil))
-		return xAppEventInstanceID, nil
+		return xAppEventInstanceID, &SubsDeleteOutcome{State: subsDeleteStateDeleted}, nil
 	}
 
 	xAppEventInstanceID = int64(subs.ReqId.Id)
-	trans := c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(*endPoint), *restSubId, e2ap.RequestId{subs.ReqId.Id, 0}, &xapp.RMRMeid{RanName: *meid})
+	trans := c.tracker.NewXappTransaction(ctx, xapp.NewRmrEndpoint(*endPoint), *restSubId, e2ap.RequestId{subs.ReqId.Id, 0}, &xapp.RMRMeid{RanName: *meid})
 	if trans == nil {
 		err := fmt.Errorf("XAPP-SubDelReq transaction not created. restSubId %s, endPoint %s, meid %s, instanceId %v", *restSubId, *endPoint, *meid, instanceId)
 		xapp.Logger.Error("%s", err.Error())
@@ -867,21 +1548,21 @@ func (c *Control) SubscriptionDeleteHandler(restSubId *string, endPoint *string,
 	if err != nil {
 		err := fmt.Errorf("XAPP-SubDelReq %s:", idstring(err, trans))
 		xapp.Logger.Error("%s", err.Error())
-		return xAppEventInstanceID, &time.ParseError{}
+		return xAppEventInstanceID, nil, &time.ParseError{}
 	}
 	//
 	// Wake subs delete
 	//
-	subs.OngoingDelCount++
-	go c.handleSubscriptionDelete(subs, trans, waitRouteCleanupTime)
-	trans.WaitEvent(0) //blocked wait as timeout is handled in subs side
-	subs.OngoingDelCount--
+	done, result := newResultWaiter()
+	c.postSubscriptionDelete(ctx, subs, trans, waitRouteCleanupTime, true, done)
+	event := <-result
 
 	xapp.Logger.Debug("XAPP-SubDelReq: Handling event %s ", idstring(nil, trans, subs))
 
-	c.registry.RemoveFromSubscription(subs, trans, waitRouteCleanup_ms, c)
+	c.registry.RemoveFromSubscription(ctx, subs, trans, waitRouteCleanup_ms, c)
 
-	return xAppEventInstanceID, nil
+	outcome, _ := event.(*SubsDeleteOutcome)
+	return xAppEventInstanceID, outcome, nil
 }
 
 //-------------------------------------------------------------------
@@ -945,21 +1626,24 @@ func (c *Control) Consume(msg *xapp.RMRParams) (err error) {
 	msg.Payload = cPay
 	msg.PayloadLen = len(cPay)
 
+	// Requests are handled in event loops of subscriptions. Only assignment of
+	// xApp request to subscription is done in own goroutine, as it may wait for
+	// routing manager or deletion of pre-empted subscriptions.
 	switch msg.Mtype {
 	case xapp.RIC_SUB_REQ:
 		go c.handleXAPPSubscriptionRequest(msg)
 	case xapp.RIC_SUB_RESP:
-		go c.handleE2TSubscriptionResponse(msg)
+		c.handleE2TSubscriptionResponse(msg)
 	case xapp.RIC_SUB_FAILURE:
-		go c.handleE2TSubscriptionFailure(msg)
+		c.handleE2TSubscriptionFailure(msg)
 	case xapp.RIC_SUB_DEL_REQ:
-		go c.handleXAPPSubscriptionDeleteRequest(msg)
+		c.handleXAPPSubscriptionDeleteRequest(msg)
 	case xapp.RIC_SUB_DEL_RESP:
-		go c.handleE2TSubscriptionDeleteResponse(msg)
+		c.handleE2TSubscriptionDeleteResponse(msg)
 	case xapp.RIC_SUB_DEL_FAILURE:
-		go c.handleE2TSubscriptionDeleteFailure(msg)
+		c.handleE2TSubscriptionDeleteFailure(msg)
 	case xapp.RIC_SUB_DEL_REQUIRED:
-		go c.handleE2TSubscriptionDeleteRequired(msg)
+		c.handleE2TSubscriptionDeleteRequired(msg)
 	default:
 		xapp.Logger.Debug("Unknown Message Type '%d', discarding", msg.Mtype)
 	}
@@ -984,40 +1668,59 @@ func (c *Control) handleXAPPSubscriptionRequest(params *xapp.RMRParams) {
 		return
 	}
 
-	trans := c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg.RequestId, params.Meid)
+	ctx, cancel := c.rmrRequestContext()
+	trans := c.tracker.NewXappTransaction(ctx, xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg.RequestId, params.Meid)
 	if trans == nil {
 		xapp.Logger.Error("XAPP-SubReq: %s", idstring(fmt.Errorf("transaction not created"), params))
+		cancel()
 		return
 	}
-	defer trans.Release()
 
 	if err = c.tracker.Track(trans); err != nil {
 		xapp.Logger.Error("XAPP-SubReq: %s", idstring(err, trans))
+		trans.Release()
+		cancel()
 		return
 	}
 
-	subs, _, err := c.registry.AssignToSubscription(trans, subReqMsg, c.ResetTestFlag, c, true)
+	subs, _, err := c.registry.AssignToSubscription(ctx, trans, subReqMsg, c.ResetTestFlag, c, true, SubscriptionSharingDefault)
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubReq: %s", idstring(err, trans))
+		trans.Release()
+		cancel()
 		return
 	}
 
-	c.wakeSubscriptionRequest(subs, trans)
+	c.wakeSubscriptionRequest(subs, trans, cancel)
 }
 
 //-------------------------------------------------------------------
-// Wake Subscription Request to E2node
+// Wake Subscription Request to E2node. Response is sent to xApp and
+// transaction released in the event loop of the subscription.
 //------------------------------------------------------------------
-func (c *Control) wakeSubscriptionRequest(subs *Subscription, trans *TransactionXapp) {
+func (c *Control) wakeSubscriptionRequest(subs *Subscription, trans *TransactionXapp, cancel context.CancelFunc) {
 
 	e2SubscriptionDirectives, err := c.GetE2SubscriptionDirectives(nil)
 	if err != nil {
 		xapp.Logger.Error("c.GetE2SubscriptionDirectives failure: %s", err.Error())
 	}
-	subs.OngoingReqCount++
-	go c.handleSubscriptionCreate(subs, trans, e2SubscriptionDirectives, waitRouteCleanup_ms)
-	event, _ := trans.WaitEvent(0) //blocked wait as timeout is handled in subs side
-	subs.OngoingReqCount--
+	c.postSubscriptionCreate(subs, trans, e2SubscriptionDirectives, waitRouteCleanup_ms, func(event interface{}) {
+		c.sendSubscriptionResultToXapp(subs, trans, event)
+		trans.Release()
+		cancel()
+	})
+}
+
+//-------------------------------------------------------------------
+// Requests received from xApp via RMR have no caller to cancel them,
+// so their processing ends at the latest in rmrRequestTimeout
+//-------------------------------------------------------------------
+func (c *Control) rmrRequestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.rootContext(), rmrRequestTimeout)
+}
+
+func (c *Control) sendSubscriptionResultToXapp(subs *Subscription, trans *TransactionXapp, event interface{}) {
+	var err error
 	if event != nil {
 		switch themsg := event.(type) {
 		case *e2ap.E2APSubscriptionResponse:
@@ -1064,33 +1767,54 @@ func (c *Control) handleXAPPSubscriptionDeleteRequest(params *xapp.RMRParams) {
 		return
 	}
 
-	trans := c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subDelReqMsg.RequestId, params.Meid)
+	ctx, cancel := c.rmrRequestContext()
+	trans := c.tracker.NewXappTransaction(ctx, xapp.NewRmrEndpoint(params.Src), params.Xid, subDelReqMsg.RequestId, params.Meid)
 	if trans == nil {
 		xapp.Logger.Error("XAPP-SubDelReq: %s", idstring(fmt.Errorf("transaction not created"), params))
+		cancel()
 		return
 	}
-	defer trans.Release()
 
 	err = c.tracker.Track(trans)
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubReq: %s", idstring(err, trans))
+		trans.Release()
+		cancel()
 		return
 	}
 
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{trans.GetSubId()})
+	subs, err := c.registry.GetE2NodeSubscription(ranNameOf(trans.GetMeid()), trans.GetSubId())
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubDelReq: %s", idstring(err, trans))
+		trans.Release()
+		cancel()
 		return
 	}
 
 	//
-	// Wake subs delete
+	// Wake subs delete. Response is sent to xApp in the event loop of the subscription.
+	// RMR receiver does not wait for room in the mailbox, delete is failed instead.
 	//
-	subs.OngoingDelCount++
-	go c.handleSubscriptionDelete(subs, trans, waitRouteCleanup_ms)
-	trans.WaitEvent(0) //blocked wait as timeout is handled in subs side
-	subs.OngoingDelCount--
+	posted := c.postSubscriptionDelete(ctx, subs, trans, waitRouteCleanup_ms, false, func(event interface{}) {
+		c.sendSubscriptionDeleteResultToXapp(subs, trans, event)
+		trans.Release()
+		cancel()
+	})
+	if posted == false {
+		xapp.Logger.Error("XAPP-SubDelReq: Mailbox of subscription full %s", idstring(nil, trans, subs))
+		c.UpdateCounter(cSubDelRejDueFullMbox)
+		outcome := &SubsDeleteOutcome{
+			State:   subsDeleteStateFailed,
+			E2Cause: e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_system_not_ready},
+		}
+		c.sendSubscriptionDeleteResultToXapp(subs, trans, outcome)
+		trans.Release()
+		cancel()
+	}
+}
 
+func (c *Control) sendSubscriptionDeleteResultToXapp(subs *Subscription, trans *TransactionXapp, event interface{}) {
+	var err error
 	xapp.Logger.Debug("XAPP-SubDelReq: Handling event %s ", idstring(nil, trans, subs))
 
 	if subs.NoRespToXapp == true {
@@ -1099,7 +1823,24 @@ func (c *Control) handleXAPPSubscriptionDeleteRequest(params *xapp.RMRParams) {
 		return
 	}
 
-	// Whatever is received success, fail or timeout, send successful delete response
+	if outcome, ok := event.(*SubsDeleteOutcome); ok && outcome.State != subsDeleteStateDeleted {
+		// E2 node rejected delete or did not respond. Delete is retried in background
+		subDelFailMsg := &e2ap.E2APSubscriptionDeleteFailure{}
+		subDelFailMsg.RequestId.Id = trans.RequestId.Id
+		subDelFailMsg.RequestId.InstanceId = subs.GetReqId().RequestId.InstanceId
+		subDelFailMsg.FunctionId = subs.SubReqMsg.FunctionId
+		subDelFailMsg.Cause = outcome.E2Cause
+		trans.Mtype, trans.Payload, err = c.e2ap.PackSubscriptionDeleteFailure(subDelFailMsg)
+		if err == nil {
+			c.UpdateCounter(cSubDelFailToXapp)
+			err := c.rmrSendToXapp("", subs, trans)
+			if err != nil {
+				xapp.Logger.Error("rmrSendToXapp() failed:%s", err.Error())
+			}
+		}
+		return
+	}
+
 	subDelRespMsg := &e2ap.E2APSubscriptionDeleteResponse{}
 	subDelRespMsg.RequestId.Id = trans.RequestId.Id
 	subDelRespMsg.RequestId.InstanceId = subs.GetReqId().RequestId.InstanceId
@@ -1117,24 +1858,39 @@ func (c *Control) handleXAPPSubscriptionDeleteRequest(params *xapp.RMRParams) {
 //-------------------------------------------------------------------
 // SUBS CREATE Handling
 //-------------------------------------------------------------------
-func (c *Control) handleSubscriptionCreate(subs *Subscription, parentTrans *TransactionXapp, e2SubscriptionDirectives *E2SubscriptionDirectives, waitRouteCleanupTime time.Duration) {
+func (c *Control) handleSubscriptionCreate(ctx context.Context, subs *Subscription, parentTrans *TransactionXapp, e2SubscriptionDirectives *E2SubscriptionDirectives, waitRouteCleanupTime time.Duration) interface{} {
 
 	var event interface{} = nil
 	var removeSubscriptionFromDb bool = false
-	trans := c.tracker.NewSubsTransaction(subs)
-	subs.WaitTransactionTurn(trans)
-	defer subs.ReleaseTransactionTurn(trans)
+	// Subscription may be shared by requests of other xApps, so ctx is cancelled
+	// only when all of them have been cancelled
+	trans := c.tracker.NewSubsTransaction(ctx, subs)
+	subs.startTransaction(trans)
+	defer subs.endTransaction(trans)
 	defer trans.Release()
 
 	xapp.Logger.Debug("SUBS-SubReq: Handling %s ", idstring(nil, trans, subs, parentTrans))
 
+	// Policy request being sent. It is restored to the acknowledged one if update fails
+	subs.mutex.Lock()
+	subReqMsg := subs.SubReqMsg
+	policyVersion := subs.Policy.Version
+	subs.mutex.Unlock()
+	xappEndpoint := ""
+	if endpoint := parentTrans.GetEndpoint(); endpoint != nil {
+		xappEndpoint = endpoint.String()
+	}
+
 	subRfMsg, valid := subs.GetCachedResponse()
 	if subRfMsg == nil && valid == true {
-		event = c.sendE2TSubscriptionRequest(subs, trans, parentTrans, e2SubscriptionDirectives)
+		event = c.sendE2TSubscriptionRequest(ctx, subs, trans, parentTrans, e2SubscriptionDirectives)
 		switch event.(type) {
 		case *e2ap.E2APSubscriptionResponse:
 			subRfMsg, valid = subs.SetCachedResponse(event, true)
 			subs.SubRespRcvd = true
+			if isPolicySubsReq(subReqMsg) {
+				c.registry.policyAcknowledged(subs, subReqMsg, policyVersion, xappEndpoint, time.Now())
+			}
 		case *e2ap.E2APSubscriptionFailure:
 			if subs.PolicyUpdate == false {
 				subRfMsg, valid = subs.SetCachedResponse(event, false)
@@ -1142,24 +1898,32 @@ func (c *Control) handleSubscriptionCreate(subs *Subscription, parentTrans *Tran
 				// In policy update case where subscription has already been created successfully in Gnb
 				// we cannot delete subscription internally in submgr
 				subRfMsg, valid = subs.SetCachedResponse(event, true)
+				c.registry.rollbackPolicy(subs, subReqMsg, policyVersion, xappEndpoint, PolicyOutcomeFailed, time.Now())
 			}
 			xapp.Logger.Debug("SUBS-SubReq: internal delete due failure event(%s) %s", typeofSubsMessage(event), idstring(nil, trans, subs, parentTrans))
 		case *SubmgrRestartTestEvent:
 			// This is used to simulate that no response has been received and after restart, subscriptions are restored from db
 			xapp.Logger.Debug("Test restart flag is active. Dropping this transaction to test restart case")
 			subRfMsg, valid = subs.SetCachedResponse(event, false)
-			parentTrans.SendEvent(subRfMsg, 0)
-			return
+			return subRfMsg
 		case *PackSubscriptionRequestErrortEvent, *SDLWriteErrortEvent:
 			subRfMsg, valid = subs.SetCachedResponse(event, false)
+		case *AdmissionCancelledEvent:
+			// Request was not sent to E2 node
+			subRfMsg, valid = subs.SetCachedResponse(nil, subs.PolicyUpdate)
+			if subs.PolicyUpdate == true {
+				c.registry.rollbackPolicy(subs, subReqMsg, policyVersion, xappEndpoint, PolicyOutcomeCancelled, time.Now())
+			}
 		default:
 			// Timer expiry
 			if subs.PolicyUpdate == false {
 				xapp.Logger.Debug("SUBS-SubReq: internal delete due default event(%s) %s", typeofSubsMessage(event), idstring(nil, trans, subs, parentTrans))
 				subRfMsg, valid = subs.SetCachedResponse(nil, false)
-				c.sendE2TSubscriptionDeleteRequest(subs, trans, parentTrans)
+				// Subscription may have been created in E2 node also when request was cancelled
+				c.sendE2TSubscriptionDeleteRequest(context.WithoutCancel(ctx), subs, trans, parentTrans)
 			} else {
 				subRfMsg, valid = subs.SetCachedResponse(nil, true)
+				c.registry.rollbackPolicy(subs, subReqMsg, policyVersion, xappEndpoint, PolicyOutcomeTimeout, time.Now())
 			}
 		}
 		xapp.Logger.Debug("SUBS-SubReq: Handling (e2t response %s) %s", typeofSubsMessage(subRfMsg), idstring(nil, trans, subs, parentTrans))
@@ -1176,58 +1940,88 @@ func (c *Control) handleSubscriptionCreate(subs *Subscription, parentTrans *Tran
 	err := c.UpdateSubscriptionInDB(subs, removeSubscriptionFromDb)
 	if err != nil {
 		valid = false
-		c.sendE2TSubscriptionDeleteRequest(subs, trans, parentTrans)
+		c.sendE2TSubscriptionDeleteRequest(context.WithoutCancel(ctx), subs, trans, parentTrans)
 
 	}
 
 	// Now RemoveFromSubscription in here to avoid race conditions (mostly concerns delete)
 	if valid == false {
-		c.registry.RemoveFromSubscription(subs, parentTrans, waitRouteCleanupTime, c)
+		c.registry.RemoveFromSubscription(ctx, subs, parentTrans, waitRouteCleanupTime, c)
 	}
-
-	parentTrans.SendEvent(subRfMsg, 0)
+	return subRfMsg
 }
 
 //-------------------------------------------------------------------
 // SUBS DELETE Handling
 //-------------------------------------------------------------------
 
-func (c *Control) handleSubscriptionDelete(subs *Subscription, parentTrans *TransactionXapp, waitRouteCleanupTime time.Duration) {
+func (c *Control) handleSubscriptionDelete(ctx context.Context, subs *Subscription, parentTrans *TransactionXapp, waitRouteCleanupTime time.Duration) *SubsDeleteOutcome {
 
-	trans := c.tracker.NewSubsTransaction(subs)
-	subs.WaitTransactionTurn(trans)
-	defer subs.ReleaseTransactionTurn(trans)
+	trans := c.tracker.NewSubsTransaction(ctx, subs)
+	subs.startTransaction(trans)
+	defer subs.endTransaction(trans)
 	defer trans.Release()
 
 	xapp.Logger.Debug("SUBS-SubDelReq: Handling %s", idstring(nil, trans, subs, parentTrans))
 
 	subs.mutex.Lock()
 
+	var event interface{}
+	e2DeleteSent := false
 	if subs.valid && subs.EpList.HasEndpoint(parentTrans.GetEndpoint()) && subs.EpList.Size() == 1 {
 		subs.valid = false
 		subs.mutex.Unlock()
-		c.sendE2TSubscriptionDeleteRequest(subs, trans, parentTrans)
+		event = c.sendE2TSubscriptionDeleteRequest(ctx, subs, trans, parentTrans)
+		e2DeleteSent = true
 	} else {
 		subs.mutex.Unlock()
 	}
 
+	outcome := subsDeleteOutcome(e2DeleteSent, event)
+	if subDelFailMsg, ok := event.(*e2ap.E2APSubscriptionDeleteFailure); ok && isE2SubscriptionUnknown(subDelFailMsg) {
+		// Subscription does not exist in E2 node
+		outcome = &SubsDeleteOutcome{State: subsDeleteStateDeleted}
+	}
+	if outcome.State != subsDeleteStateDeleted {
+		// Subscription may still exist in E2 node. Delete is retried in background
+		c.registry.AddE2Cleanup(subs, outcome, time.Now())
+	}
+
 	// Now RemoveFromSubscription in here to avoid race conditions (mostly concerns delete)
-	c.registry.RemoveFromSubscription(subs, parentTrans, waitRouteCleanupTime, c)
-	parentTrans.SendEvent(nil, 0)
+	c.registry.RemoveFromSubscription(ctx, subs, parentTrans, waitRouteCleanupTime, c)
+	return outcome
 }
 
 //-------------------------------------------------------------------
 // send to E2T Subscription Request
 //-------------------------------------------------------------------
-func (c *Control) sendE2TSubscriptionRequest(subs *Subscription, trans *TransactionSubs, parentTrans *TransactionXapp, e2SubscriptionDirectives *E2SubscriptionDirectives) interface{} {
+func (c *Control) sendE2TSubscriptionRequest(ctx context.Context, subs *Subscription, trans *TransactionSubs, parentTrans *TransactionXapp, e2SubscriptionDirectives *E2SubscriptionDirectives) interface{} {
 	var err error
 	var event interface{} = nil
 	var timedOut bool = false
-	const ricRequestorId = 123
 
+	// E2 transactions are paced per E2 node. Requests merged to existing subscriptions do not get here.
+	// Request waits in E2 node queue outside the event loop, so that the mailbox keeps draining.
+	ranName := ranNameOf(subs.Meid)
+	xid := ""
+	if parentTrans.XappKey != nil {
+		xid = parentTrans.XappKey.Xid
+	}
+	admitted := make(chan error, 1)
+	go func() {
+		admitted <- c.e2NodeAdmission.Acquire(ctx, ranName, xid, int64(parentTrans.RequestId.Id))
+	}()
+	if err := subs.waitAdmission(admitted); err != nil {
+		xapp.Logger.Debug("SUBS-SubReq: Cancelled in E2 node queue %s", idstring(err, trans, subs, parentTrans))
+		return &AdmissionCancelledEvent{}
+	}
+	defer c.e2NodeAdmission.Release(ranName)
+
+	subs.mutex.Lock()
 	subReqMsg := subs.SubReqMsg
-	subReqMsg.RequestId = subs.GetReqId().RequestId
-	subReqMsg.RequestId.Id = ricRequestorId
+	subReqMsg.RequestId = subs.ReqId.RequestId
+	subReqMsg.RequestId.Id = subs.ricRequestorId()
+	subs.mutex.Unlock()
 	trans.Mtype, trans.Payload, err = c.e2ap.PackSubscriptionRequest(subReqMsg)
 	if err != nil {
 		xapp.Logger.Error("SUBS-SubReq ASN1 pack error: %s", idstring(err, trans, subs, parentTrans))
@@ -1235,6 +2029,7 @@ func (c *Control) sendE2TSubscriptionRequest(subs *Subscription, trans *Transact
 			ErrorInfo{
 				ErrorSource: models.SubscriptionInstanceErrorSourceASN1,
 				ErrorCause:  err.Error(),
+				ErrorCode:   ErrorCodeAsn1PackFailure,
 			},
 		}
 	}
@@ -1246,6 +2041,7 @@ func (c *Control) sendE2TSubscriptionRequest(subs *Subscription, trans *Transact
 			ErrorInfo{
 				ErrorSource: models.SubscriptionInstanceErrorSourceDBAAS,
 				ErrorCause:  err.Error(),
+				ErrorCode:   ErrorCodeDbaasWriteFailure,
 			},
 		}
 	}
@@ -1263,7 +2059,11 @@ func (c *Control) sendE2TSubscriptionRequest(subs *Subscription, trans *Transact
 		}
 
 		if subs.DoNotWaitSubResp == false {
-			event, timedOut = trans.WaitEvent(e2SubscriptionDirectives.E2TimeoutTimerValue)
+			event, timedOut = subs.waitE2TEvent(ctx, e2SubscriptionDirectives.E2TimeoutTimerValue)
+			if ctx.Err() != nil {
+				xapp.Logger.Debug("SUBS-SubReq: Cancelled %s", idstring(ctx.Err(), trans, subs, parentTrans))
+				break
+			}
 			if timedOut {
 				c.UpdateCounter(cSubReqTimerExpiry)
 				continue
@@ -1283,15 +2083,14 @@ func (c *Control) sendE2TSubscriptionRequest(subs *Subscription, trans *Transact
 // send to E2T Subscription Delete Request
 //-------------------------------------------------------------------
 
-func (c *Control) sendE2TSubscriptionDeleteRequest(subs *Subscription, trans *TransactionSubs, parentTrans *TransactionXapp) interface{} {
+func (c *Control) sendE2TSubscriptionDeleteRequest(ctx context.Context, subs *Subscription, trans *TransactionSubs, parentTrans *TransactionXapp) interface{} {
 	var err error
 	var event interface{}
 	var timedOut bool
-	const ricRequestorId = 123
 
 	subDelReqMsg := &e2ap.E2APSubscriptionDeleteRequest{}
 	subDelReqMsg.RequestId = subs.GetReqId().RequestId
-	subDelReqMsg.RequestId.Id = ricRequestorId
+	subDelReqMsg.RequestId.Id = subs.GetRicRequestorId()
 	subDelReqMsg.FunctionId = subs.SubReqMsg.FunctionId
 	trans.Mtype, trans.Payload, err = c.e2ap.PackSubscriptionDeleteRequest(subDelReqMsg)
 	if err != nil {
@@ -1310,7 +2109,11 @@ func (c *Control) sendE2TSubscriptionDeleteRequest(subs *Subscription, trans *Tr
 		if err != nil {
 			xapp.Logger.Error("SUBS-SubDelReq: rmrSendToE2T failure: %s", idstring(err, trans, subs, parentTrans))
 		}
-		event, timedOut = trans.WaitEvent(e2tSubDelReqTime)
+		event, timedOut = subs.waitE2TEvent(ctx, e2tSubDelReqTime)
+		if ctx.Err() != nil {
+			xapp.Logger.Debug("SUBS-SubDelReq: Cancelled %s", idstring(ctx.Err(), trans, subs, parentTrans))
+			break
+		}
 		if timedOut {
 			c.UpdateCounter(cSubDelReqTimerExpiry)
 			continue
@@ -1333,7 +2136,7 @@ func (c *Control) handleE2TSubscriptionResponse(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubResp %s", idstring(err, params))
 		return
 	}
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{subRespMsg.RequestId.InstanceId})
+	subs, err := c.registry.GetE2NodeSubscription(ranNameOf(params.Meid), subRespMsg.RequestId.InstanceId)
 	if err != nil {
 		xapp.Logger.Error("MSG-SubResp: %s", idstring(err, params))
 		return
@@ -1345,9 +2148,8 @@ func (c *Control) handleE2TSubscriptionResponse(params *xapp.RMRParams) {
 		return
 	}
 	xapp.Logger.Debug("SUBS-SubResp: Sending event, trans= %v", trans)
-	sendOk, timedOut := trans.SendEvent(subRespMsg, e2tRecvMsgTimeout)
-	if sendOk == false {
-		err = fmt.Errorf("Passing event to transaction failed: sendOk(%t) timedOut(%t)", sendOk, timedOut)
+	if c.postE2TEvent(subs, subRespMsg) == false {
+		err = fmt.Errorf("Passing event to subscription failed: timedOut(true)")
 		xapp.Logger.Error("MSG-SubResp: %s", idstring(err, trans, subs))
 	}
 	return
@@ -1364,7 +2166,7 @@ func (c *Control) handleE2TSubscriptionFailure(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubFail %s", idstring(err, params))
 		return
 	}
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{subFailMsg.RequestId.InstanceId})
+	subs, err := c.registry.GetE2NodeSubscription(ranNameOf(params.Meid), subFailMsg.RequestId.InstanceId)
 	if err != nil {
 		xapp.Logger.Error("MSG-SubFail: %s", idstring(err, params))
 		return
@@ -1375,9 +2177,8 @@ func (c *Control) handleE2TSubscriptionFailure(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubFail: %s", idstring(err, params, subs))
 		return
 	}
-	sendOk, timedOut := trans.SendEvent(subFailMsg, e2tRecvMsgTimeout)
-	if sendOk == false {
-		err = fmt.Errorf("Passing event to transaction failed: sendOk(%t) timedOut(%t)", sendOk, timedOut)
+	if c.postE2TEvent(subs, subFailMsg) == false {
+		err = fmt.Errorf("Passing event to subscription failed: timedOut(true)")
 		xapp.Logger.Error("MSG-SubFail: %s", idstring(err, trans, subs))
 	}
 	return
@@ -1394,10 +2195,14 @@ func (c *Control) handleE2TSubscriptionDeleteResponse(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubDelResp: %s", idstring(err, params))
 		return
 	}
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{subDelRespMsg.RequestId.InstanceId})
+	subs, err := c.registry.GetE2NodeSubscription(ranNameOf(params.Meid), subDelRespMsg.RequestId.InstanceId)
 	if err != nil {
-		xapp.Logger.Error("MSG-SubDelResp: %s", idstring(err, params))
-		return
+		// Response to background retry of failed delete
+		subs = c.registry.GetE2CleanupSubscription(ranNameOf(params.Meid), subDelRespMsg.RequestId.InstanceId)
+		if subs == nil {
+			xapp.Logger.Error("MSG-SubDelResp: %s", idstring(err, params))
+			return
+		}
 	}
 	trans := subs.GetTransaction()
 	if trans == nil {
@@ -1405,9 +2210,8 @@ func (c *Control) handleE2TSubscriptionDeleteResponse(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubDelResp: %s", idstring(err, params, subs))
 		return
 	}
-	sendOk, timedOut := trans.SendEvent(subDelRespMsg, e2tRecvMsgTimeout)
-	if sendOk == false {
-		err = fmt.Errorf("Passing event to transaction failed: sendOk(%t) timedOut(%t)", sendOk, timedOut)
+	if c.postE2TEvent(subs, subDelRespMsg) == false {
+		err = fmt.Errorf("Passing event to subscription failed: timedOut(true)")
 		xapp.Logger.Error("MSG-SubDelResp: %s", idstring(err, trans, subs))
 	}
 	return
@@ -1424,10 +2228,14 @@ func (c *Control) handleE2TSubscriptionDeleteFailure(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, params))
 		return
 	}
-	subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{subDelFailMsg.RequestId.InstanceId})
+	subs, err := c.registry.GetE2NodeSubscription(ranNameOf(params.Meid), subDelFailMsg.RequestId.InstanceId)
 	if err != nil {
-		xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, params))
-		return
+		// Response to background retry of failed delete
+		subs = c.registry.GetE2CleanupSubscription(ranNameOf(params.Meid), subDelFailMsg.RequestId.InstanceId)
+		if subs == nil {
+			xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, params))
+			return
+		}
 	}
 	trans := subs.GetTransaction()
 	if trans == nil {
@@ -1435,9 +2243,8 @@ func (c *Control) handleE2TSubscriptionDeleteFailure(params *xapp.RMRParams) {
 		xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, params, subs))
 		return
 	}
-	sendOk, timedOut := trans.SendEvent(subDelFailMsg, e2tRecvMsgTimeout)
-	if sendOk == false {
-		err = fmt.Errorf("Passing event to transaction failed: sendOk(%t) timedOut(%t)", sendOk, timedOut)
+	if c.postE2TEvent(subs, subDelFailMsg) == false {
+		err = fmt.Errorf("Passing event to subscription failed: timedOut(true)")
 		xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, trans, subs))
 	}
 	return
@@ -1505,7 +2312,7 @@ func (c *Control) UpdateSubscriptionInDB(subs *Subscription, removeSubscriptionF
 //-------------------------------------------------------------------
 func (c *Control) RemoveSubscriptionFromDb(subs *Subscription) {
 	xapp.Logger.Debug("RemoveSubscriptionFromDb() subId = %v", subs.ReqId.InstanceId)
-	err := c.RemoveSubscriptionFromSdl(subs.ReqId.InstanceId)
+	err := c.RemoveSubscriptionFromSdl(e2SubsKey{ranName: ranNameOf(subs.Meid), subId: subs.ReqId.InstanceId})
 	if err != nil {
 		xapp.Logger.Error("%v", err)
 	}
@@ -1553,14 +2360,13 @@ func (c *Control) SendSubscriptionDeleteReq(subs *Subscription, e2SubsDelRequire
 		c.registry.mutex = new(sync.Mutex)
 	}
 
-	const ricRequestorId = 123
 	xapp.Logger.Debug("Sending subscription delete due to restart. subId = %v", subs.ReqId.InstanceId)
 
 	// Send delete for every endpoint in the subscription
 	if subs.PolicyUpdate == false {
 		subDelReqMsg := &e2ap.E2APSubscriptionDeleteRequest{}
 		subDelReqMsg.RequestId = subs.GetReqId().RequestId
-		subDelReqMsg.RequestId.Id = ricRequestorId
+		subDelReqMsg.RequestId.Id = subs.GetRicRequestorId()
 		subDelReqMsg.FunctionId = subs.SubReqMsg.FunctionId
 		mType, payload, err := c.e2ap.PackSubscriptionDeleteRequest(subDelReqMsg)
 		if err != nil {
@@ -1672,13 +2478,13 @@ func (c *Control) handleE2TSubscriptionDeleteRequired(params *xapp.RMRParams) {
 	var subscriptions = map[string][]e2ap.E2APSubscriptionDeleteRequired{}
 	var subDB = []*Subscription{}
 	for _, subsTobeRemove := range subsDelRequMsg.E2APSubscriptionDeleteRequiredRequests {
-		subs, err := c.registry.GetSubscriptionFirstMatch([]uint32{subsTobeRemove.RequestId.InstanceId})
+		subs, err := c.registry.GetE2NodeSubscription(ranNameOf(params.Meid), subsTobeRemove.RequestId.InstanceId)
 		if err != nil {
 			xapp.Logger.Error("MSG-SubDelFail: %s", idstring(err, params))
 			continue
 		}
 		// Check if Delete Subscription Already triggered
-		if subs.OngoingDelCount > 0 {
+		if _, ongoingDelCount := subs.GetOngoingCounts(); ongoingDelCount > 0 {
 			continue
 		}
 		subDB = append(subDB, subs)
@@ -1707,32 +2513,29 @@ func (c *Control) SendSubscriptionDeleteReqToE2T(subs *Subscription, params *xap
 		return
 	}
 
-	trans := c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subs.ReqId.RequestId, params.Meid)
+	ctx, cancel := c.rmrRequestContext()
+	trans := c.tracker.NewXappTransaction(ctx, xapp.NewRmrEndpoint(params.Src), params.Xid, subs.ReqId.RequestId, params.Meid)
 	if trans == nil {
 		xapp.Logger.Error("XAPP-SubDelReq: %s", idstring(fmt.Errorf("transaction not created"), params))
+		cancel()
 		return
 	}
-	defer trans.Release()
 
 	err := c.tracker.Track(trans)
 	if err != nil {
 		xapp.Logger.Error("XAPP-SubReq: %s", idstring(err, trans))
+		trans.Release()
+		cancel()
 		return
 	}
 
 	//
-	// Wake subs delete
+	// Wake subs delete. No response is sent to xApp. Delete required by E2 node
+	// is not dropped, so it waits for room in the mailbox outside RMR receiver.
 	//
-	subs.OngoingDelCount++
-	go c.handleSubscriptionDelete(subs, trans, waitRouteCleanup_ms)
-	trans.WaitEvent(0) //blocked wait as timeout is handled in subs side
-	subs.OngoingDelCount--
-
-	xapp.Logger.Debug("XAPP-SubDelReq: Handling event %s ", idstring(nil, trans, subs))
-
-	if subs.NoRespToXapp == true {
-		// Do no send delete responses to xapps due to submgr restart is deleting uncompleted subscriptions
-		xapp.Logger.Debug("XAPP-SubDelReq: subs.NoRespToXapp == true")
-		return
-	}
+	go c.postSubscriptionDelete(ctx, subs, trans, waitRouteCleanup_ms, true, func(event interface{}) {
+		xapp.Logger.Debug("XAPP-SubDelReq: Handling event %s ", idstring(nil, trans, subs))
+		trans.Release()
+		cancel()
+	})
 }
@@ -34,12 +34,21 @@ func (c *Control) TestRestHandler(w http.ResponseWriter, r *http.Request) {
 	pathParams := mux.Vars(r)
 	s := pathParams["testId"]
 
-	// This can be used to delete single subscription from db
+	// This can be used to delete single subscription from db. Subscription
+	// is given as <ranName>/<subId>. When given as <subId> only, like with
+	// RIC wide ids earlier, subscriptions with the id in any E2 node are deleted.
 	if contains := strings.Contains(s, "deletesubid="); contains == true {
-		var splits = strings.Split(s, "=")
-		if subId, err := strconv.ParseInt(splits[1], 10, 64); err == nil {
-			xapp.Logger.Debug("RemoveSubscriptionFromSdl() called. subId = %v", subId)
-			err := c.RemoveSubscriptionFromSdl(uint32(subId))
+		var splits = strings.SplitN(s, "=", 2)
+		if key, err := parseE2SubsSdlKey(splits[1]); err == nil && key.ranName == "" {
+			xapp.Logger.Debug("RemoveSubscriptionsWithSubIdFromSdl() called. subId = %v", key.subId)
+			err := c.RemoveSubscriptionsWithSubIdFromSdl(key.subId)
+			if err != nil {
+				xapp.Logger.Error("c.RemoveSubscriptionsWithSubIdFromSdl failure: %s", err.Error())
+			}
+			return
+		} else if err == nil {
+			xapp.Logger.Debug("RemoveSubscriptionFromSdl() called. key = %v", key)
+			err := c.RemoveSubscriptionFromSdl(key)
 			if err != nil {
 				xapp.Logger.Error("c.RemoveSubscriptionFromSdl failure: %s", err.Error())
 			}
@@ -58,6 +67,14 @@ func (c *Control) TestRestHandler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			xapp.Logger.Error("RemoveAllRESTSubscriptionsFromSdl() RemoveAllSubscriptionsFromSdl() failure: %s", err.Error())
 		}
+		err = c.RemoveAllRestDuplicateEntriesFromSdl()
+		if err != nil {
+			xapp.Logger.Error("RemoveAllRestDuplicateEntriesFromSdl() failure: %s", err.Error())
+		}
+		err = c.RemoveAllNotificationsFromSdl()
+		if err != nil {
+			xapp.Logger.Error("RemoveAllNotificationsFromSdl() failure: %s", err.Error())
+		}
 		return
 	}
 
@@ -75,11 +92,56 @@ func (c *Control) TestRestHandler(w http.ResponseWriter, r *http.Request) {
 //-------------------------------------------------------------------
 func (c *Control) GetAllRestSubscriptions(w http.ResponseWriter, r *http.Request) {
 
-	// Get all REST Subscriptions in subscription manager
-	xapp.Logger.Debug("GetAllRestSubscriptions() called")
-	_, err := w.Write(c.registry.GetAllRestSubscriptionsJson())
+	// Get all REST Subscriptions in subscription manager. Query parameters can be used to filter and paginate the list
+	xapp.Logger.Debug("GetAllRestSubscriptions() called: Req= %v", r.URL.String())
+	filter, err := ParseSubscriptionFilter(r.URL.Query())
+	if err != nil {
+		xapp.Logger.Debug("GetAllRestSubscriptions() %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	restSubscriptionsJson, nextCursor, err := c.registry.GetRestSubscriptionsJson(filter)
+	if err != nil {
+		xapp.Logger.Error("GetAllRestSubscriptions() json.Marshal error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeListResponse(w, restSubscriptionsJson, nextCursor)
+}
+
+func (c *Control) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+
+	// Same as subscription query of port 8088 but E2 subscriptions can be filtered and paginated with query parameters
+	xapp.Logger.Debug("GetSubscriptions() called: Req= %v", r.URL.String())
+	filter, err := ParseSubscriptionFilter(r.URL.Query())
+	if err != nil {
+		xapp.Logger.Debug("GetSubscriptions() %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscriptions, nextCursor, err := c.registry.QueryE2Subscriptions(filter)
+	if err != nil {
+		xapp.Logger.Debug("GetSubscriptions() %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	subscriptionsJson, err := SelectFields(subscriptions, filter.Fields)
+	if err != nil {
+		xapp.Logger.Error("GetSubscriptions() json.Marshal error: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeListResponse(w, subscriptionsJson, nextCursor)
+}
+
+func writeListResponse(w http.ResponseWriter, data []byte, nextCursor string) {
+	w.Header().Set("Content-Type", "application/json")
+	if nextCursor != "" {
+		w.Header().Set(nextCursorHeader, nextCursor)
+	}
+	_, err := w.Write(data)
 	if err != nil {
-		xapp.Logger.Error("GetAllRestSubscriptions() w.Write failure: %s", err.Error())
+		xapp.Logger.Error("w.Write failure: %s", err.Error())
 	}
 }
 
@@ -186,6 +248,28 @@ func (c *Control) DeleteAllXappSubscriptions(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(200) // OK
 }
 
+func (c *Control) GetSubscriptionQuotaUsage(w http.ResponseWriter, r *http.Request) {
+
+	// Get number of E2 subscriptions and configured quota per xApp, E2 node and RAN function of E2 node
+	xapp.Logger.Debug("GetSubscriptionQuotaUsage() called")
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(c.registry.GetQuotaUsageJson())
+	if err != nil {
+		xapp.Logger.Error("GetSubscriptionQuotaUsage() w.Write failure: %s", err.Error())
+	}
+}
+
+func (c *Control) GetE2NodeQueues(w http.ResponseWriter, r *http.Request) {
+
+	// Get outstanding and queued E2 Subscription Requests per E2 node
+	xapp.Logger.Debug("GetE2NodeQueues() called")
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(c.e2NodeAdmission.GetQueuesJson())
+	if err != nil {
+		xapp.Logger.Error("GetE2NodeQueues() w.Write failure: %s", err.Error())
+	}
+}
+
 func (c *Control) GetE2Subscriptions(w http.ResponseWriter, r *http.Request) {
 	xapp.Logger.Debug("GetE2Subscriptions() called: Req= %v", r.URL.Path)
 
@@ -207,3 +291,74 @@ func (c *Control) GetE2Subscriptions(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+func (c *Control) GetUndeliveredNotifications(w http.ResponseWriter, r *http.Request) {
+
+	// Get all REST notifications which are waiting for retry or are in dead letter list
+	xapp.Logger.Debug("GetUndeliveredNotifications() called")
+	_, err := w.Write(c.notificationOutbox.GetUndeliveredJson())
+	if err != nil {
+		xapp.Logger.Error("GetUndeliveredNotifications() w.Write failure: %s", err.Error())
+	}
+}
+
+func (c *Control) ReplayUndeliveredNotification(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("ReplayUndeliveredNotification() called: Req= %v", r.URL.Path)
+
+	// Move a dead letter notification back to delivery
+	pathParams := mux.Vars(r)
+	notificationId := pathParams["notificationId"]
+	xapp.Logger.Debug("ReplayUndeliveredNotification() notificationId=%s", notificationId)
+	if notificationId == "" {
+		w.WriteHeader(400) // Bad request
+		return
+	}
+	if err := c.notificationOutbox.Replay(notificationId); err != nil {
+		xapp.Logger.Error("ReplayUndeliveredNotification() %s", err.Error())
+		w.WriteHeader(404) // Not found
+	}
+}
+
+func (c *Control) ReplayAllUndeliveredNotifications(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("ReplayAllUndeliveredNotifications() called: Req= %v", r.URL.Path)
+
+	// Move all dead letter notifications back to delivery
+	count := c.notificationOutbox.ReplayAll()
+	xapp.Logger.Debug("ReplayAllUndeliveredNotifications() %v notifications replayed", count)
+}
+
+func (c *Control) GetPolicyHistory(w http.ResponseWriter, r *http.Request) {
+
+	// Get versions of policy subscription applied or rejected by E2 node
+	pathParams := mux.Vars(r)
+	ranName := pathParams["ranName"]
+	e2SubId, err := strconv.ParseUint(pathParams["e2SubId"], 10, 32)
+	xapp.Logger.Debug("GetPolicyHistory() called: ranName=%s, e2SubId=%s", ranName, pathParams["e2SubId"])
+	if ranName == "" || err != nil {
+		w.WriteHeader(400) // Bad request
+		return
+	}
+
+	historyJson, err := c.registry.GetPolicyHistoryJson(ranName, uint32(e2SubId))
+	if err != nil {
+		xapp.Logger.Debug("GetPolicyHistory(): %s", err.Error())
+		w.WriteHeader(404) // Not found
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(historyJson)
+	if err != nil {
+		xapp.Logger.Error("GetPolicyHistory() w.Write failure: %s", err.Error())
+	}
+}
+
+func (c *Control) GetPendingE2Cleanups(w http.ResponseWriter, r *http.Request) {
+
+	// Get E2 subscriptions whose failed delete is retried towards E2 node
+	xapp.Logger.Debug("GetPendingE2Cleanups() called")
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(c.registry.GetE2CleanupsJson())
+	if err != nil {
+		xapp.Logger.Error("GetPendingE2Cleanups() w.Write failure: %s", err.Error())
+	}
+}
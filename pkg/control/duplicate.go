@@ -24,6 +24,7 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -31,32 +32,77 @@ import (
 )
 
 type RetransEntry struct {
-	restSubsId string
-	startTime  time.Time
+	restSubsId    string
+	startTime     time.Time
+	payloadMd5sum string // md5sum of request given with idempotency key
 }
 
+// Idempotency key supplied by xApp is used in place of md5sum of the request
+const idempotencyKeyPrefix = "idempotency-key:"
+const maxIdempotencyKeyLength = 255
+
+// Interval of removing expired entries
+const duplicateCtrlPurgeInterval = 60 * time.Second
+
 type DuplicateCtrl struct {
-	mutex              sync.Mutex
-	ongoingRequestMap  map[string]RetransEntry
-	previousRequestMap map[string]string
-	collCount          int
+	mutex                    sync.Mutex
+	dbMutex                  sync.Mutex // Orders db writes. Never taken while mutex is held
+	control                  *Control   // Optional. Used for persisting previous requests in db and for metrics
+	ongoingRequestMap        map[string]RetransEntry
+	previousRequestMap       map[string]string
+	previousRequestExpiryMap map[string]time.Time
+	previousPayloadMap       map[string]string // Idempotency key -> md5sum of request the key was used with
+	collCount                int
 }
 
 func (d *DuplicateCtrl) Init() {
 	d.ongoingRequestMap = make(map[string]RetransEntry)
 	d.previousRequestMap = make(map[string]string)
+	d.previousRequestExpiryMap = make(map[string]time.Time)
+	d.previousPayloadMap = make(map[string]string)
+}
+
+func IdempotencyKeyToMd5sum(idempotencyKey string) (string, error) {
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("Idempotency key longer than %v characters", maxIdempotencyKeyLength)
+	}
+	for _, r := range idempotencyKey {
+		if r < 0x21 || r > 0x7e {
+			return "", fmt.Errorf("Idempotency key contains invalid character %q", r)
+		}
+	}
+	return idempotencyKeyPrefix + idempotencyKey, nil
+}
+
+func IsIdempotencyKey(md5sum string) bool {
+	return strings.HasPrefix(md5sum, idempotencyKeyPrefix)
+}
+
+func previousRequestTtl(md5sum string) time.Duration {
+	if IsIdempotencyKey(md5sum) {
+		return idempotencyKeyRetention
+	}
+	return restDuplicateTtl
 }
 
 func (d *DuplicateCtrl) SetMd5sumFromLastOkRequest(restSubsId string, md5sum string) {
 
+	if d.setMd5sumFromLastOkRequest(restSubsId, md5sum) {
+		d.syncToDb(md5sum)
+	}
+}
+
+func (d *DuplicateCtrl) setMd5sumFromLastOkRequest(restSubsId string, md5sum string) bool {
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
 	if md5sum == "" {
 		xapp.Logger.Error("Attempt to store empty md5sum for restubsId %s retransmission map skipped", restSubsId)
-		return
+		return false
 	}
 
+	payloadMd5sum := d.ongoingRequestMap[md5sum].payloadMd5sum
 	err := d.removeOngoingTransaction(md5sum)
 	if err != nil {
 		xapp.Logger.Error("removeOngoingTransaction() failed:%s", err.Error())
@@ -68,31 +114,193 @@ func (d *DuplicateCtrl) SetMd5sumFromLastOkRequest(restSubsId string, md5sum str
 		if prevRestSubsId != restSubsId {
 			xapp.Logger.Error("Storing md5sum for a processed request for restSubsId %s md5sum %s over a previous restSubsId %s", restSubsId, md5sum, prevRestSubsId)
 		} else {
-			return
+			return false
 		}
 	} else {
 		xapp.Logger.Debug("Storing md5sum for a processed request for restSubsId %s md5sum %s", restSubsId, md5sum)
 	}
 
+	expiry := time.Now().Add(previousRequestTtl(md5sum))
 	d.previousRequestMap[md5sum] = restSubsId
+	d.previousRequestExpiryMap[md5sum] = expiry
+	d.setPreviousPayload(md5sum, payloadMd5sum)
+	return true
 }
 
-func (d *DuplicateCtrl) GetLastKnownRestSubsIdBasedOnMd5sum(md5sum string) (string, bool) {
+//-------------------------------------------------------------------
+// Restore previous requests read from db after restart
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) Restore(entries map[string]RestDuplicateEntryInfo) {
+
+	var expired []string
+	defer func() { d.syncToDb(expired...) }()
 
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
+	now := time.Now()
+	for md5sum, entry := range entries {
+		if now.After(entry.Expiry) {
+			expired = append(expired, md5sum)
+			continue
+		}
+		xapp.Logger.Debug("Restoring md5sum %s for restSubsId %s, expires at %s", md5sum, entry.RestSubsId, entry.Expiry.Format(time.ANSIC))
+		d.previousRequestMap[md5sum] = entry.RestSubsId
+		d.previousRequestExpiryMap[md5sum] = entry.Expiry
+		d.setPreviousPayload(md5sum, entry.PayloadMd5sum)
+	}
+}
+
+//-------------------------------------------------------------------
+// Expiry of previous request. Zero if the request is not known
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) GetPreviousRequestExpiry(md5sum string) time.Time {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.previousRequestMap[md5sum]; !exists {
+		return time.Time{}
+	}
+	return d.previousRequestExpiryMap[md5sum]
+}
+
+//-------------------------------------------------------------------
+// Idempotency keys are set to match the keys held by REST subscriptions
+// after restart. Keys which no REST subscription holds are removed
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) ReconcileIdempotencyKeys(keys map[string]RestDuplicateEntryInfo) {
+
+	var changed []string
+	defer func() { d.syncToDb(changed...) }()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for md5sum, restSubsId := range d.previousRequestMap {
+		if _, ok := keys[md5sum]; IsIdempotencyKey(md5sum) && !ok {
+			xapp.Logger.Debug("Removing idempotency key %s of restSubsId %s not held by REST subscription", md5sum, restSubsId)
+			delete(d.previousRequestMap, md5sum)
+			delete(d.previousRequestExpiryMap, md5sum)
+			delete(d.previousPayloadMap, md5sum)
+			changed = append(changed, md5sum)
+		}
+	}
+	for md5sum, entry := range keys {
+		if d.previousRequestMap[md5sum] != entry.RestSubsId || !d.previousRequestExpiryMap[md5sum].Equal(entry.Expiry) {
+			xapp.Logger.Debug("Restoring idempotency key %s of restSubsId %s, expires at %s", md5sum, entry.RestSubsId, entry.Expiry.Format(time.ANSIC))
+			d.previousRequestMap[md5sum] = entry.RestSubsId
+			d.previousRequestExpiryMap[md5sum] = entry.Expiry
+			changed = append(changed, md5sum)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Removes expired previous requests and stale ongoing requests
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) RemoveExpiredEntries(now time.Time) {
+
+	var expired []string
+	defer func() { d.syncToDb(expired...) }()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for md5sum, expiry := range d.previousRequestExpiryMap {
+		if now.After(expiry) {
+			xapp.Logger.Debug("Retention time of md5sum %s for restSubsId %s expired", md5sum, d.previousRequestMap[md5sum])
+			delete(d.previousRequestMap, md5sum)
+			delete(d.previousRequestExpiryMap, md5sum)
+			delete(d.previousPayloadMap, md5sum)
+			expired = append(expired, md5sum)
+		}
+	}
+	for md5sum, entry := range d.ongoingRequestMap {
+		if d.isStale(entry, now) {
+			xapp.Logger.Error("Removing stale ongoing transaction of restSubsId %s md5sum %s started at %s", entry.restSubsId, md5sum, entry.startTime.Format(time.ANSIC))
+			delete(d.ongoingRequestMap, md5sum)
+		}
+	}
+}
+
+func (d *DuplicateCtrl) Run() {
+	for {
+		<-time.After(duplicateCtrlPurgeInterval)
+		d.RemoveExpiredEntries(time.Now())
+	}
+}
+
+func (d *DuplicateCtrl) isStale(entry RetransEntry, now time.Time) bool {
+	return now.Sub(entry.startTime) > restOngoingRequestTimeout
+}
+
+//-------------------------------------------------------------------
+// Writes current state of previous requests to db. Called without mutex
+// so that db latency does not block handling of other requests. State is
+// read only after dbMutex is taken, so the last write of md5sum always
+// reflects its latest state even if writes of concurrent requests overtake
+// each other.
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) syncToDb(md5sums ...string) {
+
+	if d.control == nil || len(md5sums) == 0 {
+		return
+	}
+
+	d.dbMutex.Lock()
+	defer d.dbMutex.Unlock()
+
+	for _, md5sum := range md5sums {
+		d.mutex.Lock()
+		restSubsId, exists := d.previousRequestMap[md5sum]
+		entry := RestDuplicateEntryInfo{RestSubsId: restSubsId, Expiry: d.previousRequestExpiryMap[md5sum], PayloadMd5sum: d.previousPayloadMap[md5sum]}
+		d.mutex.Unlock()
+
+		var err error
+		if exists {
+			err = d.control.WriteRestDuplicateEntryToSdl(md5sum, entry)
+		} else {
+			err = d.control.RemoveRestDuplicateEntryFromSdl(md5sum)
+		}
+		if err != nil {
+			xapp.Logger.Error("%s", err.Error())
+		}
+	}
+}
+
+func (d *DuplicateCtrl) GetLastKnownRestSubsIdBasedOnMd5sum(md5sum string) (string, bool) {
+
 	if md5sum == "" {
 		return "", false
 	}
 
+	d.mutex.Lock()
+	if expiry, ok := d.previousRequestExpiryMap[md5sum]; ok && time.Now().After(expiry) {
+		xapp.Logger.Debug("Retention time of md5sum %s expired", md5sum)
+		delete(d.previousRequestMap, md5sum)
+		delete(d.previousRequestExpiryMap, md5sum)
+		delete(d.previousPayloadMap, md5sum)
+		d.mutex.Unlock()
+		d.syncToDb(md5sum)
+		return "", false
+	}
+
 	m, e := d.previousRequestMap[md5sum]
+	d.mutex.Unlock()
 
 	return m, e
 }
 
 func (d *DuplicateCtrl) DeleteLastKnownRestSubsIdBasedOnMd5sum(md5sum string) {
 
+	if d.deleteLastKnownRestSubsIdBasedOnMd5sum(md5sum) {
+		d.syncToDb(md5sum)
+	}
+}
+
+func (d *DuplicateCtrl) deleteLastKnownRestSubsIdBasedOnMd5sum(md5sum string) bool {
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
@@ -107,7 +315,10 @@ func (d *DuplicateCtrl) DeleteLastKnownRestSubsIdBasedOnMd5sum(md5sum string) {
 	} else {
 		xapp.Logger.Debug("Deleted a cached md5sum %s for restSubsId %s", md5sum, restSubsId)
 		delete(d.previousRequestMap, md5sum)
+		delete(d.previousRequestExpiryMap, md5sum)
+		delete(d.previousPayloadMap, md5sum)
 	}
+	return exists
 }
 
 func CalculateRequestMd5sum(payload interface{}) (string, error) {
@@ -124,30 +335,91 @@ func CalculateRequestMd5sum(payload interface{}) (string, error) {
 	return hex.EncodeToString(hash[:]), nil
 }
 
+func (d *DuplicateCtrl) setPreviousPayload(md5sum string, payloadMd5sum string) {
+	if payloadMd5sum != "" {
+		d.previousPayloadMap[md5sum] = payloadMd5sum
+	} else {
+		delete(d.previousPayloadMap, md5sum)
+	}
+}
+
+//-------------------------------------------------------------------
+// Idempotency key must not be reused for a different request. Request
+// given with the key earlier is compared to the new one only when md5sum
+// of both is known.
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) checkPayload(md5sum string, payloadMd5sum string, entry RetransEntry, ongoing bool) error {
+
+	if payloadMd5sum == "" {
+		return nil
+	}
+	prevPayloadMd5sum := d.previousPayloadMap[md5sum]
+	if expiry, ok := d.previousRequestExpiryMap[md5sum]; ok && time.Now().After(expiry) {
+		prevPayloadMd5sum = ""
+	}
+	if ongoing {
+		prevPayloadMd5sum = entry.payloadMd5sum
+	}
+	if prevPayloadMd5sum != "" && prevPayloadMd5sum != payloadMd5sum {
+		return fmt.Errorf("Idempotency key %s is already used with a different request", strings.TrimPrefix(md5sum, idempotencyKeyPrefix))
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Checks beforehand that idempotency key is not in use by a different
+// request. Checked again when the request is registered as ongoing.
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) CheckIdempotencyKeyPayload(md5sum string, payloadMd5sum string) error {
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	entry, present := d.ongoingRequestMap[md5sum]
+	return d.checkPayload(md5sum, payloadMd5sum, entry, present && !d.isStale(entry, time.Now()))
+}
+
 func (d *DuplicateCtrl) IsDuplicateToOngoingTransaction(restSubsId string, md5sum string) bool {
+	duplicate, _ := d.IsDuplicateToOngoingTransactionWithPayload(restSubsId, md5sum, "")
+	return duplicate
+}
+
+//-------------------------------------------------------------------
+// Error is returned when idempotency key is reused with different payload
+//-------------------------------------------------------------------
+func (d *DuplicateCtrl) IsDuplicateToOngoingTransactionWithPayload(restSubsId string, md5sum string, payloadMd5sum string) (bool, error) {
 
 	if md5sum == "" {
-		return false
+		return false, nil
 	}
 
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
 	entry, present := d.ongoingRequestMap[md5sum]
+	ongoing := present && !d.isStale(entry, time.Now())
+	if err := d.checkPayload(md5sum, payloadMd5sum, entry, ongoing); err != nil {
+		return false, err
+	}
 
-	if present {
+	if present && d.isStale(entry, time.Now()) {
+		xapp.Logger.Error("Stale ongoing transaction of REST subs ID %s with md5sum : %s started at %s replaced\n", entry.restSubsId, md5sum, entry.startTime.Format(time.ANSIC))
+	} else if present {
 		xapp.Logger.Debug("Collision detected. REST subs ID %s has ongoing transaction with md5sum : %s started at %s\n", entry.restSubsId, md5sum, entry.startTime.Format(time.ANSIC))
 		d.collCount++
-		return true
+		if d.control != nil {
+			d.control.UpdateCounter(cRestSubReqCollision)
+		}
+		return true, nil
 	}
 
-	entry = RetransEntry{restSubsId: restSubsId, startTime: time.Now()}
+	entry = RetransEntry{restSubsId: restSubsId, startTime: time.Now(), payloadMd5sum: payloadMd5sum}
 
 	xapp.Logger.Debug("No collision detected against ongoing transaction. Added md5sum %s for restSubsId %s at %s\n", md5sum, entry.restSubsId, entry.startTime)
 
 	d.ongoingRequestMap[md5sum] = entry
 
-	return false
+	return false, nil
 }
 
 func (d *DuplicateCtrl) TransactionComplete(md5sum string) error {
@@ -20,7 +20,9 @@ package control
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
 	"github.com/stretchr/testify/assert"
@@ -204,3 +206,286 @@ func TestXappRestReqDuplicate(t *testing.T) {
 
 	assert.Equal(t, 0, len(retransCtrl.ongoingRequestMap))
 }
+
+func TestIdempotencyKey(t *testing.T) {
+
+	fmt.Println("#####################  TestIdempotencyKey  #####################")
+
+	var retransCtrl DuplicateCtrl
+	origRetention := idempotencyKeyRetention
+	idempotencyKeyRetention = time.Hour
+	defer func() { idempotencyKeyRetention = origRetention }()
+
+	retransCtrl.Init()
+
+	key, err := IdempotencyKeyToMd5sum("9a1e0c5b-37f2-4a48-bb07-44d7d1b1c2a1")
+	assert.Empty(t, err)
+	assert.Equal(t, true, IsIdempotencyKey(key))
+
+	// Same request without key and with different keys must not be duplicates
+	key2, err := IdempotencyKeyToMd5sum("f0d2c6a1-1b52-4d7c-a1fa-f3b2c2b56e10")
+	assert.Empty(t, err)
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", key))
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId2", key2))
+	assert.Equal(t, true, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", key))
+
+	retransCtrl.SetMd5sumFromLastOkRequest("restSubId1", key)
+	assert.Equal(t, 1, len(retransCtrl.ongoingRequestMap))
+	restSubId, exists := retransCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(key)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, "restSubId1", restSubId)
+
+	// Expired key is forgotten
+	retransCtrl.previousRequestExpiryMap[key] = time.Now().Add(-time.Second)
+	_, exists = retransCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(key)
+	assert.Equal(t, false, exists)
+	assert.Equal(t, 0, len(retransCtrl.previousRequestMap))
+
+	// Key is restored only if it has not expired
+	retransCtrl.Restore(map[string]RestDuplicateEntryInfo{
+		key:  RestDuplicateEntryInfo{RestSubsId: "restSubId1", Expiry: time.Now().Add(time.Minute)},
+		key2: RestDuplicateEntryInfo{RestSubsId: "restSubId2", Expiry: time.Now().Add(-time.Minute)},
+	})
+	_, exists = retransCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(key)
+	assert.Equal(t, true, exists)
+	_, exists = retransCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(key2)
+	assert.Equal(t, false, exists)
+
+	retransCtrl.DeleteLastKnownRestSubsIdBasedOnMd5sum(key)
+	assert.Equal(t, 0, len(retransCtrl.previousRequestExpiryMap))
+
+	_, err = IdempotencyKeyToMd5sum("key with spaces")
+	assert.NotEmpty(t, err)
+	_, err = IdempotencyKeyToMd5sum(strings.Repeat("a", maxIdempotencyKeyLength+1))
+	assert.NotEmpty(t, err)
+}
+
+func TestDuplicatePersistence(t *testing.T) {
+
+	fmt.Println("#####################  TestDuplicatePersistence  #####################")
+
+	origTtl := restDuplicateTtl
+	restDuplicateTtl = time.Hour
+	defer func() { restDuplicateTtl = origTtl }()
+
+	dbMock := CreateSdlNsMock(restDuplicateSdlNs)
+	c := &Control{Counters: mainCtrl.c.Counters, restDuplicateDb: dbMock}
+
+	var retransCtrl DuplicateCtrl
+	retransCtrl.Init()
+	retransCtrl.control = c
+
+	md5sum := "856e9546f6f7b65b13a86956f2e16f6a"
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", md5sum))
+	retransCtrl.SetMd5sumFromLastOkRequest("restSubId1", md5sum)
+	assert.Equal(t, 1, len(dbMock.db))
+
+	// Simulate restart
+	var restarted DuplicateCtrl
+	restarted.Init()
+	restarted.control = c
+	entries, err := c.ReadAllRestDuplicateEntriesFromSdl()
+	assert.Nil(t, err)
+	restarted.Restore(entries)
+	restSubId, exists := restarted.GetLastKnownRestSubsIdBasedOnMd5sum(md5sum)
+	assert.Equal(t, true, exists)
+	assert.Equal(t, "restSubId1", restSubId)
+
+	// Expired entry is removed also from db
+	restarted.RemoveExpiredEntries(time.Now().Add(2 * time.Hour))
+	assert.Equal(t, 0, len(restarted.previousRequestMap))
+	assert.Equal(t, 0, len(dbMock.db))
+}
+
+func TestDuplicateStaleOngoingTransaction(t *testing.T) {
+
+	fmt.Println("#####################  TestDuplicateStaleOngoingTransaction  #####################")
+
+	origTimeout := restOngoingRequestTimeout
+	restOngoingRequestTimeout = time.Minute
+	defer func() { restOngoingRequestTimeout = origTimeout }()
+
+	var retransCtrl DuplicateCtrl
+	retransCtrl.Init()
+
+	md5sum := "856e9546f6f7b65b13a86956f2e16f6a"
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", md5sum))
+	assert.Equal(t, true, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", md5sum))
+	assert.Equal(t, 1, retransCtrl.collCount)
+
+	// Stale ongoing transaction does not block new request
+	entry := retransCtrl.ongoingRequestMap[md5sum]
+	entry.startTime = time.Now().Add(-2 * time.Minute)
+	retransCtrl.ongoingRequestMap[md5sum] = entry
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId2", md5sum))
+	assert.Equal(t, "restSubId2", retransCtrl.ongoingRequestMap[md5sum].restSubsId)
+
+	// Stale ongoing transaction is purged
+	retransCtrl.RemoveExpiredEntries(time.Now().Add(2 * time.Minute))
+	assert.Equal(t, 0, len(retransCtrl.ongoingRequestMap))
+}
+
+func TestDuplicateIdempotencyKeyPayload(t *testing.T) {
+
+	fmt.Println("#####################  TestDuplicateIdempotencyKeyPayload  #####################")
+
+	origRetention := idempotencyKeyRetention
+	idempotencyKeyRetention = time.Hour
+	defer func() { idempotencyKeyRetention = origRetention }()
+
+	dbMock := CreateSdlNsMock(restDuplicateSdlNs)
+	c := &Control{Counters: mainCtrl.c.Counters, restDuplicateDb: dbMock}
+
+	var retransCtrl DuplicateCtrl
+	retransCtrl.Init()
+	retransCtrl.control = c
+
+	key, err := IdempotencyKeyToMd5sum("9a1e0c5b-37f2-4a48-bb07-44d7d1b1c2a1")
+	assert.Empty(t, err)
+	payload1 := "856e9546f6f7b65b13a86956f2e16f6a"
+	payload2 := "1ee3b2d7f5a9c80e0a1c77a08c5fd2a4"
+
+	// Key reused for different request while first one is ongoing
+	duplicate, err := retransCtrl.IsDuplicateToOngoingTransactionWithPayload("restSubId1", key, payload1)
+	assert.Nil(t, err)
+	assert.Equal(t, false, duplicate)
+	assert.NotNil(t, retransCtrl.CheckIdempotencyKeyPayload(key, payload2))
+	duplicate, err = retransCtrl.IsDuplicateToOngoingTransactionWithPayload("restSubId2", key, payload2)
+	assert.NotNil(t, err)
+	assert.Equal(t, false, duplicate)
+	duplicate, err = retransCtrl.IsDuplicateToOngoingTransactionWithPayload("restSubId1", key, payload1)
+	assert.Nil(t, err)
+	assert.Equal(t, true, duplicate)
+
+	// Key reused for different request after first one is processed
+	retransCtrl.SetMd5sumFromLastOkRequest("restSubId1", key)
+	assert.Nil(t, retransCtrl.CheckIdempotencyKeyPayload(key, payload1))
+	assert.NotNil(t, retransCtrl.CheckIdempotencyKeyPayload(key, payload2))
+
+	// Payload is remembered over restart
+	var restarted DuplicateCtrl
+	restarted.Init()
+	restarted.control = c
+	entries, err := c.ReadAllRestDuplicateEntriesFromSdl()
+	assert.Nil(t, err)
+	restarted.Restore(entries)
+	assert.Nil(t, restarted.CheckIdempotencyKeyPayload(key, payload1))
+	assert.NotNil(t, restarted.CheckIdempotencyKeyPayload(key, payload2))
+
+	// Key can be used for any request after it is forgotten
+	restarted.DeleteLastKnownRestSubsIdBasedOnMd5sum(key)
+	assert.Nil(t, restarted.CheckIdempotencyKeyPayload(key, payload2))
+	assert.Equal(t, 0, len(restarted.previousPayloadMap))
+}
+
+func TestIdempotencyKeyReconcile(t *testing.T) {
+
+	fmt.Println("#####################  TestIdempotencyKeyReconcile  #####################")
+
+	dbMock := CreateSdlNsMock(restDuplicateSdlNs)
+	c := &Control{Counters: mainCtrl.c.Counters, restDuplicateDb: dbMock, restSubsDb: CreateSdlNsMock(restSubSdlNs), registry: new(Registry)}
+	c.registry.Initialize()
+	c.restDuplicateCtrl = new(DuplicateCtrl)
+	c.restDuplicateCtrl.Init()
+	c.restDuplicateCtrl.control = c
+
+	now := time.Now()
+	createKeyHolder := func(restSubId string, key string, expiry time.Time) *RESTSubscription {
+		xAppServiceName, xAppRmrEndPoint, meid := "xapp1", "localhost:13560", "RAN_NAME_1"
+		restSubscription := c.registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &meid)
+		restSubscription.lastReqMd5sum = idempotencyKeyPrefix + key
+		restSubscription.idempotencyKeyExpiry = expiry
+		return restSubscription
+	}
+
+	// Retention stored with REST subscription survives restart
+	restSubs1 := createKeyHolder("restSubId1", "key1", now.Add(time.Hour))
+	c.WriteRESTSubscriptionToDb("restSubId1", restSubs1)
+	stored, err := c.ReadRESTSubscriptionFromSdl("restSubId1")
+	assert.Nil(t, err)
+	assert.True(t, restSubs1.idempotencyKeyExpiry.Equal(stored.idempotencyKeyExpiry))
+
+	// Expired key, key stored without retention and key of deleted REST subscription
+	restSubs2 := createKeyHolder("restSubId2", "key2", now.Add(-time.Second))
+	restSubs3 := createKeyHolder("restSubId3", "key3", time.Time{})
+	for md5sum, entry := range map[string]RestDuplicateEntryInfo{
+		idempotencyKeyPrefix + "key2": {RestSubsId: "restSubId2", Expiry: now.Add(time.Hour)},
+		idempotencyKeyPrefix + "key3": {RestSubsId: "restSubId3", Expiry: now.Add(time.Minute)},
+		idempotencyKeyPrefix + "key4": {RestSubsId: "restSubId4", Expiry: now.Add(time.Hour)},
+	} {
+		assert.Nil(t, c.WriteRestDuplicateEntryToSdl(md5sum, entry))
+	}
+	entries, err := c.ReadAllRestDuplicateEntriesFromSdl()
+	assert.Nil(t, err)
+	c.restDuplicateCtrl.Restore(entries)
+
+	c.reconcileIdempotencyKeys(now)
+
+	restSubId, exists := c.restDuplicateCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(idempotencyKeyPrefix + "key1")
+	assert.True(t, exists)
+	assert.Equal(t, "restSubId1", restSubId)
+	assert.True(t, restSubs1.idempotencyKeyExpiry.Equal(c.restDuplicateCtrl.GetPreviousRequestExpiry(idempotencyKeyPrefix+"key1")))
+
+	_, exists = c.restDuplicateCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(idempotencyKeyPrefix + "key2")
+	assert.False(t, exists)
+	assert.Equal(t, "", restSubs2.lastReqMd5sum)
+
+	assert.True(t, now.Add(time.Minute).Equal(restSubs3.idempotencyKeyExpiry))
+	stored, err = c.ReadRESTSubscriptionFromSdl("restSubId3")
+	assert.Nil(t, err)
+	assert.True(t, now.Add(time.Minute).Equal(stored.idempotencyKeyExpiry))
+
+	_, exists = c.restDuplicateCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(idempotencyKeyPrefix + "key4")
+	assert.False(t, exists)
+
+	entries, err = c.ReadAllRestDuplicateEntriesFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+}
+
+func TestDuplicateSlowDbDoesNotBlockLookups(t *testing.T) {
+
+	fmt.Println("#####################  TestDuplicateSlowDbDoesNotBlockLookups  #####################")
+
+	origTtl := restDuplicateTtl
+	restDuplicateTtl = time.Hour
+	defer func() { restDuplicateTtl = origTtl }()
+
+	dbMock := CreateSdlNsMock(restDuplicateSdlNs)
+	c := &Control{Counters: mainCtrl.c.Counters, restDuplicateDb: dbMock}
+
+	var retransCtrl DuplicateCtrl
+	retransCtrl.Init()
+	retransCtrl.control = c
+
+	md5sum := "856e9546f6f7b65b13a86956f2e16f6a"
+	assert.Equal(t, false, retransCtrl.IsDuplicateToOngoingTransaction("restSubId1", md5sum))
+
+	// Db write is stuck until db lock is released
+	dbMock.lock.Lock()
+	stored := make(chan struct{})
+	go func() {
+		retransCtrl.SetMd5sumFromLastOkRequest("restSubId1", md5sum)
+		close(stored)
+	}()
+
+	looked := make(chan bool)
+	go func() {
+		for {
+			if _, exists := retransCtrl.GetLastKnownRestSubsIdBasedOnMd5sum(md5sum); exists {
+				looked <- true
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-looked:
+	case <-time.After(time.Second):
+		t.Error("Lookup blocked by db write")
+	}
+
+	dbMock.lock.Unlock()
+	<-stored
+	assert.Equal(t, 1, len(dbMock.db))
+}
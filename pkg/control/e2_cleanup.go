@@ -0,0 +1,343 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Pending cleanups of E2 subscriptions. If E2 node rejects RIC Subscription
+// Delete Request or does not respond to it, the subscription may still exist
+// in E2 node. Subscription is removed from xApps but its id is kept reserved
+// and deletion is retried in background with exponential backoff until E2
+// node confirms it or try count is exhausted. Pending cleanups are stored in
+// db so that retries continue after restart. Due cleanups are retried
+// concurrently so that an unresponsive E2 node does not delay the others.
+//-----------------------------------------------------------------------------
+
+const e2CleanupCheckInterval = time.Second
+
+type E2CleanupInfo struct {
+	SubId          uint32
+	Meid           string
+	FunctionId     e2ap.FunctionId
+	RicRequestorId uint32
+	State          string
+	ErrorCode      ErrorCode
+	ErrorCause     string
+	E2Cause        *e2ap.Cause `json:",omitempty"`
+	TryCount       uint64
+	Created        time.Time
+	NextTry        time.Time
+}
+
+type e2Cleanup struct {
+	E2CleanupInfo
+	subs     *Subscription
+	retrying bool // Retry is ongoing. Guarded by registry mutex
+}
+
+//-------------------------------------------------------------------
+// Delay before next try. Doubles after every failed try and is
+// limited by e2CleanupMaxRetryDelay.
+//-------------------------------------------------------------------
+func E2CleanupRetryDelay(tryCount uint64) time.Duration {
+	delay := e2CleanupRetryDelay
+	for i := uint64(1); i < tryCount; i++ {
+		delay *= 2
+		if delay >= e2CleanupMaxRetryDelay {
+			return e2CleanupMaxRetryDelay
+		}
+	}
+	if delay > e2CleanupMaxRetryDelay {
+		return e2CleanupMaxRetryDelay
+	}
+	return delay
+}
+
+//-------------------------------------------------------------------
+// E2 node does not know the subscription anymore
+//-------------------------------------------------------------------
+func isE2SubscriptionUnknown(subDelFailMsg *e2ap.E2APSubscriptionDeleteFailure) bool {
+	return subDelFailMsg.Cause.Content == e2ap.E2AP_CauseContent_RICrequest &&
+		subDelFailMsg.Cause.Value == e2ap.E2AP_CauseValue_RICrequest_request_id_unknown
+}
+
+//-------------------------------------------------------------------
+// Must be called before subscription is removed from registry so
+// that subscription id is not released
+//-------------------------------------------------------------------
+func (r *Registry) AddE2Cleanup(subs *Subscription, outcome *SubsDeleteOutcome, now time.Time) bool {
+	if e2CleanupMaxTryCount == 0 {
+		return false
+	}
+	ricRequestorId := subs.GetRicRequestorId()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cleanup := &e2Cleanup{subs: subs}
+	cleanup.SubId = subs.ReqId.InstanceId
+	cleanup.Meid = subs.Meid.RanName
+	cleanup.FunctionId = subs.SubReqMsg.FunctionId
+	cleanup.RicRequestorId = ricRequestorId
+	cleanup.State = outcome.State
+	cleanup.ErrorCode = outcome.ErrorInfo.ErrorCode
+	cleanup.ErrorCause = outcome.ErrorInfo.ErrorCause
+	cleanup.E2Cause = outcome.ErrorInfo.E2Cause
+	cleanup.Created = now
+	cleanup.NextTry = now.Add(E2CleanupRetryDelay(1))
+	key := newE2SubsKey(subs)
+	r.e2Cleanups[key] = cleanup
+	if err := r.WriteE2CleanupToSdl(key, &cleanup.E2CleanupInfo); err != nil {
+		xapp.Logger.Error("%v", err)
+	}
+	xapp.Logger.Info("E2 subscription delete %s. subId=%v, ranName=%v. Retried at %s", outcome.State, cleanup.SubId, cleanup.Meid, cleanup.NextTry.Format(time.RFC3339))
+	return true
+}
+
+//-------------------------------------------------------------------
+// Returns subscription whose deletion is retried. Responses from E2
+// node are passed to its transaction.
+//-------------------------------------------------------------------
+func (r *Registry) GetE2CleanupSubscription(ranName string, subId uint32) *Subscription {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if cleanup, ok := r.e2Cleanups[e2SubsKey{ranName: ranName, subId: subId}]; ok {
+		return cleanup.subs
+	}
+	if cleanup, ok := r.e2Cleanups[e2SubsKey{subId: subId}]; ok {
+		return cleanup.subs
+	}
+	return nil
+}
+
+func (r *Registry) getDueE2Cleanups(now time.Time) []*e2Cleanup {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var dueCleanups []*e2Cleanup
+	for _, cleanup := range r.e2Cleanups {
+		if !cleanup.NextTry.After(now) && cleanup.retrying == false {
+			dueCleanups = append(dueCleanups, cleanup)
+		}
+	}
+	sort.Slice(dueCleanups, func(i, j int) bool { return dueCleanups[i].SubId < dueCleanups[j].SubId })
+	return dueCleanups
+}
+
+//-------------------------------------------------------------------
+// Returns false if cleanup has been removed or its retry is already
+// ongoing
+//-------------------------------------------------------------------
+func (r *Registry) startE2CleanupRetry(cleanup *e2Cleanup) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if current, ok := r.e2Cleanups[newE2SubsKey(cleanup.subs)]; !ok || current != cleanup || cleanup.retrying {
+		return false
+	}
+	cleanup.retrying = true
+	return true
+}
+
+func (r *Registry) endE2CleanupRetry(cleanup *e2Cleanup) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	cleanup.retrying = false
+}
+
+//-------------------------------------------------------------------
+// Updates cleanup after a try. Returns true when cleanup is completed
+// and subscription id is released.
+//-------------------------------------------------------------------
+func (r *Registry) updateE2Cleanup(cleanup *e2Cleanup, outcome *SubsDeleteOutcome, now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := newE2SubsKey(cleanup.subs)
+	if current, ok := r.e2Cleanups[key]; !ok || current != cleanup {
+		// Cleanup has been removed while it was retried
+		return true
+	}
+	cleanup.retrying = false
+	cleanup.TryCount++
+	cleanup.State = outcome.State
+	cleanup.ErrorCode = outcome.ErrorInfo.ErrorCode
+	cleanup.ErrorCause = outcome.ErrorInfo.ErrorCause
+	cleanup.E2Cause = outcome.ErrorInfo.E2Cause
+	if outcome.State == subsDeleteStateDeleted || cleanup.TryCount >= e2CleanupMaxTryCount {
+		r.releaseE2Cleanup(key)
+		return true
+	}
+	cleanup.NextTry = now.Add(E2CleanupRetryDelay(cleanup.TryCount + 1))
+	if err := r.WriteE2CleanupToSdl(key, &cleanup.E2CleanupInfo); err != nil {
+		xapp.Logger.Error("%v", err)
+	}
+	return false
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) releaseE2Cleanup(key e2SubsKey) {
+	if cleanup, ok := r.e2Cleanups[key]; ok {
+		delete(r.e2Cleanups, key)
+		if err := r.RemoveE2CleanupsFromSdl([]e2SubsKey{key}); err != nil {
+			xapp.Logger.Error("%v", err)
+		}
+		r.quarantineSubId(cleanup.subs, time.Now())
+	}
+}
+
+//-------------------------------------------------------------------
+// Restores cleanups read from db after subscriptions are restored and
+// before quarantines are restored. Subscription is recreated from
+// cleanup information for sending RIC Subscription Delete Request.
+//-------------------------------------------------------------------
+func (r *Registry) restoreE2Cleanups(cleanups map[e2SubsKey]*E2CleanupInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.e2Cleanups = make(map[e2SubsKey]*e2Cleanup)
+	var dropped []e2SubsKey
+	for key, info := range cleanups {
+		if r.reserveE2SubsKey(key) == false {
+			xapp.Logger.Error("Registry: Id of pending E2 cleanup is in use. Cleanup dropped. subId=%v, ranName=%v", key.subId, info.Meid)
+			dropped = append(dropped, key)
+			continue
+		}
+		ricRequestorId := info.RicRequestorId
+		subs := &Subscription{
+			registry:         r,
+			Created:          info.Created,
+			Meid:             &xapp.RMRMeid{RanName: info.Meid},
+			SubReqMsg:        &e2ap.E2APSubscriptionRequest{FunctionId: info.FunctionId},
+			PerRanInstanceId: key.ranName != "",
+			RicRequestorId:   &ricRequestorId,
+		}
+		subs.ReqId.Id = info.RicRequestorId
+		subs.ReqId.InstanceId = info.SubId
+		r.e2Cleanups[key] = &e2Cleanup{E2CleanupInfo: *info, subs: subs}
+	}
+	if len(dropped) > 0 {
+		if err := r.RemoveE2CleanupsFromSdl(dropped); err != nil {
+			xapp.Logger.Error("%v", err)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// E2 node has removed its subscriptions when connection is lost
+//-------------------------------------------------------------------
+func (r *Registry) deleteE2CleanupsOfE2Node(ranName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for key, cleanup := range r.e2Cleanups {
+		if cleanup.Meid == ranName {
+			xapp.Logger.Debug("Registry: Pending E2 cleanup deleted. subId=%v", cleanup.SubId)
+			r.releaseE2Cleanup(key)
+		}
+	}
+}
+
+func (r *Registry) GetE2Cleanups() []E2CleanupInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cleanups := make([]E2CleanupInfo, 0, len(r.e2Cleanups))
+	for _, cleanup := range r.e2Cleanups {
+		cleanups = append(cleanups, cleanup.E2CleanupInfo)
+	}
+	sort.Slice(cleanups, func(i, j int) bool { return cleanups[i].SubId < cleanups[j].SubId })
+	return cleanups
+}
+
+func (r *Registry) GetE2CleanupsJson() []byte {
+	cleanupsJson, err := json.Marshal(r.GetE2Cleanups())
+	if err != nil {
+		xapp.Logger.Error("GetE2CleanupsJson() json.Marshal error: %v", err)
+	}
+	return cleanupsJson
+}
+
+//-------------------------------------------------------------------
+// Sends RIC Subscription Delete Request again for due cleanups. Every
+// cleanup is retried in its own goroutine. Returns without waiting for
+// the retries to complete
+//-------------------------------------------------------------------
+func (c *Control) RetryDueE2Cleanups(ctx context.Context, now time.Time) {
+	for _, cleanup := range c.registry.getDueE2Cleanups(now) {
+		if ctx.Err() != nil {
+			return
+		}
+		if c.e2IfState.IsE2ConnectionUp(&cleanup.Meid) == false {
+			continue
+		}
+		if c.registry.startE2CleanupRetry(cleanup) == false {
+			continue
+		}
+		go c.retryE2Cleanup(ctx, cleanup)
+	}
+}
+
+func (c *Control) retryE2Cleanup(ctx context.Context, cleanup *e2Cleanup) {
+	c.UpdateCounter(cSubDelCleanupRetryToE2)
+	event := c.runSubscriptionCleanup(ctx, cleanup.subs)
+	if ctx.Err() != nil {
+		// Shutdown. Cleanup is retried after restart
+		c.registry.endE2CleanupRetry(cleanup)
+		return
+	}
+
+	outcome := subsDeleteOutcome(true, event)
+	if subDelFailMsg, ok := event.(*e2ap.E2APSubscriptionDeleteFailure); ok && isE2SubscriptionUnknown(subDelFailMsg) {
+		outcome = &SubsDeleteOutcome{State: subsDeleteStateDeleted}
+	}
+	if c.registry.updateE2Cleanup(cleanup, outcome, time.Now()) {
+		if outcome.State == subsDeleteStateDeleted {
+			xapp.Logger.Info("E2 subscription deleted after %v tries. subId=%v, ranName=%v", cleanup.TryCount, cleanup.SubId, cleanup.Meid)
+		} else {
+			xapp.Logger.Error("E2 subscription delete given up after %v tries. subId=%v, ranName=%v: %s", cleanup.TryCount, cleanup.SubId, cleanup.Meid, outcome.ErrorInfo.ErrorCause)
+			c.UpdateCounter(cSubDelCleanupGivenUp)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Background retry loop
+//-------------------------------------------------------------------
+func (c *Control) RunE2CleanupRetries() {
+	ctx := c.rootContext()
+	for {
+		c.RetryDueE2Cleanups(ctx, time.Now())
+		select {
+		case <-time.After(e2CleanupCheckInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,283 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createE2CleanupTestSubs(registry *Registry, ranName string) *Subscription {
+	subs := &Subscription{
+		registry:  registry,
+		Meid:      &xapp.RMRMeid{RanName: ranName},
+		SubReqMsg: &e2ap.E2APSubscriptionRequest{FunctionId: 1},
+	}
+	subs.ReqId.InstanceId = registry.subIds[0]
+	registry.subIds = registry.subIds[1:]
+	return subs
+}
+
+func isSubIdFree(registry *Registry, subId uint32) bool {
+	for _, id := range registry.subIds {
+		if id == subId {
+			return true
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupRetryDelay
+//
+// Retry delay of E2 cleanup is doubled after each try up to max delay
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupRetryDelay(t *testing.T) {
+	CaseBegin("TestE2CleanupRetryDelay")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 5, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+
+	assert.Equal(t, 10*time.Second, E2CleanupRetryDelay(1))
+	assert.Equal(t, 20*time.Second, E2CleanupRetryDelay(2))
+	assert.Equal(t, 40*time.Second, E2CleanupRetryDelay(3))
+	assert.Equal(t, 40*time.Second, E2CleanupRetryDelay(10))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupDisabled
+//
+// E2 cleanup is not added when retrying is disabled
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupDisabled(t *testing.T) {
+	CaseBegin("TestE2CleanupDisabled")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 0, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+
+	assert.False(t, registry.AddE2Cleanup(subs, subsDeleteOutcome(true, nil), time.Now()))
+	assert.Equal(t, 0, len(registry.GetE2Cleanups()))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupRetriedUntilDeleted
+//
+//   1. SubDelReq times out and E2 cleanup is added, instance id stays reserved
+//   2. Cleanup is due after retry delay
+//   3. SubDelFail to retry, cleanup is rescheduled with doubled delay
+//   4. SubDelResp to retry, cleanup is removed and instance id released
+//   5. Completed cleanup is not released again
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupRetriedUntilDeleted(t *testing.T) {
+	CaseBegin("TestE2CleanupRetriedUntilDeleted")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 5, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+	subId := subs.ReqId.InstanceId
+	now := time.Now()
+
+	assert.True(t, registry.AddE2Cleanup(subs, subsDeleteOutcome(true, nil), now))
+	assert.Equal(t, subs, registry.GetE2CleanupSubscription("RAN_NAME_1", subId))
+	assert.Nil(t, registry.GetE2CleanupSubscription("RAN_NAME_1", subId+1))
+	cleanups := registry.GetE2Cleanups()
+	assert.Equal(t, 1, len(cleanups))
+	assert.Equal(t, subsDeleteStateTimeout, cleanups[0].State)
+	assert.Equal(t, "RAN_NAME_1", cleanups[0].Meid)
+	assert.Equal(t, now.Add(10*time.Second), cleanups[0].NextTry)
+
+	// Not due before retry delay
+	assert.Equal(t, 0, len(registry.getDueE2Cleanups(now)))
+	dueCleanups := registry.getDueE2Cleanups(now.Add(10 * time.Second))
+	assert.Equal(t, 1, len(dueCleanups))
+
+	// Failed retry is rescheduled with doubled delay
+	subDelFailMsg := &e2ap.E2APSubscriptionDeleteFailure{}
+	assert.False(t, registry.updateE2Cleanup(dueCleanups[0], subsDeleteOutcome(true, subDelFailMsg), now))
+	cleanups = registry.GetE2Cleanups()
+	assert.Equal(t, uint64(1), cleanups[0].TryCount)
+	assert.Equal(t, subsDeleteStateFailed, cleanups[0].State)
+	assert.Equal(t, now.Add(20*time.Second), cleanups[0].NextTry)
+	assert.False(t, isSubIdFree(registry, subId))
+
+	assert.True(t, registry.updateE2Cleanup(dueCleanups[0], subsDeleteOutcome(true, &e2ap.E2APSubscriptionDeleteResponse{}), now))
+	assert.Equal(t, 0, len(registry.GetE2Cleanups()))
+	assert.True(t, isSubIdFree(registry, subId))
+
+	// Already completed cleanup is not released again
+	assert.True(t, registry.updateE2Cleanup(dueCleanups[0], subsDeleteOutcome(true, nil), now))
+	assert.Equal(t, 65534, len(registry.subIds))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupGivenUp
+//
+//   1. SubDelReq times out and E2 cleanup is added
+//   2. Retries time out until max try count, cleanup is given up and instance id released
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupGivenUp(t *testing.T) {
+	CaseBegin("TestE2CleanupGivenUp")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 2, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+	now := time.Now()
+
+	registry.AddE2Cleanup(subs, subsDeleteOutcome(true, nil), now)
+	cleanup := registry.getDueE2Cleanups(now.Add(time.Hour))[0]
+	assert.False(t, registry.updateE2Cleanup(cleanup, subsDeleteOutcome(true, nil), now))
+	assert.True(t, registry.updateE2Cleanup(cleanup, subsDeleteOutcome(true, nil), now))
+	assert.Equal(t, 0, len(registry.GetE2Cleanups()))
+	assert.True(t, isSubIdFree(registry, subs.ReqId.InstanceId))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupsOfE2NodeDeleted
+//
+//   1. E2 cleanups are added in two E2 nodes
+//   2. E2 node is deleted, its cleanup is removed and instance id released
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupsOfE2NodeDeleted(t *testing.T) {
+	CaseBegin("TestE2CleanupsOfE2NodeDeleted")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 5, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs1 := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+	subs2 := createE2CleanupTestSubs(registry, "RAN_NAME_2")
+	now := time.Now()
+
+	registry.AddE2Cleanup(subs1, subsDeleteOutcome(true, nil), now)
+	registry.AddE2Cleanup(subs2, subsDeleteOutcome(true, nil), now)
+	registry.deleteE2CleanupsOfE2Node("RAN_NAME_1")
+
+	cleanups := registry.GetE2Cleanups()
+	assert.Equal(t, 1, len(cleanups))
+	assert.Equal(t, subs2.ReqId.InstanceId, cleanups[0].SubId)
+	assert.True(t, isSubIdFree(registry, subs1.ReqId.InstanceId))
+	assert.False(t, isSubIdFree(registry, subs2.ReqId.InstanceId))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupRetryNotStartedTwice
+//
+//   1. Retry of due E2 cleanup is started
+//   2. Cleanup is not started again or due while retry is ongoing
+//   3. Cleanup is due again when retry has ended
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupRetryNotStartedTwice(t *testing.T) {
+	CaseBegin("TestE2CleanupRetryNotStartedTwice")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 5, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+	now := time.Now()
+
+	registry.AddE2Cleanup(subs, subsDeleteOutcome(true, nil), now)
+	cleanup := registry.getDueE2Cleanups(now.Add(time.Hour))[0]
+	assert.True(t, registry.startE2CleanupRetry(cleanup))
+	assert.False(t, registry.startE2CleanupRetry(cleanup))
+	assert.Equal(t, 0, len(registry.getDueE2Cleanups(now.Add(time.Hour))))
+
+	registry.endE2CleanupRetry(cleanup)
+	assert.Equal(t, 1, len(registry.getDueE2Cleanups(now.Add(time.Hour))))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2CleanupRestoredAfterRestart
+//
+//   1. SubDelReq and its retry time out, E2 cleanup is stored in db
+//   2. Restart, cleanup is restored from db with its subscription and instance id reserved
+//   3. SubDelResp to retry, cleanup is removed from db and instance id released
+//
+//-----------------------------------------------------------------------------
+func TestE2CleanupRestoredAfterRestart(t *testing.T) {
+	CaseBegin("TestE2CleanupRestoredAfterRestart")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2Cleanup = e2CleanupTestConfig{maxTryCount: 5, retryDelay: 10 * time.Second, maxRetryDelay: 40 * time.Second}
+	})
+	registry := createTestRegistry()
+	subs := createE2CleanupTestSubs(registry, "RAN_NAME_1")
+	ricRequestorId := uint32(200)
+	subs.RicRequestorId = &ricRequestorId
+	subId := subs.ReqId.InstanceId
+	now := time.Now()
+
+	registry.AddE2Cleanup(subs, subsDeleteOutcome(true, nil), now)
+	cleanup := registry.getDueE2Cleanups(now.Add(time.Hour))[0]
+	assert.False(t, registry.updateE2Cleanup(cleanup, subsDeleteOutcome(true, nil), now))
+
+	// Restart
+	restarted := createTestRegistry()
+	restarted.e2CleanupDb = registry.e2CleanupDb
+	cleanups, err := restarted.ReadAllE2CleanupsFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(cleanups))
+	restarted.restoreE2Cleanups(cleanups)
+
+	assert.False(t, isSubIdFree(restarted, subId))
+	restoredSubs := restarted.GetE2CleanupSubscription("RAN_NAME_1", subId)
+	assert.NotNil(t, restoredSubs)
+	assert.Equal(t, subId, restoredSubs.ReqId.InstanceId)
+	assert.Equal(t, "RAN_NAME_1", restoredSubs.Meid.RanName)
+	assert.Equal(t, e2ap.FunctionId(1), restoredSubs.SubReqMsg.FunctionId)
+	assert.Equal(t, uint32(200), restoredSubs.GetRicRequestorId())
+	restoredCleanups := restarted.GetE2Cleanups()
+	assert.Equal(t, uint64(1), restoredCleanups[0].TryCount)
+	assert.True(t, now.Add(20*time.Second).Equal(restoredCleanups[0].NextTry))
+
+	// Completed cleanup is removed from db
+	cleanup = restarted.getDueE2Cleanups(now.Add(time.Hour))[0]
+	assert.True(t, restarted.updateE2Cleanup(cleanup, subsDeleteOutcome(true, &e2ap.E2APSubscriptionDeleteResponse{}), now))
+	cleanups, err = restarted.ReadAllE2CleanupsFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cleanups))
+	assert.True(t, isSubIdFree(restarted, subId))
+}
+
+func TestIsE2SubscriptionUnknown(t *testing.T) {
+	subDelFailMsg := &e2ap.E2APSubscriptionDeleteFailure{}
+	subDelFailMsg.Cause.Content = e2ap.E2AP_CauseContent_RICrequest
+	subDelFailMsg.Cause.Value = e2ap.E2AP_CauseValue_RICrequest_request_id_unknown
+	assert.True(t, isE2SubscriptionUnknown(subDelFailMsg))
+	subDelFailMsg.Cause.Value = e2ap.E2AP_CauseValue_RICrequest_unspecified
+	assert.False(t, isE2SubscriptionUnknown(subDelFailMsg))
+}
@@ -137,6 +137,9 @@ func (e *E2ap) CheckActionNotAdmittedList(msgType int, actionNotAdmittedList e2a
 		prefixString = "RICSubscriptionFailure"
 		err := fmt.Errorf("%s", prefixString)
 		errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
+		errorInfo.SetCode(ErrorCodeE2SubscriptionFailure)
+	} else if len(actionNotAdmittedList.Items) > 0 {
+		errorInfo.SetCode(ErrorCodeE2ActionsNotAdmitted)
 	}
 	err := fmt.Errorf("%s %s", prefixString, actionNotAdmittedString)
 	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
@@ -260,7 +263,6 @@ func (e *E2ap) UnpackSubscriptionDeleteFailure(payload []byte) (*e2ap.E2APSubscr
 	return subDelFail, nil
 }
 
-/*
 func (e *E2ap) PackSubscriptionDeleteFailure(req *e2ap.E2APSubscriptionDeleteFailure) (int, *e2ap.PackedData, error) {
 	e2SubDelFail := packerif.NewPackerSubscriptionDeleteFailure()
 	err, packedData := e2SubDelFail.Pack(req)
@@ -269,7 +271,6 @@ func (e *E2ap) PackSubscriptionDeleteFailure(req *e2ap.E2APSubscriptionDeleteFai
 	}
 	return xapp.RIC_SUB_DEL_FAILURE, packedData, nil
 }
-*/
 
 //-----------------------------------------------------------------------------
 // Changes to support "RIC_SUB_DEL_REQUIRED"
@@ -120,7 +120,7 @@ func (e *E2IfState) NotificationCb(ch string, events ...string) {
 		if _, ok := e.NbIdMap[nbId]; ok {
 			e.NbIdStatusMap[nbId] = "DISCONNECTED"
 			delete(e.NbIdMap, nbId)
-			e.control.registry.DeleteAllE2Subscriptions(nbId, e.control)
+			e.control.registry.DeleteAllE2Subscriptions(e.control.rootContext(), nbId, e.control)
 		}
 	} else if strings.Contains(events[0], "_UNDER_RESET") {
 		xapp.Logger.Debug("NotificationCb UNDER_RESET len(nbId) == 0 ")
@@ -133,7 +133,7 @@ func (e *E2IfState) NotificationCb(ch string, events ...string) {
 		e.NbIdStatusMap[nbId] = "UNDER_RESET"
 		xapp.Logger.Debug("E2 Under Reset. NbId=%s", nbId)
 		if _, ok := e.NbIdMap[nbId]; ok {
-			e.control.registry.DeleteAllE2Subscriptions(nbId, e.control)
+			e.control.registry.DeleteAllE2Subscriptions(e.control.rootContext(), nbId, e.control)
 		}
 	}
 }
@@ -165,7 +165,7 @@ func (e *E2IfState) ReadE2ConfigurationFromRnib() {
 				xapp.Logger.Debug("E2 connection DISCONNETED: %v", nbIdentity.InventoryName)
 
 				// Delete all subscriptions related to InventoryName/nbId
-				e.control.registry.DeleteAllE2Subscriptions(nbIdentity.InventoryName, e.control)
+				e.control.registry.DeleteAllE2Subscriptions(e.control.rootContext(), nbIdentity.InventoryName, e.control)
 			}
 			continue
 		}
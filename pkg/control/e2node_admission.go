@@ -0,0 +1,370 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Admission control of E2 Subscription Requests per E2 node. Number of
+// outstanding E2 transactions towards a node is limited by
+// e2NodeMaxOutstandingSubReqs and rate of new transactions by a token bucket
+// which is filled with e2NodeSubReqRate tokens per second up to
+// e2NodeSubReqBurst tokens. Requests which can not be admitted wait in FIFO
+// queue of the node. Value 0 means unlimited. Node which has been marked
+// congested does not admit any requests until congestion has expired. Only
+// requests which are sent to E2 node are admitted, i.e. requests merged to
+// existing subscriptions are not paced.
+//-----------------------------------------------------------------------------
+
+type E2NodeAdmissionConfig struct {
+	MaxOutstanding int
+	Rate           float64
+	Burst          int
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var e2NodeAdmissionConfig atomic.Pointer[E2NodeAdmissionConfig]
+
+func init() {
+	setE2NodeAdmissionConfig(E2NodeAdmissionConfig{})
+}
+
+func getE2NodeAdmissionConfig() *E2NodeAdmissionConfig {
+	return e2NodeAdmissionConfig.Load()
+}
+
+func setE2NodeAdmissionConfig(config E2NodeAdmissionConfig) {
+	e2NodeAdmissionConfig.Store(&config)
+}
+
+type QueuedSubReqInfo struct {
+	RestSubId           string // Xid for requests received via RMR
+	XappEventInstanceId int64
+	Queued              time.Time
+}
+
+type E2NodeQueueInfo struct {
+	Outstanding    int
+	CongestedUntil *time.Time `json:",omitempty"`
+	Queued         []QueuedSubReqInfo
+}
+
+type queuedSubReq struct {
+	info  QueuedSubReqInfo
+	ready chan struct{}
+}
+
+type e2NodeQueue struct {
+	outstanding    int
+	tokens         float64
+	lastRefill     time.Time
+	congestedUntil time.Time
+	waiting        []*queuedSubReq
+	dispatchTimer  *time.Timer
+}
+
+type E2NodeAdmission struct {
+	mutex   sync.Mutex
+	control *Control
+	queues  map[string]*e2NodeQueue
+}
+
+func (a *E2NodeAdmission) Init(c *Control) {
+	a.control = c
+	a.queues = make(map[string]*e2NodeQueue)
+}
+
+func (a *E2NodeAdmission) getQueue(ranName string, now time.Time) *e2NodeQueue {
+	q, ok := a.queues[ranName]
+	if !ok {
+		q = &e2NodeQueue{tokens: float64(getE2NodeAdmissionConfig().burst()), lastRefill: now}
+		a.queues[ranName] = q
+	}
+	return q
+}
+
+func (c *E2NodeAdmissionConfig) burst() int {
+	if c.Burst < 1 {
+		return 1
+	}
+	return c.Burst
+}
+
+func (q *e2NodeQueue) refill(now time.Time) {
+	config := getE2NodeAdmissionConfig()
+	if config.Rate <= 0 {
+		return
+	}
+	q.tokens += now.Sub(q.lastRefill).Seconds() * config.Rate
+	if q.tokens > float64(config.burst()) {
+		q.tokens = float64(config.burst())
+	}
+	q.lastRefill = now
+}
+
+//-------------------------------------------------------------------
+// Returns zero if request can be admitted now, otherwise time to wait
+// for next token. Negative value means waiting for a free slot.
+//-------------------------------------------------------------------
+func (q *e2NodeQueue) admitDelay(now time.Time) time.Duration {
+	config := getE2NodeAdmissionConfig()
+	if config.MaxOutstanding > 0 && q.outstanding >= config.MaxOutstanding {
+		return -1
+	}
+	if now.Before(q.congestedUntil) {
+		return q.congestedUntil.Sub(now)
+	}
+	if config.Rate <= 0 {
+		return 0
+	}
+	q.refill(now)
+	if q.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - q.tokens) / config.Rate * float64(time.Second))
+}
+
+func (q *e2NodeQueue) admit() {
+	q.outstanding++
+	if getE2NodeAdmissionConfig().Rate > 0 {
+		q.tokens--
+	}
+}
+
+//-------------------------------------------------------------------
+// Acquire blocks until E2 Subscription Request towards the node can
+// be sent or ctx is done. Release must be called when the E2
+// transaction has ended if nil is returned.
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) Acquire(ctx context.Context, ranName string, restSubId string, xAppEventInstanceID int64) error {
+
+	a.mutex.Lock()
+	now := time.Now()
+	q := a.getQueue(ranName, now)
+	if len(q.waiting) == 0 && q.admitDelay(now) == 0 {
+		q.admit()
+		a.updateGauges()
+		a.mutex.Unlock()
+		return nil
+	}
+
+	req := &queuedSubReq{
+		info:  QueuedSubReqInfo{RestSubId: restSubId, XappEventInstanceId: xAppEventInstanceID, Queued: now},
+		ready: make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, req)
+	xapp.Logger.Debug("E2 SubscriptionRequest of restSubId %s queued for ranName %s. Queue depth %v, outstanding %v", restSubId, ranName, len(q.waiting), q.outstanding)
+	a.dispatch(ranName, q)
+	a.updateGauges()
+	a.mutex.Unlock()
+
+	select {
+	case <-req.ready:
+	case <-ctx.Done():
+		if a.cancel(ranName, q, req) {
+			xapp.Logger.Debug("E2 SubscriptionRequest of restSubId %s for ranName %s cancelled after %v in queue", restSubId, ranName, time.Since(now))
+			return ctx.Err()
+		}
+		// Admitted meanwhile
+	}
+	xapp.Logger.Debug("E2 SubscriptionRequest of restSubId %s for ranName %s admitted after %v", restSubId, ranName, time.Since(now))
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Removes waiting request from queue. Returns false if request has
+// already been admitted.
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) cancel(ranName string, q *e2NodeQueue, req *queuedSubReq) bool {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for i, waiting := range q.waiting {
+		if waiting == req {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			a.dispatch(ranName, q)
+			a.deleteIdleQueue(ranName, q)
+			a.updateGauges()
+			return true
+		}
+	}
+	return false
+}
+
+func (a *E2NodeAdmission) Release(ranName string) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	q, ok := a.queues[ranName]
+	if !ok {
+		return
+	}
+	if q.outstanding > 0 {
+		q.outstanding--
+	}
+	a.dispatch(ranName, q)
+	a.deleteIdleQueue(ranName, q)
+	a.updateGauges()
+}
+
+//-------------------------------------------------------------------
+// Marks the node congested. New requests towards the node are not
+// admitted before the given time has passed.
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) SetCongested(ranName string, duration time.Duration) {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	q := a.getQueue(ranName, now)
+	until := now.Add(duration)
+	if until.After(q.congestedUntil) {
+		q.congestedUntil = until
+		xapp.Logger.Info("E2 node %s congested until %v", ranName, until.Format(time.RFC3339Nano))
+	}
+	// Idle queue is kept until congestion expires
+	if q.dispatchTimer == nil {
+		q.dispatchTimer = time.AfterFunc(q.congestedUntil.Sub(now), func() {
+			a.mutex.Lock()
+			defer a.mutex.Unlock()
+			q.dispatchTimer = nil
+			a.dispatch(ranName, q)
+			a.deleteIdleQueue(ranName, q)
+			a.updateGauges()
+		})
+	}
+	a.updateGauges()
+}
+
+func (a *E2NodeAdmission) IsCongested(ranName string) bool {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	q, ok := a.queues[ranName]
+	return ok && time.Now().Before(q.congestedUntil)
+}
+
+//-------------------------------------------------------------------
+// Must be called with mutex locked. Idle queue with full token bucket
+// and no congestion is not needed anymore.
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) deleteIdleQueue(ranName string, q *e2NodeQueue) {
+	now := time.Now()
+	q.refill(now)
+	if q.outstanding == 0 && len(q.waiting) == 0 && q.dispatchTimer == nil && q.tokens >= float64(getE2NodeAdmissionConfig().burst()) &&
+		!now.Before(q.congestedUntil) && a.queues[ranName] == q {
+		delete(a.queues, ranName)
+	}
+}
+
+//-------------------------------------------------------------------
+// Must be called with mutex locked. Admits waiting requests in order.
+// If next request waits for a token, dispatch is retried when the
+// token is available.
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) dispatch(ranName string, q *e2NodeQueue) {
+
+	for len(q.waiting) > 0 {
+		delay := q.admitDelay(time.Now())
+		if delay < 0 {
+			return
+		}
+		if delay > 0 {
+			if q.dispatchTimer == nil {
+				q.dispatchTimer = time.AfterFunc(delay, func() {
+					a.mutex.Lock()
+					defer a.mutex.Unlock()
+					q.dispatchTimer = nil
+					a.dispatch(ranName, q)
+					a.updateGauges()
+				})
+			}
+			return
+		}
+		req := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.admit()
+		close(req.ready)
+	}
+}
+
+//-------------------------------------------------------------------
+// Must be called with mutex locked
+//-------------------------------------------------------------------
+func (a *E2NodeAdmission) updateGauges() {
+	if a.control == nil {
+		return
+	}
+	queued := 0
+	outstanding := 0
+	congested := 0
+	now := time.Now()
+	for _, q := range a.queues {
+		queued += len(q.waiting)
+		outstanding += q.outstanding
+		if now.Before(q.congestedUntil) {
+			congested++
+		}
+	}
+	a.control.SetGauge(gE2NodeSubReqQueueDepth, queued)
+	a.control.SetGauge(gE2NodeOutstandingSubReqs, outstanding)
+	a.control.SetGauge(gCongestedE2NodeCount, congested)
+}
+
+func (a *E2NodeAdmission) GetQueues() map[string]E2NodeQueueInfo {
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	queues := make(map[string]E2NodeQueueInfo)
+	for ranName, q := range a.queues {
+		info := E2NodeQueueInfo{Outstanding: q.outstanding, Queued: []QueuedSubReqInfo{}}
+		if time.Now().Before(q.congestedUntil) {
+			congestedUntil := q.congestedUntil
+			info.CongestedUntil = &congestedUntil
+		}
+		for _, req := range q.waiting {
+			info.Queued = append(info.Queued, req.info)
+		}
+		sort.SliceStable(info.Queued, func(i, j int) bool { return info.Queued[i].Queued.Before(info.Queued[j].Queued) })
+		queues[ranName] = info
+	}
+	return queues
+}
+
+func (a *E2NodeAdmission) GetQueuesJson() []byte {
+	queuesJson, err := json.Marshal(a.GetQueues())
+	if err != nil {
+		xapp.Logger.Error("GetQueuesJson() json.Marshal error: %v", err)
+	}
+	return queuesJson
+}
@@ -0,0 +1,192 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func waitAdmitted(admitted chan string, timeout time.Duration) string {
+	select {
+	case restSubId := <-admitted:
+		return restSubId
+	case <-time.After(timeout):
+		return ""
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestE2NodeAdmissionUnlimited
+//
+// Requests are admitted without limits by default
+//
+//-----------------------------------------------------------------------------
+func TestE2NodeAdmissionUnlimited(t *testing.T) {
+	CaseBegin("TestE2NodeAdmissionUnlimited")
+
+	setTestConfig(t, func(config *testConfig) { config.e2NodeAdmission = E2NodeAdmissionConfig{} })
+	admission := new(E2NodeAdmission)
+	admission.Init(nil)
+
+	for i := 0; i < 10; i++ {
+		admission.Acquire(context.Background(), "RAN_NAME_1", "restSubId1", int64(i))
+	}
+	assert.Equal(t, 10, admission.GetQueues()["RAN_NAME_1"].Outstanding)
+	for i := 0; i < 10; i++ {
+		admission.Release("RAN_NAME_1")
+	}
+	assert.Equal(t, 0, len(admission.GetQueues()))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2NodeAdmissionMaxOutstanding
+//
+//   1. SubReq is outstanding in E2 node, SubReqs of other E2 nodes are not affected
+//   2. Two more SubReqs to the E2 node are queued
+//   3. Queued SubReqs are admitted in order when outstanding ones are responded
+//
+//-----------------------------------------------------------------------------
+func TestE2NodeAdmissionMaxOutstanding(t *testing.T) {
+	CaseBegin("TestE2NodeAdmissionMaxOutstanding")
+
+	setTestConfig(t, func(config *testConfig) { config.e2NodeAdmission = E2NodeAdmissionConfig{MaxOutstanding: 1} })
+	admission := new(E2NodeAdmission)
+	admission.Init(nil)
+
+	admission.Acquire(context.Background(), "RAN_NAME_1", "restSubId1", 1)
+	// Other E2 nodes are not affected
+	admission.Acquire(context.Background(), "RAN_NAME_2", "restSubId2", 1)
+
+	admitted := make(chan string, 2)
+	for _, restSubId := range []string{"restSubId3", "restSubId4"} {
+		go func(restSubId string) {
+			admission.Acquire(context.Background(), "RAN_NAME_1", restSubId, 1)
+			admitted <- restSubId
+		}(restSubId)
+		<-time.After(10 * time.Millisecond)
+	}
+	assert.Equal(t, "", waitAdmitted(admitted, 50*time.Millisecond))
+
+	queues := admission.GetQueues()
+	assert.Equal(t, 1, queues["RAN_NAME_1"].Outstanding)
+	assert.Equal(t, 2, len(queues["RAN_NAME_1"].Queued))
+	assert.Equal(t, "restSubId3", queues["RAN_NAME_1"].Queued[0].RestSubId)
+
+	// Queued requests are admitted in order
+	admission.Release("RAN_NAME_1")
+	assert.Equal(t, "restSubId3", waitAdmitted(admitted, time.Second))
+	admission.Release("RAN_NAME_1")
+	assert.Equal(t, "restSubId4", waitAdmitted(admitted, time.Second))
+	admission.Release("RAN_NAME_1")
+	admission.Release("RAN_NAME_2")
+	assert.Equal(t, 0, len(admission.GetQueues()))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2NodeAdmissionCancelled
+//
+//   1. SubReq is outstanding in E2 node
+//   2. Queued SubReq is cancelled and removed from queue without being admitted
+//
+//-----------------------------------------------------------------------------
+func TestE2NodeAdmissionCancelled(t *testing.T) {
+	CaseBegin("TestE2NodeAdmissionCancelled")
+
+	setTestConfig(t, func(config *testConfig) { config.e2NodeAdmission = E2NodeAdmissionConfig{MaxOutstanding: 1} })
+	admission := new(E2NodeAdmission)
+	admission.Init(nil)
+
+	assert.Nil(t, admission.Acquire(context.Background(), "RAN_NAME_1", "restSubId1", 1))
+
+	// Cancelled request is removed from queue without being admitted
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, admission.Acquire(ctx, "RAN_NAME_1", "restSubId2", 1))
+	assert.Equal(t, 0, len(admission.GetQueues()["RAN_NAME_1"].Queued))
+	assert.Equal(t, 1, admission.GetQueues()["RAN_NAME_1"].Outstanding)
+
+	admission.Release("RAN_NAME_1")
+	assert.Equal(t, 0, len(admission.GetQueues()))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2NodeAdmissionRate
+//
+// SubReqs exceeding burst wait for tokens of the configured rate
+//
+//-----------------------------------------------------------------------------
+func TestE2NodeAdmissionRate(t *testing.T) {
+	CaseBegin("TestE2NodeAdmissionRate")
+
+	setTestConfig(t, func(config *testConfig) { config.e2NodeAdmission = E2NodeAdmissionConfig{Rate: 20, Burst: 2} })
+	admission := new(E2NodeAdmission)
+	admission.Init(nil)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		admission.Acquire(context.Background(), "RAN_NAME_1", "restSubId1", int64(i))
+		admission.Release("RAN_NAME_1")
+	}
+	// Two requests fit to burst, next two wait for tokens 50 ms each
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 90*time.Millisecond)
+	assert.True(t, elapsed < time.Second)
+}
+
+//-----------------------------------------------------------------------------
+// TestE2NodeAdmissionCongested
+//
+//   1. E2 node is congested, other E2 nodes are not affected
+//   2. SubReq to the E2 node is queued while the E2 node is congested
+//   3. SubReq is admitted when congestion has ended
+//
+//-----------------------------------------------------------------------------
+func TestE2NodeAdmissionCongested(t *testing.T) {
+	CaseBegin("TestE2NodeAdmissionCongested")
+
+	setTestConfig(t, func(config *testConfig) { config.e2NodeAdmission = E2NodeAdmissionConfig{} })
+	admission := new(E2NodeAdmission)
+	admission.Init(nil)
+
+	admission.SetCongested("RAN_NAME_1", 100*time.Millisecond)
+	assert.True(t, admission.IsCongested("RAN_NAME_1"))
+	assert.False(t, admission.IsCongested("RAN_NAME_2"))
+	assert.NotNil(t, admission.GetQueues()["RAN_NAME_1"].CongestedUntil)
+
+	// Other E2 nodes are not affected
+	admission.Acquire(context.Background(), "RAN_NAME_2", "restSubId1", 1)
+	admission.Release("RAN_NAME_2")
+
+	admitted := make(chan string, 1)
+	go func() {
+		admission.Acquire(context.Background(), "RAN_NAME_1", "restSubId2", 1)
+		admitted <- "restSubId2"
+	}()
+	assert.Equal(t, "", waitAdmitted(admitted, 50*time.Millisecond))
+	assert.Equal(t, 1, len(admission.GetQueues()["RAN_NAME_1"].Queued))
+	assert.Equal(t, "restSubId2", waitAdmitted(admitted, 500*time.Millisecond))
+	assert.False(t, admission.IsCongested("RAN_NAME_1"))
+
+	admission.Release("RAN_NAME_1")
+	assert.Equal(t, 0, len(admission.GetQueues()))
+}
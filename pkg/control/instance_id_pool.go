@@ -0,0 +1,204 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// RIC Request Instance IDs are allocated per RAN name and E2 subscriptions are
+// identified by RAN name and instance id. RMR routes of RIC Indications are
+// however created per instance id, so an id of subscription having RMR route
+// is taken from RIC wide free ids and is not used by any other E2 node while
+// it is allocated. Routing of RIC Indications stays then unambiguous.
+// Subscriptions restored from db without per RAN flag keep RIC wide ids.
+// When perRanInstanceIdStart is configured, subscriptions without RMR route
+// get ids from range perRanInstanceIdStart-65534 and subscriptions with RMR
+// route get ids below it.
+//-----------------------------------------------------------------------------
+
+const maxInstanceId uint32 = 65534
+
+var perRanInstanceIdStart atomic.Uint32 // 0 means that the whole range is shared, read while config is reloaded
+
+//-----------------------------------------------------------------------------
+// Identifies E2 subscription by its instance id. RAN name is empty when
+// instance id is RIC wide.
+//-----------------------------------------------------------------------------
+type e2SubsKey struct {
+	ranName string
+	subId   uint32
+}
+
+func (k e2SubsKey) String() string {
+	if k.ranName == "" {
+		return strconv.FormatUint(uint64(k.subId), 10)
+	}
+	return k.ranName + "/" + strconv.FormatUint(uint64(k.subId), 10)
+}
+
+func ranNameOf(meid *xapp.RMRMeid) string {
+	if meid == nil {
+		return ""
+	}
+	return meid.RanName
+}
+
+func newE2SubsKey(subs *Subscription) e2SubsKey {
+	if subs.PerRanInstanceId {
+		return e2SubsKey{ranName: subs.Meid.RanName, subId: subs.ReqId.InstanceId}
+	}
+	return e2SubsKey{subId: subs.ReqId.InstanceId}
+}
+
+//-----------------------------------------------------------------------------
+// Bitmap of instance ids allocated in an E2 node. Ids are allocated round
+// robin so that a released id is not reused immediately.
+//-----------------------------------------------------------------------------
+type instanceIdPool struct {
+	allocated []uint64
+	next      uint32
+	count     int
+}
+
+func newInstanceIdPool() *instanceIdPool {
+	return &instanceIdPool{allocated: make([]uint64, maxInstanceId/64+1)}
+}
+
+func (p *instanceIdPool) isAllocated(subId uint32) bool {
+	return p.allocated[subId/64]&(1<<(subId%64)) != 0
+}
+
+func (p *instanceIdPool) reserve(subId uint32) {
+	if p.isAllocated(subId) == false {
+		p.allocated[subId/64] |= 1 << (subId % 64)
+		p.count++
+	}
+}
+
+func (p *instanceIdPool) release(subId uint32) {
+	if p.isAllocated(subId) == true {
+		p.allocated[subId/64] &^= 1 << (subId % 64)
+		p.count--
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Allocates next free id from range first-maxInstanceId. Ids for which
+// inUse returns true are skipped. Fully allocated words are skipped at once.
+//-----------------------------------------------------------------------------
+func (p *instanceIdPool) allocate(first uint32, inUse func(uint32) bool) (uint32, bool) {
+	size := maxInstanceId - first + 1
+	subId := p.next
+	for checked := uint32(0); checked < size; {
+		if subId < first || subId > maxInstanceId {
+			subId = first
+		}
+		if subId%64 == 0 && subId+63 <= maxInstanceId && p.allocated[subId/64] == ^uint64(0) {
+			subId += 64
+			checked += 64
+			continue
+		}
+		if p.isAllocated(subId) == false && inUse(subId) == false {
+			p.reserve(subId)
+			p.next = subId + 1
+			return subId, true
+		}
+		subId++
+		checked++
+	}
+	return 0, false
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) allocateSubId(ranName string, rmrRouted bool) (uint32, error) {
+	r.releaseQuarantinedSubIds(time.Now())
+	pool := r.getShard(ranName).idPool
+	first := perRanInstanceIdStart.Load()
+	if rmrRouted == false {
+		subId, ok := pool.allocate(max(first, 1), r.isRicWideIdInUse)
+		if ok == false {
+			return 0, fmt.Errorf("Registry: Failed to reserve subscription no free ids for ranName %s", ranName)
+		}
+		r.perRanIdUse[subId]++
+		return subId, nil
+	}
+	for i := len(r.subIds); i > 0; i-- {
+		subId := r.subIds[0]
+		r.subIds = r.subIds[1:]
+		if r.perRanIdUse[subId] > 0 || (first != 0 && subId >= first) {
+			r.subIds = append(r.subIds, subId)
+			continue
+		}
+		pool.reserve(subId)
+		r.perRanIdUse[subId]++
+		r.routedIds[subId] = ranName
+		return subId, nil
+	}
+	return 0, fmt.Errorf("Registry: Failed to reserve subscription no free ids")
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) releaseSubId(subs *Subscription) {
+	r.releaseE2SubsKey(newE2SubsKey(subs))
+}
+
+func (r *Registry) releaseE2SubsKey(key e2SubsKey) {
+	if key.ranName == "" {
+		r.subIds = append(r.subIds, key.subId)
+		return
+	}
+	if shard := r.findShard(key.ranName); shard != nil && shard.idPool.isAllocated(key.subId) {
+		shard.idPool.release(key.subId)
+		if r.perRanIdUse[key.subId]--; r.perRanIdUse[key.subId] <= 0 {
+			delete(r.perRanIdUse, key.subId)
+		}
+	}
+	if ranName, ok := r.routedIds[key.subId]; ok && ranName == key.ranName {
+		delete(r.routedIds, key.subId)
+		r.subIds = append(r.subIds, key.subId)
+	}
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) isRicWideIdInUse(subId uint32) bool {
+	if _, ok := r.routedIds[subId]; ok {
+		return true
+	}
+	if _, ok := r.register[subId]; ok {
+		return true
+	}
+	if _, ok := r.e2Cleanups[e2SubsKey{subId: subId}]; ok {
+		return true
+	}
+	_, ok := r.quarantine[e2SubsKey{subId: subId}]
+	return ok
+}
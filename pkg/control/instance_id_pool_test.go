@@ -0,0 +1,253 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceIdPool(t *testing.T) {
+	pool := newInstanceIdPool()
+	notInUse := func(uint32) bool { return false }
+
+	subId, ok := pool.allocate(100, notInUse)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(100), subId)
+	subId, ok = pool.allocate(100, notInUse)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(101), subId)
+
+	// Released id is not reused immediately
+	pool.release(100)
+	subId, _ = pool.allocate(100, notInUse)
+	assert.Equal(t, uint32(102), subId)
+
+	// Ids in use elsewhere are skipped
+	subId, _ = pool.allocate(100, func(id uint32) bool { return id == 103 })
+	assert.Equal(t, uint32(104), subId)
+	assert.Equal(t, 3, pool.count)
+
+	// Allocation wraps around and all ids of range can be allocated
+	pool = newInstanceIdPool()
+	first := maxInstanceId - 200
+	for i := uint32(0); i <= 200; i++ {
+		_, ok = pool.allocate(first, notInUse)
+		assert.True(t, ok)
+	}
+	_, ok = pool.allocate(first, notInUse)
+	assert.False(t, ok)
+	pool.release(first + 10)
+	subId, ok = pool.allocate(first, notInUse)
+	assert.True(t, ok)
+	assert.Equal(t, first+10, subId)
+}
+
+func TestPerRanInstanceIds(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	subReqMsg := &e2ap.E2APSubscriptionRequest{}
+
+	// Same id is allocated in different E2 nodes for subscriptions without RMR route
+	subs1, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, false, false)
+	assert.Nil(t, err)
+	subs2, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_2", "xapp1"), subReqMsg, false, false)
+	assert.Nil(t, err)
+	assert.True(t, subs1.PerRanInstanceId)
+	assert.Equal(t, uint32(1), subs1.ReqId.InstanceId)
+	assert.Equal(t, uint32(1), subs2.ReqId.InstanceId)
+	registry.addSubs(subs1)
+	registry.addSubs(subs2)
+
+	// Subscription with RMR route gets id which is not used in any E2 node
+	subs3, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, false, true)
+	assert.Nil(t, err)
+	assert.True(t, subs3.PerRanInstanceId)
+	assert.Equal(t, uint32(2), subs3.ReqId.InstanceId)
+	assert.Equal(t, "RAN_NAME_1", registry.routedIds[2])
+	registry.addSubs(subs3)
+	assert.Equal(t, 3, registry.getSubsCount())
+	assert.Equal(t, subs3, registry.GetSubscription(2))
+	assert.Nil(t, registry.GetSubscription(1))
+
+	// Id having RMR route is not allocated in other E2 node
+	subs4, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_2", "xapp2"), subReqMsg, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), subs4.ReqId.InstanceId)
+	registry.addSubs(subs4)
+
+	subs, err := registry.GetE2NodeSubscription("RAN_NAME_2", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, subs2, subs)
+	_, err = registry.GetE2NodeSubscription("RAN_NAME_2", 2)
+	assert.NotNil(t, err)
+	_, err = registry.GetE2NodeSubscription("RAN_NAME_3", 1)
+	assert.NotNil(t, err)
+
+	// Released id of subscription without RMR route is not returned to RIC wide ids
+	assert.True(t, registry.deleteSubs(subs1))
+	registry.releaseSubId(subs1)
+	assert.Equal(t, 65533, len(registry.subIds))
+	assert.Equal(t, 1, registry.perRanIdUse[1])
+	assert.False(t, registry.getShard("RAN_NAME_1").idPool.isAllocated(1))
+
+	// Released id of subscription with RMR route is free again RIC wide
+	assert.True(t, registry.deleteSubs(subs3))
+	registry.releaseSubId(subs3)
+	assert.Equal(t, 65534, len(registry.subIds))
+	assert.Equal(t, uint32(2), registry.subIds[len(registry.subIds)-1])
+	assert.Equal(t, 0, len(registry.routedIds))
+	assert.Nil(t, registry.GetSubscription(2))
+}
+
+func TestRestoreRegister(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+
+	subs := &Subscription{Meid: &xapp.RMRMeid{RanName: "RAN_NAME_1"}, PerRanInstanceId: true}
+	subs.ReqId.InstanceId = 1
+	routedSubs := &Subscription{Meid: &xapp.RMRMeid{RanName: "RAN_NAME_1"}, PerRanInstanceId: true, RMRRouteCreated: true}
+	routedSubs.ReqId.InstanceId = 2
+	ricWideSubs := &Subscription{Meid: &xapp.RMRMeid{RanName: "RAN_NAME_2"}}
+	ricWideSubs.ReqId.InstanceId = 3
+	registry.restoreRegister(map[uint32]*Subscription{3: ricWideSubs},
+		map[e2SubsKey]*Subscription{newE2SubsKey(subs): subs, newE2SubsKey(routedSubs): routedSubs})
+	found, err := registry.GetE2NodeSubscription("RAN_NAME_1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, subs, found)
+	found, err = registry.GetE2NodeSubscription("RAN_NAME_3", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, ricWideSubs, found)
+	assert.Equal(t, 1, registry.getShard("RAN_NAME_2").getSubsCount())
+	assert.Equal(t, 3, registry.getSubsCount())
+	assert.Equal(t, routedSubs, registry.GetSubscription(2))
+
+	// Ids of routed and RIC wide subscriptions are not allocated in other E2 nodes
+	subId, err := registry.allocateSubId("RAN_NAME_2", false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), subId)
+	subId, err = registry.allocateSubId("RAN_NAME_2", false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), subId)
+}
+
+func TestE2SubSdlKey(t *testing.T) {
+	subs := &Subscription{Meid: &xapp.RMRMeid{RanName: "RAN_NAME_1"}}
+	assert.Equal(t, "RAN_NAME_1/60000", e2SubSdlKey(60000, subs))
+	subs.PerRanInstanceId = true
+	assert.Equal(t, "RAN_NAME_1/60000", e2SubSdlKey(60000, subs))
+
+	key, err := parseE2SubsSdlKey("RAN_NAME_1/60000")
+	assert.Nil(t, err)
+	assert.Equal(t, e2SubsKey{ranName: "RAN_NAME_1", subId: 60000}, key)
+}
+
+//-----------------------------------------------------------------------------
+// TestPerRanInstanceIdStart
+//
+//   1. SubReq without RMR route gets instance id from the configured start
+//   2. SubReqs with RMR route get instance ids below the start until they run out
+//
+//-----------------------------------------------------------------------------
+func TestPerRanInstanceIdStart(t *testing.T) {
+	CaseBegin("TestPerRanInstanceIdStart")
+
+	setTestConfig(t, func(config *testConfig) { config.perRanInstanceIdStart = 100 })
+	registry := createTestRegistry()
+
+	// Ids without RMR route are allocated from the configured start and ids with RMR route below it
+	subId, err := registry.allocateSubId("RAN_NAME_1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(100), subId)
+	subId, err = registry.allocateSubId("RAN_NAME_1", true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), subId)
+	for i := 2; i < 100; i++ {
+		_, err = registry.allocateSubId("RAN_NAME_2", true)
+		assert.Nil(t, err)
+	}
+	_, err = registry.allocateSubId("RAN_NAME_2", true)
+	assert.NotNil(t, err)
+}
+
+//-----------------------------------------------------------------------------
+// TestReadAllSubscriptionsFromSdlMigratesKeys
+//
+//   1. Subscription is stored in db by earlier version with instance id only as key
+//   2. Restart, subscription is read with RIC wide instance id and moved under key with RAN name
+//   3. Restart, subscription is read again and it is removed from db with the new key
+//
+//-----------------------------------------------------------------------------
+func TestReadAllSubscriptionsFromSdlMigratesKeys(t *testing.T) {
+	CaseBegin("TestReadAllSubscriptionsFromSdlMigratesKeys")
+
+	c := createTestControl(createTestRegistry(), nil)
+
+	// Subscription stored by earlier version with instance id only as key
+	subscriptionInfo := SubscriptionInfo{Valid: true, Meid: xapp.RMRMeid{RanName: "RAN_NAME_1"}}
+	subscriptionInfo.ReqId.InstanceId = 1
+	jsonData, err := json.Marshal(subscriptionInfo)
+	assert.Nil(t, err)
+	assert.Nil(t, c.e2SubsDb.Set(e2SubSdlNs, "1", jsonData))
+
+	subIds, register, ranRegister, err := c.ReadAllSubscriptionsFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 65533, len(subIds))
+	assert.Equal(t, 0, len(ranRegister))
+	subs := register[1]
+	assert.NotNil(t, subs)
+	assert.False(t, subs.PerRanInstanceId)
+	keys, err := c.e2SubsDb.GetAll(e2SubSdlNs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"RAN_NAME_1/1"}, keys)
+
+	// Migrated subscription is read again with the same RIC wide id and removed with the new key
+	_, register, _, err = c.ReadAllSubscriptionsFromSdl()
+	assert.Nil(t, err)
+	assert.NotNil(t, register[1])
+	c.RemoveSubscriptionFromDb(subs)
+	keys, err = c.e2SubsDb.GetAll(e2SubSdlNs)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+}
+
+//-----------------------------------------------------------------------------
+// TestRemoveSubscriptionsWithSubIdFromSdl
+//
+// Subscriptions with the instance id are removed from db in all E2 nodes
+//
+//-----------------------------------------------------------------------------
+func TestRemoveSubscriptionsWithSubIdFromSdl(t *testing.T) {
+	CaseBegin("TestRemoveSubscriptionsWithSubIdFromSdl")
+
+	c := createTestControl(createTestRegistry(), nil)
+	for _, key := range []string{"RAN_NAME_1/1", "RAN_NAME_2/1", "RAN_NAME_1/2"} {
+		assert.Nil(t, c.e2SubsDb.Set(e2SubSdlNs, key, []byte("{}")))
+	}
+
+	assert.Nil(t, c.RemoveSubscriptionsWithSubIdFromSdl(1))
+	keys, err := c.e2SubsDb.GetAll(e2SubSdlNs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"RAN_NAME_1/2"}, keys)
+	assert.Nil(t, c.RemoveSubscriptionsWithSubIdFromSdl(3))
+}
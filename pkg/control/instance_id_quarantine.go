@@ -0,0 +1,140 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Instance id of deleted E2 subscription is kept reserved for quarantine time
+// before it is allocated again. Late RIC Indications and responses of the
+// deleted subscription cannot then reach a new owner of the id. End times of
+// quarantines are stored in db so that quarantine continues after restart.
+//-----------------------------------------------------------------------------
+// Replaced as a whole when config is reloaded. 0 means that ids are released immediately
+var instanceIdQuarantineTime atomic.Pointer[time.Duration]
+
+func init() {
+	setInstanceIdQuarantineTime(0)
+}
+
+func getInstanceIdQuarantineTime() time.Duration {
+	return *instanceIdQuarantineTime.Load()
+}
+
+func setInstanceIdQuarantineTime(quarantineTime time.Duration) {
+	instanceIdQuarantineTime.Store(&quarantineTime)
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) quarantineSubId(subs *Subscription, now time.Time) {
+	key := newE2SubsKey(subs)
+	quarantineTime := getInstanceIdQuarantineTime()
+	if quarantineTime == 0 {
+		r.releaseE2SubsKey(key)
+		return
+	}
+	until := now.Add(quarantineTime)
+	r.quarantine[key] = until
+	r.quarantineQueue = append(r.quarantineQueue, key)
+	if err := r.WriteQuarantineToSdl(key, until); err != nil {
+		xapp.Logger.Error("%v", err)
+	}
+	xapp.Logger.Debug("Registry: Instance id quarantined until %v. subId=%v, ranName=%v", until, key.subId, key.ranName)
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked. Quarantine time is the
+// same for all ids, so the queue is in order of quarantine end.
+//-------------------------------------------------------------------
+func (r *Registry) releaseQuarantinedSubIds(now time.Time) {
+	var released []e2SubsKey
+	for len(r.quarantineQueue) > 0 {
+		key := r.quarantineQueue[0]
+		if now.Before(r.quarantine[key]) {
+			break
+		}
+		r.quarantineQueue = r.quarantineQueue[1:]
+		delete(r.quarantine, key)
+		r.releaseE2SubsKey(key)
+		released = append(released, key)
+	}
+	if len(released) > 0 {
+		if err := r.RemoveQuarantineFromSdl(released); err != nil {
+			xapp.Logger.Error("%v", err)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Restores quarantines read from db after subscriptions are restored.
+// Ids whose quarantine has ended are released.
+//-------------------------------------------------------------------
+func (r *Registry) restoreQuarantine(quarantine map[e2SubsKey]time.Time, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.quarantine = make(map[e2SubsKey]time.Time)
+	r.quarantineQueue = nil
+	var released []e2SubsKey
+	for key, until := range quarantine {
+		if now.Before(until) == false || r.reserveE2SubsKey(key) == false {
+			released = append(released, key)
+			continue
+		}
+		r.quarantine[key] = until
+		r.quarantineQueue = append(r.quarantineQueue, key)
+	}
+	sort.Slice(r.quarantineQueue, func(i, j int) bool {
+		return r.quarantine[r.quarantineQueue[i]].Before(r.quarantine[r.quarantineQueue[j]])
+	})
+	if len(released) > 0 {
+		if err := r.RemoveQuarantineFromSdl(released); err != nil {
+			xapp.Logger.Error("%v", err)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Reserves free id. Returns false if id is not free.
+//-------------------------------------------------------------------
+func (r *Registry) reserveE2SubsKey(key e2SubsKey) bool {
+	if key.ranName == "" {
+		subIds, err := removeNumber(r.subIds, key.subId)
+		if err != nil {
+			return false
+		}
+		r.subIds = subIds
+		return true
+	}
+	pool := r.getShard(key.ranName).idPool
+	if pool.isAllocated(key.subId) {
+		return false
+	}
+	pool.reserve(key.subId)
+	r.perRanIdUse[key.subId]++
+	return true
+}
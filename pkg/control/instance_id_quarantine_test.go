@@ -0,0 +1,141 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+//-----------------------------------------------------------------------------
+// TestInstanceIdQuarantine
+//
+//   1. Subscription with RMR route is deleted and its instance id quarantined in db
+//   2. Instance id is not released before quarantine time has passed
+//   3. Instance id is released to RIC wide ids and removed from db
+//
+//-----------------------------------------------------------------------------
+func TestInstanceIdQuarantine(t *testing.T) {
+	CaseBegin("TestInstanceIdQuarantine")
+
+	setTestConfig(t, func(config *testConfig) { config.instanceIdQuarantineTime = time.Minute })
+	registry := createTestRegistry()
+	now := time.Now()
+
+	subs, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), &e2ap.E2APSubscriptionRequest{}, false, true)
+	assert.Nil(t, err)
+	subId := subs.ReqId.InstanceId
+	registry.quarantineSubId(subs, now)
+	assert.Equal(t, 65533, len(registry.subIds))
+	assert.True(t, registry.isRicWideIdInUse(subId))
+
+	// Id is not released before quarantine has ended
+	registry.releaseQuarantinedSubIds(now.Add(59 * time.Second))
+	assert.Equal(t, 65533, len(registry.subIds))
+	quarantine, err := registry.ReadAllQuarantinesFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(quarantine))
+	assert.True(t, quarantine[e2SubsKey{ranName: "RAN_NAME_1", subId: subId}].Equal(now.Add(time.Minute)))
+
+	registry.releaseQuarantinedSubIds(now.Add(time.Minute))
+	assert.Equal(t, 65534, len(registry.subIds))
+	assert.Equal(t, subId, registry.subIds[len(registry.subIds)-1])
+	assert.False(t, registry.isRicWideIdInUse(subId))
+	quarantine, _ = registry.ReadAllQuarantinesFromSdl()
+	assert.Equal(t, 0, len(quarantine))
+}
+
+//-----------------------------------------------------------------------------
+// TestInstanceIdQuarantineDisabled
+//
+// Instance id of deleted subscription is released at once by default
+//
+//-----------------------------------------------------------------------------
+func TestInstanceIdQuarantineDisabled(t *testing.T) {
+	CaseBegin("TestInstanceIdQuarantineDisabled")
+
+	registry := createTestRegistry()
+
+	subs, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), &e2ap.E2APSubscriptionRequest{}, false, true)
+	assert.Nil(t, err)
+	registry.quarantineSubId(subs, time.Now())
+	assert.Equal(t, 65534, len(registry.subIds))
+	quarantine, _ := registry.ReadAllQuarantinesFromSdl()
+	assert.Equal(t, 0, len(quarantine))
+}
+
+//-----------------------------------------------------------------------------
+// TestRestoreInstanceIdQuarantine
+//
+//   1. Quarantines of RIC wide and per E2 node instance ids are stored in db
+//   2. Restart, expired quarantine is released and removed from db
+//   3. Quarantined instance ids are not allocated
+//   4. Instance ids are released when quarantines end
+//
+//-----------------------------------------------------------------------------
+func TestRestoreInstanceIdQuarantine(t *testing.T) {
+	CaseBegin("TestRestoreInstanceIdQuarantine")
+
+	setTestConfig(t, func(config *testConfig) { config.instanceIdQuarantineTime = time.Minute })
+	registry := createTestRegistry()
+	now := time.Now()
+
+	registry.WriteQuarantineToSdl(e2SubsKey{subId: 1}, now.Add(30*time.Second))
+	registry.WriteQuarantineToSdl(e2SubsKey{subId: 2}, now.Add(-time.Second))
+	registry.WriteQuarantineToSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: 60000}, now.Add(10*time.Second))
+
+	// Restart
+	restarted := createTestRegistry()
+	restarted.quarantineDb = registry.quarantineDb
+	quarantine, err := restarted.ReadAllQuarantinesFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(quarantine))
+	restarted.restoreQuarantine(quarantine, now)
+
+	// Expired quarantine is released and removed from db
+	assert.Equal(t, []e2SubsKey{{ranName: "RAN_NAME_1", subId: 60000}, {subId: 1}}, restarted.quarantineQueue)
+	quarantine, _ = restarted.ReadAllQuarantinesFromSdl()
+	assert.Equal(t, 2, len(quarantine))
+
+	subId, err := restarted.allocateSubId("RAN_NAME_2", true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), subId)
+	subId, err = restarted.allocateSubId("RAN_NAME_1", false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), subId)
+
+	restarted.releaseQuarantinedSubIds(now.Add(30 * time.Second))
+	assert.Equal(t, 0, len(restarted.quarantineQueue))
+	assert.False(t, restarted.getShard("RAN_NAME_1").idPool.isAllocated(60000))
+	assert.Equal(t, uint32(1), restarted.subIds[len(restarted.subIds)-1])
+}
+
+func TestParseQuarantineSdlKey(t *testing.T) {
+	key, err := parseE2SubsSdlKey("RAN_NAME_1/60000")
+	assert.Nil(t, err)
+	assert.Equal(t, e2SubsKey{ranName: "RAN_NAME_1", subId: 60000}, key)
+	key, err = parseE2SubsSdlKey("1")
+	assert.Nil(t, err)
+	assert.Equal(t, e2SubsKey{subId: 1}, key)
+	_, err = parseE2SubsSdlKey("65535")
+	assert.NotNil(t, err)
+}
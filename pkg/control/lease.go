@@ -0,0 +1,175 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gorilla/mux"
+)
+
+//-----------------------------------------------------------------------------
+// Leases of REST subscriptions. xApp can request a lease when it creates a
+// REST subscription. The lease must be renewed before it expires, otherwise
+// the REST subscription is deleted in the same way as if xApp had requested
+// deletion. This removes E2 subscriptions of xApps which have crashed
+// without unsubscribing.
+//-----------------------------------------------------------------------------
+
+var errRESTSubscriptionNotFound = errors.New("Registry: No valid subscription found")
+
+type RESTSubscriptionLeaseInfo struct {
+	SubscriptionId  string
+	LeaseDuration_s int64
+	LeaseExpiry     time.Time
+}
+
+func (r *RESTSubscription) leaseInfo(restSubId string) *RESTSubscriptionLeaseInfo {
+	return &RESTSubscriptionLeaseInfo{
+		SubscriptionId:  restSubId,
+		LeaseDuration_s: int64(r.leaseDuration / time.Second),
+		LeaseExpiry:     r.leaseExpiry,
+	}
+}
+
+//-------------------------------------------------------------------
+// Sets or renews lease of REST subscription. Zero duration renews
+// the lease with its previous duration.
+//-------------------------------------------------------------------
+func (r *Registry) SetRESTSubscriptionLease(restSubId string, duration time.Duration, now time.Time) (*RESTSubscription, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	restSubscription, ok := r.restSubscriptions[restSubId]
+	if !ok {
+		return nil, fmt.Errorf("%w with restSubId=%v", errRESTSubscriptionNotFound, restSubId)
+	}
+	if restSubscription.SubDelReqOngoing == true {
+		return nil, fmt.Errorf("Registry: REST subscription restSubId=%v is being deleted", restSubId)
+	}
+	if duration == 0 {
+		duration = restSubscription.leaseDuration
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("Registry: REST subscription restSubId=%v has no lease", restSubId)
+	}
+	restSubscription.leaseDuration = duration
+	restSubscription.leaseExpiry = now.Add(duration)
+	xapp.Logger.Debug("Registry: Lease of restSubId=%v set to expire %v", restSubId, restSubscription.leaseExpiry.Format(time.RFC3339))
+	return restSubscription, nil
+}
+
+//-------------------------------------------------------------------
+// Returns REST subscriptions whose lease has expired and which are
+// not being processed
+//-------------------------------------------------------------------
+func (r *Registry) GetExpiredRESTSubscriptionLeases(now time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	expired := []string{}
+	for restSubId, restSubscription := range r.restSubscriptions {
+		if restSubscription.leaseDuration == 0 || restSubscription.SubReqOngoing == true || restSubscription.SubDelReqOngoing == true {
+			continue
+		}
+		if now.After(restSubscription.leaseExpiry) {
+			expired = append(expired, restSubId)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+func (c *Control) RenewRESTSubscriptionLease(restSubId string, duration time.Duration) (*RESTSubscriptionLeaseInfo, error) {
+	restSubscription, err := c.registry.SetRESTSubscriptionLease(restSubId, duration, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	c.WriteRESTSubscriptionToDb(restSubId, restSubscription)
+	return restSubscription.leaseInfo(restSubId), nil
+}
+
+//-------------------------------------------------------------------
+// Renews lease of REST subscription. New lease duration can be given in
+// LeaseDuration_s field of the request body. Otherwise previous duration
+// is used.
+//-------------------------------------------------------------------
+func (c *Control) RenewRESTSubscriptionLeaseHandler(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("RenewRESTSubscriptionLeaseHandler() called")
+
+	restSubId := mux.Vars(r)["subscriptionId"]
+	leaseField := struct{ LeaseDuration_s int64 }{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		xapp.Logger.Error("RenewRESTSubscriptionLeaseHandler() reading body failed: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &leaseField); err != nil || leaseField.LeaseDuration_s < 0 {
+			xapp.Logger.Error("RenewRESTSubscriptionLeaseHandler() invalid request body: %s", string(body))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	leaseInfo, err := c.RenewRESTSubscriptionLease(restSubId, time.Duration(leaseField.LeaseDuration_s)*time.Second)
+	if err != nil {
+		xapp.Logger.Error("RenewRESTSubscriptionLeaseHandler() %s", err.Error())
+		if errors.Is(err, errRESTSubscriptionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(leaseInfo); err != nil {
+		xapp.Logger.Error("RenewRESTSubscriptionLeaseHandler() w.Write failure: %s", err.Error())
+	}
+}
+
+//-------------------------------------------------------------------
+// Deletes REST subscriptions whose lease has expired
+//-------------------------------------------------------------------
+func (c *Control) ExpireRESTSubscriptionLeases(now time.Time) {
+	for _, restSubId := range c.registry.GetExpiredRESTSubscriptionLeases(now) {
+		xapp.Logger.Info("Lease of REST subscription %s expired. Deleting subscription", restSubId)
+		c.UpdateCounter(cRestSubLeaseExpired)
+		c.RESTSubscriptionDeleteHandler(restSubId)
+	}
+}
+
+func (c *Control) RunLeaseReaper() {
+	for {
+		select {
+		case <-time.After(subscriptionLeaseCheckInterval):
+		case <-c.rootContext().Done():
+			return
+		}
+		c.ExpireRESTSubscriptionLeases(time.Now())
+	}
+}
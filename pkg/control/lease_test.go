@@ -0,0 +1,99 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createLeaseTestRESTSubscription(registry *Registry, restSubId string) *RESTSubscription {
+	xappServiceName := "xapp1"
+	endpoint := "xapp1:4560"
+	meid := "RAN_NAME_1"
+	restSubs := registry.CreateRESTSubscription(&restSubId, &xappServiceName, &endpoint, &meid)
+	restSubs.SubReqOngoing = false
+	return restSubs
+}
+
+func TestRESTSubscriptionLease(t *testing.T) {
+
+	registry := new(Registry)
+	registry.Initialize()
+	createLeaseTestRESTSubscription(registry, "restSubId1")
+	restSubs2 := createLeaseTestRESTSubscription(registry, "restSubId2")
+	now := time.Now()
+
+	// Unknown subscription
+	_, err := registry.SetRESTSubscriptionLease("restSubId3", 10*time.Second, now)
+	assert.True(t, errors.Is(err, errRESTSubscriptionNotFound))
+
+	// Subscription without lease can not be renewed without duration
+	_, err = registry.SetRESTSubscriptionLease("restSubId1", 0, now)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(registry.GetExpiredRESTSubscriptionLeases(now.Add(time.Hour))))
+
+	restSubs, err := registry.SetRESTSubscriptionLease("restSubId1", 10*time.Second, now)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(10*time.Second), restSubs.leaseExpiry)
+	assert.Equal(t, int64(10), restSubs.leaseInfo("restSubId1").LeaseDuration_s)
+	_, err = registry.SetRESTSubscriptionLease("restSubId2", 20*time.Second, now)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, len(registry.GetExpiredRESTSubscriptionLeases(now.Add(5*time.Second))))
+	assert.Equal(t, []string{"restSubId1"}, registry.GetExpiredRESTSubscriptionLeases(now.Add(11*time.Second)))
+	assert.Equal(t, []string{"restSubId1", "restSubId2"}, registry.GetExpiredRESTSubscriptionLeases(now.Add(21*time.Second)))
+
+	// Renew with previous duration
+	restSubs, err = registry.SetRESTSubscriptionLease("restSubId1", 0, now.Add(5*time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(15*time.Second), restSubs.leaseExpiry)
+	assert.Equal(t, 0, len(registry.GetExpiredRESTSubscriptionLeases(now.Add(11*time.Second))))
+
+	// Subscriptions which are being processed are not expired
+	restSubs2.SubDelReqOngoing = true
+	assert.Equal(t, []string{"restSubId1"}, registry.GetExpiredRESTSubscriptionLeases(now.Add(21*time.Second)))
+	_, err = registry.SetRESTSubscriptionLease("restSubId2", 0, now)
+	assert.NotNil(t, err)
+}
+
+func TestRESTSubscriptionLeasePersistence(t *testing.T) {
+
+	c := &Control{
+		Counters:   mainCtrl.c.Counters,
+		restSubsDb: CreateSdlNsMock(restSubSdlNs),
+	}
+	c.restDuplicateCtrl = new(DuplicateCtrl)
+	c.restDuplicateCtrl.Init()
+	c.registry = new(Registry)
+	c.registry.Initialize()
+
+	restSubs := createLeaseTestRESTSubscription(c.registry, "restSubId1")
+	_, err := c.registry.SetRESTSubscriptionLease("restSubId1", 30*time.Second, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, c.WriteRESTSubscriptionToSdl("restSubId1", restSubs))
+
+	readRestSubs, err := c.ReadRESTSubscriptionFromSdl("restSubId1")
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, readRestSubs.leaseDuration)
+	assert.True(t, restSubs.leaseExpiry.Equal(readRestSubs.leaseExpiry))
+}
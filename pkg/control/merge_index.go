@@ -0,0 +1,174 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+)
+
+//-----------------------------------------------------------------------------
+// Secondary index of E2 subscriptions for finding merge candidates. Key is
+// RAN name, RAN function id and hash of event trigger and action list.
+// Subscriptions with the same key are candidates only, IsMergeable makes the
+// final decision.
+//-----------------------------------------------------------------------------
+type subsMergeKey struct {
+	RanName    string
+	FunctionId e2ap.FunctionId
+	Hash       uint64
+}
+
+func newSubsMergeKey(ranName string, subReqMsg *e2ap.E2APSubscriptionRequest) subsMergeKey {
+	hash := fnv.New64a()
+	buf := make([]byte, 8)
+	writeUint64 := func(v uint64) {
+		binary.BigEndian.PutUint64(buf, v)
+		hash.Write(buf)
+	}
+	writeOctetString := func(o *e2ap.OctetString) {
+		length := o.Length
+		if length > uint64(len(o.Data)) {
+			length = uint64(len(o.Data))
+		}
+		writeUint64(length)
+		hash.Write(o.Data[:length])
+	}
+	writeBool := func(v bool) {
+		if v {
+			writeUint64(1)
+		} else {
+			writeUint64(0)
+		}
+	}
+
+	// Actions are hashed in ActionId order as order of actions does not matter in merging
+	actions := make([]*e2ap.ActionToBeSetupItem, 0, len(subReqMsg.ActionSetups))
+	for i := range subReqMsg.ActionSetups {
+		actions = append(actions, &subReqMsg.ActionSetups[i])
+	}
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].ActionId < actions[j].ActionId })
+
+	writeOctetString(&subReqMsg.EventTriggerDefinition.Data)
+	writeUint64(uint64(len(actions)))
+	for _, action := range actions {
+		writeUint64(action.ActionId)
+		writeUint64(action.ActionType)
+		writeBool(action.RicActionDefinitionPresent)
+		writeOctetString(&action.ActionDefinitionChoice.Data)
+		writeBool(action.SubsequentAction.Present)
+		writeUint64(action.SubsequentAction.Type)
+		writeUint64(action.SubsequentAction.TimetoWait)
+	}
+	return subsMergeKey{RanName: ranName, FunctionId: subReqMsg.FunctionId, Hash: hash.Sum64()}
+}
+
+//-------------------------------------------------------------------
+// Merge index is kept in shard of the E2 node
+//-------------------------------------------------------------------
+func (r *Registry) addToMergeIndex(subs *Subscription) {
+	if subs.SubReqMsg == nil || subs.Meid == nil {
+		return
+	}
+	shard := r.getShard(subs.Meid.RanName)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.removeFromMergeIndex(subs)
+	shard.addToMergeIndex(subs)
+}
+
+func (r *Registry) removeFromMergeIndex(subs *Subscription) {
+	shard := r.findShard(ranNameOf(subs.Meid))
+	if shard == nil {
+		return
+	}
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	shard.removeFromMergeIndex(subs)
+}
+
+//-------------------------------------------------------------------
+// Must be called with shard mutex locked
+//-------------------------------------------------------------------
+func (s *registryShard) addToMergeIndex(subs *Subscription) {
+	key := newSubsMergeKey(subs.Meid.RanName, subs.SubReqMsg)
+	candidates, ok := s.mergeIndex[key]
+	if ok == false {
+		candidates = make(map[uint32]*Subscription)
+		s.mergeIndex[key] = candidates
+	}
+	candidates[subs.ReqId.InstanceId] = subs
+	s.mergeKeys[subs] = key
+}
+
+//-------------------------------------------------------------------
+// Must be called with shard mutex locked
+//-------------------------------------------------------------------
+func (s *registryShard) removeFromMergeIndex(subs *Subscription) {
+	key, ok := s.mergeKeys[subs]
+	if ok == false {
+		return
+	}
+	delete(s.mergeKeys, subs)
+	if candidates, ok := s.mergeIndex[key]; ok {
+		delete(candidates, subs.ReqId.InstanceId)
+		if len(candidates) == 0 {
+			delete(s.mergeIndex, key)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Index is rebuilt after subscriptions are read from db
+//-------------------------------------------------------------------
+func (r *Registry) rebuildMergeIndex() {
+	for _, shard := range r.getShards() {
+		shard.mutex.Lock()
+		shard.mergeIndex = make(map[subsMergeKey]map[uint32]*Subscription)
+		shard.mergeKeys = make(map[*Subscription]subsMergeKey)
+		for _, subs := range shard.register {
+			if subs.SubReqMsg != nil && subs.Meid != nil {
+				shard.addToMergeIndex(subs)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+//-------------------------------------------------------------------
+// Returns copy of candidates in instance id order, so that they can
+// be checked without shard mutex
+//-------------------------------------------------------------------
+func (r *Registry) getMergeCandidates(ranName string, subReqMsg *e2ap.E2APSubscriptionRequest) []*Subscription {
+	shard := r.findShard(ranName)
+	if shard == nil {
+		return nil
+	}
+	shard.mutex.Lock()
+	candidates := make([]*Subscription, 0, len(shard.mergeIndex[newSubsMergeKey(ranName, subReqMsg)]))
+	for _, subs := range shard.mergeIndex[newSubsMergeKey(ranName, subReqMsg)] {
+		candidates = append(candidates, subs)
+	}
+	shard.mutex.Unlock()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].ReqId.InstanceId < candidates[j].ReqId.InstanceId })
+	return candidates
+}
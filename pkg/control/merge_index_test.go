@@ -0,0 +1,241 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createMergeTestSubReqMsg(functionId e2ap.FunctionId, eventTrigger uint32) *e2ap.E2APSubscriptionRequest {
+	subReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: functionId}
+	subReqMsg.EventTriggerDefinition.Data.Data = make([]byte, 4)
+	binary.BigEndian.PutUint32(subReqMsg.EventTriggerDefinition.Data.Data, eventTrigger)
+	subReqMsg.EventTriggerDefinition.Data.Length = 4
+	action := e2ap.ActionToBeSetupItem{ActionId: 1, ActionType: e2ap.E2AP_ActionTypeReport, RicActionDefinitionPresent: true}
+	action.ActionDefinitionChoice.Data.Data = []byte{1, 2, 3}
+	action.ActionDefinitionChoice.Data.Length = 3
+	subReqMsg.ActionSetups = append(subReqMsg.ActionSetups, action)
+	return subReqMsg
+}
+
+func createMergeTestRegistry(subsCount int) *Registry {
+	registry := new(Registry)
+	registry.Initialize()
+	for i := 0; i < subsCount; i++ {
+		subs := &Subscription{
+			registry:  registry,
+			Meid:      &xapp.RMRMeid{RanName: fmt.Sprintf("RAN_NAME_%v", i%100)},
+			SubReqMsg: createMergeTestSubReqMsg(1, uint32(i)),
+			valid:     true,
+		}
+		subs.ReqId.InstanceId = registry.subIds[0]
+		registry.subIds = registry.subIds[1:]
+		subs.EpList.AddEndpoint(&xapp.RmrEndpoint{Addr: "xapp1", Port: 4560})
+		registry.addSubs(subs)
+		registry.addToMergeIndex(subs)
+	}
+	return registry
+}
+
+func getMergeIndexSize(registry *Registry) (int, int) {
+	keys, candidates := 0, 0
+	for _, shard := range registry.getShards() {
+		keys += len(shard.mergeKeys)
+		candidates += len(shard.mergeIndex)
+	}
+	return keys, candidates
+}
+
+func TestSubsMergeKey(t *testing.T) {
+	key := newSubsMergeKey("RAN_NAME_1", createMergeTestSubReqMsg(1, 1))
+	assert.Equal(t, key, newSubsMergeKey("RAN_NAME_1", createMergeTestSubReqMsg(1, 1)))
+	assert.NotEqual(t, key, newSubsMergeKey("RAN_NAME_2", createMergeTestSubReqMsg(1, 1)))
+	assert.NotEqual(t, key, newSubsMergeKey("RAN_NAME_1", createMergeTestSubReqMsg(2, 1)))
+	assert.NotEqual(t, key, newSubsMergeKey("RAN_NAME_1", createMergeTestSubReqMsg(1, 2)))
+
+	subReqMsg := createMergeTestSubReqMsg(1, 1)
+	subReqMsg.ActionSetups[0].ActionDefinitionChoice.Data.Data[2] = 4
+	assert.NotEqual(t, key, newSubsMergeKey("RAN_NAME_1", subReqMsg))
+
+	// Bytes beyond Length are not part of the key
+	subReqMsg = createMergeTestSubReqMsg(1, 1)
+	subReqMsg.EventTriggerDefinition.Data.Data = append(subReqMsg.EventTriggerDefinition.Data.Data, 9)
+	assert.Equal(t, key, newSubsMergeKey("RAN_NAME_1", subReqMsg))
+}
+
+func addMergeTestAction(subReqMsg *e2ap.E2APSubscriptionRequest, actionId uint64, actionDefinition byte) {
+	action := e2ap.ActionToBeSetupItem{ActionId: actionId, ActionType: e2ap.E2AP_ActionTypeReport, RicActionDefinitionPresent: true}
+	action.ActionDefinitionChoice.Data.Data = []byte{actionDefinition}
+	action.ActionDefinitionChoice.Data.Length = 1
+	subReqMsg.ActionSetups = append(subReqMsg.ActionSetups, action)
+}
+
+func TestSubsMergeKeyActionOrder(t *testing.T) {
+	subReqMsg1 := createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(subReqMsg1, 2, 20)
+	addMergeTestAction(subReqMsg1, 3, 30)
+
+	subReqMsg2 := createMergeTestSubReqMsg(1, 1)
+	subReqMsg2.ActionSetups = nil
+	addMergeTestAction(subReqMsg2, 3, 30)
+	addMergeTestAction(subReqMsg2, 2, 20)
+	subReqMsg2.ActionSetups = append(subReqMsg2.ActionSetups, subReqMsg1.ActionSetups[0])
+	assert.Equal(t, newSubsMergeKey("RAN_NAME_1", subReqMsg1), newSubsMergeKey("RAN_NAME_1", subReqMsg2))
+
+	// Same definitions under swapped ActionIds are different actions
+	subReqMsg2.ActionSetups[0].ActionId = 2
+	subReqMsg2.ActionSetups[1].ActionId = 3
+	assert.NotEqual(t, newSubsMergeKey("RAN_NAME_1", subReqMsg1), newSubsMergeKey("RAN_NAME_1", subReqMsg2))
+}
+
+func TestSubsIsMergeableMultipleActions(t *testing.T) {
+	subReqMsg := createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(subReqMsg, 2, 20)
+	addMergeTestAction(subReqMsg, 3, 30)
+	subs := &Subscription{
+		Meid:      &xapp.RMRMeid{RanName: "RAN_NAME_1"},
+		SubReqMsg: subReqMsg,
+		valid:     true,
+	}
+	trans := &TransactionXapp{}
+	trans.Meid = &xapp.RMRMeid{RanName: "RAN_NAME_1"}
+
+	// Identical actions
+	newSubReqMsg := createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	addMergeTestAction(newSubReqMsg, 3, 30)
+	assert.True(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// Identical actions in different order
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	newSubReqMsg.ActionSetups = nil
+	addMergeTestAction(newSubReqMsg, 3, 30)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	newSubReqMsg.ActionSetups = append(newSubReqMsg.ActionSetups, subReqMsg.ActionSetups[0])
+	assert.True(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// One action differs
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	addMergeTestAction(newSubReqMsg, 3, 31)
+	assert.False(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// Definitions under swapped ActionIds
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 30)
+	addMergeTestAction(newSubReqMsg, 3, 20)
+	assert.False(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// Duplicate ActionId
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	assert.False(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// Subset of actions
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	assert.False(t, subs.IsMergeable(trans, newSubReqMsg))
+
+	// Non REPORT action
+	subs.SubReqMsg.ActionSetups[1].ActionType = e2ap.E2AP_ActionTypeInsert
+	newSubReqMsg = createMergeTestSubReqMsg(1, 1)
+	addMergeTestAction(newSubReqMsg, 2, 20)
+	addMergeTestAction(newSubReqMsg, 3, 30)
+	newSubReqMsg.ActionSetups[1].ActionType = e2ap.E2AP_ActionTypeInsert
+	assert.False(t, subs.IsMergeable(trans, newSubReqMsg))
+}
+
+func TestMergeIndex(t *testing.T) {
+	registry := createMergeTestRegistry(300)
+	trans := createValidateTestTrans("RAN_NAME_5", "xapp2")
+
+	// Subscription 105 has RAN_NAME_5 and event trigger 105
+	subs, endPointFound := registry.findExistingSubs(trans, createMergeTestSubReqMsg(1, 105), SubscriptionSharingShared)
+	assert.NotNil(t, subs)
+	assert.False(t, endPointFound)
+	assert.Equal(t, "RAN_NAME_5", subs.Meid.RanName)
+	assert.Equal(t, 1, subs.EpList.Size())
+	joined, err := registry.joinSubs(subs, trans)
+	assert.Nil(t, err)
+	assert.True(t, joined)
+	assert.Equal(t, 2, subs.EpList.Size())
+
+	subs, endPointFound = registry.findExistingSubs(trans, createMergeTestSubReqMsg(1, 105), SubscriptionSharingShared)
+	assert.NotNil(t, subs)
+	assert.True(t, endPointFound)
+
+	subs, _ = registry.findExistingSubs(trans, createMergeTestSubReqMsg(1, 106), SubscriptionSharingShared)
+	assert.Nil(t, subs)
+	subs, _ = registry.findExistingSubs(trans, createMergeTestSubReqMsg(2, 105), SubscriptionSharingShared)
+	assert.Nil(t, subs)
+
+	// Removed subscription is not found anymore
+	subs, _ = registry.findExistingSubs(trans, createMergeTestSubReqMsg(1, 105), SubscriptionSharingShared)
+	registry.deleteSubs(subs)
+	registry.removeFromMergeIndex(subs)
+	subs, _ = registry.findExistingSubs(trans, createMergeTestSubReqMsg(1, 105), SubscriptionSharingShared)
+	assert.Nil(t, subs)
+	keys, candidates := getMergeIndexSize(registry)
+	assert.Equal(t, 299, keys)
+	assert.Equal(t, 299, candidates)
+	assert.Equal(t, 2, len(registry.getShard("RAN_NAME_5").mergeKeys))
+
+	// Index is rebuilt from register
+	for _, shard := range registry.getShards() {
+		shard.mergeIndex = nil
+		shard.mergeKeys = nil
+	}
+	registry.rebuildMergeIndex()
+	keys, _ = getMergeIndexSize(registry)
+	assert.Equal(t, 299, keys)
+	subs, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_6", "xapp1"), createMergeTestSubReqMsg(1, 106), SubscriptionSharingShared)
+	assert.NotNil(t, subs)
+}
+
+func benchmarkFindExistingSubs(b *testing.B, subsCount int, found bool) {
+	registry := createMergeTestRegistry(subsCount)
+	trans := createValidateTestTrans("RAN_NAME_7", "xapp1")
+	eventTrigger := uint32(subsCount - 93)
+	if found == false {
+		eventTrigger = uint32(subsCount + 7)
+	}
+	subReqMsg := createMergeTestSubReqMsg(1, eventTrigger)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		shard := registry.lockShard("RAN_NAME_7")
+		subs, _ := registry.findExistingSubs(trans, subReqMsg, SubscriptionSharingShared)
+		shard.opMutex.Unlock()
+		if (subs != nil) != found {
+			b.Fatalf("Unexpected merge result %v", subs)
+		}
+	}
+}
+
+func BenchmarkFindExistingSubs10kFound(b *testing.B)    { benchmarkFindExistingSubs(b, 10000, true) }
+func BenchmarkFindExistingSubs10kNotFound(b *testing.B) { benchmarkFindExistingSubs(b, 10000, false) }
+func BenchmarkFindExistingSubs60kFound(b *testing.B)    { benchmarkFindExistingSubs(b, 60000, true) }
+func BenchmarkFindExistingSubs60kNotFound(b *testing.B) { benchmarkFindExistingSubs(b, 60000, false) }
@@ -44,6 +44,38 @@ const (
 	cE2StateChangedToUp     string = "E2StateChangedToUp"
 	cE2StateChangedToDown   string = "E2StateChangedToDown"
 	cE2StateUnderReset      string = "E2StateChangedToUnderReset"
+	cRestNotifRetryToXapp   string = "RestNotifRetryToXapp"
+	cRestNotifToDeadLetter  string = "RestNotifMovedToDeadLetter"
+	cRestNotifReplayToXapp  string = "RestNotifReplayToXapp"
+	cRestSubReqCollision    string = "RestSubReqCollisionWithOngoing"
+	cRestReqRejDueQuota     string = "RestReqRejDueQuota"
+	cSubReqRejDueQuota      string = "SubReqRejDueQuota"
+	cSubReqBackoffRetry     string = "SubReqRetriedAfterBackoff"
+	cSubReqRetryMaxAge      string = "SubReqRetryMaxAgeExpiry"
+	cRestSubLeaseExpired    string = "RestSubLeaseExpired"
+	cXappRemovalSubDel      string = "SubDelDueXappRemoval"
+	cRestSubValidateReq     string = "RestSubValidateReqFromXapp"
+	cRestSubDelNotifToXapp  string = "RestSubDelNotifToXapp"
+	cSubDelFailToXapp       string = "SubDelFailToXapp"
+	cSubDelCleanupRetryToE2 string = "SubDelCleanupRetryToE2"
+	cSubDelCleanupGivenUp   string = "SubDelCleanupGivenUp"
+	cSubReqRejDueNoJoin     string = "SubReqRejDueNoSubsToJoin"
+	cSubReqRejDueConflict   string = "SubReqRejDueConflict"
+	cSubPreemptedByConflict string = "SubPreemptedDueConflict"
+	cE2TRespDropped         string = "E2TRespDroppedDueFullMailbox"
+	cSubDelRejDueFullMbox   string = "SubDelReqRejDueFullMailbox"
+)
+
+const (
+	gRestNotifPendingCount    string = "RestNotifPendingCount"
+	gRestNotifDeadLetterCount string = "RestNotifDeadLetterCount"
+	gE2SubscriptionCount      string = "E2SubscriptionCount"
+	gXappQuotaMaxUsage        string = "XappQuotaMaxUsagePercent"
+	gE2NodeQuotaMaxUsage      string = "E2NodeQuotaMaxUsagePercent"
+	gRanFuncQuotaMaxUsage     string = "RanFunctionQuotaMaxUsagePercent"
+	gE2NodeSubReqQueueDepth   string = "E2NodeSubReqQueueDepth"
+	gE2NodeOutstandingSubReqs string = "E2NodeOutstandingSubReqs"
+	gCongestedE2NodeCount     string = "CongestedE2NodeCount"
 )
 
 func GetMetricsOpts() []xapp.CounterOpts {
@@ -57,6 +89,11 @@ func GetMetricsOpts() []xapp.CounterOpts {
 		{Name: cRestSubRespToXapp, Help: "The total number of Rest SubscriptionResponse messages sent to xApp"},
 		{Name: cRestSubFailToXapp, Help: "The total number of Rest SubscriptionFailure messages sent to xApp"},
 		{Name: cRestReqRejDueE2Down, Help: "The total number of Rest SubscriptionRequest messages rejected due E2 Interface down"},
+		{Name: cRestReqRejDueQuota, Help: "The total number of Rest SubscriptionRequest messages rejected due subscription quota"},
+		{Name: cSubReqRejDueQuota, Help: "The total number of E2 subscriptions rejected due subscription quota"},
+		{Name: cSubReqRejDueNoJoin, Help: "The total number of E2 subscriptions rejected as there was no existing subscription to join"},
+		{Name: cSubReqRejDueConflict, Help: "The total number of E2 subscriptions rejected due conflicting POLICY or INSERT subscriptions"},
+		{Name: cSubPreemptedByConflict, Help: "The total number of E2 subscriptions pre-empted by conflicting subscription of higher priority xApp"},
 		{Name: cRestSubNotifToXapp, Help: "The total number of successful Rest SubscriptionNotification messages sent to xApp"},
 		{Name: cRestSubFailNotifToXapp, Help: "The total number of failure Rest SubscriptionNotification messages sent to xApp"},
 		{Name: cSubReqToE2, Help: "The total number of SubscriptionRequest messages sent to E2Term"},
@@ -65,10 +102,13 @@ func GetMetricsOpts() []xapp.CounterOpts {
 		{Name: cSubRespFromE2, Help: "The total number of SubscriptionResponse messages from E2Term"},
 		{Name: cSubFailFromE2, Help: "The total number of SubscriptionFailure messages from E2Term"},
 		{Name: cSubReqTimerExpiry, Help: "The total number of SubscriptionRequest timer expires"},
+		{Name: cSubReqBackoffRetry, Help: "The total number of E2 SubscriptionRequests retried after backoff due retry policy"},
+		{Name: cSubReqRetryMaxAge, Help: "The total number of E2 SubscriptionRequests failed as maximum age of retry policy was reached"},
 		{Name: cRouteCreateFail, Help: "The total number of subscription route create failure"},
 		{Name: cRouteCreateUpdateFail, Help: "The total number of subscription route create update failure"},
 		{Name: cMergedSubscriptions, Help: "The total number of merged Subscriptions"},
 		{Name: cDuplicateE2SubReq, Help: "The total number of same E2 SubscriptionRequest messages from same xApp"},
+		{Name: cRestSubReqCollision, Help: "The total number of Rest SubscriptionRequest messages received while the same request was still ongoing"},
 
 		// Subscrition delete counters
 		{Name: cSubDelReqFromXapp, Help: "The total number of SubscriptionDeleteRequest messages received from xApp"},
@@ -76,12 +116,21 @@ func GetMetricsOpts() []xapp.CounterOpts {
 		{Name: cRestSubDelReqFromXapp, Help: "The total number of Rest SubscriptionDeleteRequest messages received from xApp"},
 		{Name: cRestSubDelRespToXapp, Help: "The total number of Rest SubscriptionDeleteResponse messages sent to xApp"},
 		{Name: cRestSubDelFailToXapp, Help: "The total number of Rest SubscriptionDeleteFailure messages sent to xApp"},
+		{Name: cRestSubLeaseExpired, Help: "The total number of Rest subscriptions deleted due expired lease"},
+		{Name: cXappRemovalSubDel, Help: "The total number of Rest and RMR subscriptions deleted due xApp removal"},
+		{Name: cRestSubValidateReq, Help: "The total number of Rest subscription dry-run validation requests from xApp"},
+		{Name: cRestSubDelNotifToXapp, Help: "The total number of Rest subscription delete completion notifications sent to xApp"},
+		{Name: cSubDelFailToXapp, Help: "The total number of SubscriptionDeleteFailure messages sent to xApp"},
+		{Name: cSubDelCleanupRetryToE2, Help: "The total number of background retries of failed SubscriptionDeleteRequests to E2"},
+		{Name: cSubDelCleanupGivenUp, Help: "The total number of failed E2 subscription deletes given up after all retries"},
 		{Name: cSubDelReqToE2, Help: "The total number of SubscriptionDeleteRequest messages sent to E2Term"},
 		{Name: cSubDelReReqToE2, Help: "The total number of SubscriptionDeleteRequest messages resent to E2Term"},
 		{Name: cSubDelRespFromE2, Help: "The total number of SubscriptionDeleteResponse messages from E2Term"},
 		{Name: cSubDelFailFromE2, Help: "The total number of SubscriptionDeleteFailure messages from E2Term"},
 		{Name: cSubDelReqTimerExpiry, Help: "The total number of SubscriptionDeleteRequest timer expires"},
 		{Name: cSubDelRequFromE2, Help: "The total number of SubscriptionDeleteRequired messages from E2Term"},
+		{Name: cE2TRespDropped, Help: "The total number of E2Term responses dropped as mailbox of the subscription was full"},
+		{Name: cSubDelRejDueFullMbox, Help: "The total number of SubscriptionDeleteRequests from xApp rejected as mailbox of the subscription was full"},
 		{Name: cRouteDeleteFail, Help: "The total number of subscription route delete failure"},
 		{Name: cRouteDeleteUpdateFail, Help: "The total number of subscription route delete update failure"},
 		{Name: cUnmergedSubscriptions, Help: "The total number of unmerged Subscriptions"},
@@ -95,6 +144,31 @@ func GetMetricsOpts() []xapp.CounterOpts {
 		{Name: cE2StateChangedToUp, Help: "The total number of E2 interface change connected state"},
 		{Name: cE2StateChangedToDown, Help: "The total number of E2 interface change disconnected state"},
 		{Name: cE2StateUnderReset, Help: "The total number of E2 interface change under reset state"},
+
+		// REST notification delivery counters
+		{Name: cRestNotifRetryToXapp, Help: "The total number of Rest SubscriptionNotification messages resent to xApp"},
+		{Name: cRestNotifToDeadLetter, Help: "The total number of Rest SubscriptionNotification messages moved to dead letter list"},
+		{Name: cRestNotifReplayToXapp, Help: "The total number of undelivered Rest SubscriptionNotification messages replayed via debug interface"},
+	}
+}
+
+func GetGaugeOpts() []xapp.CounterOpts {
+	return []xapp.CounterOpts{
+
+		// REST notification outbox gauges
+		{Name: gRestNotifPendingCount, Help: "The current number of Rest SubscriptionNotification messages waiting for retry"},
+		{Name: gRestNotifDeadLetterCount, Help: "The current number of Rest SubscriptionNotification messages in dead letter list"},
+
+		// Subscription quota gauges
+		{Name: gE2SubscriptionCount, Help: "The current number of E2 subscriptions"},
+		{Name: gXappQuotaMaxUsage, Help: "The highest usage of subscription quota of an xApp in percent"},
+		{Name: gE2NodeQuotaMaxUsage, Help: "The highest usage of subscription quota of an E2 node in percent"},
+		{Name: gRanFuncQuotaMaxUsage, Help: "The highest usage of subscription quota of a RAN function in an E2 node in percent"},
+
+		// E2 node admission control gauges
+		{Name: gE2NodeSubReqQueueDepth, Help: "The current number of E2 SubscriptionRequests waiting for admission to E2 nodes"},
+		{Name: gE2NodeOutstandingSubReqs, Help: "The current number of admitted E2 SubscriptionRequests towards E2 nodes"},
+		{Name: gCongestedE2NodeCount, Help: "The current number of E2 nodes marked congested due retry policy"},
 	}
 }
 
@@ -102,3 +176,11 @@ func (c *Control) UpdateCounter(counterName string) {
 	xapp.Logger.Debug("Add counterName=%v", counterName)
 	c.Counters[counterName].Inc()
 }
+
+func (c *Control) SetGauge(gaugeName string, value int) {
+	if c.Gauges == nil {
+		return
+	}
+	xapp.Logger.Debug("Set gaugeName=%v value=%v", gaugeName, value)
+	c.Gauges[gaugeName].Set(float64(value))
+}
@@ -34,6 +34,11 @@ func TestAddAllCountersOnce(t *testing.T) {
 		Counter{cRestSubRespToXapp, 1},
 		Counter{cRestSubFailToXapp, 1},
 		Counter{cRestReqRejDueE2Down, 1},
+		Counter{cRestReqRejDueQuota, 1},
+		Counter{cSubReqRejDueQuota, 1},
+		Counter{cSubReqRejDueNoJoin, 1},
+		Counter{cSubReqRejDueConflict, 1},
+		Counter{cSubPreemptedByConflict, 1},
 		Counter{cRestSubNotifToXapp, 1},
 		Counter{cRestSubFailNotifToXapp, 1},
 		Counter{cSubReqToE2, 1},
@@ -42,6 +47,8 @@ func TestAddAllCountersOnce(t *testing.T) {
 		Counter{cPartialSubRespFromE2, 1},
 		Counter{cSubFailFromE2, 1},
 		Counter{cSubReqTimerExpiry, 1},
+		Counter{cSubReqBackoffRetry, 1},
+		Counter{cSubReqRetryMaxAge, 1},
 		Counter{cRouteCreateFail, 1},
 		Counter{cRouteCreateUpdateFail, 1},
 		Counter{cMergedSubscriptions, 1},
@@ -50,12 +57,20 @@ func TestAddAllCountersOnce(t *testing.T) {
 		Counter{cSubDelRespToXapp, 1},
 		Counter{cRestSubDelReqFromXapp, 1},
 		Counter{cRestSubDelRespToXapp, 1},
+		Counter{cRestSubLeaseExpired, 1},
+		Counter{cXappRemovalSubDel, 1},
+		Counter{cRestSubValidateReq, 1},
+		Counter{cRestSubDelNotifToXapp, 1},
+		Counter{cSubDelFailToXapp, 1},
+		Counter{cSubDelCleanupRetryToE2, 1},
+		Counter{cSubDelCleanupGivenUp, 1},
 		Counter{cSubDelReqToE2, 1},
 		Counter{cSubDelReReqToE2, 1},
 		Counter{cSubDelRespFromE2, 1},
 		Counter{cSubDelFailFromE2, 1},
 		Counter{cSubDelReqTimerExpiry, 1},
 		Counter{cSubDelRequFromE2, 1},
+		Counter{cE2TRespDropped, 1},
 		Counter{cRouteDeleteFail, 1},
 		Counter{cRouteDeleteUpdateFail, 1},
 		Counter{cUnmergedSubscriptions, 1},
@@ -65,6 +80,10 @@ func TestAddAllCountersOnce(t *testing.T) {
 		Counter{cE2StateChangedToUp, 1},
 		Counter{cE2StateChangedToDown, 1},
 		Counter{cE2StateUnderReset, 1},
+		Counter{cRestNotifRetryToXapp, 1},
+		Counter{cRestNotifToDeadLetter, 1},
+		Counter{cRestNotifReplayToXapp, 1},
+		Counter{cRestSubReqCollision, 1},
 	})
 
 	mainCtrl.c.UpdateCounter(cSubReqFromXapp)
@@ -74,6 +93,11 @@ func TestAddAllCountersOnce(t *testing.T) {
 	mainCtrl.c.UpdateCounter(cRestSubRespToXapp)
 	mainCtrl.c.UpdateCounter(cRestSubFailToXapp)
 	mainCtrl.c.UpdateCounter(cRestReqRejDueE2Down)
+	mainCtrl.c.UpdateCounter(cRestReqRejDueQuota)
+	mainCtrl.c.UpdateCounter(cSubReqRejDueQuota)
+	mainCtrl.c.UpdateCounter(cSubReqRejDueNoJoin)
+	mainCtrl.c.UpdateCounter(cSubReqRejDueConflict)
+	mainCtrl.c.UpdateCounter(cSubPreemptedByConflict)
 	mainCtrl.c.UpdateCounter(cRestSubNotifToXapp)
 	mainCtrl.c.UpdateCounter(cRestSubFailNotifToXapp)
 	mainCtrl.c.UpdateCounter(cSubReqToE2)
@@ -82,6 +106,8 @@ func TestAddAllCountersOnce(t *testing.T) {
 	mainCtrl.c.UpdateCounter(cPartialSubRespFromE2)
 	mainCtrl.c.UpdateCounter(cSubFailFromE2)
 	mainCtrl.c.UpdateCounter(cSubReqTimerExpiry)
+	mainCtrl.c.UpdateCounter(cSubReqBackoffRetry)
+	mainCtrl.c.UpdateCounter(cSubReqRetryMaxAge)
 	mainCtrl.c.UpdateCounter(cRouteCreateFail)
 	mainCtrl.c.UpdateCounter(cRouteCreateUpdateFail)
 	mainCtrl.c.UpdateCounter(cMergedSubscriptions)
@@ -90,12 +116,20 @@ func TestAddAllCountersOnce(t *testing.T) {
 	mainCtrl.c.UpdateCounter(cSubDelRespToXapp)
 	mainCtrl.c.UpdateCounter(cRestSubDelReqFromXapp)
 	mainCtrl.c.UpdateCounter(cRestSubDelRespToXapp)
+	mainCtrl.c.UpdateCounter(cRestSubLeaseExpired)
+	mainCtrl.c.UpdateCounter(cXappRemovalSubDel)
+	mainCtrl.c.UpdateCounter(cRestSubValidateReq)
+	mainCtrl.c.UpdateCounter(cRestSubDelNotifToXapp)
+	mainCtrl.c.UpdateCounter(cSubDelFailToXapp)
+	mainCtrl.c.UpdateCounter(cSubDelCleanupRetryToE2)
+	mainCtrl.c.UpdateCounter(cSubDelCleanupGivenUp)
 	mainCtrl.c.UpdateCounter(cSubDelReqToE2)
 	mainCtrl.c.UpdateCounter(cSubDelReReqToE2)
 	mainCtrl.c.UpdateCounter(cSubDelRespFromE2)
 	mainCtrl.c.UpdateCounter(cSubDelFailFromE2)
 	mainCtrl.c.UpdateCounter(cSubDelReqTimerExpiry)
 	mainCtrl.c.UpdateCounter(cSubDelRequFromE2)
+	mainCtrl.c.UpdateCounter(cE2TRespDropped)
 	mainCtrl.c.UpdateCounter(cRouteDeleteFail)
 	mainCtrl.c.UpdateCounter(cRouteDeleteUpdateFail)
 	mainCtrl.c.UpdateCounter(cUnmergedSubscriptions)
@@ -105,6 +139,10 @@ func TestAddAllCountersOnce(t *testing.T) {
 	mainCtrl.c.UpdateCounter(cE2StateChangedToUp)
 	mainCtrl.c.UpdateCounter(cE2StateChangedToDown)
 	mainCtrl.c.UpdateCounter(cE2StateUnderReset)
+	mainCtrl.c.UpdateCounter(cRestNotifRetryToXapp)
+	mainCtrl.c.UpdateCounter(cRestNotifToDeadLetter)
+	mainCtrl.c.UpdateCounter(cRestNotifReplayToXapp)
+	mainCtrl.c.UpdateCounter(cRestSubReqCollision)
 
 	mainCtrl.VerifyCounterValues(t)
 }
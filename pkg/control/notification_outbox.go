@@ -0,0 +1,520 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/segmentio/ksuid"
+)
+
+//-----------------------------------------------------------------------------
+// Outbox for REST notifications. Notification is first tried in background
+// in the order of sending per client endpoint. Notification which could not be
+// delivered to xApp is stored in db and retried with exponential backoff. When
+// try count is exhausted the notification is moved to dead letter list from
+// where it can be replayed via debug REST interface.
+//-----------------------------------------------------------------------------
+
+type NotifyFunc func(notification *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error
+
+const (
+	notificationTypeDeleted   = "DELETED"   // E2 subscription deleted on request of xApp
+	notificationTypePreempted = "PREEMPTED" // E2 subscription deleted due conflicting subscription of other xApp
+)
+
+// Maximum number of client endpoints notifications are sent to in parallel.
+// Notifications of one endpoint are sent one after another
+const notificationMaxParallelEndpoints = 16
+
+//-----------------------------------------------------------------------------
+// REST notification sent to xApp. Fields of xapp-frame SubscriptionResponse
+// and SubscriptionInstance with additional fields which xApps decoding the
+// notification into models.SubscriptionResponse ignore.
+//-----------------------------------------------------------------------------
+type SubscriptionNotification struct {
+	SubscriptionID        *string                 `json:"SubscriptionId"`
+	NotificationType      string                  `json:",omitempty"` // DELETED in delete completion notification, PREEMPTED in pre-emption notification
+	SubscriptionInstances []*NotificationInstance `json:"SubscriptionInstances"`
+}
+
+type NotificationInstance struct {
+	models.SubscriptionInstance
+	ErrorCode         ErrorCode   `json:",omitempty"`
+	E2Cause           *e2ap.Cause `json:",omitempty"` // Cause given by E2 node
+	ConflictingSubIds []uint32    `json:",omitempty"` // Subscriptions the request conflicts with
+	DeleteState       string      `json:",omitempty"` // State of deleted E2 subscription in delete completion notification
+}
+
+//-------------------------------------------------------------------
+// ErrorCause is the human readable text of the error. Error code, E2
+// cause and ids of conflicting subscriptions are given in fields of
+// their own.
+//-------------------------------------------------------------------
+func newNotificationInstance(e2EventInstanceID int64, xAppEventInstanceID int64, errorInfo *ErrorInfo) *NotificationInstance {
+	return &NotificationInstance{
+		SubscriptionInstance: models.SubscriptionInstance{E2EventInstanceID: &e2EventInstanceID,
+			ErrorCause:          errorInfo.ErrorCause,
+			ErrorSource:         errorInfo.ErrorSource,
+			TimeoutType:         errorInfo.TimeoutType,
+			XappEventInstanceID: &xAppEventInstanceID},
+		ErrorCode:         errorInfo.ErrorCode,
+		E2Cause:           errorInfo.E2Cause,
+		ConflictingSubIds: errorInfo.ConflictingSubIds,
+	}
+}
+
+type NotificationInfo struct {
+	NotificationId string
+	RestSubId      string
+	ClientEndpoint models.SubscriptionParamsClientEndpoint
+	Response       SubscriptionNotification
+	TryCount       uint64
+	Created        time.Time
+	NextTry        time.Time
+	LastError      string
+	DeadLetter     bool
+	noRetry        bool // REST subscription deleted before first try
+}
+
+type UndeliveredNotifications struct {
+	Pending     []NotificationInfo
+	DeadLetters []NotificationInfo
+}
+
+type NotificationOutbox struct {
+	mutex       sync.Mutex
+	control     *Control
+	notify      NotifyFunc
+	pending     map[string]*NotificationInfo
+	deadLetters map[string]*NotificationInfo
+	queued      map[string][]*NotificationInfo // Waiting for first try, per client endpoint
+	inFlight    map[string]*NotificationInfo   // First try ongoing
+	sendSlots   chan struct{}
+	sending     sync.WaitGroup
+	wakeChan    chan struct{}
+}
+
+func (n *NotificationOutbox) Init(c *Control, notify NotifyFunc) {
+	n.control = c
+	n.notify = notify
+	n.pending = make(map[string]*NotificationInfo)
+	n.deadLetters = make(map[string]*NotificationInfo)
+	n.queued = make(map[string][]*NotificationInfo)
+	n.inFlight = make(map[string]*NotificationInfo)
+	n.sendSlots = make(chan struct{}, notificationMaxParallelEndpoints)
+	n.wakeChan = make(chan struct{}, 1)
+}
+
+func notificationEndpointKey(clientEndpoint models.SubscriptionParamsClientEndpoint) string {
+	if clientEndpoint.HTTPPort == nil {
+		return clientEndpoint.Host
+	}
+	return fmt.Sprintf("%s:%d", clientEndpoint.Host, *clientEndpoint.HTTPPort)
+}
+
+//-------------------------------------------------------------------
+// Send notification to xApp. Notification is tried in background. If
+// the first try fails, the notification is stored in outbox and
+// retried later.
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) Send(restSubId string, resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) {
+
+	notification := &NotificationInfo{
+		NotificationId: ksuid.New().String(),
+		RestSubId:      restSubId,
+		ClientEndpoint: clientEndpoint,
+		Response:       *resp,
+		Created:        time.Now(),
+	}
+	key := notificationEndpointKey(clientEndpoint)
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	queue := n.queued[key]
+	n.queued[key] = append(queue, notification)
+	if len(queue) == 0 {
+		n.sending.Add(1)
+		go n.sendQueued(key)
+	}
+}
+
+//-------------------------------------------------------------------
+// Tries queued notifications of client endpoint in sending order
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) sendQueued(key string) {
+	defer n.sending.Done()
+	n.sendSlots <- struct{}{}
+	defer func() { <-n.sendSlots }()
+
+	for {
+		n.mutex.Lock()
+		queue := n.queued[key]
+		if len(queue) == 0 {
+			delete(n.queued, key)
+			n.mutex.Unlock()
+			return
+		}
+		notification := queue[0]
+		n.queued[key] = queue[1:]
+		n.inFlight[notification.NotificationId] = notification
+		n.mutex.Unlock()
+
+		resp := notification.Response
+		err := n.notify(&resp, notification.ClientEndpoint)
+
+		n.mutex.Lock()
+		delete(n.inFlight, notification.NotificationId)
+		if err != nil {
+			xapp.Logger.Error("Notification to xApp failed %s", err.Error())
+			if notification.noRetry == false {
+				notification.TryCount = 1
+				notification.LastError = err.Error()
+				n.updateAfterFailure(notification, time.Now())
+			}
+		}
+		n.mutex.Unlock()
+
+		if err != nil {
+			n.wake()
+		} else if notification.Response.NotificationType == notificationTypeDeleted {
+			n.control.releaseRESTSubscriptionDeletion(notification.RestSubId)
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Waits until notifications sent so far have been tried once
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) waitFirstTries() {
+	n.sending.Wait()
+}
+
+func (n *NotificationOutbox) updateAfterFailure(notification *NotificationInfo, now time.Time) {
+
+	if notification.TryCount >= notificationMaxTryCount {
+		xapp.Logger.Error("Notification %s for restSubId %s moved to dead letter list after %v tries: %s",
+			notification.NotificationId, notification.RestSubId, notification.TryCount, notification.LastError)
+		notification.DeadLetter = true
+		delete(n.pending, notification.NotificationId)
+		n.deadLetters[notification.NotificationId] = notification
+		n.control.UpdateCounter(cRestNotifToDeadLetter)
+	} else {
+		notification.NextTry = now.Add(NotificationRetryDelay(notification.TryCount))
+		xapp.Logger.Debug("Notification %s for restSubId %s retried at %s", notification.NotificationId, notification.RestSubId, notification.NextTry.Format(time.RFC3339Nano))
+		n.pending[notification.NotificationId] = notification
+	}
+	n.writeToDb(notification)
+	n.updateGauges()
+}
+
+//-------------------------------------------------------------------
+// Delay before next try. Doubles after every failed try and is
+// limited by notificationMaxRetryDelay.
+//-------------------------------------------------------------------
+func NotificationRetryDelay(tryCount uint64) time.Duration {
+	delay := notificationRetryDelay
+	for i := uint64(1); i < tryCount; i++ {
+		delay *= 2
+		if delay >= notificationMaxRetryDelay {
+			return notificationMaxRetryDelay
+		}
+	}
+	if delay > notificationMaxRetryDelay {
+		return notificationMaxRetryDelay
+	}
+	return delay
+}
+
+//-------------------------------------------------------------------
+// Background retry loop
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) Run() {
+	for {
+		n.RetryDueNotifications(time.Now())
+
+		select {
+		case <-n.wakeChan:
+		case <-time.After(n.timeToNextTry(time.Now())):
+		}
+	}
+}
+
+func (n *NotificationOutbox) wake() {
+	select {
+	case n.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (n *NotificationOutbox) timeToNextTry(now time.Time) time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	wait := notificationMaxRetryDelay
+	for _, notification := range n.pending {
+		if untilNext := notification.NextTry.Sub(now); untilNext < wait {
+			wait = untilNext
+		}
+	}
+	if wait <= 0 {
+		wait = time.Millisecond
+	}
+	return wait
+}
+
+//-------------------------------------------------------------------
+// Due notifications are retried in parallel per client endpoint, so
+// that an unreachable xApp does not delay retries of other xApps
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) RetryDueNotifications(now time.Time) {
+
+	n.mutex.Lock()
+	dueNotifications := make(map[string][]*NotificationInfo)
+	for _, notification := range n.pending {
+		if !notification.NextTry.After(now) {
+			key := notificationEndpointKey(notification.ClientEndpoint)
+			dueNotifications[key] = append(dueNotifications[key], notification)
+		}
+	}
+	n.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, notifications := range dueNotifications {
+		sort.Slice(notifications, func(i, j int) bool {
+			return notifications[i].Created.Before(notifications[j].Created)
+		})
+		wg.Add(1)
+		go func(notifications []*NotificationInfo) {
+			defer wg.Done()
+			n.sendSlots <- struct{}{}
+			defer func() { <-n.sendSlots }()
+			for _, notification := range notifications {
+				n.retry(notification)
+			}
+		}(notifications)
+	}
+	wg.Wait()
+}
+
+func (n *NotificationOutbox) retry(notification *NotificationInfo) {
+
+	n.control.UpdateCounter(cRestNotifRetryToXapp)
+	resp := notification.Response
+	err := n.notify(&resp, notification.ClientEndpoint)
+
+	n.mutex.Lock()
+	if current, ok := n.pending[notification.NotificationId]; !ok || current != notification {
+		// Notification has been removed or replaced while it was retried
+		n.mutex.Unlock()
+		return
+	}
+	notification.TryCount++
+	if err == nil {
+		xapp.Logger.Debug("Notification %s for restSubId %s delivered after %v tries", notification.NotificationId, notification.RestSubId, notification.TryCount)
+		delete(n.pending, notification.NotificationId)
+		n.removeFromDb(notification.NotificationId)
+		n.updateGauges()
+	} else {
+		notification.LastError = err.Error()
+		n.updateAfterFailure(notification, time.Now())
+	}
+	n.mutex.Unlock()
+
+	if err == nil && notification.Response.NotificationType == notificationTypeDeleted {
+		n.control.releaseRESTSubscriptionDeletion(notification.RestSubId)
+	}
+}
+
+//-------------------------------------------------------------------
+// Tells whether delete completion notifications of REST subscription
+// are pending or in dead letter list
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) HasUndeliveredDeleteNotifications(restSubId string) bool {
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	isUndelivered := func(notification *NotificationInfo) bool {
+		return notification.RestSubId == restSubId && notification.Response.NotificationType == notificationTypeDeleted
+	}
+	for _, notifications := range []map[string]*NotificationInfo{n.pending, n.deadLetters, n.inFlight} {
+		for _, notification := range notifications {
+			if isUndelivered(notification) {
+				return true
+			}
+		}
+	}
+	for _, queue := range n.queued {
+		for _, notification := range queue {
+			if isUndelivered(notification) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//-------------------------------------------------------------------
+// Replay of dead letters
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) Replay(notificationId string) error {
+
+	n.mutex.Lock()
+	notification, ok := n.deadLetters[notificationId]
+	if !ok {
+		n.mutex.Unlock()
+		return fmt.Errorf("Undelivered notification %s not found", notificationId)
+	}
+	n.replay(notification)
+	n.mutex.Unlock()
+	n.wake()
+	return nil
+}
+
+func (n *NotificationOutbox) ReplayAll() int {
+
+	n.mutex.Lock()
+	count := 0
+	for _, notification := range n.deadLetters {
+		n.replay(notification)
+		count++
+	}
+	n.mutex.Unlock()
+	n.wake()
+	return count
+}
+
+func (n *NotificationOutbox) replay(notification *NotificationInfo) {
+	xapp.Logger.Debug("Replaying notification %s for restSubId %s", notification.NotificationId, notification.RestSubId)
+	delete(n.deadLetters, notification.NotificationId)
+	notification.DeadLetter = false
+	notification.TryCount = 0
+	notification.NextTry = time.Now()
+	n.pending[notification.NotificationId] = notification
+	n.writeToDb(notification)
+	n.updateGauges()
+	n.control.UpdateCounter(cRestNotifReplayToXapp)
+}
+
+//-------------------------------------------------------------------
+// Notifications of a deleted REST subscription are not needed anymore.
+// Notifications not tried yet are tried once but not retried
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) DeleteRestSubscriptionNotifications(restSubId string) {
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, notification := range n.inFlight {
+		if notification.RestSubId == restSubId {
+			notification.noRetry = true
+		}
+	}
+	for _, queue := range n.queued {
+		for _, notification := range queue {
+			if notification.RestSubId == restSubId {
+				notification.noRetry = true
+			}
+		}
+	}
+
+	for _, notifications := range []map[string]*NotificationInfo{n.pending, n.deadLetters} {
+		for notificationId, notification := range notifications {
+			if notification.RestSubId == restSubId {
+				xapp.Logger.Debug("Deleting undelivered notification %s of restSubId %s", notificationId, restSubId)
+				delete(notifications, notificationId)
+				n.removeFromDb(notificationId)
+			}
+		}
+	}
+	n.updateGauges()
+}
+
+func (n *NotificationOutbox) GetUndelivered() UndeliveredNotifications {
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	undelivered := UndeliveredNotifications{}
+	for _, notification := range n.pending {
+		undelivered.Pending = append(undelivered.Pending, *notification)
+	}
+	for _, notification := range n.deadLetters {
+		undelivered.DeadLetters = append(undelivered.DeadLetters, *notification)
+	}
+	sort.Slice(undelivered.Pending, func(i, j int) bool {
+		return undelivered.Pending[i].Created.Before(undelivered.Pending[j].Created)
+	})
+	sort.Slice(undelivered.DeadLetters, func(i, j int) bool {
+		return undelivered.DeadLetters[i].Created.Before(undelivered.DeadLetters[j].Created)
+	})
+	return undelivered
+}
+
+func (n *NotificationOutbox) GetUndeliveredJson() []byte {
+
+	undeliveredJson, err := json.Marshal(n.GetUndelivered())
+	if err != nil {
+		xapp.Logger.Error("GetUndeliveredJson() json.Marshal error: %v", err)
+	}
+	return undeliveredJson
+}
+
+//-------------------------------------------------------------------
+// Restore outbox content after restart
+//-------------------------------------------------------------------
+func (n *NotificationOutbox) Restore(notifications map[string]*NotificationInfo) {
+
+	n.mutex.Lock()
+	for notificationId, notification := range notifications {
+		if notification.DeadLetter {
+			n.deadLetters[notificationId] = notification
+		} else {
+			n.pending[notificationId] = notification
+		}
+	}
+	n.updateGauges()
+	n.mutex.Unlock()
+	n.wake()
+}
+
+func (n *NotificationOutbox) writeToDb(notification *NotificationInfo) {
+	if err := n.control.WriteNotificationToSdl(notification); err != nil {
+		xapp.Logger.Error("%s", err.Error())
+	}
+}
+
+func (n *NotificationOutbox) removeFromDb(notificationId string) {
+	if err := n.control.RemoveNotificationFromSdl(notificationId); err != nil {
+		xapp.Logger.Error("%s", err.Error())
+	}
+}
+
+func (n *NotificationOutbox) updateGauges() {
+	n.control.SetGauge(gRestNotifPendingCount, len(n.pending))
+	n.control.SetGauge(gRestNotifDeadLetterCount, len(n.deadLetters))
+}
@@ -0,0 +1,317 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+//-----------------------------------------------------------------------------
+//
+//-----------------------------------------------------------------------------
+type notifyStub struct {
+	lock      sync.Mutex
+	failCount int
+	calls     int
+}
+
+func (n *notifyStub) Notify(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.calls++
+	if n.calls <= n.failCount {
+		return fmt.Errorf("Test notify failure %v", n.calls)
+	}
+	return nil
+}
+
+func createTestNotificationOutbox(t *testing.T, notify NotifyFunc, maxTryCount uint64) (*NotificationOutbox, *SdlNsMock) {
+
+	origMaxTryCount, origRetryDelay, origMaxRetryDelay := notificationMaxTryCount, notificationRetryDelay, notificationMaxRetryDelay
+	notificationMaxTryCount = maxTryCount
+	notificationRetryDelay = 10 * time.Millisecond
+	notificationMaxRetryDelay = 40 * time.Millisecond
+	t.Cleanup(func() {
+		notificationMaxTryCount, notificationRetryDelay, notificationMaxRetryDelay = origMaxTryCount, origRetryDelay, origMaxRetryDelay
+	})
+
+	dbMock := CreateSdlNsMock(notificationOutboxSdlNs)
+	c := &Control{Counters: mainCtrl.c.Counters, notificationOutboxDb: dbMock}
+	outbox := new(NotificationOutbox)
+	outbox.Init(c, notify)
+	c.notificationOutbox = outbox
+	return outbox, dbMock
+}
+
+func createTestNotification(restSubId string) (*SubscriptionNotification, models.SubscriptionParamsClientEndpoint) {
+	port := int64(4560)
+	e2EventInstanceID := int64(1)
+	xAppEventInstanceID := int64(2)
+	resp := &SubscriptionNotification{
+		SubscriptionID:        &restSubId,
+		SubscriptionInstances: []*NotificationInstance{newNotificationInstance(e2EventInstanceID, xAppEventInstanceID, &ErrorInfo{})},
+	}
+	return resp, models.SubscriptionParamsClientEndpoint{Host: "localhost", HTTPPort: &port}
+}
+
+func TestNotificationRetryDelay(t *testing.T) {
+	_, _ = createTestNotificationOutbox(t, nil, 5)
+
+	assert.Equal(t, 10*time.Millisecond, NotificationRetryDelay(1))
+	assert.Equal(t, 20*time.Millisecond, NotificationRetryDelay(2))
+	assert.Equal(t, 40*time.Millisecond, NotificationRetryDelay(3))
+	assert.Equal(t, 40*time.Millisecond, NotificationRetryDelay(10))
+}
+
+func TestNotificationOutboxDeliveredAtFirstTry(t *testing.T) {
+	stub := &notifyStub{}
+	outbox, dbMock := createTestNotificationOutbox(t, stub.Notify, 3)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	outbox.waitFirstTries()
+	assert.Equal(t, 1, stub.calls)
+
+	undelivered := outbox.GetUndelivered()
+	assert.Equal(t, 0, len(undelivered.Pending))
+	assert.Equal(t, 0, len(undelivered.DeadLetters))
+	assert.Equal(t, 0, len(dbMock.db))
+}
+
+func TestNotificationOutboxDeliveredAfterRetry(t *testing.T) {
+	stub := &notifyStub{failCount: 1}
+	outbox, dbMock := createTestNotificationOutbox(t, stub.Notify, 3)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	outbox.waitFirstTries()
+
+	undelivered := outbox.GetUndelivered()
+	assert.Equal(t, 1, len(undelivered.Pending))
+	assert.Equal(t, uint64(1), undelivered.Pending[0].TryCount)
+	assert.Equal(t, 1, len(dbMock.db))
+
+	// Not yet due
+	outbox.RetryDueNotifications(undelivered.Pending[0].NextTry.Add(-time.Millisecond))
+	assert.Equal(t, 1, stub.calls)
+
+	outbox.RetryDueNotifications(undelivered.Pending[0].NextTry)
+	assert.Equal(t, 2, stub.calls)
+
+	undelivered = outbox.GetUndelivered()
+	assert.Equal(t, 0, len(undelivered.Pending))
+	assert.Equal(t, 0, len(undelivered.DeadLetters))
+	assert.Equal(t, 0, len(dbMock.db))
+}
+
+func TestNotificationOutboxDeadLetterAndReplay(t *testing.T) {
+	stub := &notifyStub{failCount: 2}
+	outbox, dbMock := createTestNotificationOutbox(t, stub.Notify, 2)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	outbox.waitFirstTries()
+	outbox.RetryDueNotifications(time.Now().Add(time.Second))
+
+	undelivered := outbox.GetUndelivered()
+	assert.Equal(t, 0, len(undelivered.Pending))
+	assert.Equal(t, 1, len(undelivered.DeadLetters))
+	assert.Equal(t, true, undelivered.DeadLetters[0].DeadLetter)
+	assert.Equal(t, 1, len(dbMock.db))
+
+	// Dead letters are not retried automatically
+	outbox.RetryDueNotifications(time.Now().Add(time.Second))
+	assert.Equal(t, 2, stub.calls)
+
+	err := outbox.Replay("unknown")
+	assert.NotNil(t, err)
+
+	err = outbox.Replay(undelivered.DeadLetters[0].NotificationId)
+	assert.Nil(t, err)
+	undelivered = outbox.GetUndelivered()
+	assert.Equal(t, 1, len(undelivered.Pending))
+	assert.Equal(t, 0, len(undelivered.DeadLetters))
+
+	outbox.RetryDueNotifications(time.Now().Add(time.Second))
+	assert.Equal(t, 3, stub.calls)
+	undelivered = outbox.GetUndelivered()
+	assert.Equal(t, 0, len(undelivered.Pending))
+	assert.Equal(t, 0, len(dbMock.db))
+}
+
+func TestNotificationOutboxRestoreAndDelete(t *testing.T) {
+	stub := &notifyStub{failCount: 3}
+	outbox, dbMock := createTestNotificationOutbox(t, stub.Notify, 1)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	resp, clientEndpoint = createTestNotification("restSubId2")
+	outbox.Send("restSubId2", resp, clientEndpoint)
+	outbox.waitFirstTries()
+	assert.Equal(t, 2, len(dbMock.db))
+
+	// Simulate restart
+	restarted, _ := createTestNotificationOutbox(t, stub.Notify, 1)
+	restarted.control.notificationOutboxDb = dbMock
+	notifications, err := restarted.control.ReadAllNotificationsFromSdl()
+	assert.Nil(t, err)
+	restarted.Restore(notifications)
+	assert.Equal(t, 2, len(restarted.GetUndelivered().DeadLetters))
+
+	restarted.DeleteRestSubscriptionNotifications("restSubId1")
+	undelivered := restarted.GetUndelivered()
+	assert.Equal(t, 1, len(undelivered.DeadLetters))
+	assert.Equal(t, "restSubId2", undelivered.DeadLetters[0].RestSubId)
+	assert.Equal(t, 1, len(dbMock.db))
+
+	assert.Equal(t, 1, restarted.ReplayAll())
+	assert.Equal(t, 1, len(restarted.GetUndelivered().Pending))
+}
+
+func TestNotificationOutboxReleasesDeletionState(t *testing.T) {
+	stub := &notifyStub{failCount: 1}
+	outbox, _ := createTestNotificationOutbox(t, stub.Notify, 3)
+	outbox.control.registry = createFilterTestRegistry()
+	registry := outbox.control.registry
+
+	registry.StartRESTSubscriptionDeletion("restSubId1")
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	resp.NotificationType = notificationTypeDeleted
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	assert.True(t, outbox.HasUndeliveredDeleteNotifications("restSubId1"))
+	outbox.waitFirstTries()
+	assert.True(t, outbox.HasUndeliveredDeleteNotifications("restSubId1"))
+
+	// Deletion state is kept after REST subscription is removed while notification is undelivered
+	restSubId := "restSubId1"
+	registry.DeleteRESTSubscription(&restSubId)
+	registry.CompleteRESTSubscriptionDeletion("restSubId1")
+	outbox.control.releaseRESTSubscriptionDeletion("restSubId1")
+	_, err := registry.GetRESTSubscriptionDeletionInfo("restSubId1")
+	assert.Nil(t, err)
+
+	outbox.RetryDueNotifications(time.Now().Add(time.Second))
+	assert.False(t, outbox.HasUndeliveredDeleteNotifications("restSubId1"))
+	_, err = registry.GetRESTSubscriptionDeletionInfo("restSubId1")
+	assert.True(t, errors.Is(err, errRESTSubscriptionNotFound))
+}
+
+func TestNotificationOutboxSendsInOrderPerEndpoint(t *testing.T) {
+	var lock sync.Mutex
+	var delivered []string
+	release := make(chan struct{})
+	outbox, _ := createTestNotificationOutbox(t, func(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+		if clientEndpoint.Host == "unreachable" {
+			<-release
+			return fmt.Errorf("Test notify timeout")
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		delivered = append(delivered, *resp.SubscriptionID)
+		return nil
+	}, 3)
+
+	resp, clientEndpoint := createTestNotification("restSubId0")
+	clientEndpoint.Host = "unreachable"
+	outbox.Send("restSubId0", resp, clientEndpoint)
+	for _, restSubId := range []string{"restSubId1", "restSubId2", "restSubId3"} {
+		resp, clientEndpoint := createTestNotification(restSubId)
+		outbox.Send(restSubId, resp, clientEndpoint)
+	}
+
+	// Unreachable endpoint does not delay notifications of other endpoints
+	assert.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(delivered) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"restSubId1", "restSubId2", "restSubId3"}, delivered)
+
+	close(release)
+	outbox.waitFirstTries()
+	assert.Equal(t, 1, len(outbox.GetUndelivered().Pending))
+}
+
+func TestNotificationOutboxRetriesEndpointsInParallel(t *testing.T) {
+	var lock sync.Mutex
+	calls := make(map[string]int)
+	release := make(chan struct{})
+	outbox, _ := createTestNotificationOutbox(t, func(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+		lock.Lock()
+		calls[clientEndpoint.Host]++
+		firstTry := calls[clientEndpoint.Host] == 1
+		lock.Unlock()
+		if firstTry {
+			return fmt.Errorf("Test notify failure")
+		}
+		if clientEndpoint.Host == "unreachable" {
+			<-release
+			return fmt.Errorf("Test notify timeout")
+		}
+		return nil
+	}, 3)
+
+	for _, host := range []string{"unreachable", "xapp1"} {
+		resp, clientEndpoint := createTestNotification("restSubId-" + host)
+		clientEndpoint.Host = host
+		outbox.Send("restSubId-"+host, resp, clientEndpoint)
+	}
+	outbox.waitFirstTries()
+	assert.Equal(t, 2, len(outbox.GetUndelivered().Pending))
+
+	retried := make(chan struct{})
+	go func() {
+		outbox.RetryDueNotifications(time.Now().Add(time.Second))
+		close(retried)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(outbox.GetUndelivered().Pending) == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "restSubId-unreachable", outbox.GetUndelivered().Pending[0].RestSubId)
+
+	close(release)
+	<-retried
+}
+
+func TestNotificationOutboxNoRetryAfterRestSubscriptionDeleted(t *testing.T) {
+	release := make(chan struct{})
+	outbox, dbMock := createTestNotificationOutbox(t, func(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+		<-release
+		return fmt.Errorf("Test notify failure")
+	}, 3)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	resp, clientEndpoint = createTestNotification("restSubId1")
+	outbox.Send("restSubId1", resp, clientEndpoint)
+	outbox.DeleteRestSubscriptionNotifications("restSubId1")
+
+	close(release)
+	outbox.waitFirstTries()
+	undelivered := outbox.GetUndelivered()
+	assert.Equal(t, 0, len(undelivered.Pending))
+	assert.Equal(t, 0, len(dbMock.db))
+}
@@ -0,0 +1,138 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/submgr/pkg/notifsign"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const notificationPath = "/ric/v1/subscriptions/response"
+const notificationHttpTimeout = 5 * time.Second
+const secretFilePrefix = "file:"
+
+//-----------------------------------------------------------------------------
+// Sender for REST notifications. Notifications are signed with HMAC and/or
+// sent over mTLS when notification security is configured. Otherwise they
+// are sent over plain http to the same path as xapp.Subscription.Notify
+// sends them.
+//-----------------------------------------------------------------------------
+type NotificationSender struct {
+	httpClient *http.Client
+	scheme     string
+	secrets    map[string][]byte
+}
+
+type NotificationSecurityConfig struct {
+	HmacSecrets map[string]string // xApp http service name -> secret or "file:<path>"
+	TlsCertFile string
+	TlsKeyFile  string
+	TlsCaFile   string
+}
+
+func NewNotificationSender(config *NotificationSecurityConfig) (*NotificationSender, error) {
+
+	s := &NotificationSender{
+		httpClient: &http.Client{Timeout: notificationHttpTimeout},
+		scheme:     "http",
+		secrets:    make(map[string][]byte),
+	}
+
+	for xAppServiceName, secret := range config.HmacSecrets {
+		if strings.HasPrefix(secret, secretFilePrefix) {
+			data, err := os.ReadFile(strings.TrimPrefix(secret, secretFilePrefix))
+			if err != nil {
+				return nil, fmt.Errorf("Reading notification secret of %s failed: %s", xAppServiceName, err.Error())
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("Empty notification secret for %s", xAppServiceName)
+		}
+		s.secrets[xAppServiceName] = []byte(secret)
+	}
+
+	if config.TlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Loading notification client certificate failed: %s", err.Error())
+		}
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if config.TlsCaFile != "" {
+			caCert, err := os.ReadFile(config.TlsCaFile)
+			if err != nil {
+				return nil, fmt.Errorf("Reading notification CA certificate failed: %s", err.Error())
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+				return nil, fmt.Errorf("No certificates found in %s", config.TlsCaFile)
+			}
+		}
+		s.httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		s.scheme = "https"
+	}
+	return s, nil
+}
+
+func (s *NotificationSender) Notify(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+
+	if clientEndpoint.HTTPPort == nil {
+		return fmt.Errorf("Notification endpoint %s has no HTTP port", clientEndpoint.Host)
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("Notification json.Marshal error: %s", err.Error())
+	}
+
+	url := fmt.Sprintf("%s://%s:%d%s", s.scheme, clientEndpoint.Host, *clientEndpoint.HTTPPort, notificationPath)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret, ok := s.secrets[clientEndpoint.Host]; ok {
+		notifsign.SignRequest(req, secret, body, time.Now())
+	} else if len(s.secrets) != 0 {
+		xapp.Logger.Warn("No notification secret configured for %s. Sending unsigned notification", clientEndpoint.Host)
+	}
+
+	httpResp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return fmt.Errorf("Notification to %s failed with status %s", url, httpResp.Status)
+	}
+	return nil
+}
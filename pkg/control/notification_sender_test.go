@@ -0,0 +1,112 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/submgr/pkg/notifsign"
+	"github.com/stretchr/testify/assert"
+)
+
+func createNotificationTestServer(t *testing.T, secret []byte, statusCode int) (*httptest.Server, int64, *int) {
+	received := 0
+	server := httptest.NewServer(notifsign.Handler(secret, notifsign.DefaultMaxAge, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, notificationPath, req.URL.Path)
+		received++
+		w.WriteHeader(statusCode)
+	})))
+	t.Cleanup(server.Close)
+
+	_, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.ParseInt(portString, 10, 64)
+	return server, port, &received
+}
+
+func TestNotificationSenderSignsNotification(t *testing.T) {
+	_, port, received := createNotificationTestServer(t, []byte("secret1"), http.StatusOK)
+
+	sender, err := NewNotificationSender(&NotificationSecurityConfig{HmacSecrets: map[string]string{"127.0.0.1": "secret1"}})
+	assert.Nil(t, err)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	clientEndpoint.Host = "127.0.0.1"
+	clientEndpoint.HTTPPort = &port
+	assert.Nil(t, sender.Notify(resp, clientEndpoint))
+	assert.Equal(t, 1, *received)
+}
+
+func TestNotificationSenderWrongSecret(t *testing.T) {
+	_, port, received := createNotificationTestServer(t, []byte("secret1"), http.StatusOK)
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	assert.Nil(t, os.WriteFile(secretFile, []byte("secret2\n"), 0600))
+	sender, err := NewNotificationSender(&NotificationSecurityConfig{HmacSecrets: map[string]string{"127.0.0.1": secretFilePrefix + secretFile}})
+	assert.Nil(t, err)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	clientEndpoint.Host = "127.0.0.1"
+	clientEndpoint.HTTPPort = &port
+	assert.NotNil(t, sender.Notify(resp, clientEndpoint))
+	assert.Equal(t, 0, *received)
+}
+
+func TestNotificationSenderPlainHttp(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	_, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.ParseInt(portString, 10, 64)
+
+	sender, err := NewNotificationSender(&NotificationSecurityConfig{})
+	assert.Nil(t, err)
+
+	resp, clientEndpoint := createTestNotification("restSubId1")
+	resp.NotificationType = notificationTypeDeleted
+	resp.SubscriptionInstances[0].DeleteState = subsDeleteStateDeleted
+	clientEndpoint.Host = "127.0.0.1"
+	clientEndpoint.HTTPPort = &port
+	assert.Nil(t, sender.Notify(resp, clientEndpoint))
+	assert.Equal(t, notificationTypeDeleted, body["NotificationType"])
+	instances, _ := body["SubscriptionInstances"].([]interface{})
+	assert.Equal(t, 1, len(instances))
+	instance, _ := instances[0].(map[string]interface{})
+	assert.Equal(t, subsDeleteStateDeleted, instance["DeleteState"])
+}
+
+func TestNotificationSenderInvalidConfig(t *testing.T) {
+	_, err := NewNotificationSender(&NotificationSecurityConfig{HmacSecrets: map[string]string{"xapp": ""}})
+	assert.NotNil(t, err)
+
+	_, err = NewNotificationSender(&NotificationSecurityConfig{HmacSecrets: map[string]string{"xapp": secretFilePrefix + "/nonexistent"}})
+	assert.NotNil(t, err)
+
+	_, err = NewNotificationSender(&NotificationSecurityConfig{TlsCertFile: "/nonexistent", TlsKeyFile: "/nonexistent"})
+	assert.NotNil(t, err)
+}
@@ -20,8 +20,12 @@
 package control
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -45,6 +49,17 @@ type RESTSubscription struct {
 	SubReqOngoing    bool
 	SubDelReqOngoing bool
 	lastReqMd5sum    string
+	// Used when lastReqMd5sum is idempotency key supplied by xApp
+	idempotencyKeyExpiry time.Time
+	// Subscription is deleted when lease is not renewed before expiry. Zero duration means no lease
+	leaseDuration time.Duration
+	leaseExpiry   time.Time
+	// Notification of every deleted E2 subscription is sent to this endpoint if xApp has requested it
+	deleteNotifyEndpoint *models.SubscriptionParamsClientEndpoint
+	// Notifications of E2 subscriptions deleted by submgr, e.g. pre-empted ones, are sent to this endpoint
+	clientEndpoint *models.SubscriptionParamsClientEndpoint
+	// Ongoing processing of subscription requests. Nil if processing is not ongoing
+	processing *restSubsProcessing
 }
 
 func (r *RESTSubscription) AddE2InstanceId(instanceId uint32) {
@@ -62,13 +77,30 @@ func (r *RESTSubscription) AddE2InstanceId(instanceId uint32) {
 func (r *RESTSubscription) AddMd5Sum(md5sum string) {
 	if md5sum != "" {
 		r.lastReqMd5sum = md5sum
+		if IsIdempotencyKey(md5sum) {
+			r.idempotencyKeyExpiry = time.Now().Add(idempotencyKeyRetention)
+		}
 	} else {
 		xapp.Logger.Error("EMPTY md5sum attempted to be add to subscrition")
 	}
 }
 
 func (r *RESTSubscription) DeleteE2InstanceId(instanceId uint32) {
-	r.InstanceIds = r.InstanceIds[1:]
+	for i, v := range r.InstanceIds {
+		if v == instanceId {
+			r.InstanceIds = append(r.InstanceIds[:i], r.InstanceIds[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *RESTSubscription) hasE2InstanceId(instanceId uint32) bool {
+	for _, v := range r.InstanceIds {
+		if v == instanceId {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *RESTSubscription) AddXappIdToE2Id(xAppEventInstanceID int64, e2EventInstanceID int64) {
@@ -87,21 +119,41 @@ func (r *RESTSubscription) SetProcessed(err error) {
 	r.SubReqOngoing = false
 	if err != nil {
 		r.lastReqMd5sum = ""
+		r.idempotencyKeyExpiry = time.Time{}
 	}
 }
 
 type Registry struct {
-	mutex             *sync.Mutex
-	register          map[uint32]*Subscription
-	subIds            []uint32
+	mutex             *sync.Mutex              // Guards global index, i.e. fields other than shards
+	register          map[uint32]*Subscription // Subscriptions with RIC wide instance ids
+	subIds            []uint32                 // Free RIC wide ids for subscriptions having RMR route
+	perRanIdUse       map[uint32]int           // Number of RANs using id in their pool
+	routedIds         map[uint32]string        // RAN name of E2 node using RIC wide id of routed subscription
 	rtmgrClient       *RtmgrClient
 	restSubscriptions map[string]*RESTSubscription
+	restSubsDeletions map[string]*restSubscriptionDeletion // Kept until delete notifications are delivered
+	e2Cleanups        map[e2SubsKey]*e2Cleanup
+	quarantine        map[e2SubsKey]time.Time // Released ids and end of their quarantine
+	quarantineQueue   []e2SubsKey             // Quarantined ids in order of release
+	quarantineDb      Sdlnterface
+	e2CleanupDb       Sdlnterface
+	shardsMutex       *sync.RWMutex
+	shards            map[string]*registryShard // Subscriptions of E2 nodes by RAN name
+	quotaCounters     quotaCounters
 }
 
 func (r *Registry) Initialize() {
 	r.mutex = new(sync.Mutex)
 	r.register = make(map[uint32]*Subscription)
+	r.perRanIdUse = make(map[uint32]int)
+	r.routedIds = make(map[uint32]string)
 	r.restSubscriptions = make(map[string]*RESTSubscription)
+	r.restSubsDeletions = make(map[string]*restSubscriptionDeletion)
+	r.e2Cleanups = make(map[e2SubsKey]*e2Cleanup)
+	r.quarantine = make(map[e2SubsKey]time.Time)
+	r.shardsMutex = new(sync.RWMutex)
+	r.shards = make(map[string]*registryShard)
+	r.quotaCounters = newQuotaCounters()
 
 	var i uint32
 	for i = 1; i < 65535; i++ {
@@ -111,15 +163,82 @@ func (r *Registry) Initialize() {
 
 func (r *Registry) GetAllRestSubscriptionsJson() []byte {
 
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	restSubscriptionsJson, err := json.Marshal(r.restSubscriptions)
+	restSubscriptionsJson, _, err := r.GetRestSubscriptionsJson(&SubscriptionFilter{})
 	if err != nil {
 		xapp.Logger.Error("GetAllRestSubscriptions() json.Marshal error: %v", err)
 	}
 	return restSubscriptionsJson
 }
 
+//-----------------------------------------------------------------------------
+// Returns json of REST subscriptions matching the filter and cursor of the
+// next page. Subscriptions are copied under registry mutex and encoded after
+// releasing it.
+//-----------------------------------------------------------------------------
+func (r *Registry) GetRestSubscriptionsJson(filter *SubscriptionFilter) ([]byte, string, error) {
+
+	restSubscriptions, nextCursor := r.GetRestSubscriptions(filter)
+	restSubscriptionsJson, err := SelectFields(restSubscriptions, filter.Fields)
+	return restSubscriptionsJson, nextCursor, err
+}
+
+func (r *Registry) GetRestSubscriptions(filter *SubscriptionFilter) (map[string]RESTSubscription, string) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	restSubIds := make([]string, 0, len(r.restSubscriptions))
+	for restSubId := range r.restSubscriptions {
+		if restSubId > filter.Cursor {
+			restSubIds = append(restSubIds, restSubId)
+		}
+	}
+	sort.Strings(restSubIds)
+
+	restSubscriptions := make(map[string]RESTSubscription)
+	lastRestSubId := ""
+	for _, restSubId := range restSubIds {
+		restSubscription := r.restSubscriptions[restSubId]
+		if !r.restSubscriptionMatches(restSubscription, filter) {
+			continue
+		}
+		if filter.pageFull(len(restSubscriptions)) {
+			return restSubscriptions, lastRestSubId
+		}
+		restSubscriptions[restSubId] = *restSubscription
+		lastRestSubId = restSubId
+	}
+	return restSubscriptions, ""
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-----------------------------------------------------------------------------
+func (r *Registry) restSubscriptionMatches(restSubscription *RESTSubscription, filter *SubscriptionFilter) bool {
+
+	if filter.Meid != "" && restSubscription.Meid != filter.Meid {
+		return false
+	}
+	if filter.XappServiceName != "" && restSubscription.xAppServiceName != filter.XappServiceName {
+		return false
+	}
+	if filter.State != "" && restSubscriptionState(restSubscription) != filter.State {
+		return false
+	}
+	if !filter.matchCreated(restSubscriptionCreated(restSubscription)) {
+		return false
+	}
+	if filter.RanFunctionId != nil {
+		for _, instanceId := range restSubscription.InstanceIds {
+			if subs, ok := r.getSubs(restSubscription.Meid, instanceId); ok && filter.matchRanFunctionId(int64(subs.SubReqMsg.FunctionId)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
 func (r *Registry) GetAllE2NodeRestSubscriptionsJson(ranName string) []byte {
 
 	restSubscriptions := r.GetAllE2NodeRestSubscriptions(ranName)
@@ -216,7 +335,7 @@ func (r *Registry) GetE2SubscriptionsJson(restSubsId string) ([]byte, error) {
 	r.mutex.Lock()
 	var e2Subscriptions []Subscription
 	for _, e2SubId := range restSubs.InstanceIds {
-		e2Subscription, ok := r.register[e2SubId]
+		e2Subscription, ok := r.getSubs(restSubs.Meid, e2SubId)
 		if ok {
 			e2Subscriptions = append(e2Subscriptions, *e2Subscription)
 		}
@@ -233,7 +352,7 @@ func (r *Registry) CreateRESTSubscription(restSubId *string, xappServiceName *st
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	newRestSubscription := RESTSubscription{}
-	newRestSubscription.Created = time.Now().Format("2006-01-02 15:04:05.000")
+	newRestSubscription.Created = time.Now().Format(restSubsCreatedFormat)
 	newRestSubscription.xAppServiceName = *xappServiceName
 	newRestSubscription.xAppRmrEndPoint = *xAppRmrEndPoint
 	newRestSubscription.Meid = *maid
@@ -241,7 +360,7 @@ func (r *Registry) CreateRESTSubscription(restSubId *string, xappServiceName *st
 	newRestSubscription.SubDelReqOngoing = false
 	r.restSubscriptions[*restSubId] = &newRestSubscription
 	newRestSubscription.xAppIdToE2Id = make(map[int64]int64)
-	xapp.Logger.Debug("Registry: Created REST subscription successfully. restSubId=%v, subscriptionCount=%v, e2apSubscriptionCount=%v", *restSubId, len(r.restSubscriptions), len(r.register))
+	xapp.Logger.Debug("Registry: Created REST subscription successfully. restSubId=%v, subscriptionCount=%v, e2apSubscriptionCount=%v", *restSubId, len(r.restSubscriptions), r.getSubsCount())
 	return &newRestSubscription
 }
 
@@ -252,6 +371,45 @@ func (r *Registry) DeleteRESTSubscription(restSubId *string) {
 	xapp.Logger.Debug("Registry: Deleted REST subscription successfully. restSubId=%v, subscriptionCount=%v", *restSubId, len(r.restSubscriptions))
 }
 
+//-------------------------------------------------------------------
+// E2 instance ids of REST subscription are changed also when another
+// xApp pre-empts its E2 subscriptions, so they are accessed only
+// under registry mutex
+//-------------------------------------------------------------------
+func (r *Registry) AddRESTSubscriptionInstance(restSubscription *RESTSubscription, xAppEventInstanceID int64, e2EventInstanceID int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	restSubscription.AddE2InstanceId(uint32(e2EventInstanceID))
+	restSubscription.AddXappIdToE2Id(xAppEventInstanceID, e2EventInstanceID)
+}
+
+func (r *Registry) DeleteRESTSubscriptionInstance(restSubscription *RESTSubscription, xAppEventInstanceID int64, e2EventInstanceID uint32) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	restSubscription.DeleteXappIdToE2Id(xAppEventInstanceID)
+	restSubscription.DeleteE2InstanceId(e2EventInstanceID)
+}
+
+//-------------------------------------------------------------------
+// Returns copies of E2 instance ids and xApp instance id mapping
+//-------------------------------------------------------------------
+func (r *Registry) GetRESTSubscriptionInstances(restSubscription *RESTSubscription) ([]uint32, map[int64]int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var instanceIds []uint32
+	if restSubscription.InstanceIds != nil {
+		instanceIds = append(make([]uint32, 0, len(restSubscription.InstanceIds)), restSubscription.InstanceIds...)
+	}
+	var xAppIdToE2Id map[int64]int64
+	if restSubscription.xAppIdToE2Id != nil {
+		xAppIdToE2Id = make(map[int64]int64, len(restSubscription.xAppIdToE2Id))
+		for xAppEventInstanceID, e2EventInstanceID := range restSubscription.xAppIdToE2Id {
+			xAppIdToE2Id[xAppEventInstanceID] = e2EventInstanceID
+		}
+	}
+	return instanceIds, xAppIdToE2Id
+}
+
 func (r *Registry) GetRESTSubscription(restSubId string, IsDelReqOngoing bool) (*RESTSubscription, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -271,57 +429,147 @@ func (r *Registry) GetRESTSubscription(restSubId string, IsDelReqOngoing bool) (
 }
 
 func (r *Registry) QueryHandler() (models.SubscriptionList, error) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	resp, _, err := r.QueryE2Subscriptions(&SubscriptionFilter{})
+	return resp, err
+}
+
+//-----------------------------------------------------------------------------
+// Returns E2 subscriptions matching the filter and cursor of the next page
+//-----------------------------------------------------------------------------
+func (r *Registry) QueryE2Subscriptions(filter *SubscriptionFilter) (models.SubscriptionList, string, error) {
+
+	var cursor uint64
+	if filter.Cursor != "" {
+		var err error
+		if cursor, err = strconv.ParseUint(filter.Cursor, 10, 32); err != nil {
+			return nil, "", fmt.Errorf("Registry: Invalid cursor %s", filter.Cursor)
+		}
+	}
+
+	// Subscriptions are collected shard by shard and matched without registry mutex
+	var allSubs []*Subscription
+	for _, subs := range r.getAllSubs() {
+		if uint64(subs.ReqId.InstanceId) > cursor {
+			allSubs = append(allSubs, subs)
+		}
+	}
+	sort.Slice(allSubs, func(i, j int) bool {
+		if allSubs[i].ReqId.InstanceId != allSubs[j].ReqId.InstanceId {
+			return allSubs[i].ReqId.InstanceId < allSubs[j].ReqId.InstanceId
+		}
+		return allSubs[i].Meid.RanName < allSubs[j].Meid.RanName
+	})
 
 	resp := models.SubscriptionList{}
-	for _, subs := range r.register {
+	var lastSubId uint32
+	for _, subs := range allSubs {
+		subId := subs.ReqId.InstanceId
 		subs.mutex.Lock()
-		resp = append(resp, &models.SubscriptionData{SubscriptionID: int64(subs.ReqId.InstanceId), Meid: subs.Meid.RanName, ClientEndpoint: subs.EpList.StringList()})
+		if e2SubscriptionMatches(subs, filter) {
+			// Per RAN instance ids can be same in many E2 nodes. Page is not cut between them as cursor is instance id.
+			if filter.pageFull(len(resp)) && subId != lastSubId {
+				subs.mutex.Unlock()
+				return resp, strconv.FormatUint(uint64(lastSubId), 10), nil
+			}
+			resp = append(resp, &models.SubscriptionData{SubscriptionID: int64(subs.ReqId.InstanceId), Meid: subs.Meid.RanName, ClientEndpoint: subs.EpList.StringList()})
+			lastSubId = subId
+		}
 		subs.mutex.Unlock()
 	}
-	return resp, nil
+	return resp, "", nil
 }
 
-func (r *Registry) allocateSubs(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, resetTestFlag bool, rmrRoutecreated bool) (*Subscription, error) {
-	if len(r.subIds) > 0 {
-		subId := r.subIds[0]
-		r.subIds = r.subIds[1:]
-		if _, ok := r.register[subId]; ok == true {
-			r.subIds = append(r.subIds, subId)
-			return nil, fmt.Errorf("Registry: Failed to reserve subscription exists")
-		}
-		subs := &Subscription{
-			registry:         r,
-			Meid:             trans.Meid,
-			RMRRouteCreated:  rmrRoutecreated,
-			SubReqMsg:        subReqMsg,
-			OngoingReqCount:  0,
-			OngoingDelCount:  0,
-			valid:            true,
-			PolicyUpdate:     false,
-			RetryFromXapp:    false,
-			SubRespRcvd:      false,
-			DeleteFromDb:     false,
-			NoRespToXapp:     false,
-			DoNotWaitSubResp: false,
-		}
-		subs.ReqId.Id = subReqMsg.RequestId.Id
-		subs.ReqId.InstanceId = subId
-		r.SetResetTestFlag(resetTestFlag, subs)
+//-----------------------------------------------------------------------------
+// Must be called with subs.mutex locked. xApp service name of E2 subscription
+// is matched against RMR endpoints of the subscription.
+//-----------------------------------------------------------------------------
+func e2SubscriptionMatches(subs *Subscription, filter *SubscriptionFilter) bool {
 
-		if subs.EpList.AddEndpoint(trans.GetEndpoint()) == false {
-			r.subIds = append(r.subIds, subs.ReqId.InstanceId)
-			return nil, fmt.Errorf("Registry: Endpoint existing already in subscription")
+	if filter.Meid != "" && (subs.Meid == nil || subs.Meid.RanName != filter.Meid) {
+		return false
+	}
+	if filter.XappServiceName != "" {
+		found := false
+		for _, endpoint := range subs.EpList.Endpoints {
+			if endpoint.Addr == filter.XappServiceName {
+				found = true
+				break
+			}
 		}
-		return subs, nil
+		if !found {
+			return false
+		}
+	}
+	if filter.State != "" && e2SubscriptionState(subs) != filter.State {
+		return false
+	}
+	if subs.SubReqMsg != nil && !filter.matchRanFunctionId(int64(subs.SubReqMsg.FunctionId)) {
+		return false
 	}
-	return nil, fmt.Errorf("Registry: Failed to reserve subscription no free ids")
+	return filter.matchCreated(subs.Created)
 }
 
-func (r *Registry) findExistingSubs(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest) (*Subscription, bool) {
+//-------------------------------------------------------------------
+// Registry mutex is locked only while quotas are checked and instance
+// id is allocated. Returns QuotaExceededError if quota would be exceeded.
+//-------------------------------------------------------------------
+func (r *Registry) allocateSubs(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, resetTestFlag bool, rmrRoutecreated bool) (*Subscription, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.checkQuotasLocked(trans.GetEndpoint().Addr, trans.GetMeid().RanName, []int64{int64(subReqMsg.FunctionId)}, true); err != nil {
+		return nil, err
+	}
+
+	subId, err := r.allocateSubId(trans.GetMeid().RanName, rmrRoutecreated)
+	if err != nil {
+		return nil, err
+	}
+	ricRequestorId := getRicRequestorIdConfig().resolve(trans.GetEndpoint().Addr)
+	subs := &Subscription{
+		registry:         r,
+		Created:          time.Now(),
+		Meid:             trans.Meid,
+		RMRRouteCreated:  rmrRoutecreated,
+		SubReqMsg:        subReqMsg,
+		OngoingReqCount:  0,
+		OngoingDelCount:  0,
+		valid:            true,
+		PolicyUpdate:     false,
+		RetryFromXapp:    false,
+		SubRespRcvd:      false,
+		DeleteFromDb:     false,
+		NoRespToXapp:     false,
+		DoNotWaitSubResp: false,
+		PerRanInstanceId: true,
+		RicRequestorId:   &ricRequestorId,
+	}
+	subs.ReqId.Id = subReqMsg.RequestId.Id
+	subs.ReqId.InstanceId = subId
+	if isPolicySubsReq(subReqMsg) {
+		subs.Policy.Version = 1
+	}
+	if _, ok := r.getSubs(subs.Meid.RanName, subId); ok == true {
+		r.releaseSubId(subs)
+		return nil, fmt.Errorf("Registry: Failed to reserve subscription exists")
+	}
+	r.SetResetTestFlag(resetTestFlag, subs)
 
-	for _, subs := range r.register {
+	if subs.EpList.AddEndpoint(trans.GetEndpoint()) == false {
+		r.releaseSubId(subs)
+		return nil, fmt.Errorf("Registry: Endpoint existing already in subscription")
+	}
+	r.startQuotaCount(subs)
+	return subs, nil
+}
+
+//-------------------------------------------------------------------
+// Must be called with shard opMutex of the E2 node locked. Subscription
+// is not modified, xApp is added to it with joinSubs.
+//-------------------------------------------------------------------
+func (r *Registry) findExistingSubs(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, sharing SubscriptionSharing) (*Subscription, bool) {
+
+	for _, subs := range r.getMergeCandidates(trans.GetMeid().RanName, subReqMsg) {
 		if subs.IsMergeable(trans, subReqMsg) {
 
 			//
@@ -338,8 +586,11 @@ func (r *Registry) findExistingSubs(trans *TransactionXapp, subReqMsg *e2ap.E2AP
 				subs.mutex.Unlock()
 				continue
 			}
-			// Try to add to endpointlist. Adding fails if endpoint is already in the list
-			if subs.EpList.AddEndpoint(trans.GetEndpoint()) == false {
+			if isJoinable(subs, trans.GetEndpoint(), sharing) == false {
+				subs.mutex.Unlock()
+				continue
+			}
+			if subs.EpList.HasEndpoint(trans.GetEndpoint()) == true {
 				subs.mutex.Unlock()
 				xapp.Logger.Debug("Registry: Subs with requesting endpoint found. %s for %s", subs.String(), trans.String())
 				return subs, true
@@ -353,12 +604,151 @@ func (r *Registry) findExistingSubs(trans *TransactionXapp, subReqMsg *e2ap.E2AP
 	return nil, false
 }
 
-func (r *Registry) AssignToSubscription(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, resetTestFlag bool, c *Control, createRMRRoute bool) (*Subscription, ErrorInfo, error) {
+//-------------------------------------------------------------------
+// Must be called with shard opMutex of the E2 node locked. Quota of the
+// xApp is checked and xApp is added to subscription under registry mutex.
+// Returns false if subscription is not mergeable anymore.
+//-------------------------------------------------------------------
+func (r *Registry) joinSubs(subs *Subscription, trans *TransactionXapp) (bool, error) {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+
+	if subs.valid == false || subs.EpList.Size() == 0 {
+		return false, nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.checkQuotasLocked(trans.GetEndpoint().Addr, trans.GetMeid().RanName, []int64{int64(subs.SubReqMsg.FunctionId)}, false); err != nil {
+		return false, err
+	}
+	if subs.EpList.AddEndpoint(trans.GetEndpoint()) == false {
+		return false, nil
+	}
+	r.countQuotaXapp(subs, trans.GetEndpoint().Addr, 1)
+	return true, nil
+}
+
+//-----------------------------------------------------------------------------
+// Decision how E2 subscription request is assigned to subscriptions
+//-----------------------------------------------------------------------------
+type subscriptionAssignment struct {
+	subs          *Subscription // Existing subscription to join or update, nil if new one is allocated
+	endPointFound bool
+	policyUpdate  bool
+	conflict      *actionConflict
+	sharing       SubscriptionSharing // Resolved sharing of the request
+}
+
+//-------------------------------------------------------------------
+// Must be called with shard opMutex of the E2 node locked. Decides how
+// request is assigned without modifying registry, so that processing
+// and validation of requests make the same decision. Quotas are checked
+// again when subscription is joined or allocated.
+//-------------------------------------------------------------------
+func (r *Registry) decideAssignment(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, actionType uint64, sharing SubscriptionSharing) (*subscriptionAssignment, ErrorInfo, error) {
+	assignment := &subscriptionAssignment{}
+	errorInfo := ErrorInfo{}
+
+	//
+	// Find possible existing Policy subscription
+	//
+	if actionType == e2ap.E2AP_ActionTypePolicy {
+		r.mutex.Lock()
+		subs, ok := r.getSubs(trans.GetMeid().RanName, trans.GetSubId())
+		r.mutex.Unlock()
+		if ok {
+			assignment.subs = subs
+			assignment.policyUpdate = true
+			return assignment, errorInfo, nil
+		}
+	}
+
+	//
+	// Check conflicts with POLICY and INSERT subscriptions of other xApps
+	//
+	if assignment.conflict = r.findActionConflict(trans, subReqMsg, actionType); assignment.conflict != nil && assignment.conflict.preempt == false {
+		err := assignment.conflict.err()
+		return assignment, newActionConflictErrorInfo(assignment.conflict, err), err
+	}
+
+	assignment.sharing = getSubscriptionSharingConfig().resolve(trans.GetEndpoint().Addr, sharing)
+	assignment.subs, assignment.endPointFound = r.findExistingSubs(trans, subReqMsg, assignment.sharing)
+	if assignment.subs == nil && assignment.sharing == SubscriptionSharingMustJoinExisting {
+		errorInfo, err := noSubscriptionToJoin(trans)
+		return assignment, errorInfo, err
+	}
+
+	// Pre-empted subscriptions release their quota
+	if assignment.endPointFound == false && assignment.conflict == nil {
+		err := r.checkQuotas(trans.GetEndpoint().Addr, trans.GetMeid().RanName, []int64{int64(subReqMsg.FunctionId)}, assignment.subs == nil)
+		if err != nil {
+			return assignment, newQuotaExceededErrorInfo(err), err
+		}
+	}
+	return assignment, errorInfo, nil
+}
+
+func noSubscriptionToJoin(trans *TransactionXapp) (ErrorInfo, error) {
+	errorInfo := ErrorInfo{}
+	err := fmt.Errorf("No existing subscription to join for %s", trans.String())
+	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+	errorInfo.SetCode(ErrorCodeSubmgrNoSubscriptionToJoin)
+	return errorInfo, err
+}
+
+func newQuotaExceededErrorInfo(err error) ErrorInfo {
+	errorInfo := ErrorInfo{}
+	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+	errorInfo.SetCode(ErrorCodeSubmgrQuotaExceeded)
+	return errorInfo
+}
+
+//-------------------------------------------------------------------
+// Subscriptions pre-empted by the request are deleted before the
+// request is assigned. Shard of the E2 node is not locked while they
+// are deleted, so the assignment is decided again after deletion.
+//-------------------------------------------------------------------
+const maxPreemptionRounds = 3
+
+func (r *Registry) AssignToSubscription(ctx context.Context, trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, resetTestFlag bool, c *Control, createRMRRoute bool, sharing SubscriptionSharing) (*Subscription, ErrorInfo, error) {
+	for round := 1; ; round++ {
+		subs, errorInfo, err := r.assignToSubscription(ctx, trans, subReqMsg, resetTestFlag, c, createRMRRoute, sharing)
+		var preemption *preemptionRequiredError
+		if errors.As(err, &preemption) == false {
+			return subs, errorInfo, err
+		}
+		conflict := preemption.conflict
+		if round == maxPreemptionRounds {
+			err = fmt.Errorf("%s. Conflicting subscriptions were re-created while pre-empting them", conflict.err().Error())
+			return r.assignRejected(c, newActionConflictErrorInfo(conflict, err), err)
+		}
+		if err = c.preemptSubscriptions(ctx, conflict.subs, trans); err != nil {
+			return r.assignRejected(c, newActionConflictErrorInfo(conflict, err), err)
+		}
+	}
+}
+
+func newActionConflictErrorInfo(conflict *actionConflict, err error) ErrorInfo {
+	errorInfo := ErrorInfo{}
+	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+	errorInfo.SetCode(ErrorCodeSubmgrActionConflict)
+	errorInfo.ConflictingSubIds = conflict.subIds()
+	return errorInfo
+}
+
+//-------------------------------------------------------------------
+// Returns preemptionRequiredError if subscriptions need to be deleted
+// before the request can be assigned
+//-------------------------------------------------------------------
+func (r *Registry) assignToSubscription(ctx context.Context, trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, resetTestFlag bool, c *Control, createRMRRoute bool, sharing SubscriptionSharing) (*Subscription, ErrorInfo, error) {
 	var err error
 	var newAlloc bool
 	errorInfo := ErrorInfo{}
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+
+	// Subscriptions of other E2 nodes are processed in parallel
+	shard := r.lockShard(trans.GetMeid().RanName)
+	defer shard.opMutex.Unlock()
 
 	//
 	// Check validity of subscription action types
@@ -367,31 +757,68 @@ func (r *Registry) AssignToSubscription(trans *TransactionXapp, subReqMsg *e2ap.
 	if err != nil {
 		xapp.Logger.Debug("CREATE %s", err)
 		err = fmt.Errorf("E2 content validation failed")
+		errorInfo.SetCode(ErrorCodeSubmgrContentValidation)
 		return nil, errorInfo, err
 	}
 
+	assignment, errorInfo, err := r.decideAssignment(trans, subReqMsg, actionType, sharing)
+	if err != nil {
+		return r.assignRejected(c, errorInfo, err)
+	}
+
 	//
-	// Find possible existing Policy subscription
+	// Update existing Policy subscription
 	//
-	if actionType == e2ap.E2AP_ActionTypePolicy {
-		if subs, ok := r.register[trans.GetSubId()]; ok {
-			xapp.Logger.Debug("CREATE %s. Existing subscription for Policy found.", subs.String())
-			// Update message data to subscription
-			subs.SubReqMsg = subReqMsg
-			subs.PolicyUpdate = true
-			subs.SetCachedResponse(nil, true)
-			r.SetResetTestFlag(resetTestFlag, subs)
-			return subs, errorInfo, nil
-		}
+	subs := assignment.subs
+	if assignment.policyUpdate {
+		xapp.Logger.Debug("CREATE %s. Existing subscription for Policy found.", subs.String())
+		// Update message data to subscription. Acknowledged policy is restored if update fails
+		subs.mutex.Lock()
+		subs.SubReqMsg = subReqMsg
+		r.addToMergeIndex(subs)
+		subs.PolicyUpdate = true
+		subs.Policy.Version++
+		subs.mutex.Unlock()
+		subs.SetCachedResponse(nil, true)
+		r.SetResetTestFlag(resetTestFlag, subs)
+		return subs, errorInfo, nil
+	}
+
+	if assignment.conflict != nil {
+		return nil, errorInfo, &preemptionRequiredError{conflict: assignment.conflict}
 	}
 
-	subs, endPointFound := r.findExistingSubs(trans, subReqMsg)
+	//
+	// Join to existing subscription. Subscription may have been changed after it was found.
+	//
+	endPointFound := assignment.endPointFound
+	for subs != nil && endPointFound == false {
+		joined, err := r.joinSubs(subs, trans)
+		if err != nil {
+			return r.assignRejected(c, newQuotaExceededErrorInfo(err), err)
+		}
+		if joined == true {
+			xapp.Logger.Debug("Registry: Joined to subs %s for %s", subs.String(), trans.String())
+			break
+		}
+		subs, endPointFound = r.findExistingSubs(trans, subReqMsg, assignment.sharing)
+	}
+	if subs == nil && assignment.sharing == SubscriptionSharingMustJoinExisting {
+		errorInfo, err = noSubscriptionToJoin(trans)
+		return r.assignRejected(c, errorInfo, err)
+	}
 	if subs == nil {
 		if subs, err = r.allocateSubs(trans, subReqMsg, resetTestFlag, createRMRRoute); err != nil {
+			var quotaErr *QuotaExceededError
+			if errors.As(err, &quotaErr) {
+				return r.assignRejected(c, newQuotaExceededErrorInfo(err), err)
+			}
 			xapp.Logger.Error("%s", err.Error())
 			err = fmt.Errorf("subscription not allocated")
+			errorInfo.SetCode(ErrorCodeSubmgrIdAllocationFailure)
 			return nil, errorInfo, err
 		}
+		subs.Exclusive = assignment.sharing == SubscriptionSharingExclusive
 		newAlloc = true
 	} else if endPointFound == true {
 		// Requesting endpoint is already present in existing subscription. This can happen if xApp is restarted.
@@ -410,42 +837,65 @@ func (r *Registry) AssignToSubscription(trans *TransactionXapp, subReqMsg *e2ap.
 	epamount := subs.EpList.Size()
 	xapp.Logger.Debug("AssignToSubscription subs.EpList.Size()=%v", subs.EpList.Size())
 
-	r.mutex.Unlock()
 	//
-	// Subscription route updates
+	// Subscription route updates. Only the E2 node shard is locked while waiting routing manager.
 	//
 	if createRMRRoute == true {
 		if epamount == 1 {
-			errorInfo, err = r.RouteCreate(subs, c)
+			errorInfo, err = r.RouteCreate(ctx, subs, c)
 		} else {
-			errorInfo, err = r.RouteCreateUpdate(subs, c)
+			errorInfo, err = r.RouteCreateUpdate(ctx, subs, c)
 		}
 	} else {
 		xapp.Logger.Debug("RMR route not created: createRMRRoute=%v", createRMRRoute)
 	}
-	r.mutex.Lock()
 
 	if err != nil {
+		r.mutex.Lock()
 		if newAlloc {
-			r.subIds = append(r.subIds, subs.ReqId.InstanceId)
+			r.stopQuotaCount(subs)
+			r.releaseSubId(subs)
 		}
 		// Delete already added endpoint for the request
 		subs.EpList.DelEndpoint(trans.GetEndpoint())
+		r.countQuotaXapp(subs, trans.GetEndpoint().Addr, -1)
+		r.mutex.Unlock()
 		return nil, errorInfo, err
 	}
 
 	if newAlloc {
-		r.register[subs.ReqId.InstanceId] = subs
+		r.mutex.Lock()
+		r.addSubs(subs)
+		r.mutex.Unlock()
+		r.addToMergeIndex(subs)
 	}
+	r.updateQuotaGauges(c)
 	xapp.Logger.Debug("CREATE %s", subs.String())
-	xapp.Logger.Debug("Registry: substable=%v", r.register)
+	xapp.Logger.Debug("Registry: %v subscriptions in %s", shard.getSubsCount(), shard.ranName)
 	return subs, errorInfo, nil
 }
 
-func (r *Registry) RouteCreate(subs *Subscription, c *Control) (ErrorInfo, error) {
+//-------------------------------------------------------------------
+// Counters of requests rejected by assignment
+//-------------------------------------------------------------------
+var assignRejectionCounters = map[ErrorCode]string{
+	ErrorCodeSubmgrActionConflict:       cSubReqRejDueConflict,
+	ErrorCodeSubmgrNoSubscriptionToJoin: cSubReqRejDueNoJoin,
+	ErrorCodeSubmgrQuotaExceeded:        cSubReqRejDueQuota,
+}
+
+func (r *Registry) assignRejected(c *Control, errorInfo ErrorInfo, err error) (*Subscription, ErrorInfo, error) {
+	xapp.Logger.Error("%s", err.Error())
+	if counter, ok := assignRejectionCounters[errorInfo.ErrorCode]; ok {
+		c.UpdateCounter(counter)
+	}
+	return nil, errorInfo, err
+}
+
+func (r *Registry) RouteCreate(ctx context.Context, subs *Subscription, c *Control) (ErrorInfo, error) {
 	errorInfo := ErrorInfo{}
 	subRouteAction := SubRouteInfo{subs.EpList, uint16(subs.ReqId.InstanceId)}
-	err := r.rtmgrClient.SubscriptionRequestCreate(subRouteAction)
+	err := r.rtmgrClient.SubscriptionRequestCreate(ctx, subRouteAction)
 	if err != nil {
 		if strings.Contains(err.Error(), "status 400") {
 			errorInfo.TimeoutType = models.SubscriptionInstanceTimeoutTypeRTMGRTimeout
@@ -453,6 +903,7 @@ func (r *Registry) RouteCreate(subs *Subscription, c *Control) (ErrorInfo, error
 			errorInfo.ErrorSource = models.SubscriptionInstanceErrorSourceRTMGR
 		}
 		errorInfo.ErrorCause = err.Error()
+		errorInfo.SetCode(ErrorCodeRtmgrRouteCreateFailure)
 		c.UpdateCounter(cRouteCreateFail)
 		xapp.Logger.Error("%s", err.Error())
 		err = fmt.Errorf("RTMGR route create failure")
@@ -460,10 +911,10 @@ func (r *Registry) RouteCreate(subs *Subscription, c *Control) (ErrorInfo, error
 	return errorInfo, err
 }
 
-func (r *Registry) RouteCreateUpdate(subs *Subscription, c *Control) (ErrorInfo, error) {
+func (r *Registry) RouteCreateUpdate(ctx context.Context, subs *Subscription, c *Control) (ErrorInfo, error) {
 	errorInfo := ErrorInfo{}
 	subRouteAction := SubRouteInfo{subs.EpList, uint16(subs.ReqId.InstanceId)}
-	err := r.rtmgrClient.SubscriptionRequestUpdate(subRouteAction)
+	err := r.rtmgrClient.SubscriptionRequestUpdate(ctx, subRouteAction)
 	if err != nil {
 		if strings.Contains(err.Error(), "status 400") {
 			errorInfo.TimeoutType = models.SubscriptionInstanceTimeoutTypeRTMGRTimeout
@@ -471,6 +922,7 @@ func (r *Registry) RouteCreateUpdate(subs *Subscription, c *Control) (ErrorInfo,
 			errorInfo.ErrorSource = models.SubscriptionInstanceErrorSourceRTMGR
 		}
 		errorInfo.ErrorCause = err.Error()
+		errorInfo.SetCode(ErrorCodeRtmgrRouteUpdateFailure)
 		c.UpdateCounter(cRouteCreateUpdateFail)
 		xapp.Logger.Error("%s", err.Error())
 		err = fmt.Errorf("RTMGR route update failure")
@@ -511,29 +963,44 @@ func (r *Registry) CheckActionTypes(subReqMsg *e2ap.E2APSubscriptionRequest) (ui
 	return e2ap.E2AP_ActionTypeInvalid, fmt.Errorf("Invalid action type in RICactions-ToBeSetup-List")
 }
 
-func (r *Registry) RemoveFromSubscription(subs *Subscription, trans *TransactionXapp, waitRouteClean time.Duration, c *Control) {
+//-----------------------------------------------------------------------------
+// Cancelling ctx only cuts the wait for route cleanup. Routes are cleaned
+// also for cancelled requests
+//-----------------------------------------------------------------------------
+func (r *Registry) RemoveFromSubscription(ctx context.Context, subs *Subscription, trans *TransactionXapp, waitRouteClean time.Duration, c *Control) {
 
 	xapp.Logger.Debug("RemoveFromSubscription %s", idstring(nil, trans, subs, trans))
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+	shard := r.lockShard(ranNameOf(subs.Meid))
 	subs.mutex.Lock()
-	defer subs.mutex.Unlock()
-
+	r.mutex.Lock()
 	delStatus := subs.EpList.DelEndpoint(trans.GetEndpoint())
+	if delStatus == true {
+		r.countQuotaXapp(subs, trans.GetEndpoint().Addr, -1)
+	}
+	r.mutex.Unlock()
 	epamount := subs.EpList.Size()
+	subs.mutex.Unlock()
+	shard.opMutex.Unlock()
 
-	subId := subs.ReqId.InstanceId
 	if delStatus == false {
 		return
 	}
 
 	if waitRouteClean > 0 {
-		// Wait here that response is delivered to xApp via RMR before route is cleaned
+		// Wait here that response is delivered to xApp via RMR before route is cleaned.
+		// Nothing is locked meanwhile. Subscription without endpoints is not merged anymore.
 		xapp.Logger.Debug("Pending %v in order to wait route cleanup", waitRouteClean)
-		r.mutex.Unlock()
-		time.Sleep(waitRouteClean)
-		r.mutex.Lock()
+		select {
+		case <-time.After(waitRouteClean):
+		case <-ctx.Done():
+		}
 	}
+	ctx = context.WithoutCancel(ctx)
+
+	shard.opMutex.Lock()
+	defer shard.opMutex.Unlock()
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
 
 	xapp.Logger.Debug("CLEAN %s", subs.String())
 
@@ -542,7 +1009,7 @@ func (r *Registry) RemoveFromSubscription(subs *Subscription, trans *Transaction
 		// Subscription route delete
 		//
 		if subs.RMRRouteCreated == true {
-			r.RouteDelete(subs, trans, c)
+			r.RouteDelete(ctx, subs, trans, c)
 		}
 
 		// Not merged subscription is being deleted
@@ -552,19 +1019,24 @@ func (r *Registry) RemoveFromSubscription(subs *Subscription, trans *Transaction
 		//
 		// Subscription release
 		//
-
-		if _, ok := r.register[subId]; ok {
+		r.mutex.Lock()
+		if r.deleteSubs(subs) {
 			xapp.Logger.Debug("RELEASE %s", subs.String())
-			delete(r.register, subId)
-			xapp.Logger.Debug("Registry: substable=%v", r.register)
 		}
-		r.subIds = append(r.subIds, subId)
+		if _, ok := r.e2Cleanups[newE2SubsKey(subs)]; ok == false {
+			// Id of pending E2 cleanup is released when cleanup is completed
+			r.quarantineSubId(subs, time.Now())
+		}
+		r.mutex.Unlock()
+		r.removeFromMergeIndex(subs)
+		xapp.Logger.Debug("Registry: %v subscriptions in %s", shard.getSubsCount(), shard.ranName)
+		r.updateQuotaGauges(c)
 	} else if subs.EpList.Size() > 0 {
 		//
 		// Subscription route update
 		//
 		if subs.RMRRouteCreated == true {
-			r.RouteDeleteUpdate(subs, c)
+			r.RouteDeleteUpdate(ctx, subs, c)
 		}
 
 		// Endpoint of merged subscription is being deleted
@@ -578,18 +1050,18 @@ func (r *Registry) RemoveFromSubscription(subs *Subscription, trans *Transaction
 	return
 }
 
-func (r *Registry) RouteDelete(subs *Subscription, trans *TransactionXapp, c *Control) {
+func (r *Registry) RouteDelete(ctx context.Context, subs *Subscription, trans *TransactionXapp, c *Control) {
 	tmpList := xapp.RmrEndpointList{}
 	tmpList.AddEndpoint(trans.GetEndpoint())
 	subRouteAction := SubRouteInfo{tmpList, uint16(subs.ReqId.InstanceId)}
-	if err := r.rtmgrClient.SubscriptionRequestDelete(subRouteAction); err != nil {
+	if err := r.rtmgrClient.SubscriptionRequestDelete(ctx, subRouteAction); err != nil {
 		c.UpdateCounter(cRouteDeleteFail)
 	}
 }
 
-func (r *Registry) RouteDeleteUpdate(subs *Subscription, c *Control) {
+func (r *Registry) RouteDeleteUpdate(ctx context.Context, subs *Subscription, c *Control) {
 	subRouteAction := SubRouteInfo{subs.EpList, uint16(subs.ReqId.InstanceId)}
-	if err := r.rtmgrClient.SubscriptionRequestUpdate(subRouteAction); err != nil {
+	if err := r.rtmgrClient.SubscriptionRequestUpdate(ctx, subRouteAction); err != nil {
 		c.UpdateCounter(cRouteDeleteUpdateFail)
 	}
 }
@@ -624,38 +1096,46 @@ func (r *Registry) SetResetTestFlag(resetTestFlag bool, subs *Subscription) {
 	}
 }
 
-func (r *Registry) DeleteAllE2Subscriptions(ranName string, c *Control) {
+func (r *Registry) DeleteAllE2Subscriptions(ctx context.Context, ranName string, c *Control) {
 
 	xapp.Logger.Debug("Registry: DeleteAllE2Subscriptions()")
-	for subId, subs := range r.register {
-		if subs.Meid.RanName == ranName {
-			if subs.OngoingReqCount != 0 || subs.OngoingDelCount != 0 {
-				// Subscription creation or deletion processes need to be processed gracefully till the end.
-				// Subscription is deleted at end of the process in both cases.
-				xapp.Logger.Debug("Registry: E2 subscription under prosessing ongoing cannot delete it yet. subId=%v, OngoingReqCount=%v, OngoingDelCount=%v", subId, subs.OngoingReqCount, subs.OngoingDelCount)
-				continue
-			} else {
-				// Delete route
-				if subs.RMRRouteCreated == true {
-					for _, ep := range subs.EpList.Endpoints {
-						tmpList := xapp.RmrEndpointList{}
-						tmpList.AddEndpoint(&ep)
-						subRouteAction := SubRouteInfo{tmpList, uint16(subs.ReqId.InstanceId)}
-						if err := r.rtmgrClient.SubscriptionRequestDelete(subRouteAction); err != nil {
-							c.UpdateCounter(cRouteDeleteFail)
-						}
+	shard := r.lockShard(ranName)
+	for _, subs := range shard.getAllSubs() {
+		subId := subs.ReqId.InstanceId
+		if ongoingReqCount, ongoingDelCount := subs.GetOngoingCounts(); ongoingReqCount != 0 || ongoingDelCount != 0 {
+			// Subscription creation or deletion processes need to be processed gracefully till the end.
+			// Subscription is deleted at end of the process in both cases.
+			xapp.Logger.Debug("Registry: E2 subscription under prosessing ongoing cannot delete it yet. subId=%v, OngoingReqCount=%v, OngoingDelCount=%v", subId, ongoingReqCount, ongoingDelCount)
+			continue
+		} else {
+			// Delete route
+			if subs.RMRRouteCreated == true {
+				for _, ep := range subs.EpList.Endpoints {
+					tmpList := xapp.RmrEndpointList{}
+					tmpList.AddEndpoint(&ep)
+					subRouteAction := SubRouteInfo{tmpList, uint16(subs.ReqId.InstanceId)}
+					if err := r.rtmgrClient.SubscriptionRequestDelete(ctx, subRouteAction); err != nil {
+						c.UpdateCounter(cRouteDeleteFail)
 					}
 				}
-				// Delete E2 subscription from registry and db
-				xapp.Logger.Debug("Registry: Subscription delete. subId=%v", subId)
-				delete(r.register, subId)
-				r.subIds = append(r.subIds, subId)
-				c.RemoveSubscriptionFromDb(subs)
 			}
+			// Delete E2 subscription from registry and db
+			xapp.Logger.Debug("Registry: Subscription delete. subId=%v", subId)
+			r.mutex.Lock()
+			r.deleteSubs(subs)
+			r.quarantineSubId(subs, time.Now())
+			r.mutex.Unlock()
+			r.removeFromMergeIndex(subs)
+			c.RemoveSubscriptionFromDb(subs)
 		}
 	}
+	shard.opMutex.Unlock()
+	r.updateQuotaGauges(c)
+	r.deleteE2CleanupsOfE2Node(ranName)
 
 	// Delete REST subscription from registry and db
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
 	for restSubId, restSubs := range r.restSubscriptions {
 		if restSubs.Meid == ranName {
 			if restSubs.SubReqOngoing == true || restSubs.SubDelReqOngoing == true {
@@ -0,0 +1,254 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"fmt"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+// Registry is partitioned by RAN name. Each E2 node has a shard with its own
+// locks, subscriptions, per RAN instance id pool and merge index, so that
+// subscription processing in one E2 node does not block other E2 nodes.
+// Registry mutex guards only the thin global index: REST subscriptions, RIC
+// wide instance ids needed for RMR routing, pending E2 cleanups and
+// quarantined ids.
+//
+// Locks are taken in order: shard opMutex, subscription mutex, registry
+// mutex, shard mutex. Shard mutex is held only while maps of the shard are
+// accessed.
+//-----------------------------------------------------------------------------
+type registryShard struct {
+	ranName    string
+	opMutex    *sync.Mutex // Serializes assignment and removal of subscriptions in the E2 node
+	mutex      *sync.Mutex // Guards register and merge index
+	register   map[uint32]*Subscription
+	idPool     *instanceIdPool // Per RAN instance ids. Guarded by registry mutex as allocation checks also RIC wide ids
+	mergeIndex map[subsMergeKey]map[uint32]*Subscription
+	mergeKeys  map[*Subscription]subsMergeKey
+}
+
+func newRegistryShard(ranName string) *registryShard {
+	return &registryShard{
+		ranName:    ranName,
+		opMutex:    new(sync.Mutex),
+		mutex:      new(sync.Mutex),
+		register:   make(map[uint32]*Subscription),
+		idPool:     newInstanceIdPool(),
+		mergeIndex: make(map[subsMergeKey]map[uint32]*Subscription),
+		mergeKeys:  make(map[*Subscription]subsMergeKey),
+	}
+}
+
+func (s *registryShard) getSubs(subId uint32) (*Subscription, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	subs, ok := s.register[subId]
+	return subs, ok
+}
+
+func (s *registryShard) getAllSubs() []*Subscription {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	allSubs := make([]*Subscription, 0, len(s.register))
+	for _, subs := range s.register {
+		allSubs = append(allSubs, subs)
+	}
+	return allSubs
+}
+
+func (s *registryShard) getSubsCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.register)
+}
+
+//-------------------------------------------------------------------
+// Returns shard of E2 node. Shard is created when subscription of E2
+// node is added first time. Shards are not removed, as number of E2
+// nodes is limited.
+//-------------------------------------------------------------------
+func (r *Registry) getShard(ranName string) *registryShard {
+	r.shardsMutex.RLock()
+	shard, ok := r.shards[ranName]
+	r.shardsMutex.RUnlock()
+	if ok {
+		return shard
+	}
+	r.shardsMutex.Lock()
+	defer r.shardsMutex.Unlock()
+	if shard, ok = r.shards[ranName]; ok == false {
+		shard = newRegistryShard(ranName)
+		r.shards[ranName] = shard
+	}
+	return shard
+}
+
+//-------------------------------------------------------------------
+// Returns shard of E2 node or nil if E2 node has no shard. Used in
+// lookups, so that requests for unknown E2 nodes do not create shards.
+//-------------------------------------------------------------------
+func (r *Registry) findShard(ranName string) *registryShard {
+	r.shardsMutex.RLock()
+	defer r.shardsMutex.RUnlock()
+	return r.shards[ranName]
+}
+
+func (r *Registry) getShards() []*registryShard {
+	r.shardsMutex.RLock()
+	defer r.shardsMutex.RUnlock()
+	shards := make([]*registryShard, 0, len(r.shards))
+	for _, shard := range r.shards {
+		shards = append(shards, shard)
+	}
+	return shards
+}
+
+//-------------------------------------------------------------------
+// Locks shard of E2 node for assignment or removal of subscriptions
+//-------------------------------------------------------------------
+func (r *Registry) lockShard(ranName string) *registryShard {
+	shard := r.getShard(ranName)
+	shard.opMutex.Lock()
+	return shard
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked. Subscriptions restored
+// with RIC wide instance id are found also with RAN name of other E2
+// node.
+//-------------------------------------------------------------------
+func (r *Registry) getSubs(ranName string, subId uint32) (*Subscription, bool) {
+	if shard := r.findShard(ranName); shard != nil {
+		if subs, ok := shard.getSubs(subId); ok {
+			return subs, true
+		}
+	}
+	if subs, ok := r.register[subId]; ok && subs.PerRanInstanceId == false {
+		return subs, true
+	}
+	return nil, false
+}
+
+//-------------------------------------------------------------------
+// Subscriptions having RMR route are indexed also with instance id
+// only, as their ids are unique RIC wide
+//-------------------------------------------------------------------
+func hasRicWideInstanceId(subs *Subscription) bool {
+	return subs.PerRanInstanceId == false || subs.RMRRouteCreated == true
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) addSubs(subs *Subscription) {
+	if hasRicWideInstanceId(subs) {
+		r.register[subs.ReqId.InstanceId] = subs
+	}
+	shard := r.getShard(ranNameOf(subs.Meid))
+	shard.mutex.Lock()
+	shard.register[subs.ReqId.InstanceId] = subs
+	shard.mutex.Unlock()
+	r.startQuotaCount(subs)
+}
+
+//-------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-------------------------------------------------------------------
+func (r *Registry) deleteSubs(subs *Subscription) bool {
+	found := false
+	if shard := r.findShard(ranNameOf(subs.Meid)); shard != nil {
+		shard.mutex.Lock()
+		_, found = shard.register[subs.ReqId.InstanceId]
+		delete(shard.register, subs.ReqId.InstanceId)
+		shard.mutex.Unlock()
+	}
+	if hasRicWideInstanceId(subs) {
+		if _, ok := r.register[subs.ReqId.InstanceId]; ok {
+			delete(r.register, subs.ReqId.InstanceId)
+			found = true
+		}
+	}
+	r.stopQuotaCount(subs)
+	return found
+}
+
+func (r *Registry) getAllSubs() []*Subscription {
+	var allSubs []*Subscription
+	for _, shard := range r.getShards() {
+		allSubs = append(allSubs, shard.getAllSubs()...)
+	}
+	return allSubs
+}
+
+func (r *Registry) getSubsCount() int {
+	count := 0
+	for _, shard := range r.getShards() {
+		count += shard.getSubsCount()
+	}
+	return count
+}
+
+//-------------------------------------------------------------------
+// Lookup of subscription by instance id received from E2 node or
+// used in E2 node. Registry mutex is locked only when subscription is
+// not found in shard of the E2 node.
+//-------------------------------------------------------------------
+func (r *Registry) GetE2NodeSubscription(ranName string, subId uint32) (*Subscription, error) {
+	if shard := r.findShard(ranName); shard != nil {
+		if subs, ok := shard.getSubs(subId); ok {
+			return subs, nil
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if subs, ok := r.getSubs(ranName, subId); ok {
+		return subs, nil
+	}
+	return nil, fmt.Errorf("No valid subscription found with subId %v for ranName %s", subId, ranName)
+}
+
+//-------------------------------------------------------------------
+// Restores subscriptions read from db to shards and reserves their
+// per RAN instance ids
+//-------------------------------------------------------------------
+func (r *Registry) restoreRegister(register map[uint32]*Subscription, ranRegister map[e2SubsKey]*Subscription) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.register = make(map[uint32]*Subscription)
+	r.perRanIdUse = make(map[uint32]int)
+	r.routedIds = make(map[uint32]string)
+	r.shardsMutex.Lock()
+	r.shards = make(map[string]*registryShard)
+	r.shardsMutex.Unlock()
+	r.quotaCounters = newQuotaCounters()
+	for _, subs := range register {
+		r.addSubs(subs)
+	}
+	for key, subs := range ranRegister {
+		r.addSubs(subs)
+		r.getShard(key.ranName).idPool.reserve(key.subId)
+		r.perRanIdUse[key.subId]++
+		if subs.RMRRouteCreated {
+			r.routedIds[key.subId] = key.ranName
+		}
+	}
+}
@@ -0,0 +1,172 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+//-----------------------------------------------------------------------------
+// TestRegistryShards
+//
+//   1. SubReqs without RMR route in two E2 nodes get the same instance id in shards of their E2 nodes
+//   2. Lookup of unknown E2 node does not create shard
+//   3. SubReq of other E2 node is merged while shard of the first E2 node is locked
+//   4. SubDel removes subscription from shard of its E2 node
+//
+//-----------------------------------------------------------------------------
+func TestRegistryShards(t *testing.T) {
+	CaseBegin("TestRegistryShards")
+
+	registry := createTestRegistry()
+	c := createTestControl(registry, nil)
+
+	trans1 := createValidateTestTrans("RAN_NAME_1", "xapp1")
+	subs1, _, err := registry.AssignToSubscription(context.Background(), trans1, createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	trans2 := createValidateTestTrans("RAN_NAME_2", "xapp1")
+	subs2, _, err := registry.AssignToSubscription(context.Background(), trans2, createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+
+	// Subscriptions without RMR route are only in shards of their E2 nodes and can have the same id
+	assert.Equal(t, 2, len(registry.getShards()))
+	assert.Equal(t, 1, registry.getShard("RAN_NAME_1").getSubsCount())
+	assert.Equal(t, 1, registry.getShard("RAN_NAME_2").getSubsCount())
+	assert.Equal(t, subs1.ReqId.InstanceId, subs2.ReqId.InstanceId)
+	assert.Nil(t, registry.GetSubscription(subs1.ReqId.InstanceId))
+	found, err := registry.GetE2NodeSubscription("RAN_NAME_1", subs1.ReqId.InstanceId)
+	assert.Nil(t, err)
+	assert.Equal(t, subs1, found)
+	found, err = registry.GetE2NodeSubscription("RAN_NAME_2", subs2.ReqId.InstanceId)
+	assert.Nil(t, err)
+	assert.Equal(t, subs2, found)
+
+	// Lookups do not create shards for unknown E2 nodes
+	_, err = registry.GetE2NodeSubscription("RAN_NAME_3", subs1.ReqId.InstanceId)
+	assert.NotNil(t, err)
+	assert.Nil(t, registry.findShard("RAN_NAME_3"))
+	assert.Equal(t, 2, len(registry.getShards()))
+
+	// Locked E2 node does not block subscriptions of other E2 nodes
+	shard := registry.lockShard("RAN_NAME_1")
+	done := make(chan *Subscription)
+	go func() {
+		subs, _, _ := registry.AssignToSubscription(context.Background(), createValidateTestTrans("RAN_NAME_2", "xapp2"), createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+		done <- subs
+	}()
+	select {
+	case subs := <-done:
+		// Merged to existing subscription of the E2 node
+		assert.Equal(t, subs2, subs)
+	case <-time.After(5 * time.Second):
+		t.Error("Subscription of other E2 node blocked by locked shard")
+	}
+	shard.opMutex.Unlock()
+
+	registry.RemoveFromSubscription(context.Background(), subs1, trans1, 0, c)
+	assert.Equal(t, 0, registry.getShard("RAN_NAME_1").getSubsCount())
+	_, err = registry.GetE2NodeSubscription("RAN_NAME_1", subs1.ReqId.InstanceId)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, registry.getSubsCount())
+}
+
+//-----------------------------------------------------------------------------
+// Subscriptions are created and deleted in parallel. Requests are spread
+// evenly over the E2 nodes. Quotas are counted and gauges updated as in
+// submgr. Routes are created in routing manager stub if createRMRRoute is
+// true.
+//-----------------------------------------------------------------------------
+func benchmarkAssignToSubscription(b *testing.B, e2NodeCount int, createRMRRoute bool) {
+	setTestConfig(b, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{XappQuota: 1000000, E2NodeQuota: 1000000, RanFunctionQuota: 1000000}
+	})
+	registry := createTestRegistry()
+	registry.rtmgrClient = mainCtrl.c.registry.rtmgrClient
+	c := createTestControl(registry, nil)
+	c.Gauges = mainCtrl.c.Gauges
+	var requestCount uint32
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddUint32(&requestCount, 1)
+			trans := createValidateTestTrans(fmt.Sprintf("RAN_NAME_%v", int(n)%e2NodeCount), "xapp1")
+			subReqMsg := createMergeTestSubReqMsg(e2ap.FunctionId(1), n)
+			subs, _, err := registry.AssignToSubscription(context.Background(), trans, subReqMsg, false, c, createRMRRoute, SubscriptionSharingDefault)
+			if err != nil {
+				b.Fatalf("AssignToSubscription failed: %v", err)
+			}
+			registry.RemoveFromSubscription(context.Background(), subs, trans, 0, c)
+		}
+	})
+}
+
+func BenchmarkAssignToSubscription1E2Node(b *testing.B) {
+	benchmarkAssignToSubscription(b, 1, false)
+}
+
+func BenchmarkAssignToSubscription10E2Nodes(b *testing.B) {
+	benchmarkAssignToSubscription(b, 10, false)
+}
+
+func BenchmarkAssignToSubscription100E2Nodes(b *testing.B) {
+	benchmarkAssignToSubscription(b, 100, false)
+}
+
+func BenchmarkAssignToSubscription1000E2Nodes(b *testing.B) {
+	benchmarkAssignToSubscription(b, 1000, false)
+}
+
+func BenchmarkAssignToSubscriptionWithRoute1E2Node(b *testing.B) {
+	benchmarkAssignToSubscription(b, 1, true)
+}
+
+func BenchmarkAssignToSubscriptionWithRoute100E2Nodes(b *testing.B) {
+	benchmarkAssignToSubscription(b, 100, true)
+}
+
+//-----------------------------------------------------------------------------
+// Lookups of E2 responses by instance id while subscriptions are assigned in
+// other E2 nodes
+//-----------------------------------------------------------------------------
+func BenchmarkGetE2NodeSubscription1000E2Nodes(b *testing.B) {
+	registry := createMergeTestRegistry(10000)
+	for i := 0; i < 1000; i++ {
+		registry.getShard(fmt.Sprintf("RAN_NAME_%v", i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		subId := uint32(1)
+		for pb.Next() {
+			// Subscription subId is in E2 node RAN_NAME_<(subId-1)%100>
+			if _, err := registry.GetE2NodeSubscription(fmt.Sprintf("RAN_NAME_%v", (subId-1)%100), subId); err != nil {
+				b.Fatalf("GetE2NodeSubscription failed: %v", err)
+			}
+			subId = subId%10000 + 1
+		}
+	})
+}
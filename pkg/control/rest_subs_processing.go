@@ -0,0 +1,85 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Processing of subscription requests of REST subscription runs with its own
+// context derived from the root context of Control. It is cancelled when
+// submgr shuts down or when the xApp owning the subscription is removed.
+//-----------------------------------------------------------------------------
+type restSubsProcessing struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *Registry) StartRESTSubscriptionProcessing(restSubs *RESTSubscription, parent context.Context) (context.Context, *restSubsProcessing) {
+	ctx, cancel := context.WithCancel(parent)
+	processing := &restSubsProcessing{cancel: cancel, done: make(chan struct{})}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	restSubs.processing = processing
+	return ctx, processing
+}
+
+func (r *Registry) EndRESTSubscriptionProcessing(restSubs *RESTSubscription, processing *restSubsProcessing) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	processing.cancel()
+	close(processing.done)
+	if restSubs.processing == processing {
+		restSubs.processing = nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Returns channel which is closed when cancelled processing has ended. Nil if
+// processing of the REST subscription is not ongoing
+//-----------------------------------------------------------------------------
+func (r *Registry) CancelRESTSubscriptionProcessing(restSubId string) <-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	restSubs, ok := r.restSubscriptions[restSubId]
+	if ok == false || restSubs.processing == nil {
+		return nil
+	}
+	xapp.Logger.Debug("Registry: Cancelling processing of REST subscription. restSubId=%v", restSubId)
+	restSubs.processing.cancel()
+	return restSubs.processing.done
+}
+
+//-----------------------------------------------------------------------------
+// Returns channels which are closed when ongoing processing has ended
+//-----------------------------------------------------------------------------
+func (r *Registry) GetRESTSubscriptionProcessingDone() []<-chan struct{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var doneList []<-chan struct{}
+	for _, restSubs := range r.restSubscriptions {
+		if restSubs.processing != nil {
+			doneList = append(doneList, restSubs.processing.done)
+		}
+	}
+	return doneList
+}
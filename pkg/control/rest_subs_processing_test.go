@@ -0,0 +1,257 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/restapi/operations/common"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createProcessingTestRESTSubscription(registry *Registry) (*RESTSubscription, string) {
+	restSubId, xAppServiceName, xAppRmrEndPoint, meid := "restsub-1", "xapp1", "localhost:13560", "RAN_NAME_1"
+	return registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &meid), restSubId
+}
+
+func TestRESTSubscriptionProcessingCancel(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	restSubs, restSubId := createProcessingTestRESTSubscription(registry)
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+	ctx, processing := registry.StartRESTSubscriptionProcessing(restSubs, parent)
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, registry.CancelRESTSubscriptionProcessing("restsub-unknown"))
+
+	done := registry.CancelRESTSubscriptionProcessing(restSubId)
+	assert.NotNil(t, done)
+	assert.Equal(t, context.Canceled, ctx.Err())
+	select {
+	case <-done:
+		t.Fatalf("Processing ended before EndRESTSubscriptionProcessing")
+	default:
+	}
+
+	registry.EndRESTSubscriptionProcessing(restSubs, processing)
+	<-done
+	assert.Nil(t, registry.CancelRESTSubscriptionProcessing(restSubId))
+	assert.Nil(t, parent.Err())
+}
+
+func TestRESTSubscriptionProcessingCancelledWithParent(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	restSubs, _ := createProcessingTestRESTSubscription(registry)
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, processing := registry.StartRESTSubscriptionProcessing(restSubs, parent)
+	cancelParent()
+	assert.Equal(t, context.Canceled, ctx.Err())
+	registry.EndRESTSubscriptionProcessing(restSubs, processing)
+}
+
+func TestTransactionWaitEventCancelled(t *testing.T) {
+	tracker := new(Tracker)
+	tracker.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	trans := tracker.NewXappTransaction(ctx, &xapp.RmrEndpoint{Addr: "localhost", Port: 13560}, "xid", e2ap.RequestId{Id: 1}, &xapp.RMRMeid{RanName: "RAN_NAME_1"})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	event, timedOut := trans.WaitEvent(0)
+	assert.Nil(t, event)
+	assert.True(t, timedOut)
+
+	sendOk, timedOut := trans.SendEvent(&e2ap.E2APSubscriptionResponse{}, 0)
+	assert.False(t, sendOk)
+	assert.True(t, timedOut)
+}
+
+func TestTransactionWaitEventDeadline(t *testing.T) {
+	tracker := new(Tracker)
+	tracker.Init()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	trans := tracker.NewSubsTransaction(ctx, &Subscription{})
+
+	started := time.Now()
+	event, timedOut := trans.WaitEvent(time.Minute)
+	assert.Nil(t, event)
+	assert.True(t, timedOut)
+	assert.True(t, time.Since(started) < time.Minute)
+}
+
+func TestSubscriptionRequestCancelled(t *testing.T) {
+	c := &Control{tracker: new(Tracker)}
+	c.tracker.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	trans := c.tracker.NewXappTransaction(ctx, &xapp.RmrEndpoint{Addr: "localhost", Port: 13560}, "xid", e2ap.RequestId{Id: 1}, &xapp.RMRMeid{RanName: "RAN_NAME_1"})
+	meid := "RAN_NAME_1"
+
+	subRespMsg, errorInfo, err := c.handleSubscriptionRequest(ctx, trans, &e2ap.E2APSubscriptionRequest{}, &meid, "restsub-1", &E2SubscriptionDirectives{})
+	assert.Nil(t, subRespMsg)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrorCodeSubmgrRequestCancelled, errorInfo.ErrorCode)
+}
+
+func TestRtmgrRequestContext(t *testing.T) {
+	origTimeout := rtmgrRequestTimeout.Load()
+	rtmgrRequestTimeout.Store(int64(time.Minute))
+	defer func() { rtmgrRequestTimeout.Store(origTimeout) }()
+
+	ctx, cancel := rtmgrRequestContext(context.Background())
+	deadline, ok := ctx.Deadline()
+	cancel()
+	assert.True(t, ok)
+	assert.True(t, time.Until(deadline) <= time.Minute)
+
+	// Earlier deadline of the request is kept
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Second)
+	defer cancelParent()
+	parentDeadline, _ := parent.Deadline()
+	ctx, cancel = rtmgrRequestContext(parent)
+	deadline, _ = ctx.Deadline()
+	cancel()
+	assert.Equal(t, parentDeadline, deadline)
+}
+
+//-----------------------------------------------------------------------------
+// TestShutdownCancelsProcessing
+//
+//   1. Shutdown cancels ongoing REST subscription processing
+//   2. Shutdown returns when the processing has ended
+//
+//-----------------------------------------------------------------------------
+func TestShutdownCancelsProcessing(t *testing.T) {
+	CaseBegin("TestShutdownCancelsProcessing")
+
+	c := createTestControl(createTestRegistry(), nil)
+	restSubs, _ := createProcessingTestRESTSubscription(c.registry)
+	ctx, processing := c.registry.StartRESTSubscriptionProcessing(restSubs, c.rootContext())
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		c.Shutdown()
+		close(shutdownDone)
+	}()
+	<-ctx.Done()
+	assert.Equal(t, context.Canceled, c.rootContext().Err())
+	select {
+	case <-shutdownDone:
+		t.Fatalf("Shutdown returned before processing ended")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.registry.EndRESTSubscriptionProcessing(restSubs, processing)
+	<-shutdownDone
+	assert.Equal(t, 0, len(c.registry.GetRESTSubscriptionProcessingDone()))
+}
+
+//-----------------------------------------------------------------------------
+// TestShutdownWaitTime
+//
+// Processing which does not end does not block shutdown longer than wait time
+//
+//-----------------------------------------------------------------------------
+func TestShutdownWaitTime(t *testing.T) {
+	CaseBegin("TestShutdownWaitTime")
+
+	origWaitTime := shutdownWaitTime
+	shutdownWaitTime = 20 * time.Millisecond
+	defer func() { shutdownWaitTime = origWaitTime }()
+
+	c := createTestControl(createTestRegistry(), nil)
+	restSubs, _ := createProcessingTestRESTSubscription(c.registry)
+	_, processing := c.registry.StartRESTSubscriptionProcessing(restSubs, c.rootContext())
+	defer c.registry.EndRESTSubscriptionProcessing(restSubs, processing)
+
+	// Processing which does not end does not block shutdown
+	c.Shutdown()
+	assert.Equal(t, 1, len(c.registry.GetRESTSubscriptionProcessingDone()))
+}
+
+//-----------------------------------------------------------------------------
+// TestShutdownOnSigterm
+//
+// SIGTERM cancels ongoing processing also without shutdown callback
+//
+//-----------------------------------------------------------------------------
+func TestShutdownOnSigterm(t *testing.T) {
+	CaseBegin("TestShutdownOnSigterm")
+
+	c := createTestControl(createTestRegistry(), nil)
+	sigs := make(chan os.Signal, 1)
+	exited := make(chan struct{})
+	go c.shutdownOnSignal(sigs, func() { close(exited) })
+
+	sigs <- syscall.SIGTERM
+	<-exited
+	assert.Equal(t, context.Canceled, c.rootContext().Err())
+}
+
+//-----------------------------------------------------------------------------
+// TestRESTSubscriptionDeleteCancelsProcessing
+//
+//   stub
+// +-------+     +---------+
+// | xapp  |     | submgr  |
+// +-------+     +---------+
+//     |              |
+//     | RESTSubReq   |
+//     |------------->|
+//     |              |
+//     | RESTSubDelReq|
+//     |------------->|
+//     |              |
+//     |       processing of RESTSubReq cancelled
+//     |              |
+//     | RESTSubDelResp
+//     |<-------------|
+//     |              |
+//
+//-----------------------------------------------------------------------------
+func TestRESTSubscriptionDeleteCancelsProcessing(t *testing.T) {
+	CaseBegin("TestRESTSubscriptionDeleteCancelsProcessing")
+
+	c := createTestControl(createTestRegistry(), nil)
+	restSubs, restSubId := createProcessingTestRESTSubscription(c.registry)
+	ctx, processing := c.registry.StartRESTSubscriptionProcessing(restSubs, c.rootContext())
+
+	assert.Equal(t, common.UnsubscribeNoContentCode, c.RESTSubscriptionDeleteHandler(restSubId))
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Nil(t, c.rootContext().Err())
+
+	// Delete is handled when cancelled processing has ended. Request of the
+	// subscription is still ongoing, so subscription is not deleted yet
+	c.registry.EndRESTSubscriptionProcessing(restSubs, processing)
+	_, err := c.registry.GetRESTSubscription(restSubId, false)
+	assert.NotNil(t, err)
+	c.cancel()
+}
@@ -56,13 +56,18 @@ func ConstructEndpointAddresses(clientEndpoint models.SubscriptionParamsClientEn
 		xAppHTTPEndPoint = host + ":" + strconv.FormatInt(*clientEndpoint.HTTPPort, 10)
 	}
 	if *clientEndpoint.RMRPort > 0 {
-		if i := strings.Index(host, "http"); i != -1 {
-			host = strings.Replace(host, "http", "rmr", -1)
-		}
-		xAppRMREndPoint = host + ":" + strconv.FormatInt(*clientEndpoint.RMRPort, 10)
+		xAppRMREndPoint = XappRmrServiceName(host) + ":" + strconv.FormatInt(*clientEndpoint.RMRPort, 10)
 	}
 
 	xapp.Logger.Debug("xAppHttpEndPoint=%v, xAppRrmEndPoint=%v", xAppHTTPEndPoint, xAppRMREndPoint)
 
 	return xAppHTTPEndPoint, xAppRMREndPoint, nil
 }
+
+//-----------------------------------------------------------------------------
+// xApp http service name is converted to RMR service name by replacing http
+// with rmr, e.g. service-ricxapp-ueec-http.ricxapp -> service-ricxapp-ueec-rmr.ricxapp
+//-----------------------------------------------------------------------------
+func XappRmrServiceName(host string) string {
+	return strings.Replace(host, "http", "rmr", -1)
+}
@@ -0,0 +1,200 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+//-----------------------------------------------------------------------------
+// Retry policies of E2 Subscription Requests. When E2 node fails a
+// subscription with cause which has a retry policy, the request is sent again
+// after backoff which is doubled after every failure up to maxBackoff_ms.
+// Retrying is given up when the request would be older than maxAge_s. During
+// backoff the E2 node is marked congested so that other requests towards it
+// wait as well.
+//-----------------------------------------------------------------------------
+
+type E2RetryPolicy struct {
+	CauseContent      uint8 `json:"CauseContent" mapstructure:"causeContent"`
+	CauseValue        uint8 `json:"CauseValue" mapstructure:"causeValue"`
+	InitialBackoff_ms int64 `json:"InitialBackoff_ms" mapstructure:"initialBackoff_ms"`
+	MaxBackoff_ms     int64 `json:"MaxBackoff_ms" mapstructure:"maxBackoff_ms"`
+	MaxAge_s          int64 `json:"MaxAge_s" mapstructure:"maxAge_s"`
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var e2RetryPolicies atomic.Pointer[[]E2RetryPolicy]
+
+func init() {
+	setE2RetryPolicies(nil)
+}
+
+func getE2RetryPolicies() []E2RetryPolicy {
+	return *e2RetryPolicies.Load()
+}
+
+func setE2RetryPolicies(policies []E2RetryPolicy) {
+	e2RetryPolicies.Store(&policies)
+}
+
+type E2SubscriptionFailureError struct {
+	Cause        e2ap.Cause
+	PolicyUpdate bool
+}
+
+func (e *E2SubscriptionFailureError) Error() string {
+	return fmt.Sprintf("RICSubscriptionFailure. E2NodeCause: (Cause:%v, Value %v)", e.Cause.Content, e.Cause.Value)
+}
+
+func DefaultE2RetryPolicies() []E2RetryPolicy {
+	return []E2RetryPolicy{
+		{
+			CauseContent:      e2ap.E2AP_CauseContent_RICrequest,
+			CauseValue:        e2ap.E2AP_CauseValue_RICrequest_function_resource_limit,
+			InitialBackoff_ms: 1000,
+			MaxBackoff_ms:     16000,
+			MaxAge_s:          60,
+		},
+		{
+			CauseContent:      e2ap.E2AP_CauseContent_RICrequest,
+			CauseValue:        e2ap.E2AP_CauseValue_RICrequest_system_not_ready,
+			InitialBackoff_ms: 1000,
+			MaxBackoff_ms:     16000,
+			MaxAge_s:          60,
+		},
+	}
+}
+
+func ReadE2RetryPolicyConfig() []E2RetryPolicy {
+	if viper.IsSet("controls.e2SubReqRetryPolicies") == false {
+		xapp.Logger.Debug("WARNING: Using hard coded default value for e2SubReqRetryPolicies")
+		return DefaultE2RetryPolicies()
+	}
+	policies := []E2RetryPolicy{}
+	if err := viper.UnmarshalKey("controls.e2SubReqRetryPolicies", &policies); err != nil {
+		xapp.Logger.Error("Invalid e2SubReqRetryPolicies: %s", err.Error())
+		return DefaultE2RetryPolicies()
+	}
+	return ValidateE2RetryPolicies(policies, "e2SubReqRetryPolicies")
+}
+
+//-------------------------------------------------------------------
+// Policies with invalid backoff are dropped. Policy with zero maxAge_s
+// is kept as it disables retrying of the cause.
+//-------------------------------------------------------------------
+func ValidateE2RetryPolicies(policies []E2RetryPolicy, source string) []E2RetryPolicy {
+	valid := []E2RetryPolicy{}
+	for _, policy := range policies {
+		if policy.MaxAge_s < 0 || (policy.MaxAge_s > 0 && policy.InitialBackoff_ms <= 0) {
+			xapp.Logger.Error("Invalid retry policy %+v in %s", policy, source)
+			continue
+		}
+		if policy.MaxBackoff_ms < policy.InitialBackoff_ms {
+			policy.MaxBackoff_ms = policy.InitialBackoff_ms
+		}
+		valid = append(valid, policy)
+	}
+	return valid
+}
+
+func (p *E2RetryPolicy) matches(cause e2ap.Cause) bool {
+	return p.CauseContent == cause.Content && p.CauseValue == cause.Value
+}
+
+//-------------------------------------------------------------------
+// Backoff before retry after given number of failed attempts
+//-------------------------------------------------------------------
+func (p *E2RetryPolicy) Backoff(failures int) time.Duration {
+	backoff := time.Duration(p.InitialBackoff_ms) * time.Millisecond
+	maxBackoff := time.Duration(p.MaxBackoff_ms) * time.Millisecond
+	for i := 1; i < failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (p *E2RetryPolicy) MaxAge() time.Duration {
+	return time.Duration(p.MaxAge_s) * time.Second
+}
+
+//-------------------------------------------------------------------
+// Policy given in E2SubscriptionDirectives overrides configured one
+//-------------------------------------------------------------------
+func FindE2RetryPolicy(cause e2ap.Cause, e2SubscriptionDirectives *E2SubscriptionDirectives) *E2RetryPolicy {
+	if e2SubscriptionDirectives != nil {
+		for i := range e2SubscriptionDirectives.E2RetryPolicies {
+			if e2SubscriptionDirectives.E2RetryPolicies[i].matches(cause) {
+				return &e2SubscriptionDirectives.E2RetryPolicies[i]
+			}
+		}
+	}
+	policies := getE2RetryPolicies()
+	for i := range policies {
+		if policies[i].matches(cause) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Handles E2 Subscription Request and retries it according to retry
+// policy of the failure cause. Returns transaction of the last attempt.
+//-------------------------------------------------------------------
+func (c *Control) handleSubscriptionRequestWithRetryPolicy(ctx context.Context, trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, meid *string,
+	restSubId string, e2SubscriptionDirectives *E2SubscriptionDirectives) (*TransactionXapp, *e2ap.E2APSubscriptionResponse, *ErrorInfo, error) {
+
+	started := time.Now()
+	for failures := 1; ; failures++ {
+		subRespMsg, errorInfo, err := c.handleSubscriptionRequest(ctx, trans, subReqMsg, meid, restSubId, e2SubscriptionDirectives)
+
+		// Failed policy update is not retried as the previous policy is still valid in E2 node
+		failure, ok := err.(*E2SubscriptionFailureError)
+		if ok == false || failure.PolicyUpdate == true {
+			return trans, subRespMsg, errorInfo, err
+		}
+		policy := FindE2RetryPolicy(failure.Cause, e2SubscriptionDirectives)
+		if policy == nil || policy.MaxAge() == 0 || ctx.Err() != nil {
+			return trans, subRespMsg, errorInfo, err
+		}
+		backoff := policy.Backoff(failures)
+		if time.Since(started)+backoff > policy.MaxAge() {
+			xapp.Logger.Info("XAPP-SubReq retry policy max age %v reached after %v attempts: %s", policy.MaxAge(), failures, idstring(err, trans))
+			c.UpdateCounter(cSubReqRetryMaxAge)
+			return trans, subRespMsg, errorInfo, err
+		}
+
+		xapp.Logger.Info("XAPP-SubReq retried after backoff %v: %s", backoff, idstring(err, trans))
+		c.e2NodeAdmission.SetCongested(*meid, backoff)
+		c.UpdateCounter(cSubReqBackoffRetry)
+		trans.Release()
+		trans = c.tracker.NewXappTransaction(ctx, trans.GetEndpoint(), restSubId, subReqMsg.RequestId, &xapp.RMRMeid{RanName: *meid})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestE2RetryPolicyBackoff(t *testing.T) {
+
+	policy := E2RetryPolicy{InitialBackoff_ms: 100, MaxBackoff_ms: 1000, MaxAge_s: 10}
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 800*time.Millisecond, policy.Backoff(4))
+	assert.Equal(t, 1000*time.Millisecond, policy.Backoff(5))
+	assert.Equal(t, 1000*time.Millisecond, policy.Backoff(50))
+	assert.Equal(t, 10*time.Second, policy.MaxAge())
+}
+
+//-----------------------------------------------------------------------------
+// TestE2RetryPolicyDefaults
+//
+// Default retry policies retry SubFails of temporary causes only
+//
+//-----------------------------------------------------------------------------
+func TestE2RetryPolicyDefaults(t *testing.T) {
+	CaseBegin("TestE2RetryPolicyDefaults")
+
+	setTestConfig(t, func(config *testConfig) { config.e2RetryPolicies = DefaultE2RetryPolicies() })
+
+	resourceLimit := e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_function_resource_limit}
+	systemNotReady := e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_system_not_ready}
+	messageInvalid := e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_control_message_invalid}
+
+	assert.NotNil(t, FindE2RetryPolicy(resourceLimit, nil))
+	assert.NotNil(t, FindE2RetryPolicy(systemNotReady, &E2SubscriptionDirectives{}))
+	assert.Nil(t, FindE2RetryPolicy(messageInvalid, nil))
+}
+
+//-----------------------------------------------------------------------------
+// TestE2RetryPolicyOverride
+//
+//   1. Retry policy of subscription directives overrides configured policy of the cause
+//   2. Zero max age of directives disables retrying of the cause
+//
+//-----------------------------------------------------------------------------
+func TestE2RetryPolicyOverride(t *testing.T) {
+	CaseBegin("TestE2RetryPolicyOverride")
+
+	setTestConfig(t, func(config *testConfig) { config.e2RetryPolicies = DefaultE2RetryPolicies() })
+
+	cause := e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_function_resource_limit}
+	directives := &E2SubscriptionDirectives{
+		E2RetryPolicies: []E2RetryPolicy{
+			{CauseContent: cause.Content, CauseValue: cause.Value, InitialBackoff_ms: 50, MaxBackoff_ms: 100, MaxAge_s: 1},
+		},
+	}
+	policy := FindE2RetryPolicy(cause, directives)
+	assert.NotNil(t, policy)
+	assert.Equal(t, int64(50), policy.InitialBackoff_ms)
+
+	// Zero max age disables retrying of the cause
+	directives.E2RetryPolicies[0].MaxAge_s = 0
+	assert.Equal(t, time.Duration(0), FindE2RetryPolicy(cause, directives).MaxAge())
+}
+
+func TestValidateE2RetryPolicies(t *testing.T) {
+
+	policies := ValidateE2RetryPolicies([]E2RetryPolicy{
+		{CauseContent: 1, CauseValue: 5, InitialBackoff_ms: 100, MaxBackoff_ms: 50, MaxAge_s: 10},
+		{CauseContent: 1, CauseValue: 12, InitialBackoff_ms: 0, MaxBackoff_ms: 50, MaxAge_s: 10},
+		{CauseContent: 1, CauseValue: 13, MaxAge_s: -1},
+		{CauseContent: 1, CauseValue: 1},
+	}, "test")
+	assert.Equal(t, 2, len(policies))
+	assert.Equal(t, int64(100), policies[0].MaxBackoff_ms)
+	assert.Equal(t, uint8(1), policies[1].CauseValue)
+}
+
+func TestE2SubscriptionFailureError(t *testing.T) {
+
+	var err error = &E2SubscriptionFailureError{Cause: e2ap.Cause{Content: 1, Value: 5}}
+	assert.Equal(t, "RICSubscriptionFailure. E2NodeCause: (Cause:1, Value 5)", err.Error())
+}
@@ -0,0 +1,93 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+//-----------------------------------------------------------------------------
+// RIC Requestor ID is sent to E2 node in E2 Subscription Request and E2
+// Subscription Delete Request. It tells E2 node which RIC, and optionally
+// which xApp, owns the subscription. Subscriptions stored in db before the
+// id was configurable were created with the default value.
+//-----------------------------------------------------------------------------
+const defaultRicRequestorId uint32 = 123
+const maxRicRequestorId uint32 = 65535
+
+type RicRequestorIdConfig struct {
+	RicRequestorId   uint32
+	XappRequestorIds map[string]uint32
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var ricRequestorIdConfig atomic.Pointer[RicRequestorIdConfig]
+
+func init() {
+	setRicRequestorIdConfig(RicRequestorIdConfig{RicRequestorId: defaultRicRequestorId, XappRequestorIds: make(map[string]uint32)})
+}
+
+func getRicRequestorIdConfig() *RicRequestorIdConfig {
+	return ricRequestorIdConfig.Load()
+}
+
+func setRicRequestorIdConfig(config RicRequestorIdConfig) {
+	ricRequestorIdConfig.Store(&config)
+}
+
+//-----------------------------------------------------------------------------
+// Reads controls.ricRequestorId of RIC instance and optional per xApp
+// requestor ids from map controls.xappRicRequestorIds
+//-----------------------------------------------------------------------------
+func ReadRicRequestorIdConfig() RicRequestorIdConfig {
+
+	viper.SetDefault("controls.ricRequestorId", defaultRicRequestorId)
+	r := RicRequestorIdConfig{
+		RicRequestorId:   uint32(viper.GetInt("controls.ricRequestorId")),
+		XappRequestorIds: make(map[string]uint32),
+	}
+	if r.RicRequestorId > maxRicRequestorId {
+		xapp.Logger.Error("Invalid ricRequestorId %v. Using default value %v", r.RicRequestorId, defaultRicRequestorId)
+		r.RicRequestorId = defaultRicRequestorId
+	}
+	for name, value := range viper.GetStringMapString("controls.xappRicRequestorIds") {
+		id, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			xapp.Logger.Error("Invalid RIC requestor id %s for %s in xappRicRequestorIds", value, name)
+			continue
+		}
+		r.XappRequestorIds[strings.ToLower(XappRmrServiceName(name))] = uint32(id)
+	}
+	return r
+}
+
+//-----------------------------------------------------------------------------
+// Requestor id of xApp overrides requestor id of RIC instance
+//-----------------------------------------------------------------------------
+func (r *RicRequestorIdConfig) resolve(xappRmrServiceName string) uint32 {
+	if id, ok := r.XappRequestorIds[strings.ToLower(xappRmrServiceName)]; ok {
+		return id
+	}
+	return r.RicRequestorId
+}
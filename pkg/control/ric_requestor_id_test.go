@@ -0,0 +1,119 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRicRequestorId(t *testing.T) {
+	config := RicRequestorIdConfig{RicRequestorId: 1000, XappRequestorIds: map[string]uint32{"service-ricxapp-xapp1-rmr.ricxapp": 2000}}
+	assert.Equal(t, uint32(2000), config.resolve("service-ricxapp-xapp1-rmr.ricxapp"))
+	assert.Equal(t, uint32(2000), config.resolve("Service-Ricxapp-Xapp1-Rmr.ricxapp"))
+	assert.Equal(t, uint32(1000), config.resolve("service-ricxapp-xapp2-rmr.ricxapp"))
+}
+
+//-----------------------------------------------------------------------------
+// TestRicRequestorIdOfSubscription
+//
+//   1. SubReq of xApp with own requestor id gets the id of the xApp
+//   2. SubReq of other xApp gets RIC wide requestor id
+//   3. Subscription read from db without requestor id gets default id
+//
+//-----------------------------------------------------------------------------
+func TestRicRequestorIdOfSubscription(t *testing.T) {
+	CaseBegin("TestRicRequestorIdOfSubscription")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.ricRequestorId = RicRequestorIdConfig{RicRequestorId: 1000, XappRequestorIds: map[string]uint32{"xapp1": 2000}}
+	})
+	registry := createTestRegistry()
+	subReqMsg := &e2ap.E2APSubscriptionRequest{}
+
+	subs, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2000), subs.GetRicRequestorId())
+	subs, err = registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp2"), subReqMsg, false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1000), subs.GetRicRequestorId())
+
+	// Subscription read from db record without requestor id was created with default id
+	subs.RicRequestorId = nil
+	assert.Equal(t, defaultRicRequestorId, subs.GetRicRequestorId())
+}
+
+//-----------------------------------------------------------------------------
+// TestRicRequestorIdZero
+//
+//   1. SubReq gets configured requestor id 0
+//   2. Subscription and legacy subscription without requestor id are stored in db
+//   3. Restart, configured id 0 is kept and legacy subscription gets default id
+//
+//-----------------------------------------------------------------------------
+func TestRicRequestorIdZero(t *testing.T) {
+	CaseBegin("TestRicRequestorIdZero")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.ricRequestorId = RicRequestorIdConfig{RicRequestorId: 0, XappRequestorIds: map[string]uint32{}}
+	})
+	registry := createTestRegistry()
+	c := createTestControl(registry, nil)
+
+	subs, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), &e2ap.E2APSubscriptionRequest{}, false, false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), subs.GetRicRequestorId())
+
+	// Configured id 0 is kept over restart, record without requestor id gets default id
+	assert.Nil(t, c.WriteSubscriptionToSdl(subs.ReqId.InstanceId, subs))
+	legacySubs := &Subscription{Meid: subs.Meid, SubReqMsg: subs.SubReqMsg}
+	legacySubs.ReqId.InstanceId = subs.ReqId.InstanceId + 1
+	assert.Nil(t, c.WriteSubscriptionToSdl(legacySubs.ReqId.InstanceId, legacySubs))
+	_, register, ranRegister, err := c.ReadAllSubscriptionsFromSdl()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), ranRegister[newE2SubsKey(subs)].GetRicRequestorId())
+	assert.Equal(t, defaultRicRequestorId, register[legacySubs.ReqId.InstanceId].GetRicRequestorId())
+}
+
+//-----------------------------------------------------------------------------
+// TestFindExistingSubsRicRequestorId
+//
+//   1. SubReq of other xApp is merged to existing subscription
+//   2. SubReq of xApp with requestor id of its own is not merged
+//   3. SubReq of xApp with RIC wide requestor id is merged
+//
+//-----------------------------------------------------------------------------
+func TestFindExistingSubsRicRequestorId(t *testing.T) {
+	CaseBegin("TestFindExistingSubsRicRequestorId")
+
+	registry := createMergeTestRegistry(1)
+	subs, _ := registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingShared)
+	assert.NotNil(t, subs)
+
+	// xApp with requestor id of its own cannot join subscription of other requestor id
+	setTestConfig(t, func(config *testConfig) {
+		config.ricRequestorId = RicRequestorIdConfig{RicRequestorId: defaultRicRequestorId, XappRequestorIds: map[string]uint32{"xapp3": 2000}}
+	})
+	found, _ := registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp3"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingShared)
+	assert.Nil(t, found)
+	found, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp4"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingShared)
+	assert.Equal(t, subs, found)
+}
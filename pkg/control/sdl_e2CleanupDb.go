@@ -0,0 +1,102 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+
+	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const e2CleanupSdlNs = "submgr_e2CleanupDb"
+
+func CreateE2CleanupSdl() Sdlnterface {
+	return sdl.NewSyncStorage()
+}
+
+func (r *Registry) WriteE2CleanupToSdl(key e2SubsKey, cleanup *E2CleanupInfo) error {
+	if r.e2CleanupDb == nil {
+		return nil
+	}
+	jsonData, err := json.Marshal(cleanup)
+	if err != nil {
+		return fmt.Errorf("SDL: WriteE2CleanupToSdl() json.Marshal error: %s", err.Error())
+	}
+	if err = r.e2CleanupDb.Set(e2CleanupSdlNs, key.String(), jsonData); err != nil {
+		return fmt.Errorf("SDL: WriteE2CleanupToSdl(): %s", err.Error())
+	}
+	return nil
+}
+
+func (r *Registry) RemoveE2CleanupsFromSdl(keys []e2SubsKey) error {
+	if r.e2CleanupDb == nil {
+		return nil
+	}
+	sdlKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		sdlKeys = append(sdlKeys, key.String())
+	}
+	if err := r.e2CleanupDb.Remove(e2CleanupSdlNs, sdlKeys); err != nil {
+		return fmt.Errorf("SDL: RemoveE2CleanupsFromSdl(): %s", err.Error())
+	}
+	xapp.Logger.Debug("SDL: E2 cleanups removed from e2CleanupDb. keys = %v", sdlKeys)
+	return nil
+}
+
+func (r *Registry) ReadAllE2CleanupsFromSdl() (map[e2SubsKey]*E2CleanupInfo, error) {
+
+	retMap := make(map[e2SubsKey]*E2CleanupInfo)
+	if r.e2CleanupDb == nil {
+		return retMap, nil
+	}
+	// Get all keys
+	keys, err := r.e2CleanupDb.GetAll(e2CleanupSdlNs)
+	if err != nil {
+		return nil, fmt.Errorf("SDL: ReadAllE2CleanupsFromSdl(), GetAll(). Error while reading E2 cleanup keys from DBAAS %s", err.Error())
+	}
+
+	if len(keys) == 0 {
+		return retMap, nil
+	}
+
+	// Get all cleanups
+	iCleanupMap, err := r.e2CleanupDb.Get(e2CleanupSdlNs, keys)
+	if err != nil {
+		return nil, fmt.Errorf("SDL: ReadAllE2CleanupsFromSdl(), Get(): Error while reading E2 cleanups from DBAAS %s", err.Error())
+	}
+
+	for sdlKey, iCleanup := range iCleanupMap {
+
+		if iCleanup == nil {
+			return nil, fmt.Errorf("SDL: ReadAllE2CleanupsFromSdl() iCleanup = nil")
+		}
+		key, err := parseE2SubsSdlKey(sdlKey)
+		if err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllE2CleanupsFromSdl() %s", err.Error())
+		}
+		cleanup := &E2CleanupInfo{}
+		if err := json.Unmarshal([]byte(iCleanup.(string)), cleanup); err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllE2CleanupsFromSdl() json.unmarshal error: %s", err.Error())
+		}
+		retMap[key] = cleanup
+	}
+	return retMap, nil
+}
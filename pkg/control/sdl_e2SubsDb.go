@@ -22,7 +22,7 @@ package control
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"time"
 
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
 	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
@@ -32,14 +32,20 @@ import (
 const e2SubSdlNs = "submgr_e2SubsDb"
 
 type SubscriptionInfo struct {
-	Valid        bool
-	ReqId        RequestId
-	Meid         xapp.RMRMeid
-	EpList       xapp.RmrEndpointList
-	SubReqMsg    e2ap.E2APSubscriptionRequest
-	SubRespMsg   e2ap.E2APSubscriptionResponse
-	SubRespRcvd  string
-	PolicyUpdate bool
+	Valid            bool
+	ReqId            RequestId
+	Meid             xapp.RMRMeid
+	EpList           xapp.RmrEndpointList
+	SubReqMsg        e2ap.E2APSubscriptionRequest
+	SubRespMsg       e2ap.E2APSubscriptionResponse
+	SubRespRcvd      string
+	PolicyUpdate     bool
+	Created          time.Time
+	Exclusive        bool
+	PerRanInstanceId bool
+	RMRRouteCreated  bool
+	RicRequestorId   *uint32
+	Policy           PolicyState
 }
 
 func CreateSdl() Sdlnterface {
@@ -55,6 +61,12 @@ func (c *Control) WriteSubscriptionToSdl(subId uint32, subs *Subscription) error
 	subscriptionInfo.EpList = subs.EpList
 	subscriptionInfo.SubReqMsg = *subs.SubReqMsg
 	subscriptionInfo.PolicyUpdate = subs.PolicyUpdate
+	subscriptionInfo.Created = subs.Created
+	subscriptionInfo.Exclusive = subs.Exclusive
+	subscriptionInfo.PerRanInstanceId = subs.PerRanInstanceId
+	subscriptionInfo.RMRRouteCreated = subs.RMRRouteCreated
+	subscriptionInfo.RicRequestorId = subs.RicRequestorId
+	subscriptionInfo.Policy = subs.Policy
 
 	if typeofSubsMessage(subs.SubRFMsg) == "SubResp" {
 		subscriptionInfo.SubRespRcvd = "SubResp"
@@ -68,7 +80,7 @@ func (c *Control) WriteSubscriptionToSdl(subId uint32, subs *Subscription) error
 		return fmt.Errorf("SDL: WriteSubscriptionToSdl() json.Marshal error: %s", err.Error())
 	}
 
-	if err = c.e2SubsDb.Set(e2SubSdlNs, strconv.FormatUint(uint64(subId), 10), jsonData); err != nil {
+	if err = c.e2SubsDb.Set(e2SubSdlNs, e2SubSdlKey(subId, subs), jsonData); err != nil {
 		c.UpdateCounter(cSDLWriteFailure)
 		return fmt.Errorf("SDL: WriteSubscriptionToSdl(): %s", err.Error())
 	} else {
@@ -77,11 +89,11 @@ func (c *Control) WriteSubscriptionToSdl(subId uint32, subs *Subscription) error
 	return nil
 }
 
-func (c *Control) ReadSubscriptionFromSdl(subId uint32) (*Subscription, error) {
+func (c *Control) ReadSubscriptionFromSdl(key e2SubsKey) (*Subscription, error) {
 
 	// This function is now just for testing purpose
-	key := strconv.FormatUint(uint64(subId), 10)
-	retMap, err := c.e2SubsDb.Get(e2SubSdlNs, []string{key})
+	subId := key.subId
+	retMap, err := c.e2SubsDb.Get(e2SubSdlNs, []string{key.String()})
 	if err != nil {
 		c.UpdateCounter(cSDLReadFailure)
 		return nil, fmt.Errorf("SDL: ReadSubscriptionFromSdl(): %s", err.Error())
@@ -123,6 +135,12 @@ func (c *Control) CreateSubscription(subscriptionInfo *SubscriptionInfo, jsonSub
 	subReq = subscriptionInfo.SubReqMsg
 	subs.SubReqMsg = &subReq
 	subs.PolicyUpdate = subscriptionInfo.PolicyUpdate
+	subs.Created = subscriptionInfo.Created
+	subs.Exclusive = subscriptionInfo.Exclusive
+	subs.PerRanInstanceId = subscriptionInfo.PerRanInstanceId
+	subs.RMRRouteCreated = subscriptionInfo.RMRRouteCreated
+	subs.RicRequestorId = subscriptionInfo.RicRequestorId
+	subs.Policy = subscriptionInfo.Policy
 
 	if subscriptionInfo.SubRespRcvd == "SubResp" {
 		subs.SubRespRcvd = true
@@ -137,18 +155,75 @@ func (c *Control) CreateSubscription(subscriptionInfo *SubscriptionInfo, jsonSub
 	return subs
 }
 
-func (c *Control) RemoveSubscriptionFromSdl(subId uint32) error {
+//-------------------------------------------------------------------
+// Subscriptions are stored with RAN name and instance id as key, also
+// the ones with RIC wide instance id. Earlier versions stored
+// subscriptions with instance id only as key. Those are migrated when
+// subscriptions are read from db.
+//-------------------------------------------------------------------
+func e2SubSdlKey(subId uint32, subs *Subscription) string {
+	return e2SubsKey{ranName: ranNameOf(subs.Meid), subId: subId}.String()
+}
+
+func (c *Control) RemoveSubscriptionFromSdl(key e2SubsKey) error {
 
-	key := strconv.FormatUint(uint64(subId), 10)
-	if err := c.e2SubsDb.Remove(e2SubSdlNs, []string{key}); err != nil {
+	if err := c.e2SubsDb.Remove(e2SubSdlNs, []string{key.String()}); err != nil {
 		return fmt.Errorf("SDL: RemoveSubscriptionfromSdl(): %s\n", err.Error())
 	} else {
-		xapp.Logger.Debug("SDL: Subscription removed from e2SubsDb. subId = %v", subId)
+		xapp.Logger.Debug("SDL: Subscription removed from e2SubsDb. key = %v", key)
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Removes subscriptions having the instance id in any E2 node
+//-------------------------------------------------------------------
+func (c *Control) RemoveSubscriptionsWithSubIdFromSdl(subId uint32) error {
+
+	keys, err := c.e2SubsDb.GetAll(e2SubSdlNs)
+	if err != nil {
+		c.UpdateCounter(cSDLReadFailure)
+		return fmt.Errorf("SDL: RemoveSubscriptionsWithSubIdFromSdl(): %s\n", err.Error())
+	}
+	var removed []string
+	for _, sdlKey := range keys {
+		if key, err := parseE2SubsSdlKey(sdlKey); err == nil && key.subId == subId {
+			removed = append(removed, sdlKey)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
 	}
+	if err := c.e2SubsDb.Remove(e2SubSdlNs, removed); err != nil {
+		return fmt.Errorf("SDL: RemoveSubscriptionsWithSubIdFromSdl(): %s\n", err.Error())
+	}
+	xapp.Logger.Debug("SDL: Subscriptions removed from e2SubsDb. keys = %v", removed)
 	return nil
 }
 
-func (c *Control) ReadAllSubscriptionsFromSdl() ([]uint32, map[uint32]*Subscription, error) {
+//-------------------------------------------------------------------
+// Moves subscription stored by earlier version with instance id only
+// as key under key of RAN name and instance id
+//-------------------------------------------------------------------
+func (c *Control) migrateSubscriptionInSdl(oldKey string, newKey string, jsonSubscriptionInfo string) error {
+
+	if err := c.e2SubsDb.Set(e2SubSdlNs, newKey, []byte(jsonSubscriptionInfo)); err != nil {
+		c.UpdateCounter(cSDLWriteFailure)
+		return fmt.Errorf("SDL: migrateSubscriptionInSdl(): %s\n", err.Error())
+	}
+	if err := c.e2SubsDb.Remove(e2SubSdlNs, []string{oldKey}); err != nil {
+		c.UpdateCounter(cSDLRemoveFailure)
+		return fmt.Errorf("SDL: migrateSubscriptionInSdl(): %s\n", err.Error())
+	}
+	xapp.Logger.Info("SDL: Subscription key %s migrated to %s in e2SubsDb", oldKey, newKey)
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Returns free RIC wide instance ids, subscriptions with RIC wide
+// instance ids and subscriptions with per RAN instance ids
+//-------------------------------------------------------------------
+func (c *Control) ReadAllSubscriptionsFromSdl() ([]uint32, map[uint32]*Subscription, map[e2SubsKey]*Subscription, error) {
 
 	// Read all subscriptionInfos
 	var subIds []uint32
@@ -158,50 +233,77 @@ func (c *Control) ReadAllSubscriptionsFromSdl() ([]uint32, map[uint32]*Subscript
 	}
 
 	retMap := make(map[uint32]*Subscription)
+	ranMap := make(map[e2SubsKey]*Subscription)
 	// Get all keys
 	keys, err := c.e2SubsDb.GetAll(e2SubSdlNs)
 	if err != nil {
 		c.UpdateCounter(cSDLReadFailure)
-		return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl(), GetAll(). Error while reading E2 subscriptions  keys from DBAAS %s\n", err.Error())
+		return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl(), GetAll(). Error while reading E2 subscriptions  keys from DBAAS %s\n", err.Error())
 	}
 
 	if len(keys) == 0 {
-		return subIds, retMap, nil
+		return subIds, retMap, ranMap, nil
 	}
 
 	// Get all subscriptionInfos
 	iSubscriptionMap, err := c.e2SubsDb.Get(e2SubSdlNs, keys)
 	if err != nil {
 		c.UpdateCounter(cSDLReadFailure)
-		return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl(), Get():  Error while reading E2 subscriptions from DBAAS %s\n", err.Error())
+		return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl(), Get():  Error while reading E2 subscriptions from DBAAS %s\n", err.Error())
 	}
 
-	for _, iSubscriptionInfo := range iSubscriptionMap {
+	for sdlKey, iSubscriptionInfo := range iSubscriptionMap {
 
 		if iSubscriptionInfo == nil {
-			return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() iSubscriptionInfo = nil\n")
+			return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() iSubscriptionInfo = nil\n")
 		}
 
 		subscriptionInfo := &SubscriptionInfo{}
 		jsonSubscriptionInfo := iSubscriptionInfo.(string)
 
 		if err := json.Unmarshal([]byte(jsonSubscriptionInfo), subscriptionInfo); err != nil {
-			return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() json.unmarshal error: %s\n", err.Error())
+			return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() json.unmarshal error: %s\n", err.Error())
 		}
 
 		subs := c.CreateSubscription(subscriptionInfo, &jsonSubscriptionInfo)
 
+		// Subscription stored by earlier version with instance id only as key
+		if newKey := e2SubSdlKey(subscriptionInfo.ReqId.InstanceId, subs); newKey != sdlKey {
+			if _, ok := iSubscriptionMap[newKey]; ok {
+				return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() subscriptions with keys %s and %s conflict\n", sdlKey, newKey)
+			}
+			if err := c.migrateSubscriptionInSdl(sdlKey, newKey, jsonSubscriptionInfo); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		if subscriptionInfo.PerRanInstanceId {
+			// Records without the field are RIC wide as before
+			if subscriptionInfo.ReqId.InstanceId == 0 || subscriptionInfo.ReqId.InstanceId > maxInstanceId {
+				return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() per RAN instance id is out of range. Index is %d", subscriptionInfo.ReqId.InstanceId)
+			}
+			ranMap[newE2SubsKey(subs)] = subs
+			if subscriptionInfo.RMRRouteCreated == false {
+				continue
+			}
+			// Id of subscription having RMR route is not free RIC wide
+			if subIds, err = removeNumber(subIds, subscriptionInfo.ReqId.InstanceId); err != nil {
+				return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() error: %s\n", err.Error())
+			}
+			continue
+		}
+
 		if int(subscriptionInfo.ReqId.InstanceId) >= len(subIds) {
-			return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() index is out of range. Index is %d with slice length %d", subscriptionInfo.ReqId.InstanceId, len(subIds))
+			return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() index is out of range. Index is %d with slice length %d", subscriptionInfo.ReqId.InstanceId, len(subIds))
 		}
 		retMap[subscriptionInfo.ReqId.InstanceId] = subs
 
 		// Remove subId from free subIds. Original slice is modified here!
 		if subIds, err = removeNumber(subIds, subscriptionInfo.ReqId.InstanceId); err != nil {
-			return nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() error: %s\n", err.Error())
+			return nil, nil, nil, fmt.Errorf("SDL: ReadAllSubscriptionsFromSdl() error: %s\n", err.Error())
 		}
 	}
-	return subIds, retMap, nil
+	return subIds, retMap, ranMap, nil
 }
 
 func removeNumber(s []uint32, removedNum uint32) ([]uint32, error) {
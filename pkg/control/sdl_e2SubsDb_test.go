@@ -20,10 +20,10 @@
 package control
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -99,7 +99,7 @@ func GetSubscription(t *testing.T, e2SubId uint32, responseType int, srcEndPoint
 	params.Meid = &meid
 
 	// Create xApp transaction
-	trans := mainCtrl.c.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subReqParams.Req.RequestId, params.Meid)
+	trans := mainCtrl.c.tracker.NewXappTransaction(context.Background(), xapp.NewRmrEndpoint(params.Src), params.Xid, subReqParams.Req.RequestId, params.Meid)
 	if trans == nil {
 		t.Errorf("TEST: %s", idstring(fmt.Errorf("transaction not created"), params))
 		return nil
@@ -111,6 +111,7 @@ func GetSubscription(t *testing.T, e2SubId uint32, responseType int, srcEndPoint
 	subs.ReqId.Id = 123
 	subs.ReqId.InstanceId = subReqParams.Req.RequestId.InstanceId
 	subs.Meid = &meid
+	subs.PerRanInstanceId = true
 	subs.EpList.AddEndpoint(trans.GetEndpoint())
 	subs.SubReqMsg = subReqParams.Req
 	// subs.SubRFMsg contains received/cached SubscriptionResponse or SubscriptionFailure, nil in no response received
@@ -217,7 +218,7 @@ func TestReadSubscriptionFromSdl(t *testing.T) {
 
 	subId := mock.lastAllocatedSubId
 	t.Logf("Reading subId = %v\n", subId)
-	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(subId)
+	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		t.Errorf("TEST: %s", err.Error())
 		return
@@ -229,7 +230,7 @@ func TestReadSubscriptionFromSdl(t *testing.T) {
 func TestRemoveSubscriptionFromSdl(t *testing.T) {
 
 	subId := mock.lastAllocatedSubId
-	err := mainCtrl.c.RemoveSubscriptionFromSdl(subId)
+	err := mainCtrl.c.RemoveSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		t.Errorf("TEST: %s", err.Error())
 		return
@@ -242,7 +243,7 @@ func TestRemoveSubscriptionFromSdl(t *testing.T) {
 func TestReadNotExistingSubscriptionFromSdl(t *testing.T) {
 
 	var subId uint32 = 0
-	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(subId)
+	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		t.Logf("TEST: subscription not found from db. subId = %v", subId)
 		return
@@ -254,7 +255,7 @@ func TestReadNotExistingSubscriptionFromSdl(t *testing.T) {
 func TestReadNotExistingSubscriptionFromSdl2(t *testing.T) {
 
 	var subId uint32 = 7
-	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(subId)
+	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		t.Logf("TEST: subscription not found from db. subId = %v", subId)
 		return
@@ -266,7 +267,7 @@ func TestReadNotExistingSubscriptionFromSdl2(t *testing.T) {
 func TestRemoveNotExistingSubscriptionFromSdl(t *testing.T) {
 
 	var subId uint32 = 0
-	err := mainCtrl.c.RemoveSubscriptionFromSdl(subId)
+	err := mainCtrl.c.RemoveSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		t.Logf("TEST: %s", err.Error())
 		return
@@ -319,7 +320,7 @@ func TestReadSubscriptionsFromSdl(t *testing.T) {
 	// Db subscriptions should now contain subIDs 2, 3 and 4
 	var subId uint32
 	for subId = 2; subId <= 4; subId++ {
-		subs, err := mainCtrl.c.ReadSubscriptionFromSdl(subId)
+		subs, err := mainCtrl.c.ReadSubscriptionFromSdl(e2SubsKey{ranName: fmt.Sprintf("RAN_NAME_%v", subId-1), subId: subId})
 		if err != nil {
 			t.Errorf("TEST: %s", err.Error())
 			return
@@ -333,21 +334,22 @@ func TestReadAllSubscriptionsFromSdl(t *testing.T) {
 	// This test cases simulates submgr restart. SubIds and subscriptions are restored from db
 	// after initializing mock.subIds and mock.register
 	//	var err error
-	subIds, register, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
+	subIds, register, ranRegister, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
 	if err != nil {
 		t.Errorf("TEST: %s", err.Error())
 		return
 	}
 	//	for _, subs := range mock.register {
-	for _, subs := range register {
+	for _, subs := range ranRegister {
 		PrintSubscriptionData(t, subs)
 	}
 	// SubIds slices before and after restart can't be directly compared as original slice is not stored
-	// in the db. SubId values 1, 2, 3, 4 are already removed from the beginning of subIds slice above
-	// so far. Next free subId is 5 in the beginning of mock.subIds slice. The db contains now however only
-	// 3 subscriptions with subIds 2, 3 and 4, so only subId values 2, 3, 4 are removed from the returned
-	// subIds slice and there next free value is 1
+	// in the db. The db contains now 3 subscriptions with subIds 2, 3 and 4 in different E2 nodes. They
+	// have per RAN instance ids without RMR route, so no subId values are removed from the returned
+	// RIC wide subIds slice and there next free value is 1
 	assert.Equal(t, uint32(0x1), subIds[0])
+	assert.Equal(t, 0, len(register))
+	assert.Equal(t, 3, len(ranRegister))
 }
 
 func TestRemoveAllSubscriptionsFromSdl(t *testing.T) {
@@ -364,11 +366,12 @@ func TestReadAllSubscriptionsFromSdl2(t *testing.T) {
 
 	// This test cases simulates submgr startup. SubIds and subscriptions are restored from empty db
 	// after initializing mock.subIds and mock.register
-	subIds, register, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
+	subIds, register, ranRegister, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
 	if err != nil {
 		t.Errorf("TEST: %s", err.Error())
 		return
 	}
+	assert.Equal(t, 0, len(ranRegister))
 	for _, subs := range mock.register {
 		PrintSubscriptionData(t, subs)
 	}
@@ -400,7 +403,7 @@ func TestReadSubscriptionFromSdlFail(t *testing.T) {
 	MakeNextSdlCallFail()
 	subId := mock.lastAllocatedSubId
 	t.Logf("Reading subId = %v\n", subId)
-	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(subId)
+	subs, err := mainCtrl.c.ReadSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		if !strings.Contains(fmt.Sprintf("%s", err), sdlTestErrorString) {
 			t.Errorf("TEST: %s", err.Error())
@@ -418,7 +421,7 @@ func TestRemoveSubscriptionFromSdlFail(t *testing.T) {
 	// Try to remove one subscription. Test db should return test error string
 	MakeNextSdlCallFail()
 	subId := mock.lastAllocatedSubId
-	err := mainCtrl.c.RemoveSubscriptionFromSdl(subId)
+	err := mainCtrl.c.RemoveSubscriptionFromSdl(e2SubsKey{ranName: "RAN_NAME_1", subId: subId})
 	if err != nil {
 		if !strings.Contains(fmt.Sprintf("%s", err), sdlTestErrorString) {
 			t.Errorf("TEST: %s", err.Error())
@@ -439,7 +442,7 @@ func TestReadAllSubscriptionsFromSdlFail(t *testing.T) {
 	// This test cases simulates submgr restart. SubIds and subscriptions are restored from db
 	// after initializing mock.subIds and mock.register
 	//	var err error
-	subIds, register, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
+	subIds, register, _, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
 	if err != nil {
 		if !strings.Contains(fmt.Sprintf("%s", err), sdlTestErrorString) {
 			t.Errorf("TEST: %s", err.Error())
@@ -575,16 +578,16 @@ func (m *Mock) Remove(ns string, keys []string) error {
 	if len(keys) == 0 {
 		return fmt.Errorf("Remove() error: len(key) == 0\n")
 	}
-	subId64, err := strconv.ParseUint(keys[0], 10, 64)
+	key, err := parseE2SubsSdlKey(keys[0])
 	if err != nil {
-		return fmt.Errorf("Remove() ParseUint() error: %s\n", err.Error())
+		return fmt.Errorf("Remove() parseE2SubsSdlKey() error: %s\n", err.Error())
 	}
 
 	if sdlShouldReturnError == true {
 		return GetSdlError()
 	}
 
-	subId := uint32(subId64)
+	subId := key.subId
 	delete(m.e2SubsDb, keys[0])
 	delete(m.register, subId)
 	m.subIds = append(m.subIds, subId)
@@ -598,12 +601,12 @@ func (m *Mock) RemoveAll(ns string) error {
 	}
 
 	for key := range m.e2SubsDb {
-		subId64, err := strconv.ParseUint(key, 10, 64)
+		e2Key, err := parseE2SubsSdlKey(key)
 		if err != nil {
-			return fmt.Errorf("RemoveAll() ParseUint() error: %s\n", err.Error())
+			return fmt.Errorf("RemoveAll() parseE2SubsSdlKey() error: %s\n", err.Error())
 		}
 
-		subId := uint32(subId64)
+		subId := e2Key.subId
 		delete(m.e2SubsDb, key)
 		delete(m.register, subId)
 		m.subIds = append(m.subIds, subId)
@@ -0,0 +1,107 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+
+	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const notificationOutboxSdlNs = "submgr_notificationOutboxDb"
+
+func CreateNotificationOutboxSdl() Sdlnterface {
+	return sdl.NewSyncStorage()
+}
+
+func (c *Control) WriteNotificationToSdl(notification *NotificationInfo) error {
+
+	jsonData, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("SDL: WriteNotificationToSdl() json.Marshal error: %s", err.Error())
+	}
+
+	if err = c.notificationOutboxDb.Set(notificationOutboxSdlNs, notification.NotificationId, jsonData); err != nil {
+		c.UpdateCounter(cSDLWriteFailure)
+		return fmt.Errorf("SDL: WriteNotificationToSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: Notification written in notificationOutboxDb. notificationId = %v", notification.NotificationId)
+	}
+	return nil
+}
+
+func (c *Control) RemoveNotificationFromSdl(notificationId string) error {
+
+	if err := c.notificationOutboxDb.Remove(notificationOutboxSdlNs, []string{notificationId}); err != nil {
+		c.UpdateCounter(cSDLRemoveFailure)
+		return fmt.Errorf("SDL: RemoveNotificationFromSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: Notification removed from notificationOutboxDb. notificationId = %v", notificationId)
+	}
+	return nil
+}
+
+func (c *Control) ReadAllNotificationsFromSdl() (map[string]*NotificationInfo, error) {
+
+	retMap := make(map[string]*NotificationInfo)
+	// Get all keys
+	keys, err := c.notificationOutboxDb.GetAll(notificationOutboxSdlNs)
+	if err != nil {
+		c.UpdateCounter(cSDLReadFailure)
+		return nil, fmt.Errorf("SDL: ReadAllNotificationsFromSdl(), GetAll(). Error while reading notification keys from DBAAS %s", err.Error())
+	}
+
+	if len(keys) == 0 {
+		return retMap, nil
+	}
+
+	// Get all notifications
+	iNotificationMap, err := c.notificationOutboxDb.Get(notificationOutboxSdlNs, keys)
+	if err != nil {
+		c.UpdateCounter(cSDLReadFailure)
+		return nil, fmt.Errorf("SDL: ReadAllNotificationsFromSdl(), Get(): Error while reading notifications from DBAAS %s", err.Error())
+	}
+
+	for iNotificationId, iNotificationInfo := range iNotificationMap {
+
+		if iNotificationInfo == nil {
+			return nil, fmt.Errorf("SDL: ReadAllNotificationsFromSdl() iNotificationInfo = nil")
+		}
+
+		notification := &NotificationInfo{}
+		if err := json.Unmarshal([]byte(iNotificationInfo.(string)), notification); err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllNotificationsFromSdl() json.unmarshal error: %s", err.Error())
+		}
+		retMap[iNotificationId] = notification
+	}
+	return retMap, nil
+}
+
+func (c *Control) RemoveAllNotificationsFromSdl() error {
+
+	if err := c.notificationOutboxDb.RemoveAll(notificationOutboxSdlNs); err != nil {
+		c.UpdateCounter(cSDLRemoveFailure)
+		return fmt.Errorf("SDL: RemoveAllNotificationsFromSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: All notifications removed from notificationOutboxDb")
+	}
+	return nil
+}
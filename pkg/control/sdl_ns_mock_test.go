@@ -0,0 +1,124 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"fmt"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+// Generic SDL mock for a single namespace
+//-----------------------------------------------------------------------------
+type SdlNsMock struct {
+	ns   string
+	db   map[string]string // Store information as a string like real db does.
+	lock sync.Mutex
+}
+
+func CreateSdlNsMock(ns string) *SdlNsMock {
+	fmt.Printf("Test CreateSdlNsMock(%s)\n", ns)
+	sdlNsMock := new(SdlNsMock)
+	sdlNsMock.ns = ns
+	sdlNsMock.db = make(map[string]string)
+	return sdlNsMock
+}
+
+func (m *SdlNsMock) Set(ns string, pairs ...interface{}) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ns != m.ns {
+		return fmt.Errorf("Unexpected namespace '%s' error\n", ns)
+	}
+	if len(pairs) != 2 {
+		return fmt.Errorf("Set() error: Unexpected number of pairs %v\n", len(pairs))
+	}
+	key, ok := pairs[0].(string)
+	if !ok {
+		return fmt.Errorf("Set() error: Unexpected key type\n")
+	}
+	val, ok := pairs[1].([]byte)
+	if !ok {
+		return fmt.Errorf("Set() error: Unexpected value type\n")
+	}
+	m.db[key] = string(val)
+	return nil
+}
+
+func (m *SdlNsMock) Get(ns string, keys []string) (map[string]interface{}, error) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ns != m.ns {
+		return nil, fmt.Errorf("Unexpected namespace '%s' error\n", ns)
+	}
+	retMap := make(map[string]interface{})
+	for _, key := range keys {
+		if val, ok := m.db[key]; ok {
+			retMap[key] = val
+		} else {
+			retMap[key] = nil
+		}
+	}
+	return retMap, nil
+}
+
+func (m *SdlNsMock) GetAll(ns string) ([]string, error) {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ns != m.ns {
+		return nil, fmt.Errorf("Unexpected namespace '%s' error\n", ns)
+	}
+	keys := []string{}
+	for key := range m.db {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (m *SdlNsMock) Remove(ns string, keys []string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ns != m.ns {
+		return fmt.Errorf("Unexpected namespace '%s' error\n", ns)
+	}
+	for _, key := range keys {
+		delete(m.db, key)
+	}
+	return nil
+}
+
+func (m *SdlNsMock) RemoveAll(ns string) error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if ns != m.ns {
+		return fmt.Errorf("Unexpected namespace '%s' error\n", ns)
+	}
+	m.db = make(map[string]string)
+	return nil
+}
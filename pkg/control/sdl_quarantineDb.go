@@ -0,0 +1,124 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const quarantineSdlNs = "submgr_instanceIdQuarantineDb"
+
+func CreateQuarantineSdl() Sdlnterface {
+	return sdl.NewSyncStorage()
+}
+
+//-------------------------------------------------------------------
+// Keys of quarantineDb and e2CleanupDb are formed like keys of
+// subscriptions in e2SubsDb
+//-------------------------------------------------------------------
+func parseE2SubsSdlKey(sdlKey string) (e2SubsKey, error) {
+	key := e2SubsKey{}
+	idStr := sdlKey
+	if i := strings.LastIndex(sdlKey, "/"); i >= 0 {
+		key.ranName = sdlKey[:i]
+		idStr = sdlKey[i+1:]
+	}
+	subId, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil || subId == 0 || uint32(subId) > maxInstanceId {
+		return key, fmt.Errorf("invalid key %s", sdlKey)
+	}
+	key.subId = uint32(subId)
+	return key, nil
+}
+
+func (r *Registry) WriteQuarantineToSdl(key e2SubsKey, until time.Time) error {
+	if r.quarantineDb == nil {
+		return nil
+	}
+	jsonData, err := json.Marshal(until)
+	if err != nil {
+		return fmt.Errorf("SDL: WriteQuarantineToSdl() json.Marshal error: %s", err.Error())
+	}
+	if err = r.quarantineDb.Set(quarantineSdlNs, key.String(), jsonData); err != nil {
+		return fmt.Errorf("SDL: WriteQuarantineToSdl(): %s", err.Error())
+	}
+	return nil
+}
+
+func (r *Registry) RemoveQuarantineFromSdl(keys []e2SubsKey) error {
+	if r.quarantineDb == nil {
+		return nil
+	}
+	sdlKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		sdlKeys = append(sdlKeys, key.String())
+	}
+	if err := r.quarantineDb.Remove(quarantineSdlNs, sdlKeys); err != nil {
+		return fmt.Errorf("SDL: RemoveQuarantineFromSdl(): %s", err.Error())
+	}
+	xapp.Logger.Debug("SDL: Quarantines removed from instanceIdQuarantineDb. keys = %v", sdlKeys)
+	return nil
+}
+
+func (r *Registry) ReadAllQuarantinesFromSdl() (map[e2SubsKey]time.Time, error) {
+
+	retMap := make(map[e2SubsKey]time.Time)
+	if r.quarantineDb == nil {
+		return retMap, nil
+	}
+	// Get all keys
+	keys, err := r.quarantineDb.GetAll(quarantineSdlNs)
+	if err != nil {
+		return nil, fmt.Errorf("SDL: ReadAllQuarantinesFromSdl(), GetAll(). Error while reading quarantine keys from DBAAS %s", err.Error())
+	}
+
+	if len(keys) == 0 {
+		return retMap, nil
+	}
+
+	// Get all quarantine end times
+	iQuarantineMap, err := r.quarantineDb.Get(quarantineSdlNs, keys)
+	if err != nil {
+		return nil, fmt.Errorf("SDL: ReadAllQuarantinesFromSdl(), Get(): Error while reading quarantines from DBAAS %s", err.Error())
+	}
+
+	for sdlKey, iUntil := range iQuarantineMap {
+
+		if iUntil == nil {
+			return nil, fmt.Errorf("SDL: ReadAllQuarantinesFromSdl() iUntil = nil")
+		}
+		key, err := parseE2SubsSdlKey(sdlKey)
+		if err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllQuarantinesFromSdl() %s", err.Error())
+		}
+		var until time.Time
+		if err := json.Unmarshal([]byte(iUntil.(string)), &until); err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllQuarantinesFromSdl() json.unmarshal error: %s", err.Error())
+		}
+		retMap[key] = until
+	}
+	return retMap, nil
+}
@@ -0,0 +1,114 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+const restDuplicateSdlNs = "submgr_restDuplicateDb"
+
+type RestDuplicateEntryInfo struct {
+	RestSubsId    string
+	Expiry        time.Time
+	PayloadMd5sum string // Set for idempotency keys only
+}
+
+func CreateRestDuplicateSdl() Sdlnterface {
+	return sdl.NewSyncStorage()
+}
+
+func (c *Control) WriteRestDuplicateEntryToSdl(md5sum string, entry RestDuplicateEntryInfo) error {
+
+	jsonData, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("SDL: WriteRestDuplicateEntryToSdl() json.Marshal error: %s", err.Error())
+	}
+
+	if err = c.restDuplicateDb.Set(restDuplicateSdlNs, md5sum, jsonData); err != nil {
+		c.UpdateCounter(cSDLWriteFailure)
+		return fmt.Errorf("SDL: WriteRestDuplicateEntryToSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: md5sum written in restDuplicateDb. md5sum = %v, restSubsId = %v", md5sum, entry.RestSubsId)
+	}
+	return nil
+}
+
+func (c *Control) RemoveRestDuplicateEntryFromSdl(md5sum string) error {
+
+	if err := c.restDuplicateDb.Remove(restDuplicateSdlNs, []string{md5sum}); err != nil {
+		c.UpdateCounter(cSDLRemoveFailure)
+		return fmt.Errorf("SDL: RemoveRestDuplicateEntryFromSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: md5sum removed from restDuplicateDb. md5sum = %v", md5sum)
+	}
+	return nil
+}
+
+func (c *Control) ReadAllRestDuplicateEntriesFromSdl() (map[string]RestDuplicateEntryInfo, error) {
+
+	retMap := make(map[string]RestDuplicateEntryInfo)
+	// Get all keys
+	keys, err := c.restDuplicateDb.GetAll(restDuplicateSdlNs)
+	if err != nil {
+		c.UpdateCounter(cSDLReadFailure)
+		return nil, fmt.Errorf("SDL: ReadAllRestDuplicateEntriesFromSdl(), GetAll(). Error while reading md5sum keys from DBAAS %s", err.Error())
+	}
+
+	if len(keys) == 0 {
+		return retMap, nil
+	}
+
+	// Get all entries
+	iEntryMap, err := c.restDuplicateDb.Get(restDuplicateSdlNs, keys)
+	if err != nil {
+		c.UpdateCounter(cSDLReadFailure)
+		return nil, fmt.Errorf("SDL: ReadAllRestDuplicateEntriesFromSdl(), Get(): Error while reading md5sums from DBAAS %s", err.Error())
+	}
+
+	for md5sum, iEntryInfo := range iEntryMap {
+
+		if iEntryInfo == nil {
+			return nil, fmt.Errorf("SDL: ReadAllRestDuplicateEntriesFromSdl() iEntryInfo = nil")
+		}
+
+		entry := RestDuplicateEntryInfo{}
+		if err := json.Unmarshal([]byte(iEntryInfo.(string)), &entry); err != nil {
+			return nil, fmt.Errorf("SDL: ReadAllRestDuplicateEntriesFromSdl() json.unmarshal error: %s", err.Error())
+		}
+		retMap[md5sum] = entry
+	}
+	return retMap, nil
+}
+
+func (c *Control) RemoveAllRestDuplicateEntriesFromSdl() error {
+
+	if err := c.restDuplicateDb.RemoveAll(restDuplicateSdlNs); err != nil {
+		c.UpdateCounter(cSDLRemoveFailure)
+		return fmt.Errorf("SDL: RemoveAllRestDuplicateEntriesFromSdl(): %s", err.Error())
+	} else {
+		xapp.Logger.Debug("SDL: All md5sums removed from restDuplicateDb")
+	}
+	return nil
+}
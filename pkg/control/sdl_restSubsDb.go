@@ -22,23 +22,32 @@ package control
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	sdl "gerrit.o-ran-sc.org/r/ric-plt/sdlgo"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
 )
 
 const restSubSdlNs = "submgr_restSubsDb"
 
 type RESTSubscriptionInfo struct {
-	Created          string
-	XAppServiceName  string
-	XAppRmrEndPoint  string
-	Meid             string
-	InstanceIds      []uint32
-	XAppIdToE2Id     map[int64]int64
-	SubReqOngoing    bool
-	SubDelReqOngoing bool
-	Md5sum           string
+	Created              string
+	XAppServiceName      string
+	XAppRmrEndPoint      string
+	Meid                 string
+	InstanceIds          []uint32
+	XAppIdToE2Id         map[int64]int64
+	SubReqOngoing        bool
+	SubDelReqOngoing     bool
+	Md5sum               string
+	IdempotencyKey       string
+	IdempotencyKeyExpiry time.Time
+	LeaseDuration_s      int64
+	LeaseExpiry          time.Time
+	DeleteNotifyEndpoint *models.SubscriptionParamsClientEndpoint
+	ClientEndpoint       *models.SubscriptionParamsClientEndpoint
 }
 
 func CreateRESTSdl() Sdlnterface {
@@ -52,11 +61,19 @@ func (c *Control) WriteRESTSubscriptionToSdl(restSubId string, restSubs *RESTSub
 	restSubscriptionInfo.XAppServiceName = restSubs.xAppServiceName
 	restSubscriptionInfo.XAppRmrEndPoint = restSubs.xAppRmrEndPoint
 	restSubscriptionInfo.Meid = restSubs.Meid
-	restSubscriptionInfo.InstanceIds = restSubs.InstanceIds
-	restSubscriptionInfo.XAppIdToE2Id = restSubs.xAppIdToE2Id
+	restSubscriptionInfo.InstanceIds, restSubscriptionInfo.XAppIdToE2Id = c.registry.GetRESTSubscriptionInstances(restSubs)
 	restSubscriptionInfo.SubReqOngoing = restSubs.SubReqOngoing
 	restSubscriptionInfo.SubDelReqOngoing = restSubs.SubDelReqOngoing
-	restSubscriptionInfo.Md5sum = restSubs.lastReqMd5sum
+	if IsIdempotencyKey(restSubs.lastReqMd5sum) {
+		restSubscriptionInfo.IdempotencyKey = strings.TrimPrefix(restSubs.lastReqMd5sum, idempotencyKeyPrefix)
+		restSubscriptionInfo.IdempotencyKeyExpiry = restSubs.idempotencyKeyExpiry
+	} else {
+		restSubscriptionInfo.Md5sum = restSubs.lastReqMd5sum
+	}
+	restSubscriptionInfo.LeaseDuration_s = int64(restSubs.leaseDuration / time.Second)
+	restSubscriptionInfo.LeaseExpiry = restSubs.leaseExpiry
+	restSubscriptionInfo.DeleteNotifyEndpoint = restSubs.deleteNotifyEndpoint
+	restSubscriptionInfo.ClientEndpoint = restSubs.clientEndpoint
 
 	jsonData, err := json.Marshal(restSubscriptionInfo)
 	if err != nil {
@@ -117,6 +134,14 @@ func (c *Control) CreateRESTSubscription(restSubscriptionInfo *RESTSubscriptionI
 	restSubs.SubReqOngoing = restSubscriptionInfo.SubReqOngoing
 	restSubs.SubDelReqOngoing = restSubscriptionInfo.SubDelReqOngoing
 	restSubs.lastReqMd5sum = restSubscriptionInfo.Md5sum
+	if restSubscriptionInfo.IdempotencyKey != "" {
+		restSubs.lastReqMd5sum = idempotencyKeyPrefix + restSubscriptionInfo.IdempotencyKey
+		restSubs.idempotencyKeyExpiry = restSubscriptionInfo.IdempotencyKeyExpiry
+	}
+	restSubs.leaseDuration = time.Duration(restSubscriptionInfo.LeaseDuration_s) * time.Second
+	restSubs.leaseExpiry = restSubscriptionInfo.LeaseExpiry
+	restSubs.deleteNotifyEndpoint = restSubscriptionInfo.DeleteNotifyEndpoint
+	restSubs.clientEndpoint = restSubscriptionInfo.ClientEndpoint
 
 	return restSubs
 }
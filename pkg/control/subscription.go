@@ -20,10 +20,13 @@
 package control
 
 import (
+	"context"
+
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
 
 	"sync"
+	"time"
 )
 
 //-----------------------------------------------------------------------------
@@ -33,11 +36,11 @@ type Subscription struct {
 	mutex            sync.Mutex                    // Lock
 	valid            bool                          // valid
 	registry         *Registry                     // Registry
+	Created          time.Time                     // Creation time
 	ReqId            RequestId                     // ReqId (Requestor Id + Seq Nro a.k.a subsid)
 	Meid             *xapp.RMRMeid                 // Meid/RanName
 	EpList           xapp.RmrEndpointList          // Endpoints
 	RMRRouteCreated  bool                          // Does subscription have RMR route
-	TransLock        sync.Mutex                    // Lock transactions, only one executed per time for subs
 	TheTrans         TransactionIf                 // Ongoing transaction
 	SubReqMsg        *e2ap.E2APSubscriptionRequest // Subscription information
 	SubRFMsg         interface{}                   // Subscription information
@@ -49,6 +52,20 @@ type Subscription struct {
 	DeleteFromDb     bool                          // Delete subscription from db
 	NoRespToXapp     bool                          // Send no response for subscription delete to xApp after restart
 	DoNotWaitSubResp bool                          // Test flag. Response is not waited for Subscription Request
+	Exclusive        bool                          // Subscription is not shared with other endpoints
+	PerRanInstanceId bool                          // Instance id is unique only within E2 node
+	RicRequestorId   *uint32                       // RIC Requestor ID sent to E2 node, nil in subscription read from db record without it
+	Policy           PolicyState                   // Versions and history of policy subscription
+	mailbox          chan interface{}              // Requests and E2T responses to subscription event loop
+	mailboxPosted    int                           // Items posted to mailbox but not yet received by event loop
+	loopRunning      bool                          // Event loop of subscription is running
+	queuedRequests   []*subsRequest                // Requests received while another one is ongoing. Owned by event loop
+	requestorsCtx    context.Context               // Context of E2 transactions of create requests. Cancelled when all requestors have cancelled
+	cancelRequestors context.CancelFunc            // Cancels requestorsCtx
+	requestors       int                           // Create requests sharing requestorsCtx, which have not ended or been cancelled
+	quotaCounted     bool                          // Subscription is counted in quota usage. Guarded by registry mutex
+	quotaFunctionId  int64                         // RAN function counted in quota usage. Guarded by registry mutex
+	quotaXapps       []string                      // xApps counted in quota usage. Guarded by registry mutex
 }
 
 func (s *Subscription) String() string {
@@ -79,6 +96,24 @@ func (s *Subscription) GetReqId() *RequestId {
 	return &s.ReqId
 }
 
+//-----------------------------------------------------------------------------
+// Subscriptions restored from db records written before requestor id was
+// stored were created with the default requestor id. Configured requestor
+// id 0 is used as such.
+//-----------------------------------------------------------------------------
+func (s *Subscription) GetRicRequestorId() uint32 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ricRequestorId()
+}
+
+func (s *Subscription) ricRequestorId() uint32 {
+	if s.RicRequestorId == nil {
+		return defaultRicRequestorId
+	}
+	return *s.RicRequestorId
+}
+
 func (s *Subscription) GetMeid() *xapp.RMRMeid {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -91,20 +126,22 @@ func (s *Subscription) GetTransaction() TransactionIf {
 	return s.TheTrans
 }
 
-func (s *Subscription) WaitTransactionTurn(trans TransactionIf) {
-	s.TransLock.Lock()
+//-----------------------------------------------------------------------------
+// Only one transaction is executed per time for subs as transactions are run
+// by the event loop of the subscription
+//-----------------------------------------------------------------------------
+func (s *Subscription) startTransaction(trans TransactionIf) {
 	s.mutex.Lock()
 	s.TheTrans = trans
 	s.mutex.Unlock()
 }
 
-func (s *Subscription) ReleaseTransactionTurn(trans TransactionIf) {
+func (s *Subscription) endTransaction(trans TransactionIf) {
 	s.mutex.Lock()
 	if trans != nil && trans == s.TheTrans {
 		s.TheTrans = nil
 	}
 	s.mutex.Unlock()
-	s.TransLock.Unlock()
 }
 
 func (s *Subscription) IsMergeable(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest) bool {
@@ -124,50 +161,73 @@ func (s *Subscription) IsMergeable(trans *TransactionXapp, subReqMsg *e2ap.E2APS
 	}
 
 	// EventTrigger check
-	if s.SubReqMsg.EventTriggerDefinition.Data.Length != subReqMsg.EventTriggerDefinition.Data.Length {
+	if isEqualOctetString(&s.SubReqMsg.EventTriggerDefinition.Data, &subReqMsg.EventTriggerDefinition.Data) == false {
+		return false
+	}
+
+	// Actions check. Order of actions does not matter, actions are matched by ActionId
+	if len(s.SubReqMsg.ActionSetups) != len(subReqMsg.ActionSetups) {
 		return false
 	}
-	for i := uint64(0); i < s.SubReqMsg.EventTriggerDefinition.Data.Length; i++ {
-		if s.SubReqMsg.EventTriggerDefinition.Data.Data[i] != subReqMsg.EventTriggerDefinition.Data.Data[i] {
+	actions := make(map[uint64]*e2ap.ActionToBeSetupItem, len(s.SubReqMsg.ActionSetups))
+	for i := range s.SubReqMsg.ActionSetups {
+		acts := &s.SubReqMsg.ActionSetups[i]
+		if _, ok := actions[acts.ActionId]; ok {
+			// Duplicate ActionId
+			return false
+		}
+		actions[acts.ActionId] = acts
+	}
+	for i := range subReqMsg.ActionSetups {
+		actt := &subReqMsg.ActionSetups[i]
+		acts, ok := actions[actt.ActionId]
+		if ok == false {
+			return false
+		}
+		// Each existing action can match only once
+		delete(actions, actt.ActionId)
+		if isMergeableAction(acts, actt) == false {
 			return false
 		}
 	}
+	return true
+}
 
-	// Actions check
-	if len(s.SubReqMsg.ActionSetups) != len(subReqMsg.ActionSetups) {
+//-------------------------------------------------------------------
+// Only equal REPORT actions can be merged
+//-------------------------------------------------------------------
+func isMergeableAction(acts *e2ap.ActionToBeSetupItem, actt *e2ap.ActionToBeSetupItem) bool {
+	if acts.ActionType != actt.ActionType {
+		return false
+	}
+
+	if acts.ActionType != e2ap.E2AP_ActionTypeReport {
+		return false
+	}
+
+	if acts.RicActionDefinitionPresent != actt.RicActionDefinitionPresent {
+		return false
+	}
+
+	if isEqualOctetString(&acts.ActionDefinitionChoice.Data, &actt.ActionDefinitionChoice.Data) == false {
+		return false
+	}
+
+	if acts.SubsequentAction.Present != actt.SubsequentAction.Present ||
+		acts.SubsequentAction.Type != actt.SubsequentAction.Type ||
+		acts.SubsequentAction.TimetoWait != actt.SubsequentAction.TimetoWait {
 		return false
 	}
+	return true
+}
 
-	for _, acts := range s.SubReqMsg.ActionSetups {
-		for _, actt := range subReqMsg.ActionSetups {
-			if acts.ActionId != actt.ActionId {
-				return false
-			}
-			if acts.ActionType != actt.ActionType {
-				return false
-			}
-
-			if acts.ActionType != e2ap.E2AP_ActionTypeReport {
-				return false
-			}
-
-			if acts.RicActionDefinitionPresent != actt.RicActionDefinitionPresent {
-				return false
-			}
-
-			if acts.ActionDefinitionChoice.Data.Length != actt.ActionDefinitionChoice.Data.Length {
-				return false
-			}
-			for i := uint64(0); i < acts.ActionDefinitionChoice.Data.Length; i++ {
-				if acts.ActionDefinitionChoice.Data.Data[i] != actt.ActionDefinitionChoice.Data.Data[i] {
-					return false
-				}
-			}
-			if acts.SubsequentAction.Present != actt.SubsequentAction.Present ||
-				acts.SubsequentAction.Type != actt.SubsequentAction.Type ||
-				acts.SubsequentAction.TimetoWait != actt.SubsequentAction.TimetoWait {
-				return false
-			}
+func isEqualOctetString(a *e2ap.OctetString, b *e2ap.OctetString) bool {
+	if a.Length != b.Length {
+		return false
+	}
+	for i := uint64(0); i < a.Length; i++ {
+		if a.Data[i] != b.Data[i] {
+			return false
 		}
 	}
 	return true
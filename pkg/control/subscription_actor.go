@@ -0,0 +1,344 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Every subscription is processed by its own event loop. xApp requests (create,
+// delete and background delete retry) and E2T responses are posted into the
+// subscription mailbox and the loop handles them one by one in posting order.
+// While a request waits for E2T response the loop keeps consuming the mailbox:
+// E2T responses and timer expiries are given to the waiting request and new
+// requests are queued to be handled after it. The loop is started by a post
+// and it exits when the mailbox becomes empty. Result of a request is given
+// to its done function in the loop, so that no goroutine waits for it.
+//-----------------------------------------------------------------------------
+const subsMailboxSize = 64
+
+type subsRequestKind int
+
+const (
+	subsRequestCreate subsRequestKind = iota
+	subsRequestDelete
+	subsRequestCleanup
+)
+
+type subsRequest struct {
+	kind    subsRequestKind
+	handler func()
+}
+
+type subsE2TEvent struct {
+	msg interface{}
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with subs.mutex locked
+//-----------------------------------------------------------------------------
+func (s *Subscription) getMailbox() chan interface{} {
+	if s.mailbox == nil {
+		s.mailbox = make(chan interface{}, subsMailboxSize)
+	}
+	return s.mailbox
+}
+
+//-----------------------------------------------------------------------------
+// Ongoing counters are updated only here, under subs.mutex, when request is
+// posted and when event loop has handled it
+//-----------------------------------------------------------------------------
+func (s *Subscription) updateOngoingCount(kind subsRequestKind, delta int) {
+	switch kind {
+	case subsRequestCreate:
+		s.OngoingReqCount += delta
+	case subsRequestDelete:
+		s.OngoingDelCount += delta
+	}
+}
+
+func (s *Subscription) GetOngoingCounts() (int, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.OngoingReqCount, s.OngoingDelCount
+}
+
+//-----------------------------------------------------------------------------
+// Posts request or E2T response to subscription mailbox and starts the event
+// loop if it is not running. If wait is true, post blocks until there is room
+// in the mailbox. Otherwise item is not posted if mailbox is full.
+//-----------------------------------------------------------------------------
+func (s *Subscription) post(item interface{}, wait bool) bool {
+	s.mutex.Lock()
+	mailbox := s.getMailbox()
+	s.mailboxPosted++
+	if request, ok := item.(*subsRequest); ok {
+		s.updateOngoingCount(request.kind, 1)
+	}
+	startLoop := s.loopRunning == false
+	s.loopRunning = true
+	s.mutex.Unlock()
+
+	if startLoop {
+		go s.run()
+	}
+	if wait == false {
+		select {
+		case mailbox <- item:
+			return true
+		default:
+			// Mailbox is full so the loop is running and it sees the decrement
+			s.mutex.Lock()
+			s.mailboxPosted--
+			if request, ok := item.(*subsRequest); ok {
+				s.updateOngoingCount(request.kind, -1)
+			}
+			s.mutex.Unlock()
+			return false
+		}
+	}
+	mailbox <- item
+	return true
+}
+
+func (s *Subscription) received() {
+	s.mutex.Lock()
+	s.mailboxPosted--
+	s.mutex.Unlock()
+}
+
+//-----------------------------------------------------------------------------
+// Subscription event loop
+//-----------------------------------------------------------------------------
+func (s *Subscription) run() {
+	for {
+		request := s.nextRequest()
+		if request == nil {
+			return
+		}
+		request.handler()
+		s.mutex.Lock()
+		s.updateOngoingCount(request.kind, -1)
+		s.mutex.Unlock()
+	}
+}
+
+func (s *Subscription) nextRequest() *subsRequest {
+	for {
+		if len(s.queuedRequests) > 0 {
+			request := s.queuedRequests[0]
+			s.queuedRequests = s.queuedRequests[1:]
+			return request
+		}
+		s.mutex.Lock()
+		if s.mailboxPosted == 0 {
+			s.loopRunning = false
+			s.mutex.Unlock()
+			return nil
+		}
+		mailbox := s.getMailbox()
+		s.mutex.Unlock()
+
+		item := <-mailbox
+		s.received()
+		switch item := item.(type) {
+		case *subsRequest:
+			return item
+		case *subsE2TEvent:
+			xapp.Logger.Error("SUBS: No ongoing transaction, dropping event(%s) %s", typeofSubsMessage(item.msg), s.String())
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Waits E2T response for the ongoing request. Requests received meanwhile are
+// queued. Zero waittime waits without timeout. Wait ends as timed out also
+// when ctx is done. Must be called from the event loop of the subscription
+//-----------------------------------------------------------------------------
+func (s *Subscription) waitE2TEvent(ctx context.Context, waittime time.Duration) (interface{}, bool) {
+	var expiry <-chan time.Time
+	if waittime > 0 {
+		timer := time.NewTimer(waittime)
+		defer timer.Stop()
+		expiry = timer.C
+	}
+	s.mutex.Lock()
+	mailbox := s.getMailbox()
+	s.mutex.Unlock()
+
+	for {
+		select {
+		case item := <-mailbox:
+			s.received()
+			switch item := item.(type) {
+			case *subsRequest:
+				s.queuedRequests = append(s.queuedRequests, item)
+			case *subsE2TEvent:
+				return item.msg, false
+			}
+		case <-expiry:
+			return nil, true
+		case <-ctx.Done():
+			return nil, true
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Waits until request is admitted to E2 node. Requests received meanwhile are
+// queued and E2T responses dropped, as nothing has been sent to E2 node yet.
+// Must be called from the event loop of the subscription
+//-----------------------------------------------------------------------------
+func (s *Subscription) waitAdmission(admitted <-chan error) error {
+	s.mutex.Lock()
+	mailbox := s.getMailbox()
+	s.mutex.Unlock()
+
+	for {
+		select {
+		case err := <-admitted:
+			return err
+		case item := <-mailbox:
+			s.received()
+			switch item := item.(type) {
+			case *subsRequest:
+				s.queuedRequests = append(s.queuedRequests, item)
+			case *subsE2TEvent:
+				xapp.Logger.Error("SUBS: Request not sent yet, dropping event(%s) %s", typeofSubsMessage(item.msg), s.String())
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Create requests merged to the same subscription wait for the same E2
+// transaction. Its context is cancelled only when every requestor has
+// cancelled its request, or when submgr shuts down. Returned remove must be
+// called when the request has ended. New context is created for requests
+// received after the previous one has been cancelled.
+//-----------------------------------------------------------------------------
+func (s *Subscription) addRequestor(root context.Context, requestor context.Context) (context.Context, func()) {
+	s.mutex.Lock()
+	if s.requestorsCtx == nil || s.requestorsCtx.Err() != nil {
+		s.requestorsCtx, s.cancelRequestors = context.WithCancel(root)
+		s.requestors = 0
+	}
+	ctx := s.requestorsCtx
+	cancel := s.cancelRequestors
+	s.requestors++
+	s.mutex.Unlock()
+
+	var once sync.Once
+	remove := func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if s.requestorsCtx != ctx {
+				return
+			}
+			s.requestors--
+			if s.requestors == 0 {
+				cancel()
+			}
+		})
+	}
+	stop := context.AfterFunc(requestor, remove)
+	return ctx, func() {
+		stop()
+		remove()
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Response of E2 node to create request, or nil, and outcome of delete request
+// are given to done in the event loop of the subscription. Delete request is
+// not posted if wait is false and mailbox is full.
+//-----------------------------------------------------------------------------
+func (c *Control) postSubscriptionCreate(subs *Subscription, parentTrans *TransactionXapp, e2SubscriptionDirectives *E2SubscriptionDirectives, waitRouteCleanupTime time.Duration, done func(event interface{})) {
+	ctx, removeRequestor := subs.addRequestor(c.rootContext(), parentTrans.Context())
+	subs.post(&subsRequest{
+		kind: subsRequestCreate,
+		handler: func() {
+			event := c.handleSubscriptionCreate(ctx, subs, parentTrans, e2SubscriptionDirectives, waitRouteCleanupTime)
+			removeRequestor()
+			done(event)
+		},
+	}, true)
+}
+
+func (c *Control) postSubscriptionDelete(ctx context.Context, subs *Subscription, parentTrans *TransactionXapp, waitRouteCleanupTime time.Duration, wait bool, done func(event interface{})) bool {
+	return subs.post(&subsRequest{
+		kind: subsRequestDelete,
+		handler: func() {
+			done(c.handleSubscriptionDelete(ctx, subs, parentTrans, waitRouteCleanupTime))
+		},
+	}, wait)
+}
+
+//-----------------------------------------------------------------------------
+// Done function and channel for requests whose caller waits for the result.
+// Result is buffered, so the event loop does not block on a caller which has
+// stopped waiting
+//-----------------------------------------------------------------------------
+func newResultWaiter() (func(event interface{}), <-chan interface{}) {
+	result := make(chan interface{}, 1)
+	return func(event interface{}) {
+		result <- event
+	}, result
+}
+
+//-----------------------------------------------------------------------------
+// Sends RIC Subscription Delete Request from the event loop of the subscription
+// and waits for the result
+//-----------------------------------------------------------------------------
+func (c *Control) runSubscriptionCleanup(ctx context.Context, subs *Subscription) interface{} {
+	var event interface{}
+	done := make(chan struct{})
+	subs.post(&subsRequest{
+		kind: subsRequestCleanup,
+		handler: func() {
+			trans := c.tracker.NewSubsTransaction(ctx, subs)
+			subs.startTransaction(trans)
+			event = c.sendE2TSubscriptionDeleteRequest(ctx, subs, trans, &TransactionXapp{})
+			subs.endTransaction(trans)
+			trans.Release()
+			close(done)
+		},
+	}, true)
+	<-done
+	return event
+}
+
+//-----------------------------------------------------------------------------
+// E2T responses are not waited for, so that RMR receiver is never blocked by a
+// subscription. Response is dropped if mailbox is full. Request waiting for it
+// then times out and is retried as if E2 node had not responded.
+//-----------------------------------------------------------------------------
+func (c *Control) postE2TEvent(subs *Subscription, msg interface{}) bool {
+	if subs.post(&subsE2TEvent{msg: msg}, false) == false {
+		c.UpdateCounter(cE2TRespDropped)
+		return false
+	}
+	return true
+}
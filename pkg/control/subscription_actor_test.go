@@ -0,0 +1,270 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+func postTestRequest(subs *Subscription, kind subsRequestKind, handler func()) {
+	subs.post(&subsRequest{kind: kind, handler: handler}, true)
+}
+
+func waitSubsLoopStopped(t *testing.T, subs *Subscription) {
+	for i := 0; i < 100; i++ {
+		subs.mutex.Lock()
+		running := subs.loopRunning
+		subs.mutex.Unlock()
+		if running == false {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Event loop of %s not stopped", subs.String())
+}
+
+func TestSubsActorHandlesRequestsInOrder(t *testing.T) {
+	subs := &Subscription{}
+	var mutex sync.Mutex
+	handled := []int{}
+	release := make(chan struct{})
+
+	postTestRequest(subs, subsRequestCreate, func() {
+		<-release
+		mutex.Lock()
+		handled = append(handled, 0)
+		mutex.Unlock()
+	})
+	for i := 1; i < 20; i++ {
+		i := i
+		kind := subsRequestCreate
+		if i%2 == 1 {
+			kind = subsRequestDelete
+		}
+		postTestRequest(subs, kind, func() {
+			mutex.Lock()
+			handled = append(handled, i)
+			mutex.Unlock()
+		})
+	}
+
+	ongoingReqCount, ongoingDelCount := subs.GetOngoingCounts()
+	assert.Equal(t, 10, ongoingReqCount)
+	assert.Equal(t, 10, ongoingDelCount)
+
+	close(release)
+	waitSubsLoopStopped(t, subs)
+
+	expected := []int{}
+	for i := 0; i < 20; i++ {
+		expected = append(expected, i)
+	}
+	mutex.Lock()
+	assert.Equal(t, expected, handled)
+	mutex.Unlock()
+	ongoingReqCount, ongoingDelCount = subs.GetOngoingCounts()
+	assert.Equal(t, 0, ongoingReqCount)
+	assert.Equal(t, 0, ongoingDelCount)
+}
+
+func TestSubsActorDeliversE2TEventToOngoingRequest(t *testing.T) {
+	subs := &Subscription{}
+	handled := make(chan string, 3)
+	waiting := make(chan struct{})
+
+	postTestRequest(subs, subsRequestCreate, func() {
+		close(waiting)
+		event, timedOut := subs.waitE2TEvent(context.Background(), time.Second)
+		assert.False(t, timedOut)
+		_, ok := event.(*e2ap.E2APSubscriptionResponse)
+		assert.True(t, ok)
+		handled <- "create"
+	})
+	<-waiting
+	// Request posted before the response is queued after the ongoing request
+	postTestRequest(subs, subsRequestDelete, func() {
+		event, timedOut := subs.waitE2TEvent(context.Background(), 50*time.Millisecond)
+		assert.True(t, timedOut)
+		assert.Nil(t, event)
+		handled <- "delete"
+	})
+	assert.True(t, subs.post(&subsE2TEvent{msg: &e2ap.E2APSubscriptionResponse{}}, false))
+
+	assert.Equal(t, "create", <-handled)
+	assert.Equal(t, "delete", <-handled)
+	waitSubsLoopStopped(t, subs)
+}
+
+func TestSubsActorDropsE2TEventWithoutOngoingRequest(t *testing.T) {
+	subs := &Subscription{}
+	assert.True(t, subs.post(&subsE2TEvent{msg: &e2ap.E2APSubscriptionDeleteResponse{}}, false))
+	waitSubsLoopStopped(t, subs)
+
+	// Dropped event is not given to the next request
+	done := make(chan struct{})
+	postTestRequest(subs, subsRequestCleanup, func() {
+		event, timedOut := subs.waitE2TEvent(context.Background(), 20*time.Millisecond)
+		assert.True(t, timedOut)
+		assert.Nil(t, event)
+		close(done)
+	})
+	<-done
+	waitSubsLoopStopped(t, subs)
+	subs.mutex.Lock()
+	assert.Equal(t, 0, subs.mailboxPosted)
+	subs.mutex.Unlock()
+}
+
+func TestSubsActorE2TWaitCancelled(t *testing.T) {
+	subs := &Subscription{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	postTestRequest(subs, subsRequestCreate, func() {
+		event, timedOut := subs.waitE2TEvent(ctx, time.Minute)
+		assert.True(t, timedOut)
+		assert.Nil(t, event)
+		close(done)
+	})
+	cancel()
+	<-done
+	waitSubsLoopStopped(t, subs)
+}
+
+func TestSubsActorDropsE2TEventWhenMailboxFull(t *testing.T) {
+	subs := &Subscription{}
+	release := make(chan struct{})
+	postTestRequest(subs, subsRequestCreate, func() {
+		<-release
+	})
+	for i := 0; i < subsMailboxSize; i++ {
+		postTestRequest(subs, subsRequestDelete, func() {})
+	}
+
+	// E2T event is not waited for when mailbox is full
+	assert.False(t, subs.post(&subsE2TEvent{msg: &e2ap.E2APSubscriptionResponse{}}, false))
+	_, ongoingDelCount := subs.GetOngoingCounts()
+	assert.Equal(t, subsMailboxSize, ongoingDelCount)
+
+	close(release)
+	waitSubsLoopStopped(t, subs)
+	subs.mutex.Lock()
+	assert.Equal(t, 0, subs.mailboxPosted)
+	subs.mutex.Unlock()
+}
+
+func TestSubsActorDrainsMailboxWhileWaitingAdmission(t *testing.T) {
+	subs := &Subscription{}
+	admitted := make(chan error, 1)
+	waiting := make(chan struct{})
+	handled := make(chan string, 2)
+
+	postTestRequest(subs, subsRequestCreate, func() {
+		close(waiting)
+		assert.Nil(t, subs.waitAdmission(admitted))
+		// Event received before the request was sent has been dropped
+		event, timedOut := subs.waitE2TEvent(context.Background(), 20*time.Millisecond)
+		assert.True(t, timedOut)
+		assert.Nil(t, event)
+		handled <- "create"
+	})
+	<-waiting
+	postTestRequest(subs, subsRequestDelete, func() {
+		handled <- "delete"
+	})
+	assert.True(t, subs.post(&subsE2TEvent{msg: &e2ap.E2APSubscriptionResponse{}}, false))
+	for i := 0; i < 100; i++ {
+		subs.mutex.Lock()
+		posted := subs.mailboxPosted
+		subs.mutex.Unlock()
+		if posted == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	subs.mutex.Lock()
+	assert.Equal(t, 0, subs.mailboxPosted)
+	subs.mutex.Unlock()
+
+	admitted <- nil
+	assert.Equal(t, "create", <-handled)
+	assert.Equal(t, "delete", <-handled)
+	waitSubsLoopStopped(t, subs)
+}
+
+func TestSubsActorDeleteNotPostedWhenMailboxFull(t *testing.T) {
+	c := &Control{}
+	subs := &Subscription{}
+	release := make(chan struct{})
+	postTestRequest(subs, subsRequestCreate, func() {
+		<-release
+	})
+	for i := 0; i < subsMailboxSize; i++ {
+		postTestRequest(subs, subsRequestCleanup, func() {})
+	}
+
+	// Delete from RMR receiver is not waited for when mailbox is full
+	posted := c.postSubscriptionDelete(context.Background(), subs, &TransactionXapp{}, 0, false, func(event interface{}) {
+		t.Errorf("Delete handled")
+	})
+	assert.False(t, posted)
+	_, ongoingDelCount := subs.GetOngoingCounts()
+	assert.Equal(t, 0, ongoingDelCount)
+
+	close(release)
+	waitSubsLoopStopped(t, subs)
+}
+
+func TestSubsRequestorContextCancelledByAllRequestors(t *testing.T) {
+	subs := &Subscription{}
+	requestor1, cancel1 := context.WithCancel(context.Background())
+	requestor2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	ctx, remove1 := subs.addRequestor(context.Background(), requestor1)
+	ctx2, remove2 := subs.addRequestor(context.Background(), requestor2)
+	assert.Equal(t, ctx, ctx2)
+
+	// Request shared by another requestor is not cancelled
+	cancel1()
+	remove1()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, ctx.Err())
+
+	cancel2()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Context not cancelled")
+	}
+	remove2()
+
+	// Next requestor gets a new context
+	requestor3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	ctx3, remove3 := subs.addRequestor(context.Background(), requestor3)
+	assert.Nil(t, ctx3.Err())
+	remove3()
+	assert.NotNil(t, ctx3.Err())
+}
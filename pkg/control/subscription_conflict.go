@@ -0,0 +1,281 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+//-----------------------------------------------------------------------------
+// POLICY and INSERT subscriptions of the same RAN function and event trigger
+// in the same E2 node control the same RAN behaviour. Such subscriptions are
+// not merged, so xApps could otherwise install policies fighting each other.
+// With strategy REJECT any conflicting request is rejected. With FIRST_WINS
+// only requests of other xApps than the owner of the existing subscription
+// are rejected. With PRIORITY request of xApp with higher priority than the
+// owners of conflicting subscriptions pre-empts them, other requests are
+// rejected as with FIRST_WINS.
+//-----------------------------------------------------------------------------
+type ActionConflictStrategy string
+
+const (
+	ActionConflictStrategyNone      ActionConflictStrategy = "NONE"
+	ActionConflictStrategyReject    ActionConflictStrategy = "REJECT"
+	ActionConflictStrategyFirstWins ActionConflictStrategy = "FIRST_WINS"
+	ActionConflictStrategyPriority  ActionConflictStrategy = "PRIORITY"
+)
+
+type ActionConflictConfig struct {
+	Strategy       ActionConflictStrategy
+	XappPriorities map[string]int
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var actionConflictConfig atomic.Pointer[ActionConflictConfig]
+
+func init() {
+	setActionConflictConfig(ActionConflictConfig{Strategy: ActionConflictStrategyNone, XappPriorities: make(map[string]int)})
+}
+
+func getActionConflictConfig() *ActionConflictConfig {
+	return actionConflictConfig.Load()
+}
+
+func setActionConflictConfig(config ActionConflictConfig) {
+	actionConflictConfig.Store(&config)
+}
+
+//-----------------------------------------------------------------------------
+// Reads controls.actionConflictStrategy and per xApp priorities from map
+// controls.xappSubscriptionPriorities. Priority of xApp is 0 by default.
+//-----------------------------------------------------------------------------
+func ReadActionConflictConfig() ActionConflictConfig {
+
+	a := ActionConflictConfig{Strategy: ActionConflictStrategyNone, XappPriorities: make(map[string]int)}
+	switch strategy := ActionConflictStrategy(strings.ToUpper(viper.GetString("controls.actionConflictStrategy"))); strategy {
+	case "", ActionConflictStrategyNone:
+	case ActionConflictStrategyReject, ActionConflictStrategyFirstWins, ActionConflictStrategyPriority:
+		a.Strategy = strategy
+	default:
+		xapp.Logger.Error("Invalid actionConflictStrategy %s. Conflicts are not detected", strategy)
+	}
+	for name, value := range viper.GetStringMapString("controls.xappSubscriptionPriorities") {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			xapp.Logger.Error("Invalid priority %s for %s in xappSubscriptionPriorities", value, name)
+			continue
+		}
+		a.XappPriorities[strings.ToLower(XappRmrServiceName(name))] = priority
+	}
+	return a
+}
+
+func (a *ActionConflictConfig) priority(xappRmrServiceName string) int {
+	return a.XappPriorities[strings.ToLower(xappRmrServiceName)]
+}
+
+func isConflictingActionType(actionType uint64) bool {
+	return actionType == e2ap.E2AP_ActionTypePolicy || actionType == e2ap.E2AP_ActionTypeInsert
+}
+
+//-----------------------------------------------------------------------------
+// Conflicting subscriptions found for request. Conflicting subscriptions are
+// pre-empted if preempt is true, otherwise request is rejected.
+//-----------------------------------------------------------------------------
+type actionConflict struct {
+	subs    []*Subscription
+	preempt bool
+}
+
+func (a *actionConflict) subIds() []uint32 {
+	subIds := make([]uint32, 0, len(a.subs))
+	for _, subs := range a.subs {
+		subIds = append(subIds, subs.ReqId.InstanceId)
+	}
+	return subIds
+}
+
+func (a *actionConflict) err() error {
+	return fmt.Errorf("Request conflicts with POLICY or INSERT subscriptions %v of other xApps", a.subIds())
+}
+
+//-------------------------------------------------------------------
+// Must be called with shard opMutex of the E2 node locked
+//-------------------------------------------------------------------
+func (r *Registry) findActionConflict(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, actionType uint64) *actionConflict {
+	config := getActionConflictConfig()
+	if config.Strategy == ActionConflictStrategyNone || isConflictingActionType(actionType) == false {
+		return nil
+	}
+	shard := r.findShard(trans.GetMeid().RanName)
+	if shard == nil {
+		return nil
+	}
+	xappAddr := trans.GetEndpoint().Addr
+	conflict := &actionConflict{preempt: config.Strategy == ActionConflictStrategyPriority}
+	for _, subs := range shard.getAllSubs() {
+		if subs.SubReqMsg == nil ||
+			subs.SubReqMsg.FunctionId != subReqMsg.FunctionId ||
+			isConflictingActionType(actionTypeOf(subs.SubReqMsg)) == false ||
+			isEqualOctetString(&subs.SubReqMsg.EventTriggerDefinition.Data, &subReqMsg.EventTriggerDefinition.Data) == false {
+			continue
+		}
+		subs.mutex.Lock()
+		owners := subs.EpList.Endpoints
+		valid := subs.valid && len(owners) > 0
+		subs.mutex.Unlock()
+		if valid == false {
+			continue
+		}
+		for _, owner := range owners {
+			if config.Strategy != ActionConflictStrategyReject && owner.Addr == xappAddr {
+				continue
+			}
+			if config.priority(owner.Addr) >= config.priority(xappAddr) {
+				conflict.preempt = false
+			}
+			conflict.subs = append(conflict.subs, subs)
+			break
+		}
+	}
+	if len(conflict.subs) == 0 {
+		return nil
+	}
+	sort.Slice(conflict.subs, func(i, j int) bool { return conflict.subs[i].ReqId.InstanceId < conflict.subs[j].ReqId.InstanceId })
+	return conflict
+}
+
+func actionTypeOf(subReqMsg *e2ap.E2APSubscriptionRequest) uint64 {
+	if len(subReqMsg.ActionSetups) == 0 {
+		return e2ap.E2AP_ActionTypeInvalid
+	}
+	return subReqMsg.ActionSetups[0].ActionType
+}
+
+//-------------------------------------------------------------------
+// Returned by assignment when conflicting subscriptions need to be
+// pre-empted before the request can be assigned
+//-------------------------------------------------------------------
+type preemptionRequiredError struct {
+	conflict *actionConflict
+}
+
+func (e *preemptionRequiredError) Error() string {
+	return fmt.Sprintf("Subscriptions %v need to be pre-empted", e.conflict.subIds())
+}
+
+//-------------------------------------------------------------------
+// Owner of pre-empted subscription. REST subscription id is empty if
+// owner has subscribed over RMR.
+//-------------------------------------------------------------------
+type preemptedOwner struct {
+	subId     uint32
+	ranName   string
+	endpoint  string
+	restSubId string
+}
+
+func (r *Registry) getPreemptedOwners(subsList []*Subscription) []preemptedOwner {
+	var owners []preemptedOwner
+	for _, subs := range subsList {
+		subs.mutex.Lock()
+		for _, endpoint := range subs.EpList.Endpoints {
+			owners = append(owners, preemptedOwner{subId: subs.ReqId.InstanceId, ranName: subs.Meid.RanName, endpoint: endpoint.String()})
+		}
+		subs.mutex.Unlock()
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := range owners {
+		for restSubId, restSubscription := range r.restSubscriptions {
+			if restSubscription.Meid == owners[i].ranName && restSubscription.xAppRmrEndPoint == owners[i].endpoint &&
+				restSubscription.hasE2InstanceId(owners[i].subId) {
+				owners[i].restSubId = restSubId
+				break
+			}
+		}
+	}
+	return owners
+}
+
+//-------------------------------------------------------------------
+// Deletes pre-empted subscriptions in the same way as subscriptions
+// of removed xApps are deleted. Pre-empted subscriptions are removed
+// from REST subscriptions of their owners and owners are notified.
+// Fails if any of the subscriptions could not be deleted.
+//-------------------------------------------------------------------
+func (c *Control) preemptSubscriptions(ctx context.Context, subsList []*Subscription, trans *TransactionXapp) error {
+	for _, owner := range c.registry.getPreemptedOwners(subsList) {
+		xapp.Logger.Info("Subscription %v of %s pre-empted by %s", owner.subId, owner.endpoint, trans.String())
+		c.UpdateCounter(cSubPreemptedByConflict)
+		xid := owner.restSubId
+		if xid == "" {
+			xid = "preempted-" + strconv.FormatUint(uint64(owner.subId), 10)
+		}
+		xAppEventInstanceID, outcome, err := c.SubscriptionDeleteHandler(ctx, &xid, &owner.endpoint, &owner.ranName, owner.subId, 0)
+		if err == nil && (outcome == nil || outcome.State != subsDeleteStateDeleted) {
+			err = fmt.Errorf("E2 node did not confirm deletion")
+		}
+		if err != nil {
+			return fmt.Errorf("Deleting pre-empted subscription %v of %s failed: %s", owner.subId, owner.endpoint, err.Error())
+		}
+		if owner.restSubId != "" {
+			c.notifyPreemptedOwner(owner, xAppEventInstanceID, trans)
+		}
+	}
+	return nil
+}
+
+func (c *Control) notifyPreemptedOwner(owner preemptedOwner, xAppEventInstanceID int64, trans *TransactionXapp) {
+	c.registry.mutex.Lock()
+	restSubscription, ok := c.registry.restSubscriptions[owner.restSubId]
+	if ok {
+		restSubscription.DeleteXappIdToE2Id(xAppEventInstanceID)
+		restSubscription.DeleteE2InstanceId(owner.subId)
+	}
+	c.registry.mutex.Unlock()
+	if ok == false {
+		return
+	}
+	c.WriteRESTSubscriptionToDb(owner.restSubId, restSubscription)
+	if restSubscription.clientEndpoint == nil {
+		return
+	}
+	errorInfo := ErrorInfo{}
+	errorInfo.SetInfo("Subscription pre-empted by conflicting subscription of "+trans.GetEndpoint().String(), models.SubscriptionInstanceErrorSourceSUBMGR, "")
+	errorInfo.SetCode(ErrorCodeSubmgrPreempted)
+	resp := &SubscriptionNotification{
+		SubscriptionID:        &owner.restSubId,
+		NotificationType:      notificationTypePreempted,
+		SubscriptionInstances: []*NotificationInstance{newNotificationInstance(int64(owner.subId), xAppEventInstanceID, &errorInfo)},
+	}
+	xapp.Logger.Debug("Sending pre-emption notification to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v",
+		restSubscription.clientEndpoint.Host, *restSubscription.clientEndpoint.HTTPPort, xAppEventInstanceID, owner.subId)
+	c.notificationOutbox.Send(owner.restSubId, resp, *restSubscription.clientEndpoint)
+}
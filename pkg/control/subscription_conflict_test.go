@@ -0,0 +1,280 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createConflictTestSubReqMsg(actionType uint64, trigger byte) *e2ap.E2APSubscriptionRequest {
+	subReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: 1}
+	subReqMsg.EventTriggerDefinition.Data.Data = []byte{trigger}
+	subReqMsg.EventTriggerDefinition.Data.Length = 1
+	subReqMsg.ActionSetups = append(subReqMsg.ActionSetups, e2ap.ActionToBeSetupItem{ActionId: 1, ActionType: actionType})
+	return subReqMsg
+}
+
+//-----------------------------------------------------------------------------
+// POLICY, INSERT and REPORT subscriptions of xapp1 with the same event trigger
+// in RAN_NAME_1
+//-----------------------------------------------------------------------------
+func addConflictTestSubs(registry *Registry) {
+	for i, actionType := range []uint64{e2ap.E2AP_ActionTypePolicy, e2ap.E2AP_ActionTypeInsert, e2ap.E2AP_ActionTypeReport} {
+		subs := &Subscription{
+			registry:  registry,
+			Meid:      &xapp.RMRMeid{RanName: "RAN_NAME_1"},
+			SubReqMsg: createConflictTestSubReqMsg(actionType, 1),
+			valid:     true,
+		}
+		subs.ReqId.InstanceId = uint32(i + 1)
+		subs.EpList.AddEndpoint(&xapp.RmrEndpoint{Addr: "xapp1", Port: 4560})
+		registry.addSubs(subs)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// TestFindActionConflict
+//
+//   1. Conflicts are not detected by default
+//   2. REJECT: POLICY SubReq conflicts with POLICY and INSERT subscriptions also of the same xApp
+//   3. REPORT SubReqs, other event triggers and other E2 nodes do not conflict
+//   4. FIRST_WINS: owner xApp can add subscriptions, other xApps conflict
+//   5. PRIORITY: subscriptions of lower priority xApps are pre-empted
+//
+//-----------------------------------------------------------------------------
+func TestFindActionConflict(t *testing.T) {
+	CaseBegin("TestFindActionConflict")
+
+	registry := createTestRegistry()
+	addConflictTestSubs(registry)
+	subReqMsg := createConflictTestSubReqMsg(e2ap.E2AP_ActionTypePolicy, 1)
+
+	// Conflicts are not detected by default
+	assert.Nil(t, registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp2"), subReqMsg, e2ap.E2AP_ActionTypePolicy))
+
+	// REJECT conflicts also with subscriptions of the same xApp
+	setTestConfig(t, func(config *testConfig) {
+		config.actionConflict = ActionConflictConfig{Strategy: ActionConflictStrategyReject}
+	})
+	conflict := registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, e2ap.E2AP_ActionTypePolicy)
+	assert.NotNil(t, conflict)
+	assert.Equal(t, []uint32{1, 2}, conflict.subIds())
+	assert.False(t, conflict.preempt)
+
+	// REPORT subscriptions, other triggers and other E2 nodes do not conflict
+	assert.Nil(t, registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp2"), subReqMsg, e2ap.E2AP_ActionTypeReport))
+	assert.Nil(t, registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp2"), createConflictTestSubReqMsg(e2ap.E2AP_ActionTypePolicy, 2), e2ap.E2AP_ActionTypePolicy))
+	assert.Nil(t, registry.findActionConflict(createValidateTestTrans("RAN_NAME_2", "xapp2"), subReqMsg, e2ap.E2AP_ActionTypePolicy))
+
+	// FIRST_WINS allows owner xApp to add subscriptions
+	setTestConfig(t, func(config *testConfig) {
+		config.actionConflict = ActionConflictConfig{Strategy: ActionConflictStrategyFirstWins}
+	})
+	assert.Nil(t, registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, e2ap.E2AP_ActionTypePolicy))
+	conflict = registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp2"), subReqMsg, e2ap.E2AP_ActionTypeInsert)
+	assert.NotNil(t, conflict)
+	assert.False(t, conflict.preempt)
+
+	// PRIORITY pre-empts subscriptions of lower priority xApps only
+	setTestConfig(t, func(config *testConfig) {
+		config.actionConflict = ActionConflictConfig{Strategy: ActionConflictStrategyPriority, XappPriorities: map[string]int{"xapp2": 10, "xapp3": -1}}
+	})
+	conflict = registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp2"), subReqMsg, e2ap.E2AP_ActionTypePolicy)
+	assert.NotNil(t, conflict)
+	assert.True(t, conflict.preempt)
+	conflict = registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp3"), subReqMsg, e2ap.E2AP_ActionTypePolicy)
+	assert.NotNil(t, conflict)
+	assert.False(t, conflict.preempt)
+	conflict = registry.findActionConflict(createValidateTestTrans("RAN_NAME_1", "xapp4"), subReqMsg, e2ap.E2AP_ActionTypePolicy)
+	assert.False(t, conflict.preempt)
+}
+
+//-----------------------------------------------------------------------------
+// TestAssignToSubscriptionActionConflict
+//
+//   1. Conflicting SubReq is rejected with conflicting instance ids
+//   2. Dry-run validation of the SubReq reports the same conflict
+//
+//-----------------------------------------------------------------------------
+func TestAssignToSubscriptionActionConflict(t *testing.T) {
+	CaseBegin("TestAssignToSubscriptionActionConflict")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.actionConflict = ActionConflictConfig{Strategy: ActionConflictStrategyFirstWins}
+	})
+	registry := createTestRegistry()
+	addConflictTestSubs(registry)
+
+	subs, errorInfo, err := registry.AssignToSubscription(context.Background(), createValidateTestTrans("RAN_NAME_1", "xapp2"), createConflictTestSubReqMsg(e2ap.E2AP_ActionTypePolicy, 1), false, mainCtrl.c, false, SubscriptionSharingDefault)
+	assert.Nil(t, subs)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrorCodeSubmgrActionConflict, errorInfo.ErrorCode)
+	assert.Equal(t, []uint32{1, 2}, errorInfo.ConflictingSubIds)
+	instance := newNotificationInstance(0, 1, &errorInfo)
+	assert.Equal(t, err.Error(), instance.ErrorCause)
+	assert.Equal(t, ErrorCodeSubmgrActionConflict, instance.ErrorCode)
+	assert.Equal(t, []uint32{1, 2}, instance.ConflictingSubIds)
+
+	// Dry-run validation reports the same conflict
+	assignment, err := registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp2"), createConflictTestSubReqMsg(e2ap.E2AP_ActionTypePolicy, 1), e2ap.E2AP_ActionTypePolicy, SubscriptionSharingDefault)
+	assert.NotNil(t, err)
+	assert.Equal(t, []uint32{1, 2}, assignment.conflict.subIds())
+}
+
+//-----------------------------------------------------------------------------
+// TestGetPreemptedOwners
+//
+// Owners of pre-empted subscriptions are resolved with their REST subscriptions
+//
+//-----------------------------------------------------------------------------
+func TestGetPreemptedOwners(t *testing.T) {
+	CaseBegin("TestGetPreemptedOwners")
+
+	registry := createTestRegistry()
+	addConflictTestSubs(registry)
+	restSubId, xAppServiceName, xAppRmrEndPoint, ranName := "restSubId1", "xapp1", "xapp1:4560", "RAN_NAME_1"
+	restSubscription := registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &ranName)
+	restSubscription.AddE2InstanceId(2)
+
+	subs1, _ := registry.GetE2NodeSubscription("RAN_NAME_1", 1)
+	subs2, _ := registry.GetE2NodeSubscription("RAN_NAME_1", 2)
+	owners := registry.getPreemptedOwners([]*Subscription{subs1, subs2})
+	assert.Equal(t, []preemptedOwner{
+		{subId: 1, ranName: "RAN_NAME_1", endpoint: "xapp1:4560"},
+		{subId: 2, ranName: "RAN_NAME_1", endpoint: "xapp1:4560", restSubId: "restSubId1"},
+	}, owners)
+}
+
+//-----------------------------------------------------------------------------
+// TestNotifyPreemptedOwner
+//
+//   stub                          stub
+// +-------+     +---------+    +-------+
+// | xapp1 |     | submgr  |    | xapp2 |
+// +-------+     +---------+    +-------+
+//     |              |              |
+//     |              |   RESTSubReq |
+//     |              |<-------------|
+//     |              |              |
+//     |  RESTNotif   |              |
+//     |  pre-empted  |              |
+//     |<-------------|              |
+//     |              |              |
+//
+// Only the pre-empted instance is removed from REST subscription of xapp1
+//
+//-----------------------------------------------------------------------------
+func TestNotifyPreemptedOwner(t *testing.T) {
+	CaseBegin("TestNotifyPreemptedOwner")
+
+	var notifications []*SubscriptionNotification
+	registry := createTestRegistry()
+	addConflictTestSubs(registry)
+	c := createTestControl(registry, &notifications)
+
+	restSubId, xAppServiceName, xAppRmrEndPoint, ranName := "restSubId1", "xapp1", "xapp1:4560", "RAN_NAME_1"
+	restSubscription := registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &ranName)
+	restSubscription.AddE2InstanceId(1)
+	restSubscription.AddXappIdToE2Id(5, 1)
+	restSubscription.AddE2InstanceId(2)
+	restSubscription.AddXappIdToE2Id(6, 2)
+	port := int64(4560)
+	restSubscription.clientEndpoint = &models.SubscriptionParamsClientEndpoint{Host: "xapp1", HTTPPort: &port}
+
+	owner := preemptedOwner{subId: 2, ranName: "RAN_NAME_1", endpoint: "xapp1:4560", restSubId: "restSubId1"}
+	c.notifyPreemptedOwner(owner, 6, createValidateTestTrans("RAN_NAME_1", "xapp2"))
+	c.notificationOutbox.waitFirstTries()
+
+	// Only the pre-empted instance is removed from REST subscription
+	assert.Equal(t, []uint32{1}, restSubscription.InstanceIds)
+	assert.Equal(t, map[int64]int64{5: 1}, restSubscription.xAppIdToE2Id)
+	stored, err := c.ReadRESTSubscriptionFromSdl("restSubId1")
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{1}, stored.InstanceIds)
+
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, notificationTypePreempted, notifications[0].NotificationType)
+	instance := notifications[0].SubscriptionInstances[0]
+	assert.Equal(t, int64(2), *instance.E2EventInstanceID)
+	assert.Equal(t, int64(6), *instance.XappEventInstanceID)
+	assert.Equal(t, ErrorCodeSubmgrPreempted, instance.ErrorCode)
+	assert.Equal(t, "Subscription pre-empted by conflicting subscription of xapp2:4560", instance.ErrorCause)
+}
+
+//-----------------------------------------------------------------------------
+// TestNotifyPreemptedOwnerWhileOwnerProcessing
+//
+//   stub                          stub
+// +-------+     +---------+    +-------+
+// | xapp1 |     | submgr  |    | xapp2 |
+// +-------+     +---------+    +-------+
+//     |              |              |
+//     | RESTSubReq   |              |
+//     |------------->|              |
+//     |              |   RESTSubReq |
+//     |              |<-------------|
+//     |              |              |
+//     |  RESTNotif   |              |
+//     |  pre-empted  |              |
+//     |<-------------|              |
+//     |              |              |
+//
+// Instances of xapp1 are stored while its pre-empted instance is removed
+//
+//-----------------------------------------------------------------------------
+func TestNotifyPreemptedOwnerWhileOwnerProcessing(t *testing.T) {
+	CaseBegin("TestNotifyPreemptedOwnerWhileOwnerProcessing")
+
+	var notifications []*SubscriptionNotification
+	registry := createTestRegistry()
+	addConflictTestSubs(registry)
+	c := createTestControl(registry, &notifications)
+
+	restSubId, xAppServiceName, xAppRmrEndPoint, ranName := "restSubId1", "xapp1", "xapp1:4560", "RAN_NAME_1"
+	restSubscription := registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &ranName)
+	registry.AddRESTSubscriptionInstance(restSubscription, 5, 1)
+	port := int64(4560)
+	restSubscription.clientEndpoint = &models.SubscriptionParamsClientEndpoint{Host: "xapp1", HTTPPort: &port}
+
+	// Processing of the owner stores its other instances meanwhile
+	done := make(chan struct{})
+	go func() {
+		for i := int64(0); i < 20; i++ {
+			registry.AddRESTSubscriptionInstance(restSubscription, 10+i, 100+i)
+		}
+		close(done)
+	}()
+	owner := preemptedOwner{subId: 1, ranName: "RAN_NAME_1", endpoint: "xapp1:4560", restSubId: "restSubId1"}
+	c.notifyPreemptedOwner(owner, 5, createValidateTestTrans("RAN_NAME_1", "xapp2"))
+	<-done
+	c.notificationOutbox.waitFirstTries()
+
+	instanceIds, xAppIdToE2Id := registry.GetRESTSubscriptionInstances(restSubscription)
+	assert.Equal(t, 20, len(instanceIds))
+	assert.Equal(t, 20, len(xAppIdToE2Id))
+	_, found := xAppIdToE2Id[5]
+	assert.False(t, found)
+	assert.Equal(t, 1, len(notifications))
+}
@@ -0,0 +1,241 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/gorilla/mux"
+)
+
+//-----------------------------------------------------------------------------
+// Deletion of REST subscriptions is completed in background after response
+// has been sent to xApp. xApp can request a notification of every deleted
+// E2 subscription by giving NotifyDeleteCompletion in REST Subscription
+// Request. Deletion state can be queried while deletion is ongoing and
+// after it until the delete completion notifications have been delivered.
+//-----------------------------------------------------------------------------
+
+const (
+	subsDeleteStatePending = "pending"
+	subsDeleteStateOngoing = "ongoing"
+	subsDeleteStateDeleted = "deleted"
+	subsDeleteStateFailed  = "failed"
+	subsDeleteStateTimeout = "timeout"
+)
+
+//-----------------------------------------------------------------------------
+// Outcome of E2 subscription deletion. Returned by handleSubscriptionDelete
+// to done function of the delete request
+//-----------------------------------------------------------------------------
+type SubsDeleteOutcome struct {
+	State     string
+	ErrorInfo ErrorInfo
+	E2Cause   e2ap.Cause
+}
+
+func subsDeleteOutcome(e2DeleteSent bool, event interface{}) *SubsDeleteOutcome {
+	outcome := &SubsDeleteOutcome{State: subsDeleteStateDeleted}
+	if e2DeleteSent == false {
+		// Endpoint was removed from merged subscription. Nothing sent to E2 node
+		return outcome
+	}
+	switch themsg := event.(type) {
+	case *e2ap.E2APSubscriptionDeleteResponse:
+	case *e2ap.E2APSubscriptionDeleteFailure:
+		outcome.State = subsDeleteStateFailed
+		outcome.E2Cause = themsg.Cause
+		outcome.ErrorInfo.SetInfo(fmt.Sprintf("RICSubscriptionDeleteFailure. E2NodeCause: (Cause:%v, Value %v)", themsg.Cause.Content, themsg.Cause.Value),
+			models.SubscriptionInstanceErrorSourceE2Node, "")
+		outcome.ErrorInfo.SetCode(ErrorCodeE2SubscriptionDeleteFailure)
+		outcome.ErrorInfo.SetE2Cause(themsg.Cause)
+	default:
+		outcome.State = subsDeleteStateTimeout
+		outcome.E2Cause = e2ap.Cause{Content: e2ap.E2AP_CauseContent_RICrequest, Value: e2ap.E2AP_CauseValue_RICrequest_unspecified}
+		outcome.ErrorInfo.SetInfo("No response from E2 node to RICSubscriptionDeleteRequest", models.SubscriptionInstanceErrorSourceE2Node,
+			models.SubscriptionInstanceTimeoutTypeE2Timeout)
+		outcome.ErrorInfo.SetCode(ErrorCodeE2SubscriptionDeleteTimeout)
+	}
+	return outcome
+}
+
+type E2SubscriptionDeletionInfo struct {
+	XappEventInstanceID int64
+	E2EventInstanceID   uint32
+	State               string
+	ErrorCode           ErrorCode   `json:",omitempty"`
+	ErrorCause          string      `json:",omitempty"`
+	ErrorSource         string      `json:",omitempty"`
+	TimeoutType         string      `json:",omitempty"`
+	E2Cause             *e2ap.Cause `json:",omitempty"`
+}
+
+type RESTSubscriptionDeletionInfo struct {
+	SubscriptionId string
+	Instances      []E2SubscriptionDeletionInfo
+}
+
+type restSubscriptionDeletion struct {
+	instances []E2SubscriptionDeletionInfo
+	completed bool // All E2 subscriptions have been processed
+}
+
+//-------------------------------------------------------------------
+// Marks all E2 subscriptions of REST subscription pending for deletion
+//-------------------------------------------------------------------
+func (r *Registry) StartRESTSubscriptionDeletion(restSubId string) []E2SubscriptionDeletionInfo {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	restSubscription, ok := r.restSubscriptions[restSubId]
+	if ok == false {
+		return nil
+	}
+	xAppIds := make(map[int64]int64)
+	for xAppEventInstanceID, e2EventInstanceID := range restSubscription.xAppIdToE2Id {
+		xAppIds[e2EventInstanceID] = xAppEventInstanceID
+	}
+	deletion := &restSubscriptionDeletion{instances: make([]E2SubscriptionDeletionInfo, 0, len(restSubscription.InstanceIds))}
+	for _, instanceId := range restSubscription.InstanceIds {
+		deletion.instances = append(deletion.instances, E2SubscriptionDeletionInfo{
+			XappEventInstanceID: xAppIds[int64(instanceId)],
+			E2EventInstanceID:   instanceId,
+			State:               subsDeleteStatePending,
+		})
+	}
+	r.restSubsDeletions[restSubId] = deletion
+	return append([]E2SubscriptionDeletionInfo{}, deletion.instances...)
+}
+
+func (r *Registry) SetRESTSubscriptionDeletionState(restSubId string, instanceId uint32, outcome *SubsDeleteOutcome) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deletion, ok := r.restSubsDeletions[restSubId]
+	if ok == false {
+		return
+	}
+	for i := range deletion.instances {
+		if deletion.instances[i].E2EventInstanceID == instanceId {
+			deletion.instances[i].State = outcome.State
+			deletion.instances[i].ErrorCode = outcome.ErrorInfo.ErrorCode
+			deletion.instances[i].ErrorCause = outcome.ErrorInfo.ErrorCause
+			deletion.instances[i].ErrorSource = outcome.ErrorInfo.ErrorSource
+			deletion.instances[i].TimeoutType = outcome.ErrorInfo.TimeoutType
+			deletion.instances[i].E2Cause = outcome.ErrorInfo.E2Cause
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Marks all E2 subscriptions of REST subscription processed. Deletion
+// state is kept until it is released
+//-------------------------------------------------------------------
+func (r *Registry) CompleteRESTSubscriptionDeletion(restSubId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if deletion, ok := r.restSubsDeletions[restSubId]; ok {
+		deletion.completed = true
+	}
+}
+
+//-------------------------------------------------------------------
+// Removes deletion state of REST subscription if deletion has been completed
+//-------------------------------------------------------------------
+func (r *Registry) ReleaseRESTSubscriptionDeletion(restSubId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if deletion, ok := r.restSubsDeletions[restSubId]; ok && deletion.completed {
+		delete(r.restSubsDeletions, restSubId)
+	}
+}
+
+func (r *Registry) GetRESTSubscriptionDeletionInfo(restSubId string) (*RESTSubscriptionDeletionInfo, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deletion, ok := r.restSubsDeletions[restSubId]
+	if ok == false {
+		if _, ok := r.restSubscriptions[restSubId]; ok == false {
+			return nil, fmt.Errorf("%w with restSubId=%v", errRESTSubscriptionNotFound, restSubId)
+		}
+		return nil, fmt.Errorf("Deletion of REST subscription not ongoing. restSubId=%v", restSubId)
+	}
+	return &RESTSubscriptionDeletionInfo{
+		SubscriptionId: restSubId,
+		Instances:      append([]E2SubscriptionDeletionInfo{}, deletion.instances...),
+	}, nil
+}
+
+//-------------------------------------------------------------------
+// Sends notification of completed E2 subscription deletion to xApp
+//-------------------------------------------------------------------
+func (c *Control) sendDeleteCompletedNotification(restSubId string, clientEndpoint *models.SubscriptionParamsClientEndpoint,
+	deletion *E2SubscriptionDeletionInfo, outcome *SubsDeleteOutcome) {
+
+	xAppEventInstanceID := deletion.XappEventInstanceID
+	e2EventInstanceID := int64(deletion.E2EventInstanceID)
+	instance := newNotificationInstance(e2EventInstanceID, xAppEventInstanceID, &outcome.ErrorInfo)
+	instance.DeleteState = outcome.State
+	resp := &SubscriptionNotification{
+		SubscriptionID:        &restSubId,
+		NotificationType:      notificationTypeDeleted,
+		SubscriptionInstances: []*NotificationInstance{instance},
+	}
+	xapp.Logger.Debug("Sending REST delete notification: State:%s, ErrorCode:%s, ErrorCause:%s, to Endpoint=%v:%v, XappEventInstanceID=%v, E2EventInstanceID=%v",
+		outcome.State, outcome.ErrorInfo.ErrorCode, outcome.ErrorInfo.ErrorCause, clientEndpoint.Host, *clientEndpoint.HTTPPort, xAppEventInstanceID, e2EventInstanceID)
+	c.UpdateCounter(cRestSubDelNotifToXapp)
+	c.notificationOutbox.Send(restSubId, resp, *clientEndpoint)
+}
+
+//-------------------------------------------------------------------
+// Deletion state of REST subscription is released when all its delete
+// completion notifications have been delivered
+//-------------------------------------------------------------------
+func (c *Control) releaseRESTSubscriptionDeletion(restSubId string) {
+	if c.notificationOutbox.HasUndeliveredDeleteNotifications(restSubId) == false {
+		c.registry.ReleaseRESTSubscriptionDeletion(restSubId)
+	}
+}
+
+//-------------------------------------------------------------------
+// Returns deletion state of E2 subscriptions of REST subscription
+//-------------------------------------------------------------------
+func (c *Control) GetRESTSubscriptionDeletion(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("GetRESTSubscriptionDeletion() called")
+
+	restSubId := mux.Vars(r)["subscriptionId"]
+	deletionInfo, err := c.registry.GetRESTSubscriptionDeletionInfo(restSubId)
+	if err != nil {
+		xapp.Logger.Error("GetRESTSubscriptionDeletion() %s", err.Error())
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deletionInfo); err != nil {
+		xapp.Logger.Error("GetRESTSubscriptionDeletion() w.Write failure: %s", err.Error())
+	}
+}
@@ -0,0 +1,86 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"errors"
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubsDeleteOutcome(t *testing.T) {
+
+	outcome := subsDeleteOutcome(false, nil)
+	assert.Equal(t, subsDeleteStateDeleted, outcome.State)
+	assert.Equal(t, ErrorInfo{}, outcome.ErrorInfo)
+
+	outcome = subsDeleteOutcome(true, &e2ap.E2APSubscriptionDeleteResponse{})
+	assert.Equal(t, subsDeleteStateDeleted, outcome.State)
+
+	subDelFailMsg := &e2ap.E2APSubscriptionDeleteFailure{}
+	subDelFailMsg.Cause.Content = 1
+	subDelFailMsg.Cause.Value = 3
+	outcome = subsDeleteOutcome(true, subDelFailMsg)
+	assert.Equal(t, subsDeleteStateFailed, outcome.State)
+	assert.Equal(t, "RICSubscriptionDeleteFailure. E2NodeCause: (Cause:1, Value 3)", outcome.ErrorInfo.ErrorCause)
+	assert.Equal(t, models.SubscriptionInstanceErrorSourceE2Node, outcome.ErrorInfo.ErrorSource)
+	assert.Equal(t, ErrorCodeE2SubscriptionDeleteFailure, outcome.ErrorInfo.ErrorCode)
+	assert.Equal(t, e2ap.Cause{Content: 1, Value: 3}, *outcome.ErrorInfo.E2Cause)
+
+	outcome = subsDeleteOutcome(true, nil)
+	assert.Equal(t, subsDeleteStateTimeout, outcome.State)
+	assert.Equal(t, models.SubscriptionInstanceTimeoutTypeE2Timeout, outcome.ErrorInfo.TimeoutType)
+	assert.Equal(t, ErrorCodeE2SubscriptionDeleteTimeout, outcome.ErrorInfo.ErrorCode)
+	assert.Nil(t, outcome.ErrorInfo.E2Cause)
+}
+
+func TestRESTSubscriptionDeletionState(t *testing.T) {
+
+	registry := createFilterTestRegistry()
+	registry.restSubscriptions["restSubId1"].AddE2InstanceId(11)
+	registry.restSubscriptions["restSubId1"].AddXappIdToE2Id(7, 11)
+
+	_, err := registry.GetRESTSubscriptionDeletionInfo("restSubId9")
+	assert.True(t, errors.Is(err, errRESTSubscriptionNotFound))
+	_, err = registry.GetRESTSubscriptionDeletionInfo("restSubId1")
+	assert.NotNil(t, err)
+	assert.Nil(t, registry.StartRESTSubscriptionDeletion("restSubId9"))
+
+	deletions := registry.StartRESTSubscriptionDeletion("restSubId1")
+	assert.Equal(t, 2, len(deletions))
+	assert.Equal(t, E2SubscriptionDeletionInfo{XappEventInstanceID: 7, E2EventInstanceID: 11, State: subsDeleteStatePending}, deletions[1])
+
+	registry.SetRESTSubscriptionDeletionState("restSubId1", 1, &SubsDeleteOutcome{State: subsDeleteStateOngoing})
+	deletionInfo, err := registry.GetRESTSubscriptionDeletionInfo("restSubId1")
+	assert.Nil(t, err)
+	assert.Equal(t, "restSubId1", deletionInfo.SubscriptionId)
+	assert.Equal(t, subsDeleteStateOngoing, deletionInfo.Instances[0].State)
+	assert.Equal(t, subsDeleteStatePending, deletionInfo.Instances[1].State)
+
+	registry.SetRESTSubscriptionDeletionState("restSubId1", 11, subsDeleteOutcome(true, nil))
+	deletionInfo, err = registry.GetRESTSubscriptionDeletionInfo("restSubId1")
+	assert.Nil(t, err)
+	assert.Equal(t, subsDeleteStateTimeout, deletionInfo.Instances[1].State)
+	assert.Equal(t, models.SubscriptionInstanceTimeoutTypeE2Timeout, deletionInfo.Instances[1].TimeoutType)
+	// Returned state is a copy
+	assert.Equal(t, subsDeleteStatePending, deletions[1].State)
+}
@@ -0,0 +1,222 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	subsStateOngoing  = "ongoing"
+	subsStateActive   = "active"
+	subsStateDeleting = "deleting"
+)
+
+// Format of RESTSubscription.Created
+const restSubsCreatedFormat = "2006-01-02 15:04:05.000"
+
+// Http header carrying cursor of the next page of a listing
+const nextCursorHeader = "X-Next-Cursor"
+
+//-----------------------------------------------------------------------------
+// Filter for REST and E2 subscription listings. Zero values do not filter.
+//-----------------------------------------------------------------------------
+type SubscriptionFilter struct {
+	Meid            string
+	XappServiceName string
+	RanFunctionId   *int64
+	State           string
+	CreatedAfter    time.Time
+	CreatedBefore   time.Time
+	Limit           int
+	Cursor          string
+	Fields          []string
+}
+
+//-----------------------------------------------------------------------------
+// ParseSubscriptionFilter reads filter from query parameters meid,
+// xappServiceName, ranFunctionId, state, createdAfter, createdBefore (RFC3339),
+// limit, cursor and fields (comma separated list)
+//-----------------------------------------------------------------------------
+func ParseSubscriptionFilter(query url.Values) (*SubscriptionFilter, error) {
+
+	f := &SubscriptionFilter{
+		Meid:            query.Get("meid"),
+		XappServiceName: query.Get("xappServiceName"),
+		State:           query.Get("state"),
+		Cursor:          query.Get("cursor"),
+	}
+
+	if f.State != "" && f.State != subsStateOngoing && f.State != subsStateActive && f.State != subsStateDeleting {
+		return nil, fmt.Errorf("Invalid state %s. Allowed values are %s, %s and %s", f.State, subsStateOngoing, subsStateActive, subsStateDeleting)
+	}
+	if value := query.Get("ranFunctionId"); value != "" {
+		ranFunctionId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ranFunctionId %s", value)
+		}
+		f.RanFunctionId = &ranFunctionId
+	}
+	if value := query.Get("createdAfter"); value != "" {
+		createdAfter, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid createdAfter %s: %s", value, err.Error())
+		}
+		f.CreatedAfter = createdAfter
+	}
+	if value := query.Get("createdBefore"); value != "" {
+		createdBefore, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid createdBefore %s: %s", value, err.Error())
+		}
+		f.CreatedBefore = createdBefore
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("Invalid limit %s", value)
+		}
+		f.Limit = limit
+	}
+	if value := query.Get("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				f.Fields = append(f.Fields, field)
+			}
+		}
+	}
+	return f, nil
+}
+
+//-----------------------------------------------------------------------------
+// ParseRestQueryFilter reads filter of E2 subscription query of port 8088
+// from query string. Response of xapp-frame query cannot be paginated or
+// reduced, so limit, cursor and fields are not allowed.
+//-----------------------------------------------------------------------------
+func ParseRestQueryFilter(value string) (*SubscriptionFilter, error) {
+
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid query %s: %s", value, err.Error())
+	}
+	for _, param := range []string{"limit", "cursor", "fields"} {
+		if query.Has(param) {
+			return nil, fmt.Errorf("Parameter %s is not supported in subscription query of port 8088", param)
+		}
+	}
+	return ParseSubscriptionFilter(query)
+}
+
+func (f *SubscriptionFilter) matchCreated(created time.Time) bool {
+	if !f.CreatedAfter.IsZero() && !created.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !created.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func (f *SubscriptionFilter) matchRanFunctionId(functionId int64) bool {
+	return f.RanFunctionId == nil || *f.RanFunctionId == functionId
+}
+
+//-----------------------------------------------------------------------------
+// Returns true when the page is full and further matches only tell that
+// there is a next page
+//-----------------------------------------------------------------------------
+func (f *SubscriptionFilter) pageFull(count int) bool {
+	return f.Limit != 0 && count >= f.Limit
+}
+
+func restSubscriptionState(restSubs *RESTSubscription) string {
+	if restSubs.SubDelReqOngoing {
+		return subsStateDeleting
+	} else if restSubs.SubReqOngoing {
+		return subsStateOngoing
+	}
+	return subsStateActive
+}
+
+func restSubscriptionCreated(restSubs *RESTSubscription) time.Time {
+	created, err := time.ParseInLocation(restSubsCreatedFormat, restSubs.Created, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return created
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with subs.mutex locked
+//-----------------------------------------------------------------------------
+func e2SubscriptionState(subs *Subscription) string {
+	if subs.OngoingDelCount > 0 || !subs.valid {
+		return subsStateDeleting
+	} else if subs.OngoingReqCount > 0 || !subs.SubRespRcvd {
+		return subsStateOngoing
+	}
+	return subsStateActive
+}
+
+//-----------------------------------------------------------------------------
+// SelectFields returns json encoding of v where each listed item contains
+// only the given fields. v is either a map or a slice of objects.
+//-----------------------------------------------------------------------------
+func SelectFields(v interface{}, fields []string) ([]byte, error) {
+
+	data, err := json.Marshal(v)
+	if err != nil || len(fields) == 0 {
+		return data, err
+	}
+
+	selectFrom := func(item map[string]interface{}) map[string]interface{} {
+		selected := make(map[string]interface{})
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				selected[field] = value
+			}
+		}
+		return selected
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		var items []map[string]interface{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		for i := range items {
+			items[i] = selectFrom(items[i])
+		}
+		return json.Marshal(items)
+	}
+
+	var items map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	for key := range items {
+		items[key] = selectFrom(items[key])
+	}
+	return json.Marshal(items)
+}
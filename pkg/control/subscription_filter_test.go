@@ -0,0 +1,181 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createFilterTestRegistry() *Registry {
+
+	registry := new(Registry)
+	registry.Initialize()
+
+	for i, ranName := range []string{"RAN_NAME_1", "RAN_NAME_1", "RAN_NAME_2"} {
+		restSubId := "restSubId" + string(rune('1'+i))
+		xappServiceName := "xapp1"
+		if i == 2 {
+			xappServiceName = "xapp2"
+		}
+		endpoint := xappServiceName + ":4560"
+		meid := ranName
+		restSubs := registry.CreateRESTSubscription(&restSubId, &xappServiceName, &endpoint, &meid)
+
+		subId := uint32(i + 1)
+		subs := &Subscription{
+			registry:    registry,
+			Created:     time.Now(),
+			Meid:        &xapp.RMRMeid{RanName: ranName},
+			SubReqMsg:   &e2ap.E2APSubscriptionRequest{FunctionId: e2ap.FunctionId(i + 1)},
+			valid:       true,
+			SubRespRcvd: true,
+		}
+		subs.ReqId.InstanceId = subId
+		subs.EpList.AddEndpoint(&xapp.RmrEndpoint{Addr: xappServiceName, Port: 4560})
+		registry.addSubs(subs)
+		registry.addToMergeIndex(subs)
+		restSubs.AddE2InstanceId(subId)
+		if i != 1 {
+			restSubs.SetProcessed(nil)
+		}
+	}
+	return registry
+}
+
+func TestParseSubscriptionFilter(t *testing.T) {
+
+	query := url.Values{}
+	query.Set("meid", "RAN_NAME_1")
+	query.Set("ranFunctionId", "1")
+	query.Set("state", "active")
+	query.Set("createdAfter", "2026-01-01T00:00:00Z")
+	query.Set("limit", "10")
+	query.Set("fields", "Meid, Created")
+	filter, err := ParseSubscriptionFilter(query)
+	assert.Nil(t, err)
+	assert.Equal(t, "RAN_NAME_1", filter.Meid)
+	assert.Equal(t, int64(1), *filter.RanFunctionId)
+	assert.Equal(t, 10, filter.Limit)
+	assert.Equal(t, []string{"Meid", "Created"}, filter.Fields)
+
+	for _, invalid := range []string{"state=unknown", "ranFunctionId=x", "createdBefore=yesterday", "limit=0"} {
+		query, _ := url.ParseQuery(invalid)
+		_, err = ParseSubscriptionFilter(query)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestFilterRestSubscriptions(t *testing.T) {
+
+	registry := createFilterTestRegistry()
+
+	restSubscriptions, nextCursor := registry.GetRestSubscriptions(&SubscriptionFilter{Meid: "RAN_NAME_1"})
+	assert.Equal(t, 2, len(restSubscriptions))
+	assert.Equal(t, "", nextCursor)
+
+	restSubscriptions, _ = registry.GetRestSubscriptions(&SubscriptionFilter{XappServiceName: "xapp2"})
+	assert.Equal(t, 1, len(restSubscriptions))
+
+	restSubscriptions, _ = registry.GetRestSubscriptions(&SubscriptionFilter{State: subsStateOngoing})
+	assert.Equal(t, 1, len(restSubscriptions))
+	assert.NotNil(t, restSubscriptions["restSubId2"])
+
+	ranFunctionId := int64(3)
+	restSubscriptions, _ = registry.GetRestSubscriptions(&SubscriptionFilter{RanFunctionId: &ranFunctionId})
+	assert.Equal(t, 1, len(restSubscriptions))
+
+	restSubscriptions, _ = registry.GetRestSubscriptions(&SubscriptionFilter{CreatedBefore: time.Now().Add(-time.Hour)})
+	assert.Equal(t, 0, len(restSubscriptions))
+
+	// Pagination
+	restSubscriptions, nextCursor = registry.GetRestSubscriptions(&SubscriptionFilter{Limit: 2})
+	assert.Equal(t, 2, len(restSubscriptions))
+	assert.Equal(t, "restSubId2", nextCursor)
+	restSubscriptions, nextCursor = registry.GetRestSubscriptions(&SubscriptionFilter{Limit: 2, Cursor: nextCursor})
+	assert.Equal(t, 1, len(restSubscriptions))
+	assert.Equal(t, "", nextCursor)
+
+	// Field selection
+	data, _, err := registry.GetRestSubscriptionsJson(&SubscriptionFilter{Meid: "RAN_NAME_2", Fields: []string{"Meid"}})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"restSubId3":{"Meid":"RAN_NAME_2"}}`, string(data))
+}
+
+func TestFilterE2Subscriptions(t *testing.T) {
+
+	registry := createFilterTestRegistry()
+
+	subscriptions, _, err := registry.QueryE2Subscriptions(&SubscriptionFilter{XappServiceName: "xapp1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(subscriptions))
+
+	ranFunctionId := int64(2)
+	subscriptions, _, err = registry.QueryE2Subscriptions(&SubscriptionFilter{RanFunctionId: &ranFunctionId})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(subscriptions))
+	assert.Equal(t, int64(2), subscriptions[0].SubscriptionID)
+
+	subscriptions, nextCursor, err := registry.QueryE2Subscriptions(&SubscriptionFilter{Limit: 1, Cursor: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(subscriptions))
+	assert.Equal(t, int64(2), subscriptions[0].SubscriptionID)
+	assert.Equal(t, "2", nextCursor)
+
+	_, _, err = registry.QueryE2Subscriptions(&SubscriptionFilter{Cursor: "restSubId1"})
+	assert.NotNil(t, err)
+
+	data, err := SelectFields(subscriptions, []string{"SubscriptionId"})
+	assert.Nil(t, err)
+	var items []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &items))
+	assert.Equal(t, 1, len(items[0]))
+}
+
+func TestRestQueryFilter(t *testing.T) {
+
+	filter, err := ParseRestQueryFilter("meid=RAN_NAME_1&ranFunctionId=2")
+	assert.Nil(t, err)
+	assert.Equal(t, "RAN_NAME_1", filter.Meid)
+
+	for _, value := range []string{"limit=10", "cursor=1", "fields=Meid", "state=unknown", "meid=%zz"} {
+		_, err = ParseRestQueryFilter(value)
+		assert.NotNil(t, err, value)
+	}
+
+	c := &Control{registry: createFilterTestRegistry()}
+	defer restQueryFilter.Store(&SubscriptionFilter{})
+
+	restQueryFilter.Store(&SubscriptionFilter{})
+	subscriptions, err := c.RESTQueryHandler()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(subscriptions))
+
+	restQueryFilter.Store(filter)
+	subscriptions, err = c.RESTQueryHandler()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(subscriptions))
+	assert.Equal(t, int64(2), subscriptions[0].SubscriptionID)
+}
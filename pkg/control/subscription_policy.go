@@ -0,0 +1,148 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// Policy subscription is updated by sending a new E2 Subscription Request
+// with the same instance id. SubReqMsg holds the latest request and the last
+// request acknowledged by E2 node is kept alongside it. If E2 node rejects
+// the update or does not respond to it, the acknowledged request is restored
+// so that the stored request matches the policy E2 node enforces.
+//-----------------------------------------------------------------------------
+const maxPolicyHistoryLength = 20
+
+const (
+	PolicyOutcomeApplied   = "APPLIED"
+	PolicyOutcomeFailed    = "FAILED"
+	PolicyOutcomeTimeout   = "TIMEOUT"
+	PolicyOutcomeRestart   = "NO_RESPONSE_BEFORE_RESTART"
+	PolicyOutcomeCancelled = "CANCELLED_BEFORE_SENT"
+)
+
+type PolicyHistoryAction struct {
+	ActionId         uint64
+	ActionDefinition []byte
+}
+
+type PolicyHistoryEntry struct {
+	Version uint32
+	Time    time.Time
+	Xapp    string
+	Outcome string
+	Actions []PolicyHistoryAction
+}
+
+type PolicyState struct {
+	Version        uint32                        // Version of SubReqMsg. Incremented by every update
+	AckedVersion   uint32                        // Version acknowledged by E2 node
+	AckedSubReqMsg *e2ap.E2APSubscriptionRequest // Last request acknowledged by E2 node
+	History        []PolicyHistoryEntry
+}
+
+func isPolicySubsReq(subReqMsg *e2ap.E2APSubscriptionRequest) bool {
+	return subReqMsg != nil && len(subReqMsg.ActionSetups) > 0 && subReqMsg.ActionSetups[0].ActionType == e2ap.E2AP_ActionTypePolicy
+}
+
+func newPolicyHistoryEntry(version uint32, subReqMsg *e2ap.E2APSubscriptionRequest, xappEndpoint string, outcome string, now time.Time) PolicyHistoryEntry {
+	entry := PolicyHistoryEntry{Version: version, Time: now, Xapp: xappEndpoint, Outcome: outcome}
+	for _, action := range subReqMsg.ActionSetups {
+		historyAction := PolicyHistoryAction{ActionId: action.ActionId}
+		if action.RicActionDefinitionPresent {
+			// Request may be reused after entry is stored
+			historyAction.ActionDefinition = append([]byte(nil), action.ActionDefinitionChoice.Data.Data...)
+		}
+		entry.Actions = append(entry.Actions, historyAction)
+	}
+	return entry
+}
+
+func (p *PolicyState) addHistory(entry PolicyHistoryEntry) {
+	p.History = append(p.History, entry)
+	if len(p.History) > maxPolicyHistoryLength {
+		p.History = p.History[len(p.History)-maxPolicyHistoryLength:]
+	}
+}
+
+//-------------------------------------------------------------------
+// Called when E2 node has acknowledged policy request subReqMsg
+//-------------------------------------------------------------------
+func (r *Registry) policyAcknowledged(subs *Subscription, subReqMsg *e2ap.E2APSubscriptionRequest, version uint32, xappEndpoint string, now time.Time) {
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+
+	subs.Policy.AckedSubReqMsg = subReqMsg
+	subs.Policy.AckedVersion = version
+	subs.Policy.addHistory(newPolicyHistoryEntry(version, subReqMsg, xappEndpoint, PolicyOutcomeApplied, now))
+	xapp.Logger.Debug("Registry: Policy version %v applied. %s", version, subs.String())
+}
+
+//-------------------------------------------------------------------
+// Called when E2 node has not acknowledged policy update subReqMsg.
+// Acknowledged request is restored unless a newer update has already
+// replaced the failed one.
+//-------------------------------------------------------------------
+func (r *Registry) rollbackPolicy(subs *Subscription, subReqMsg *e2ap.E2APSubscriptionRequest, version uint32, xappEndpoint string, outcome string, now time.Time) {
+	shard := r.lockShard(ranNameOf(subs.Meid))
+	defer shard.opMutex.Unlock()
+	subs.mutex.Lock()
+	defer subs.mutex.Unlock()
+
+	subs.Policy.addHistory(newPolicyHistoryEntry(version, subReqMsg, xappEndpoint, outcome, now))
+	if subs.Policy.AckedSubReqMsg == nil || subs.SubReqMsg != subReqMsg {
+		return
+	}
+	subs.SubReqMsg = subs.Policy.AckedSubReqMsg
+	subs.Policy.Version = subs.Policy.AckedVersion
+	r.addToMergeIndex(subs)
+	xapp.Logger.Debug("Registry: Policy version %v %s, version %v restored. %s", version, outcome, subs.Policy.AckedVersion, subs.String())
+}
+
+//-------------------------------------------------------------------
+// Policy history of E2 subscription
+//-------------------------------------------------------------------
+func (r *Registry) GetPolicyHistoryJson(ranName string, subId uint32) ([]byte, error) {
+	subs, err := r.GetE2NodeSubscription(ranName, subId)
+	if err != nil {
+		return nil, err
+	}
+	if subs.Meid == nil || subs.Meid.RanName != ranName {
+		return nil, fmt.Errorf("No subscription found with subId %v for ranName %s", subId, ranName)
+	}
+	subs.mutex.Lock()
+	version := subs.Policy.Version
+	history := append([]PolicyHistoryEntry(nil), subs.Policy.History...)
+	subs.mutex.Unlock()
+	if version == 0 {
+		return nil, fmt.Errorf("E2 subscription %v of %s is not a policy subscription", subId, ranName)
+	}
+	historyJson, err := json.Marshal(history)
+	if err != nil {
+		xapp.Logger.Error("GetPolicyHistoryJson() json.Marshal error: %v", err)
+	}
+	return historyJson, nil
+}
@@ -0,0 +1,118 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"github.com/stretchr/testify/assert"
+)
+
+func createPolicyTestSubReqMsg(definition byte) *e2ap.E2APSubscriptionRequest {
+	subReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: 1}
+	action := e2ap.ActionToBeSetupItem{ActionId: 1, ActionType: e2ap.E2AP_ActionTypePolicy, RicActionDefinitionPresent: true}
+	action.ActionDefinitionChoice.Data.Data = []byte{definition}
+	action.ActionDefinitionChoice.Data.Length = 1
+	subReqMsg.ActionSetups = append(subReqMsg.ActionSetups, action)
+	return subReqMsg
+}
+
+func createPolicyTestSubs(t *testing.T, registry *Registry) *Subscription {
+	subReqMsg := createPolicyTestSubReqMsg(1)
+	subs, err := registry.allocateSubs(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, false, true)
+	assert.Nil(t, err)
+	registry.addSubs(subs)
+	registry.addToMergeIndex(subs)
+	assert.Equal(t, uint32(1), subs.Policy.Version)
+	registry.policyAcknowledged(subs, subReqMsg, 1, "xapp1:4560", time.Now())
+	return subs
+}
+
+func TestPolicyUpdateAcknowledged(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	subs := createPolicyTestSubs(t, registry)
+
+	update := createPolicyTestSubReqMsg(2)
+	subs.SubReqMsg = update
+	subs.Policy.Version++
+	registry.policyAcknowledged(subs, update, 2, "xapp2:4560", time.Now())
+	assert.Equal(t, update, subs.Policy.AckedSubReqMsg)
+	assert.Equal(t, uint32(2), subs.Policy.AckedVersion)
+	assert.Equal(t, 2, len(subs.Policy.History))
+	assert.Equal(t, PolicyOutcomeApplied, subs.Policy.History[1].Outcome)
+	assert.Equal(t, "xapp2:4560", subs.Policy.History[1].Xapp)
+	assert.Equal(t, []PolicyHistoryAction{{ActionId: 1, ActionDefinition: []byte{2}}}, subs.Policy.History[1].Actions)
+
+	// History does not change with request
+	update.ActionSetups[0].ActionDefinitionChoice.Data.Data[0] = 3
+	assert.Equal(t, []PolicyHistoryAction{{ActionId: 1, ActionDefinition: []byte{2}}}, subs.Policy.History[1].Actions)
+}
+
+func TestPolicyUpdateRollback(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	subs := createPolicyTestSubs(t, registry)
+	acked := subs.SubReqMsg
+
+	update := createPolicyTestSubReqMsg(2)
+	subs.SubReqMsg = update
+	subs.Policy.Version++
+	registry.addToMergeIndex(subs)
+	registry.rollbackPolicy(subs, update, 2, "xapp2:4560", PolicyOutcomeFailed, time.Now())
+	assert.Equal(t, acked, subs.SubReqMsg)
+	assert.Equal(t, uint32(1), subs.Policy.Version)
+	assert.Equal(t, newSubsMergeKey("RAN_NAME_1", acked), registry.getShard("RAN_NAME_1").mergeKeys[subs])
+	assert.Equal(t, PolicyOutcomeFailed, subs.Policy.History[1].Outcome)
+	assert.Equal(t, uint32(2), subs.Policy.History[1].Version)
+
+	// Newer update is not overwritten when older one times out
+	update = createPolicyTestSubReqMsg(3)
+	newer := createPolicyTestSubReqMsg(4)
+	subs.SubReqMsg = newer
+	registry.rollbackPolicy(subs, update, 3, "xapp2:4560", PolicyOutcomeTimeout, time.Now())
+	assert.Equal(t, newer, subs.SubReqMsg)
+	assert.Equal(t, PolicyOutcomeTimeout, subs.Policy.History[2].Outcome)
+}
+
+func TestPolicyHistory(t *testing.T) {
+	registry := new(Registry)
+	registry.Initialize()
+	subs := createPolicyTestSubs(t, registry)
+	for i := 0; i < maxPolicyHistoryLength; i++ {
+		registry.rollbackPolicy(subs, createPolicyTestSubReqMsg(2), 2, "xapp2:4560", PolicyOutcomeTimeout, time.Now())
+	}
+	assert.Equal(t, maxPolicyHistoryLength, len(subs.Policy.History))
+	assert.Equal(t, PolicyOutcomeTimeout, subs.Policy.History[0].Outcome)
+
+	historyJson, err := registry.GetPolicyHistoryJson("RAN_NAME_1", subs.ReqId.InstanceId)
+	assert.Nil(t, err)
+	var history []PolicyHistoryEntry
+	assert.Nil(t, json.Unmarshal(historyJson, &history))
+	assert.Equal(t, maxPolicyHistoryLength, len(history))
+
+	_, err = registry.GetPolicyHistoryJson("RAN_NAME_2", subs.ReqId.InstanceId)
+	assert.NotNil(t, err)
+	subs.Policy = PolicyState{}
+	_, err = registry.GetPolicyHistoryJson("RAN_NAME_1", subs.ReqId.InstanceId)
+	assert.NotNil(t, err)
+}
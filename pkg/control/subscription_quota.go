@@ -0,0 +1,350 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+//-----------------------------------------------------------------------------
+// Quotas limit number of E2 subscriptions per xApp, per E2 node and per RAN
+// function of an E2 node. Quota 0 means unlimited. xApps are identified by
+// their RMR service name. Names are compared case insensitively as viper
+// converts configured map keys to lower case.
+//-----------------------------------------------------------------------------
+type SubscriptionQuotaConfig struct {
+	XappQuota         int
+	XappQuotas        map[string]int
+	E2NodeQuota       int
+	E2NodeQuotas      map[string]int
+	RanFunctionQuota  int
+	RanFunctionQuotas map[int64]int
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var subscriptionQuotas atomic.Pointer[SubscriptionQuotaConfig]
+
+func init() {
+	setSubscriptionQuotas(SubscriptionQuotaConfig{})
+}
+
+func getSubscriptionQuotas() *SubscriptionQuotaConfig {
+	return subscriptionQuotas.Load()
+}
+
+func setSubscriptionQuotas(quotas SubscriptionQuotaConfig) {
+	subscriptionQuotas.Store(&quotas)
+}
+
+func (q *SubscriptionQuotaConfig) xappQuota(xappRmrServiceName string) int {
+	if quota, ok := q.XappQuotas[strings.ToLower(xappRmrServiceName)]; ok {
+		return quota
+	}
+	return q.XappQuota
+}
+
+func (q *SubscriptionQuotaConfig) e2NodeQuota(ranName string) int {
+	if quota, ok := q.E2NodeQuotas[strings.ToLower(ranName)]; ok {
+		return quota
+	}
+	return q.E2NodeQuota
+}
+
+func (q *SubscriptionQuotaConfig) ranFunctionQuota(functionId int64) int {
+	if quota, ok := q.RanFunctionQuotas[functionId]; ok {
+		return quota
+	}
+	return q.RanFunctionQuota
+}
+
+//-----------------------------------------------------------------------------
+// Reads quotas from controls.xappSubscriptionQuota, e2NodeSubscriptionQuota and
+// ranFunctionSubscriptionQuota and the per name overrides in maps
+// controls.xappSubscriptionQuotas, e2NodeSubscriptionQuotas and
+// ranFunctionSubscriptionQuotas
+//-----------------------------------------------------------------------------
+func ReadSubscriptionQuotaConfig() SubscriptionQuotaConfig {
+
+	q := SubscriptionQuotaConfig{
+		XappQuota:         viper.GetInt("controls.xappSubscriptionQuota"),
+		XappQuotas:        make(map[string]int),
+		E2NodeQuota:       viper.GetInt("controls.e2NodeSubscriptionQuota"),
+		E2NodeQuotas:      make(map[string]int),
+		RanFunctionQuota:  viper.GetInt("controls.ranFunctionSubscriptionQuota"),
+		RanFunctionQuotas: make(map[int64]int),
+	}
+	for name, quota := range readQuotaMap("controls.xappSubscriptionQuotas") {
+		q.XappQuotas[XappRmrServiceName(name)] = quota
+	}
+	for name, quota := range readQuotaMap("controls.e2NodeSubscriptionQuotas") {
+		q.E2NodeQuotas[name] = quota
+	}
+	for name, quota := range readQuotaMap("controls.ranFunctionSubscriptionQuotas") {
+		functionId, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			xapp.Logger.Error("Invalid RAN function id %s in ranFunctionSubscriptionQuotas", name)
+			continue
+		}
+		q.RanFunctionQuotas[functionId] = quota
+	}
+	return q
+}
+
+func readQuotaMap(key string) map[string]int {
+	quotas := make(map[string]int)
+	for name, value := range viper.GetStringMapString(key) {
+		quota, err := strconv.Atoi(value)
+		if err != nil || quota < 0 {
+			xapp.Logger.Error("Invalid quota %s for %s in %s", value, name, key)
+			continue
+		}
+		quotas[strings.ToLower(name)] = quota
+	}
+	return quotas
+}
+
+type QuotaUsage struct {
+	Used  int
+	Quota int
+}
+
+type SubscriptionQuotaUsage struct {
+	Xapps        map[string]QuotaUsage
+	E2Nodes      map[string]QuotaUsage
+	RanFunctions map[string]QuotaUsage // Key is <ranName>/<ranFunctionId>
+}
+
+func ranFunctionQuotaKey(ranName string, functionId int64) string {
+	return ranName + "/" + strconv.FormatInt(functionId, 10)
+}
+
+func quotaExceeded(used int, requested int, quota int) bool {
+	return quota != 0 && used+requested > quota
+}
+
+func maxQuotaUsagePercent(usage map[string]QuotaUsage) int {
+	max := 0
+	for _, u := range usage {
+		if u.Quota != 0 && u.Used*100/u.Quota > max {
+			max = u.Used * 100 / u.Quota
+		}
+	}
+	return max
+}
+
+//-----------------------------------------------------------------------------
+// Error returned when request would exceed a subscription quota
+//-----------------------------------------------------------------------------
+type QuotaExceededError struct {
+	cause string
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.cause
+}
+
+//-----------------------------------------------------------------------------
+// Number of subscriptions counted against quotas. Subscription is counted
+// from allocation until it is deleted and xApp from joining a subscription
+// until it leaves it, so that quota check and counting are done atomically
+// under registry mutex. Subscription remembers what is counted for it, so
+// counters do not depend on later changes of its endpoint list.
+//-----------------------------------------------------------------------------
+type quotaCounters struct {
+	xapps        map[string]int
+	e2Nodes      map[string]int
+	ranFunctions map[string]int // Key is <ranName>/<ranFunctionId>
+}
+
+func newQuotaCounters() quotaCounters {
+	return quotaCounters{
+		xapps:        make(map[string]int),
+		e2Nodes:      make(map[string]int),
+		ranFunctions: make(map[string]int),
+	}
+}
+
+func addQuotaCount(counters map[string]int, key string, delta int) {
+	if counters[key]+delta <= 0 {
+		delete(counters, key)
+	} else {
+		counters[key] += delta
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with registry mutex locked and with subscription mutex
+// locked unless the subscription is not yet visible to others
+//-----------------------------------------------------------------------------
+func (r *Registry) startQuotaCount(subs *Subscription) {
+	if subs.quotaCounted || subs.Meid == nil || subs.SubReqMsg == nil {
+		return
+	}
+	subs.quotaCounted = true
+	subs.quotaFunctionId = int64(subs.SubReqMsg.FunctionId)
+	subs.quotaXapps = nil
+	addQuotaCount(r.quotaCounters.e2Nodes, subs.Meid.RanName, 1)
+	addQuotaCount(r.quotaCounters.ranFunctions, ranFunctionQuotaKey(subs.Meid.RanName, subs.quotaFunctionId), 1)
+	for _, endpoint := range subs.EpList.Endpoints {
+		r.countQuotaXapp(subs, endpoint.Addr, 1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with registry mutex locked
+//-----------------------------------------------------------------------------
+func (r *Registry) stopQuotaCount(subs *Subscription) {
+	if subs.quotaCounted == false {
+		return
+	}
+	subs.quotaCounted = false
+	addQuotaCount(r.quotaCounters.e2Nodes, subs.Meid.RanName, -1)
+	addQuotaCount(r.quotaCounters.ranFunctions, ranFunctionQuotaKey(subs.Meid.RanName, subs.quotaFunctionId), -1)
+	for _, xappName := range subs.quotaXapps {
+		addQuotaCount(r.quotaCounters.xapps, xappName, -1)
+	}
+	subs.quotaXapps = nil
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with registry mutex locked. Counts xApp joining (delta 1)
+// or leaving (delta -1) a counted subscription.
+//-----------------------------------------------------------------------------
+func (r *Registry) countQuotaXapp(subs *Subscription, xappRmrServiceName string, delta int) {
+	if subs.quotaCounted == false {
+		return
+	}
+	if delta > 0 {
+		subs.quotaXapps = append(subs.quotaXapps, xappRmrServiceName)
+		addQuotaCount(r.quotaCounters.xapps, xappRmrServiceName, 1)
+		return
+	}
+	for i, xappName := range subs.quotaXapps {
+		if xappName == xappRmrServiceName {
+			subs.quotaXapps = append(subs.quotaXapps[:i], subs.quotaXapps[i+1:]...)
+			addQuotaCount(r.quotaCounters.xapps, xappRmrServiceName, -1)
+			return
+		}
+	}
+}
+
+func (r *Registry) getQuotaUsage() *SubscriptionQuotaUsage {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	quotas := getSubscriptionQuotas()
+	usage := &SubscriptionQuotaUsage{
+		Xapps:        make(map[string]QuotaUsage),
+		E2Nodes:      make(map[string]QuotaUsage),
+		RanFunctions: make(map[string]QuotaUsage),
+	}
+	for xappName, used := range r.quotaCounters.xapps {
+		usage.Xapps[xappName] = QuotaUsage{Used: used, Quota: quotas.xappQuota(xappName)}
+	}
+	for ranName, used := range r.quotaCounters.e2Nodes {
+		usage.E2Nodes[ranName] = QuotaUsage{Used: used, Quota: quotas.e2NodeQuota(ranName)}
+	}
+	for key, used := range r.quotaCounters.ranFunctions {
+		functionId, _ := strconv.ParseInt(key[strings.LastIndex(key, "/")+1:], 10, 64)
+		usage.RanFunctions[key] = QuotaUsage{Used: used, Quota: quotas.ranFunctionQuota(functionId)}
+	}
+	return usage
+}
+
+func (r *Registry) checkQuotas(xappRmrServiceName string, ranName string, functionIds []int64, newAllocation bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.checkQuotasLocked(xappRmrServiceName, ranName, functionIds, newAllocation)
+}
+
+//-----------------------------------------------------------------------------
+// Must be called with registry mutex locked. Checks whether E2 subscriptions
+// for given RAN functions can be added for the xApp. E2 node and RAN function
+// quotas are checked only when new E2 subscriptions are allocated, i.e. not
+// when xApp is merged to an existing subscription.
+//-----------------------------------------------------------------------------
+func (r *Registry) checkQuotasLocked(xappRmrServiceName string, ranName string, functionIds []int64, newAllocation bool) error {
+
+	quotas := getSubscriptionQuotas()
+	used := r.quotaCounters.xapps[xappRmrServiceName]
+	if quota := quotas.xappQuota(xappRmrServiceName); quotaExceeded(used, len(functionIds), quota) {
+		return &QuotaExceededError{cause: fmt.Sprintf("Subscription quota of xApp %s exceeded. Used %d, requested %d, quota %d",
+			xappRmrServiceName, used, len(functionIds), quota)}
+	}
+	if newAllocation == false {
+		return nil
+	}
+	e2NodeUsed := r.quotaCounters.e2Nodes[ranName]
+	if quota := quotas.e2NodeQuota(ranName); quotaExceeded(e2NodeUsed, len(functionIds), quota) {
+		return &QuotaExceededError{cause: fmt.Sprintf("Subscription quota of E2 node %s exceeded. Used %d, requested %d, quota %d",
+			ranName, e2NodeUsed, len(functionIds), quota)}
+	}
+	requested := make(map[int64]int)
+	for _, functionId := range functionIds {
+		requested[functionId]++
+	}
+	for functionId, count := range requested {
+		used := r.quotaCounters.ranFunctions[ranFunctionQuotaKey(ranName, functionId)]
+		if quota := quotas.ranFunctionQuota(functionId); quotaExceeded(used, count, quota) {
+			return &QuotaExceededError{cause: fmt.Sprintf("Subscription quota of RAN function %d in E2 node %s exceeded. Used %d, requested %d, quota %d",
+				functionId, ranName, used, count, quota)}
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Checks quotas for a new REST subscription before it is processed
+//-----------------------------------------------------------------------------
+func (r *Registry) CheckSubscriptionQuotas(xappRmrServiceName string, ranName string, functionIds []int64) error {
+	return r.checkQuotas(xappRmrServiceName, ranName, functionIds, true)
+}
+
+func (r *Registry) GetQuotaUsageJson() []byte {
+
+	usage := r.getQuotaUsage()
+
+	usageJson, err := json.Marshal(usage)
+	if err != nil {
+		xapp.Logger.Error("GetQuotaUsageJson() json.Marshal error: %v", err)
+	}
+	return usageJson
+}
+
+//-----------------------------------------------------------------------------
+// Must not be called with registry mutex locked
+//-----------------------------------------------------------------------------
+func (r *Registry) updateQuotaGauges(c *Control) {
+	if c == nil || c.Gauges == nil {
+		return
+	}
+	usage := r.getQuotaUsage()
+	c.SetGauge(gE2SubscriptionCount, r.getSubsCount())
+	c.SetGauge(gXappQuotaMaxUsage, maxQuotaUsagePercent(usage.Xapps))
+	c.SetGauge(gE2NodeQuotaMaxUsage, maxQuotaUsagePercent(usage.E2Nodes))
+	c.SetGauge(gRanFuncQuotaMaxUsage, maxQuotaUsagePercent(usage.RanFunctions))
+}
@@ -0,0 +1,167 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//-----------------------------------------------------------------------------
+// TestSubscriptionQuotaUsage
+//
+// Usage of xApp, E2 node and RAN function quotas is reported with configured quotas
+//
+//-----------------------------------------------------------------------------
+func TestSubscriptionQuotaUsage(t *testing.T) {
+	CaseBegin("TestSubscriptionQuotaUsage")
+
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{E2NodeQuota: 4, E2NodeQuotas: map[string]int{"ran_name_2": 1}}
+	})
+	registry := createFilterTestRegistry()
+
+	usage := registry.getQuotaUsage()
+	assert.Equal(t, QuotaUsage{Used: 2, Quota: 0}, usage.Xapps["xapp1"])
+	assert.Equal(t, QuotaUsage{Used: 2, Quota: 4}, usage.E2Nodes["RAN_NAME_1"])
+	assert.Equal(t, QuotaUsage{Used: 1, Quota: 1}, usage.E2Nodes["RAN_NAME_2"])
+	assert.Equal(t, QuotaUsage{Used: 1, Quota: 0}, usage.RanFunctions["RAN_NAME_1/2"])
+	assert.Equal(t, 100, maxQuotaUsagePercent(usage.E2Nodes))
+}
+
+//-----------------------------------------------------------------------------
+// TestSubscriptionQuotaExceeded
+//
+//   1. SubReqs are not limited by default
+//   2. SubReqs exceeding quota of xApp are rejected
+//   3. SubReqs exceeding quota of E2 node are rejected, merge to existing subscription is not counted
+//   4. SubReqs exceeding quota of RAN function are rejected
+//
+//-----------------------------------------------------------------------------
+func TestSubscriptionQuotaExceeded(t *testing.T) {
+	CaseBegin("TestSubscriptionQuotaExceeded")
+
+	registry := createFilterTestRegistry()
+
+	// Unlimited by default
+	assert.Nil(t, registry.CheckSubscriptionQuotas("xapp1", "RAN_NAME_1", []int64{1, 1, 1}))
+
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{XappQuota: 3, XappQuotas: map[string]int{"xapp2": 1}}
+	})
+	assert.Nil(t, registry.CheckSubscriptionQuotas("xapp1", "RAN_NAME_1", []int64{1}))
+	err := registry.CheckSubscriptionQuotas("xapp1", "RAN_NAME_1", []int64{1, 2})
+	assert.NotNil(t, err)
+	_, ok := err.(*QuotaExceededError)
+	assert.True(t, ok)
+	assert.NotNil(t, registry.CheckSubscriptionQuotas("xapp2", "RAN_NAME_2", []int64{3}))
+
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{E2NodeQuota: 2}
+	})
+	assert.NotNil(t, registry.CheckSubscriptionQuotas("xapp3", "RAN_NAME_1", []int64{5}))
+	assert.Nil(t, registry.CheckSubscriptionQuotas("xapp3", "RAN_NAME_2", []int64{5}))
+	// Merge to existing subscription does not consume E2 node quota
+	shard := registry.lockShard("RAN_NAME_1")
+	assert.Nil(t, registry.checkQuotas("xapp3", "RAN_NAME_1", []int64{1}, false))
+	shard.opMutex.Unlock()
+
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{RanFunctionQuotas: map[int64]int{1: 1}}
+	})
+	assert.NotNil(t, registry.CheckSubscriptionQuotas("xapp3", "RAN_NAME_1", []int64{1}))
+	assert.Nil(t, registry.CheckSubscriptionQuotas("xapp3", "RAN_NAME_2", []int64{1}))
+	assert.Nil(t, registry.CheckSubscriptionQuotas("xapp3", "RAN_NAME_1", []int64{2}))
+}
+
+//-----------------------------------------------------------------------------
+// TestSubscriptionQuotaCounters
+//
+//   1. SubReqs of two xApps are merged to the same subscription, usage is counted for both xApps
+//   2. SubDel of one xApp releases quota of the xApp only
+//   3. SubDel of the other xApp releases all quotas
+//
+//-----------------------------------------------------------------------------
+func TestSubscriptionQuotaCounters(t *testing.T) {
+	CaseBegin("TestSubscriptionQuotaCounters")
+
+	registry := createTestRegistry()
+	c := createTestControl(registry, nil)
+
+	trans1 := createValidateTestTrans("RAN_NAME_1", "xapp1")
+	subs, _, err := registry.AssignToSubscription(context.Background(), trans1, createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	trans2 := createValidateTestTrans("RAN_NAME_1", "xapp2")
+	_, _, err = registry.AssignToSubscription(context.Background(), trans2, createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+
+	usage := registry.getQuotaUsage()
+	assert.Equal(t, 1, usage.Xapps["xapp1"].Used)
+	assert.Equal(t, 1, usage.Xapps["xapp2"].Used)
+	assert.Equal(t, 1, usage.E2Nodes["RAN_NAME_1"].Used)
+	assert.Equal(t, 1, usage.RanFunctions["RAN_NAME_1/1"].Used)
+
+	registry.RemoveFromSubscription(context.Background(), subs, trans2, 0, c)
+	usage = registry.getQuotaUsage()
+	assert.Equal(t, 0, usage.Xapps["xapp2"].Used)
+	assert.Equal(t, 1, usage.E2Nodes["RAN_NAME_1"].Used)
+
+	registry.RemoveFromSubscription(context.Background(), subs, trans1, 0, c)
+	usage = registry.getQuotaUsage()
+	assert.Equal(t, 0, len(usage.Xapps))
+	assert.Equal(t, 0, len(usage.E2Nodes))
+	assert.Equal(t, 0, len(usage.RanFunctions))
+}
+
+//-----------------------------------------------------------------------------
+// TestSubscriptionQuotaExceededOnMerge
+//
+//   1. SubReq of xApp creates subscription
+//   2. SubReq of the xApp to be merged to subscription of other xApp is rejected with quota of the xApp
+//
+//-----------------------------------------------------------------------------
+func TestSubscriptionQuotaExceededOnMerge(t *testing.T) {
+	CaseBegin("TestSubscriptionQuotaExceededOnMerge")
+
+	registry := createMergeTestRegistry(1)
+	existing := registry.getAllSubs()[0]
+	c := createTestControl(registry, nil)
+	trans := createValidateTestTrans("RAN_NAME_0", "xapp2")
+	_, _, err := registry.AssignToSubscription(context.Background(), createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 1), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+
+	// Quota of xApp is checked before it joins subscription of other xApp
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionQuotas = SubscriptionQuotaConfig{XappQuotas: map[string]int{"xapp2": 1}}
+	})
+	subs, errorInfo, err := registry.AssignToSubscription(context.Background(), trans, createMergeTestSubReqMsg(1, 0), false, c, false, SubscriptionSharingDefault)
+	assert.Nil(t, subs)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrorCodeSubmgrQuotaExceeded, errorInfo.ErrorCode)
+
+	assert.Equal(t, 1, existing.EpList.Size())
+	assert.False(t, existing.EpList.HasEndpoint(trans.GetEndpoint()))
+	assert.Equal(t, 1, registry.getQuotaUsage().Xapps["xapp2"].Used)
+}
+
+func TestXappRmrServiceName(t *testing.T) {
+	assert.Equal(t, "service-ricxapp-ueec-rmr.ricxapp", XappRmrServiceName("service-ricxapp-ueec-http.ricxapp"))
+}
@@ -0,0 +1,137 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/spf13/viper"
+)
+
+//-----------------------------------------------------------------------------
+// Sharing directive of E2 subscription request tells whether the request can
+// be merged to an existing E2 subscription of other xApps. Shared request is
+// merged if possible. Exclusive request gets always an E2 subscription of its
+// own which is not shared later with any other xApp. Request which must join
+// existing is rejected if there is no E2 subscription to merge it to.
+//-----------------------------------------------------------------------------
+type SubscriptionSharing string
+
+const (
+	SubscriptionSharingDefault          SubscriptionSharing = ""
+	SubscriptionSharingShared           SubscriptionSharing = "SHARED"
+	SubscriptionSharingExclusive        SubscriptionSharing = "EXCLUSIVE"
+	SubscriptionSharingMustJoinExisting SubscriptionSharing = "MUST_JOIN_EXISTING"
+)
+
+func ParseSubscriptionSharing(value string) (SubscriptionSharing, error) {
+	switch sharing := SubscriptionSharing(strings.ToUpper(value)); sharing {
+	case SubscriptionSharingDefault, SubscriptionSharingShared, SubscriptionSharingExclusive, SubscriptionSharingMustJoinExisting:
+		return sharing, nil
+	}
+	return SubscriptionSharingDefault, fmt.Errorf("Invalid subscription sharing %s. Allowed values are %s, %s and %s",
+		value, SubscriptionSharingShared, SubscriptionSharingExclusive, SubscriptionSharingMustJoinExisting)
+}
+
+//-----------------------------------------------------------------------------
+// Merging can be disabled globally. Then all requests are handled as
+// exclusive ones and requests which must join existing are rejected. Default
+// sharing can be configured per xApp. xApps are identified by their RMR
+// service name.
+//-----------------------------------------------------------------------------
+type SubscriptionSharingConfig struct {
+	MergeEnabled bool
+	XappDefaults map[string]SubscriptionSharing
+}
+
+// Replaced as a whole when config is reloaded, never modified in place
+var subscriptionSharingConfig atomic.Pointer[SubscriptionSharingConfig]
+
+func init() {
+	setSubscriptionSharingConfig(SubscriptionSharingConfig{MergeEnabled: true, XappDefaults: make(map[string]SubscriptionSharing)})
+}
+
+func getSubscriptionSharingConfig() *SubscriptionSharingConfig {
+	return subscriptionSharingConfig.Load()
+}
+
+func setSubscriptionSharingConfig(config SubscriptionSharingConfig) {
+	subscriptionSharingConfig.Store(&config)
+}
+
+//-----------------------------------------------------------------------------
+// Reads controls.subscriptionMergeEnabled and per xApp default sharing from
+// map controls.xappSubscriptionSharing
+//-----------------------------------------------------------------------------
+func ReadSubscriptionSharingConfig() SubscriptionSharingConfig {
+
+	viper.SetDefault("controls.subscriptionMergeEnabled", true)
+	s := SubscriptionSharingConfig{
+		MergeEnabled: viper.GetBool("controls.subscriptionMergeEnabled"),
+		XappDefaults: make(map[string]SubscriptionSharing),
+	}
+	for name, value := range viper.GetStringMapString("controls.xappSubscriptionSharing") {
+		sharing, err := ParseSubscriptionSharing(value)
+		if err != nil {
+			xapp.Logger.Error("Invalid subscription sharing for %s in xappSubscriptionSharing: %s", name, err.Error())
+			continue
+		}
+		s.XappDefaults[strings.ToLower(XappRmrServiceName(name))] = sharing
+	}
+	return s
+}
+
+//-----------------------------------------------------------------------------
+// Resolves sharing of request. Sharing given in request overrides default
+// of xApp.
+//-----------------------------------------------------------------------------
+func (s *SubscriptionSharingConfig) resolve(xappRmrServiceName string, sharing SubscriptionSharing) SubscriptionSharing {
+	if sharing == SubscriptionSharingDefault {
+		sharing = s.XappDefaults[strings.ToLower(xappRmrServiceName)]
+	}
+	if sharing == SubscriptionSharingDefault {
+		sharing = SubscriptionSharingShared
+	}
+	if s.MergeEnabled == false && sharing == SubscriptionSharingShared {
+		sharing = SubscriptionSharingExclusive
+	}
+	return sharing
+}
+
+//-----------------------------------------------------------------------------
+// Endpoint can always be found from a subscription it already belongs to.
+// Otherwise exclusive requests cannot join any subscription and exclusive
+// subscriptions cannot be joined. Subscription is owned by one RIC requestor
+// id in E2 node, so xApps with different requestor ids cannot share it.
+//-----------------------------------------------------------------------------
+func isJoinable(subs *Subscription, endpoint *xapp.RmrEndpoint, sharing SubscriptionSharing) bool {
+	if subs.EpList.HasEndpoint(endpoint) {
+		return true
+	}
+	if sharing == SubscriptionSharingExclusive || subs.Exclusive {
+		return false
+	}
+	if subs.ricRequestorId() != getRicRequestorIdConfig().resolve(endpoint.Addr) {
+		return false
+	}
+	return getSubscriptionSharingConfig().MergeEnabled
+}
@@ -0,0 +1,90 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSubscriptionSharing(t *testing.T) {
+	sharing, err := ParseSubscriptionSharing("")
+	assert.Nil(t, err)
+	assert.Equal(t, SubscriptionSharingDefault, sharing)
+	sharing, err = ParseSubscriptionSharing("exclusive")
+	assert.Nil(t, err)
+	assert.Equal(t, SubscriptionSharingExclusive, sharing)
+	sharing, err = ParseSubscriptionSharing("MUST_JOIN_EXISTING")
+	assert.Nil(t, err)
+	assert.Equal(t, SubscriptionSharingMustJoinExisting, sharing)
+	_, err = ParseSubscriptionSharing("PRIVATE")
+	assert.NotNil(t, err)
+}
+
+func TestResolveSubscriptionSharing(t *testing.T) {
+	config := SubscriptionSharingConfig{
+		MergeEnabled: true,
+		XappDefaults: map[string]SubscriptionSharing{"service-ricxapp-xapp1-rmr.ricxapp": SubscriptionSharingExclusive},
+	}
+	assert.Equal(t, SubscriptionSharingShared, config.resolve("service-ricxapp-xapp2-rmr.ricxapp", SubscriptionSharingDefault))
+	assert.Equal(t, SubscriptionSharingExclusive, config.resolve("service-ricxapp-xapp1-rmr.ricxapp", SubscriptionSharingDefault))
+	assert.Equal(t, SubscriptionSharingShared, config.resolve("service-ricxapp-xapp1-rmr.ricxapp", SubscriptionSharingShared))
+	assert.Equal(t, SubscriptionSharingMustJoinExisting, config.resolve("service-ricxapp-xapp2-rmr.ricxapp", SubscriptionSharingMustJoinExisting))
+
+	config.MergeEnabled = false
+	assert.Equal(t, SubscriptionSharingExclusive, config.resolve("service-ricxapp-xapp2-rmr.ricxapp", SubscriptionSharingShared))
+	assert.Equal(t, SubscriptionSharingMustJoinExisting, config.resolve("service-ricxapp-xapp2-rmr.ricxapp", SubscriptionSharingMustJoinExisting))
+}
+
+func TestFindExistingSubsSharing(t *testing.T) {
+	registry := createMergeTestRegistry(1)
+
+	// Shared subscription can be joined by shared request but not by exclusive one
+	subs, endPointFound := registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingShared)
+	assert.NotNil(t, subs)
+	assert.False(t, endPointFound)
+	joined, _ := registry.joinSubs(subs, createValidateTestTrans("RAN_NAME_0", "xapp2"))
+	assert.True(t, joined)
+	// Endpoint already in subscription finds it also with exclusive request
+	found, _ := registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingExclusive)
+	assert.Equal(t, subs, found)
+	found, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp3"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingExclusive)
+	assert.Nil(t, found)
+	found, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp3"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingMustJoinExisting)
+	assert.Equal(t, subs, found)
+
+	// Exclusive subscription is found only by its own endpoint
+	subs.EpList.DelEndpoint(createValidateTestTrans("RAN_NAME_0", "xapp2").GetEndpoint())
+	subs.EpList.DelEndpoint(createValidateTestTrans("RAN_NAME_0", "xapp3").GetEndpoint())
+	subs.Exclusive = true
+	found, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingShared)
+	assert.Nil(t, found)
+	found, endPointFound = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp1"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingExclusive)
+	assert.Equal(t, subs, found)
+	assert.True(t, endPointFound)
+
+	// Merging disabled globally
+	subs.Exclusive = false
+	setTestConfig(t, func(config *testConfig) {
+		config.subscriptionSharing = SubscriptionSharingConfig{MergeEnabled: false, XappDefaults: make(map[string]SubscriptionSharing)}
+	})
+	found, _ = registry.findExistingSubs(createValidateTestTrans("RAN_NAME_0", "xapp2"), createMergeTestSubReqMsg(1, 0), SubscriptionSharingMustJoinExisting)
+	assert.Nil(t, found)
+}
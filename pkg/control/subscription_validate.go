@@ -0,0 +1,237 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/go-openapi/strfmt"
+)
+
+//-----------------------------------------------------------------------------
+// Dry-run validation of REST subscription requests. Request is processed
+// in the same way as a real subscription request up to the point where
+// E2 subscriptions would be allocated, but no ids are allocated, no routes
+// are created and nothing is sent to E2 node. All problems found are
+// returned instead of stopping to the first one.
+//-----------------------------------------------------------------------------
+
+type SubscriptionValidationProblem struct {
+	Check  string
+	Detail *int64 `json:",omitempty"` // XappEventInstanceID of subscription detail the problem concerns
+	Error  string
+}
+
+type SubscriptionDetailValidation struct {
+	XappEventInstanceID int64
+	ActionType          string
+	PolicyUpdate        bool     // Existing Policy subscription would be updated
+	Mergeable           bool     // Request would be merged to existing subscription
+	AlreadySubscribed   bool     // xApp is already included in the existing subscription
+	SubscriptionId      uint32   `json:",omitempty"` // E2 subscription id of existing subscription
+	ConflictingSubIds   []uint32 `json:",omitempty"` // Conflicting POLICY or INSERT subscriptions
+	Preempts            bool     `json:",omitempty"` // Conflicting subscriptions would be pre-empted
+}
+
+type SubscriptionValidationResult struct {
+	Valid               bool
+	E2ConnectionUp      bool
+	Problems            []SubscriptionValidationProblem
+	SubscriptionDetails []SubscriptionDetailValidation
+}
+
+func (v *SubscriptionValidationResult) addProblem(check string, detail *int64, err error) {
+	v.Problems = append(v.Problems, SubscriptionValidationProblem{Check: check, Detail: detail, Error: err.Error()})
+}
+
+//-----------------------------------------------------------------------------
+// Same decision as in AssignToSubscription but without modifying registry
+//-----------------------------------------------------------------------------
+func (r *Registry) CheckAssignToSubscription(trans *TransactionXapp, subReqMsg *e2ap.E2APSubscriptionRequest, actionType uint64, sharing SubscriptionSharing) (*subscriptionAssignment, error) {
+	shard := r.lockShard(trans.GetMeid().RanName)
+	defer shard.opMutex.Unlock()
+
+	assignment, _, err := r.decideAssignment(trans, subReqMsg, actionType, sharing)
+	return assignment, err
+}
+
+//-------------------------------------------------------------------
+// Validates REST subscription request without processing it. Sharing
+// is the Sharing field of E2SubscriptionDirectives which is not part
+// of xapp-frame SubscriptionParams.
+//-------------------------------------------------------------------
+func (c *Control) ValidateRESTSubscriptionRequest(p *models.SubscriptionParams, sharingDirective string) *SubscriptionValidationResult {
+
+	result := &SubscriptionValidationResult{Problems: []SubscriptionValidationProblem{}, SubscriptionDetails: []SubscriptionDetailValidation{}}
+
+	if err := p.Validate(strfmt.Default); err != nil {
+		result.addProblem("SubscriptionParams", nil, err)
+		// Rest of the checks cannot be done safely if mandatory fields are missing
+		return result
+	}
+	result.E2ConnectionUp = c.e2IfState.IsE2ConnectionUp(p.Meid) && c.e2IfState.IsE2ConnectionUnderReset(p.Meid) == false
+
+	if _, err := c.GetE2SubscriptionDirectives(p); err != nil {
+		result.addProblem("E2SubscriptionDirectives", nil, err)
+	}
+	sharing, err := ParseSubscriptionSharing(sharingDirective)
+	if err != nil {
+		result.addProblem("E2SubscriptionDirectives", nil, err)
+	}
+
+	var xAppRmrEndpoint string
+	if p.ClientEndpoint == nil {
+		result.addProblem("ClientEndpoint", nil, fmt.Errorf("ClientEndpoint == nil"))
+	} else {
+		var err error
+		if _, xAppRmrEndpoint, err = ConstructEndpointAddresses(*p.ClientEndpoint); err != nil {
+			result.addProblem("ClientEndpoint", nil, err)
+		}
+	}
+
+	restSubscription := &RESTSubscription{xAppIdToE2Id: make(map[int64]int64)}
+	if p.SubscriptionID != "" {
+		existingRestSubscription, err := c.registry.GetRESTSubscription(p.SubscriptionID, false)
+		if existingRestSubscription == nil {
+			result.addProblem("SubscriptionID", nil, err)
+		} else {
+			// Processing of the REST subscription may change its instance ids meanwhile
+			_, restSubscription.xAppIdToE2Id = c.registry.GetRESTSubscriptionInstances(existingRestSubscription)
+		}
+	}
+
+	subReqList := e2ap.SubscriptionRequestList{}
+	if err := c.e2ap.FillSubscriptionReqMsgs(p, &subReqList, restSubscription); err != nil {
+		result.addProblem("SubscriptionDetails", nil, err)
+		return result
+	}
+
+	var endpoint *xapp.RmrEndpoint
+	if xAppRmrEndpoint != "" {
+		endpoint = xapp.NewRmrEndpoint(xAppRmrEndpoint)
+	}
+
+	functionIds := make([]int64, 0, len(subReqList.E2APSubscriptionRequests))
+	for i := range subReqList.E2APSubscriptionRequests {
+		subReqMsg := &subReqList.E2APSubscriptionRequests[i]
+		xAppEventInstanceID := int64(subReqMsg.RequestId.Id)
+		functionIds = append(functionIds, int64(subReqMsg.FunctionId))
+
+		detail := SubscriptionDetailValidation{XappEventInstanceID: xAppEventInstanceID}
+		actionType, err := c.registry.CheckActionTypes(subReqMsg)
+		if err != nil {
+			result.addProblem("ActionTypes", &xAppEventInstanceID, err)
+		} else {
+			for name, value := range e2ap.E2AP_ActionTypeStrMap {
+				if value == actionType {
+					detail.ActionType = name
+				}
+			}
+		}
+
+		if _, _, err := c.e2ap.PackSubscriptionRequest(subReqMsg); err != nil {
+			result.addProblem("E2AP", &xAppEventInstanceID, err)
+		}
+
+		if endpoint != nil && actionType != e2ap.E2AP_ActionTypeInvalid {
+			trans := &TransactionXapp{}
+			trans.Meid = &xapp.RMRMeid{RanName: *p.Meid}
+			trans.XappKey = &TransactionXappKey{InstanceID: subReqMsg.RequestId.InstanceId, RmrEndpoint: *endpoint}
+			trans.RequestId = subReqMsg.RequestId
+			assignment, err := c.registry.CheckAssignToSubscription(trans, subReqMsg, actionType, sharing)
+			check := "Quota"
+			if assignment.conflict != nil {
+				detail.ConflictingSubIds = assignment.conflict.subIds()
+				detail.Preempts = assignment.conflict.preempt
+				if assignment.conflict.preempt == false {
+					check = "ActionConflict"
+				}
+			}
+			if err != nil {
+				result.addProblem(check, &xAppEventInstanceID, err)
+			}
+			if assignment.subs != nil {
+				detail.SubscriptionId = assignment.subs.ReqId.InstanceId
+				detail.PolicyUpdate = assignment.policyUpdate
+				detail.Mergeable = assignment.policyUpdate == false
+				detail.AlreadySubscribed = assignment.endPointFound
+			}
+		}
+		result.SubscriptionDetails = append(result.SubscriptionDetails, detail)
+	}
+
+	// Same check which is done for new REST subscriptions before they are processed
+	if p.SubscriptionID == "" && p.ClientEndpoint != nil {
+		if err := c.registry.CheckSubscriptionQuotas(XappRmrServiceName(p.ClientEndpoint.Host), *p.Meid, functionIds); err != nil {
+			result.addProblem("Quota", nil, err)
+		}
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result
+}
+
+//-------------------------------------------------------------------
+// Dry-run validation of REST Subscription Request. Returns all
+// problems found in the request and whether the request would be
+// merged to existing subscriptions.
+//-------------------------------------------------------------------
+func (c *Control) ValidateRESTSubscriptionRequestHandler(w http.ResponseWriter, r *http.Request) {
+	xapp.Logger.Debug("ValidateRESTSubscriptionRequestHandler() called")
+
+	c.UpdateCounter(cRestSubValidateReq)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		xapp.Logger.Error("ValidateRESTSubscriptionRequestHandler() reading body failed: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p := &models.SubscriptionParams{}
+	if err := json.Unmarshal(body, p); err != nil {
+		xapp.Logger.Error("ValidateRESTSubscriptionRequestHandler() json.Unmarshal error: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	extensionFields := struct {
+		E2SubscriptionDirectives *struct {
+			Sharing string
+		}
+	}{}
+	if err := json.Unmarshal(body, &extensionFields); err != nil {
+		xapp.Logger.Error("ValidateRESTSubscriptionRequestHandler() json.Unmarshal error: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sharing := ""
+	if extensionFields.E2SubscriptionDirectives != nil {
+		sharing = extensionFields.E2SubscriptionDirectives.Sharing
+	}
+
+	result := c.ValidateRESTSubscriptionRequest(p, sharing)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		xapp.Logger.Error("ValidateRESTSubscriptionRequestHandler() w.Write failure: %s", err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func createValidateTestTrans(ranName string, addr string) *TransactionXapp {
+	trans := &TransactionXapp{}
+	trans.Meid = &xapp.RMRMeid{RanName: ranName}
+	trans.XappKey = &TransactionXappKey{RmrEndpoint: xapp.RmrEndpoint{Addr: addr, Port: 4560}}
+	return trans
+}
+
+func TestCheckAssignToSubscription(t *testing.T) {
+
+	registry := createFilterTestRegistry()
+	subReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: 1}
+
+	// Merge to existing subscription of another xApp
+	assignment, err := registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp3"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	assert.NotNil(t, assignment.subs)
+	assert.False(t, assignment.endPointFound)
+	assert.False(t, assignment.policyUpdate)
+	// Registry is not modified
+	assert.Equal(t, 1, assignment.subs.EpList.Size())
+
+	// Exclusive request is not merged and request which must join fails without subscription to join
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp3"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingExclusive)
+	assert.Nil(t, err)
+	assert.Nil(t, assignment.subs)
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_3", "xapp3"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingMustJoinExisting)
+	assert.NotNil(t, err)
+
+	// Requesting xApp is already included
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp1"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	assert.True(t, assignment.endPointFound)
+
+	// No mergeable subscription in another E2 node
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_3", "xapp1"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	assert.Nil(t, assignment.subs)
+
+	// Quota of new allocation
+	setTestConfig(t, func(config *testConfig) { config.subscriptionQuotas = SubscriptionQuotaConfig{E2NodeQuota: 2} })
+	newReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: 7}
+	newReqMsg.EventTriggerDefinition.Data.Data = []byte{1}
+	newReqMsg.EventTriggerDefinition.Data.Length = 1
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp3"), newReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingDefault)
+	assert.NotNil(t, err)
+	assert.Nil(t, assignment.subs)
+	assignment, err = registry.CheckAssignToSubscription(createValidateTestTrans("RAN_NAME_1", "xapp3"), subReqMsg, e2ap.E2AP_ActionTypeReport, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+
+	// Existing Policy subscription is updated
+	policyReqMsg := &e2ap.E2APSubscriptionRequest{FunctionId: 7}
+	policyReqMsg.RequestId.InstanceId = 3
+	policyTrans := createValidateTestTrans("RAN_NAME_2", "xapp2")
+	policyTrans.RequestId = policyReqMsg.RequestId
+	assignment, err = registry.CheckAssignToSubscription(policyTrans, policyReqMsg, e2ap.E2AP_ActionTypePolicy, SubscriptionSharingDefault)
+	assert.Nil(t, err)
+	assert.True(t, assignment.policyUpdate)
+	assert.Equal(t, uint32(3), assignment.subs.ReqId.InstanceId)
+}
+
+func TestGetRESTSubscriptionInstances(t *testing.T) {
+	registry := createFilterTestRegistry()
+	restSubId, xAppServiceName, xAppRmrEndPoint, ranName := "restSubIdValidate", "xapp1", "xapp1:4560", "RAN_NAME_1"
+	restSubscription := registry.CreateRESTSubscription(&restSubId, &xAppServiceName, &xAppRmrEndPoint, &ranName)
+	registry.AddRESTSubscriptionInstance(restSubscription, 5, 1)
+
+	// Validation uses a copy which is not changed by processing of the REST subscription
+	instanceIds, xAppIdToE2Id := registry.GetRESTSubscriptionInstances(restSubscription)
+	registry.AddRESTSubscriptionInstance(restSubscription, 6, 2)
+	registry.DeleteRESTSubscriptionInstance(restSubscription, 5, 1)
+	assert.Equal(t, []uint32{1}, instanceIds)
+	assert.Equal(t, map[int64]int64{5: 1}, xAppIdToE2Id)
+	assert.Equal(t, []uint32{2}, restSubscription.InstanceIds)
+}
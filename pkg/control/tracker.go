@@ -20,6 +20,7 @@
 package control
 
 import (
+	"context"
 	"fmt"
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
@@ -39,24 +40,26 @@ func (t *Tracker) Init() {
 	t.transactionXappTable = make(map[TransactionXappKey]*TransactionXapp)
 }
 
-func (t *Tracker) initTransaction(transBase *Transaction) {
+func (t *Tracker) initTransaction(ctx context.Context, transBase *Transaction) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
+	transBase.ctx = ctx
 	transBase.EventChan = make(chan interface{})
 	transBase.tracker = t
 	transBase.Seq = t.transSeq
 	t.transSeq++
 }
 
-func (t *Tracker) NewSubsTransaction(subs *Subscription) *TransactionSubs {
+func (t *Tracker) NewSubsTransaction(ctx context.Context, subs *Subscription) *TransactionSubs {
 	trans := &TransactionSubs{}
 	trans.Meid = subs.GetMeid()
-	t.initTransaction(&trans.Transaction)
+	t.initTransaction(ctx, &trans.Transaction)
 	xapp.Logger.Debug("CREATE %s", trans.String())
 	return trans
 }
 
 func (t *Tracker) NewXappTransaction(
+	ctx context.Context,
 	endpoint *xapp.RmrEndpoint,
 	xid string,
 	requestId e2ap.RequestId,
@@ -66,7 +69,7 @@ func (t *Tracker) NewXappTransaction(
 	trans.XappKey = &TransactionXappKey{requestId.Id, *endpoint, xid}
 	trans.Meid = meid
 	trans.RequestId = requestId
-	t.initTransaction(&trans.Transaction)
+	t.initTransaction(ctx, &trans.Transaction)
 	xapp.Logger.Debug("CREATE %s", trans.String())
 	return trans
 }
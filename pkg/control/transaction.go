@@ -20,6 +20,7 @@
 package control
 
 import (
+	"context"
 	"strconv"
 	"sync"
 	"time"
@@ -50,6 +51,7 @@ type Transaction struct {
 	Mtype     int              //Encoded message type to be send
 	Payload   *e2ap.PackedData //Encoded message to be send
 	EventChan chan interface{}
+	ctx       context.Context //cancels event waits of transaction
 }
 
 func (t *Transaction) String() string {
@@ -60,31 +62,49 @@ func (t *Transaction) String() string {
 	return "trans(" + strconv.FormatUint(uint64(t.Seq), 10) + "/" + meidstr + ")"
 }
 
+//-----------------------------------------------------------------------------
+// Context given to tracker when transaction was created. Cancellation and
+// deadline of the context end event waits as if they had timed out
+//-----------------------------------------------------------------------------
+func (t *Transaction) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
 func (t *Transaction) SendEvent(event interface{}, waittime time.Duration) (bool, bool) {
+	var expiry <-chan time.Time
 	if waittime > 0 {
-		select {
-		case t.EventChan <- event:
-			return true, false
-		case <-time.After(waittime):
-			return false, true
-		}
-		return false, false
+		timer := time.NewTimer(waittime)
+		defer timer.Stop()
+		expiry = timer.C
+	}
+	select {
+	case t.EventChan <- event:
+		return true, false
+	case <-expiry:
+		return false, true
+	case <-t.Context().Done():
+		return false, true
 	}
-	t.EventChan <- event
-	return true, false
 }
 
 func (t *Transaction) WaitEvent(waittime time.Duration) (interface{}, bool) {
+	var expiry <-chan time.Time
 	if waittime > 0 {
-		select {
-		case event := <-t.EventChan:
-			return event, false
-		case <-time.After(waittime):
-			return nil, true
-		}
+		timer := time.NewTimer(waittime)
+		defer timer.Stop()
+		expiry = timer.C
+	}
+	select {
+	case event := <-t.EventChan:
+		return event, false
+	case <-expiry:
+		return nil, true
+	case <-t.Context().Done():
+		return nil, true
 	}
-	event := <-t.EventChan
-	return event, false
 }
 
 func (t *Transaction) GetMtype() int {
@@ -59,12 +59,50 @@ type E2SubscriptionDirectives struct {
 
 	// Subscription needs RMR route from E2Term to xApp
 	CreateRMRRoute bool
+
+	// Retry policies which override configured policies of the same cause
+	E2RetryPolicies []E2RetryPolicy
+
+	// Whether subscription can be shared with other xApps
+	Sharing SubscriptionSharing
 }
 
+//-----------------------------------------------------------------------------
+// Stable error codes of failed subscription requests. Codes are meant for
+// xApps and are not changed when human readable ErrorCause texts change.
+//-----------------------------------------------------------------------------
+type ErrorCode string
+
+const (
+	ErrorCodeNone                        ErrorCode = ""
+	ErrorCodeSubmgrTrackingFailure       ErrorCode = "SUBMGR_TRACKING_FAILURE"
+	ErrorCodeSubmgrContentValidation     ErrorCode = "SUBMGR_E2_CONTENT_VALIDATION_FAILURE"
+	ErrorCodeSubmgrIdAllocationFailure   ErrorCode = "SUBMGR_SUBSCRIPTION_ID_ALLOCATION_FAILURE"
+	ErrorCodeSubmgrQuotaExceeded         ErrorCode = "SUBMGR_QUOTA_EXCEEDED"
+	ErrorCodeSubmgrNoSubscriptionToJoin  ErrorCode = "SUBMGR_NO_SUBSCRIPTION_TO_JOIN"
+	ErrorCodeSubmgrActionConflict        ErrorCode = "SUBMGR_ACTION_CONFLICT"
+	ErrorCodeSubmgrUnexpectedE2Response  ErrorCode = "SUBMGR_UNEXPECTED_E2_RESPONSE"
+	ErrorCodeSubmgrRequestCancelled      ErrorCode = "SUBMGR_REQUEST_CANCELLED"
+	ErrorCodeSubmgrPreempted             ErrorCode = "SUBMGR_SUBSCRIPTION_PREEMPTED"
+	ErrorCodeRtmgrRouteCreateFailure     ErrorCode = "RTMGR_ROUTE_CREATE_FAILURE"
+	ErrorCodeRtmgrRouteUpdateFailure     ErrorCode = "RTMGR_ROUTE_UPDATE_FAILURE"
+	ErrorCodeDbaasWriteFailure           ErrorCode = "DBAAS_WRITE_FAILURE"
+	ErrorCodeAsn1PackFailure             ErrorCode = "ASN1_PACK_FAILURE"
+	ErrorCodeE2InterfaceDown             ErrorCode = "E2_INTERFACE_DOWN"
+	ErrorCodeE2SubscriptionFailure       ErrorCode = "E2_SUBSCRIPTION_FAILURE"
+	ErrorCodeE2SubscriptionTimeout       ErrorCode = "E2_SUBSCRIPTION_TIMEOUT"
+	ErrorCodeE2ActionsNotAdmitted        ErrorCode = "E2_ACTIONS_NOT_ADMITTED"
+	ErrorCodeE2SubscriptionDeleteFailure ErrorCode = "E2_SUBSCRIPTION_DELETE_FAILURE"
+	ErrorCodeE2SubscriptionDeleteTimeout ErrorCode = "E2_SUBSCRIPTION_DELETE_TIMEOUT"
+)
+
 type ErrorInfo struct {
-	ErrorCause  string
-	ErrorSource string
-	TimeoutType string
+	ErrorCause        string
+	ErrorSource       string
+	TimeoutType       string
+	ErrorCode         ErrorCode
+	E2Cause           *e2ap.Cause // Cause given by E2 node
+	ConflictingSubIds []uint32    // Subscriptions the request conflicts with
 }
 
 func (e *ErrorInfo) SetInfo(errorCause string, errorSource string, timeoutType string) {
@@ -73,6 +111,14 @@ func (e *ErrorInfo) SetInfo(errorCause string, errorSource string, timeoutType s
 	e.TimeoutType = timeoutType
 }
 
+func (e *ErrorInfo) SetCode(errorCode ErrorCode) {
+	e.ErrorCode = errorCode
+}
+
+func (e *ErrorInfo) SetE2Cause(cause e2ap.Cause) {
+	e.E2Cause = &cause
+}
+
 type XappRnibInterface interface {
 	XappRnibSubscribe(cb func(string, ...string), channel string) error
 	XappRnibGetListGnbIds() ([]*xapp.RNIBNbIdentity, xapp.RNIBIRNibError)
@@ -0,0 +1,75 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"testing"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotificationInstanceErrorFields(t *testing.T) {
+
+	errorInfo := ErrorInfo{}
+	instance := newNotificationInstance(1, 2, &errorInfo)
+	assert.Equal(t, int64(1), *instance.E2EventInstanceID)
+	assert.Equal(t, int64(2), *instance.XappEventInstanceID)
+	assert.Equal(t, "", instance.ErrorCause)
+	assert.Equal(t, ErrorCodeNone, instance.ErrorCode)
+
+	errorInfo.SetInfo("E2 RICSubscriptionResponse timeout", "", models.SubscriptionInstanceTimeoutTypeE2Timeout)
+	errorInfo.SetCode(ErrorCodeE2SubscriptionTimeout)
+	instance = newNotificationInstance(1, 2, &errorInfo)
+	assert.Equal(t, "E2 RICSubscriptionResponse timeout", instance.ErrorCause)
+	assert.Equal(t, models.SubscriptionInstanceTimeoutTypeE2Timeout, instance.TimeoutType)
+	assert.Equal(t, ErrorCodeE2SubscriptionTimeout, instance.ErrorCode)
+	assert.Nil(t, instance.E2Cause)
+
+	errorInfo = ErrorInfo{}
+	err := &E2SubscriptionFailureError{Cause: e2ap.Cause{Content: 1, Value: 5}}
+	errorInfo.SetInfo(err.Error(), models.SubscriptionInstanceErrorSourceE2Node, "")
+	errorInfo.SetCode(ErrorCodeE2SubscriptionFailure)
+	errorInfo.SetE2Cause(err.Cause)
+	instance = newNotificationInstance(1, 2, &errorInfo)
+	// Human readable text is kept as such
+	assert.Equal(t, "RICSubscriptionFailure. E2NodeCause: (Cause:1, Value 5)", instance.ErrorCause)
+	assert.Equal(t, models.SubscriptionInstanceErrorSourceE2Node, instance.ErrorSource)
+	assert.Equal(t, ErrorCodeE2SubscriptionFailure, instance.ErrorCode)
+	assert.Equal(t, e2ap.Cause{Content: 1, Value: 5}, *instance.E2Cause)
+}
+
+func TestCheckActionNotAdmittedListErrorCode(t *testing.T) {
+
+	c := &Control{Counters: mainCtrl.c.Counters}
+	e := &E2ap{}
+
+	errorInfo := e.CheckActionNotAdmittedList(xapp.RIC_SUB_RESP, e2ap.ActionNotAdmittedList{}, c)
+	assert.Equal(t, ErrorCodeNone, errorInfo.ErrorCode)
+
+	actionNotAdmittedList := e2ap.ActionNotAdmittedList{}
+	actionNotAdmittedList.Items = append(actionNotAdmittedList.Items, e2ap.ActionNotAdmittedItem{ActionId: 1})
+	errorInfo = e.CheckActionNotAdmittedList(xapp.RIC_SUB_RESP, actionNotAdmittedList, c)
+	assert.Equal(t, ErrorCodeE2ActionsNotAdmitted, errorInfo.ErrorCode)
+
+	errorInfo = e.CheckActionNotAdmittedList(xapp.RIC_SUB_FAILURE, actionNotAdmittedList, c)
+	assert.Equal(t, ErrorCodeE2SubscriptionFailure, errorInfo.ErrorCode)
+}
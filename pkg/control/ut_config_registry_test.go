@@ -0,0 +1,122 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
+)
+
+//-----------------------------------------------------------------------------
+// Reloadable configuration of a test case. Case modifies the configuration
+// read at its start and the configuration is restored when the case ends.
+//-----------------------------------------------------------------------------
+type testConfig struct {
+	subscriptionQuotas       SubscriptionQuotaConfig
+	subscriptionSharing      SubscriptionSharingConfig
+	e2NodeAdmission          E2NodeAdmissionConfig
+	e2RetryPolicies          []E2RetryPolicy
+	e2Cleanup                e2CleanupTestConfig
+	instanceIdQuarantineTime time.Duration
+	perRanInstanceIdStart    uint32
+	ricRequestorId           RicRequestorIdConfig
+	actionConflict           ActionConflictConfig
+}
+
+type e2CleanupTestConfig struct {
+	maxTryCount   uint64
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+}
+
+func getTestConfig() testConfig {
+	return testConfig{
+		subscriptionQuotas:       *getSubscriptionQuotas(),
+		subscriptionSharing:      *getSubscriptionSharingConfig(),
+		e2NodeAdmission:          *getE2NodeAdmissionConfig(),
+		e2RetryPolicies:          getE2RetryPolicies(),
+		e2Cleanup:                e2CleanupTestConfig{e2CleanupMaxTryCount, e2CleanupRetryDelay, e2CleanupMaxRetryDelay},
+		instanceIdQuarantineTime: getInstanceIdQuarantineTime(),
+		perRanInstanceIdStart:    perRanInstanceIdStart.Load(),
+		ricRequestorId:           *getRicRequestorIdConfig(),
+		actionConflict:           *getActionConflictConfig(),
+	}
+}
+
+func (config testConfig) apply() {
+	setSubscriptionQuotas(config.subscriptionQuotas)
+	setSubscriptionSharingConfig(config.subscriptionSharing)
+	setE2NodeAdmissionConfig(config.e2NodeAdmission)
+	setE2RetryPolicies(config.e2RetryPolicies)
+	e2CleanupMaxTryCount = config.e2Cleanup.maxTryCount
+	e2CleanupRetryDelay = config.e2Cleanup.retryDelay
+	e2CleanupMaxRetryDelay = config.e2Cleanup.maxRetryDelay
+	setInstanceIdQuarantineTime(config.instanceIdQuarantineTime)
+	perRanInstanceIdStart.Store(config.perRanInstanceIdStart)
+	setRicRequestorIdConfig(config.ricRequestorId)
+	setActionConflictConfig(config.actionConflict)
+}
+
+func setTestConfig(t testing.TB, modify func(config *testConfig)) {
+	origConfig := getTestConfig()
+	config := origConfig
+	modify(&config)
+	config.apply()
+	t.Cleanup(origConfig.apply)
+}
+
+//-----------------------------------------------------------------------------
+// Registry of a test case. Instance id quarantines and E2 cleanups are
+// stored in db mocks.
+//-----------------------------------------------------------------------------
+func createTestRegistry() *Registry {
+	registry := new(Registry)
+	registry.Initialize()
+	registry.quarantineDb = CreateSdlNsMock(quarantineSdlNs)
+	registry.e2CleanupDb = CreateSdlNsMock(e2CleanupSdlNs)
+	return registry
+}
+
+//-----------------------------------------------------------------------------
+// Control of a test case using the registry. Subscriptions are stored in db
+// mocks. REST notifications sent to xApps are collected to notifications if
+// it is given.
+//-----------------------------------------------------------------------------
+func createTestControl(registry *Registry, notifications *[]*SubscriptionNotification) *Control {
+	c := &Control{
+		Counters:   mainCtrl.c.Counters,
+		registry:   registry,
+		e2SubsDb:   CreateSdlNsMock(e2SubSdlNs),
+		restSubsDb: CreateSdlNsMock(restSubSdlNs),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if notifications != nil {
+		c.restDuplicateCtrl = new(DuplicateCtrl)
+		c.restDuplicateCtrl.Init()
+		c.notificationOutbox = new(NotificationOutbox)
+		c.notificationOutbox.Init(c, func(resp *SubscriptionNotification, clientEndpoint models.SubscriptionParamsClientEndpoint) error {
+			*notifications = append(*notifications, resp)
+			return nil
+		})
+	}
+	return c
+}
@@ -64,9 +64,13 @@ func createSubmgrControl(srcId teststub.RmrSrcId, rtgSvc teststub.RmrRtgSvc) *te
 	mainCtrl.c.e2ap.SetASN1DebugPrintStatus(mainCtrl.c.LoggerLevel)
 	xapp.Logger.Debug("Test: LoggerLevel %v", mainCtrl.c.LoggerLevel)
 	xapp.Logger.Debug("Replacing real db with test db")
-	mainCtrl.c.e2SubsDb = CreateMock()              // This overrides real E2 Subscription database for testing
-	mainCtrl.c.restSubsDb = CreateRestSubsDbMock()  // This overrides real REST Subscription database for testing
-	mainCtrl.c.e2IfStateDb = CreateXappRnibIfMock() // This overrides real RNIB database for testing
+	mainCtrl.c.e2SubsDb = CreateMock()                                         // This overrides real E2 Subscription database for testing
+	mainCtrl.c.restSubsDb = CreateRestSubsDbMock()                             // This overrides real REST Subscription database for testing
+	mainCtrl.c.restDuplicateDb = CreateSdlNsMock(restDuplicateSdlNs)           // This overrides real REST duplicate control database for testing
+	mainCtrl.c.e2IfStateDb = CreateXappRnibIfMock()                            // This overrides real RNIB database for testing
+	mainCtrl.c.notificationOutboxDb = CreateSdlNsMock(notificationOutboxSdlNs) // This overrides real notification outbox database for testing
+	mainCtrl.c.registry.quarantineDb = CreateSdlNsMock(quarantineSdlNs)        // This overrides real instance id quarantine database for testing
+	mainCtrl.c.registry.e2CleanupDb = CreateSdlNsMock(e2CleanupSdlNs)          // This overrides real E2 cleanup database for testing
 	xapp.SetReadyCB(mainCtrl.ReadyCB, nil)
 	go xapp.RunWithParams(mainCtrl.c, false)
 	mainCtrl.WaitCB()
@@ -182,6 +186,17 @@ func (mc *testingSubmgrControl) wait_subs_clean(t *testing.T, e2SubsId uint32, s
 	return false
 }
 
+func (mc *testingSubmgrControl) wait_e2_cleanup_done(t *testing.T, e2SubsId uint32, secs int) bool {
+	for i := 1; i <= secs*10; i++ {
+		if mc.c.registry.GetE2CleanupSubscription("RAN_NAME_1", e2SubsId) == nil {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	mc.TestError(t, "(submgr) E2 cleanup not done within %d secs: subId=%v", secs, e2SubsId)
+	return false
+}
+
 func (mc *testingSubmgrControl) wait_multi_subs_clean(t *testing.T, e2SubsIds []uint32, secs int) bool {
 
 	purgedSubscriptions := 0
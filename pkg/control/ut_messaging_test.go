@@ -20,6 +20,7 @@
 package control
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -30,6 +31,7 @@ import (
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap_wrapper"
 	"gerrit.o-ran-sc.org/r/ric-plt/nodeb-rnib.git/entities"
 	"gerrit.o-ran-sc.org/r/ric-plt/submgr/pkg/teststube2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/models"
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
 	"github.com/stretchr/testify/assert"
 )
@@ -167,7 +169,7 @@ func TestRESTSubReqE2ConnBreak(t *testing.T) {
 	assert.Equal(t, 0, len(mainCtrl.c.registry.register))
 	assert.Equal(t, 0, len(mainCtrl.c.registry.restSubscriptions))
 
-	subIds, register, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
+	subIds, register, _, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
 	if err != nil {
 		xapp.Logger.Error("%v", err)
 	} else {
@@ -242,7 +244,7 @@ func TestRESTSubscriptionDeleteAfterE2ConnectionBreak(t *testing.T) {
 	assert.Equal(t, 0, len(mainCtrl.c.registry.register))
 	assert.Equal(t, 0, len(mainCtrl.c.registry.restSubscriptions))
 
-	subIds, register, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
+	subIds, register, _, err := mainCtrl.c.ReadAllSubscriptionsFromSdl()
 	if err != nil {
 		xapp.Logger.Error("%v", err)
 	} else {
@@ -1743,7 +1745,7 @@ func TestSubDelReqRetryInSubmgr(t *testing.T) {
 //     |              |------------->|
 //     |              |              |
 //     |              |              |
-//     |   SubDelResp |              |
+//     |   SubDelFail |              |
 //     |<-------------|              |
 //
 //-----------------------------------------------------------------------------
@@ -1768,8 +1770,8 @@ func TestSubDelReqTwoRetriesNoRespInSubmgr(t *testing.T) {
 	// E2t: Receive 2nd SubsDelReq
 	e2termConn1.RecvSubsDelReq(t)
 
-	// Xapp: Receive SubsDelResp
-	xappConn1.RecvSubsDelResp(t, deltrans)
+	// Xapp: Receive SubsDelFail
+	xappConn1.RecvSubsDelFail(t, deltrans)
 
 	// Wait that subs is cleaned
 	mainCtrl.wait_subs_clean(t, e2SubsId, 10)
@@ -1800,7 +1802,7 @@ func TestSubDelReqTwoRetriesNoRespInSubmgr(t *testing.T) {
 //     |              |   SubDelFail |
 //     |              |<-------------|
 //     |              |              |
-//     |   SubDelResp |              |
+//     |   SubDelFail |              |
 //     |<-------------|              |
 //     |              |              |
 //
@@ -1817,7 +1819,7 @@ func TestSubDelReqSubDelFailRespInSubmgr(t *testing.T) {
 		Counter{cSubDelReqFromXapp, 1},
 		Counter{cSubDelReqToE2, 1},
 		Counter{cSubDelFailFromE2, 1},
-		Counter{cSubDelRespToXapp, 1},
+		Counter{cSubDelFailToXapp, 1},
 	})
 
 	// Subs Create
@@ -1833,8 +1835,8 @@ func TestSubDelReqSubDelFailRespInSubmgr(t *testing.T) {
 	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
 	e2termConn1.SendSubsDelFail(t, delreq, delmsg)
 
-	// Xapp: Receive SubsDelResp
-	xappConn1.RecvSubsDelResp(t, deltrans)
+	// Xapp: Receive SubsDelFail
+	xappConn1.RecvSubsDelFail(t, deltrans)
 
 	// Wait that subs is cleaned
 	mainCtrl.wait_subs_clean(t, e2SubsId, 10)
@@ -1847,6 +1849,98 @@ func TestSubDelReqSubDelFailRespInSubmgr(t *testing.T) {
 	mainCtrl.VerifyCounterValues(t)
 }
 
+//-----------------------------------------------------------------------------
+// TestSubDelReqSubDelFailRespE2CleanupRetry
+//
+//   stub                          stub
+// +-------+     +---------+    +---------+
+// | xapp  |     | submgr  |    | e2term  |
+// +-------+     +---------+    +---------+
+//     |              |              |
+//     |         [SUBS CREATE]       |
+//     |              |              |
+//     |              |              |
+//     |  SubDelReq   |              |
+//     |------------->|              |
+//     |              |              |
+//     |              | SubDelReq    |
+//     |              |------------->|
+//     |              |              |
+//     |              |   SubDelFail |
+//     |              |<-------------|
+//     |              |              |
+//     |   SubDelFail |              |
+//     |<-------------|              |
+//     |              |              |
+//     |       [BACKGROUND RETRY]    |
+//     |              |              |
+//     |              | SubDelReq    |
+//     |              |------------->|
+//     |              |              |
+//     |              |   SubDelResp |
+//     |              |<-------------|
+//     |              |              |
+//
+//-----------------------------------------------------------------------------
+
+func TestSubDelReqSubDelFailRespE2CleanupRetry(t *testing.T) {
+	CaseBegin("TestSubDelReqSubDelFailRespE2CleanupRetry start")
+
+	setTestConfig(t, func(config *testConfig) { config.e2Cleanup.maxTryCount = 3 })
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cSubReqFromXapp, 1},
+		Counter{cSubReqToE2, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cSubRespToXapp, 1},
+		Counter{cSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 2},
+		Counter{cSubDelFailFromE2, 1},
+		Counter{cSubDelFailToXapp, 1},
+		Counter{cSubDelCleanupRetryToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+	})
+
+	// Subs Create
+	cretrans := xappConn1.SendSubsReq(t, nil, nil)
+	crereq, cremsg := e2termConn1.RecvSubsReq(t)
+	e2termConn1.SendSubsResp(t, crereq, cremsg)
+	e2SubsId := xappConn1.RecvSubsResp(t, cretrans)
+
+	// Xapp: Send SubsDelReq
+	deltrans := xappConn1.SendSubsDelReq(t, nil, e2SubsId)
+
+	// E2t: Send receive SubsDelReq and send SubsDelFail
+	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
+	e2termConn1.SendSubsDelFail(t, delreq, delmsg)
+
+	// Xapp: Receive SubsDelFail
+	xappConn1.RecvSubsDelFail(t, deltrans)
+
+	// Subscription is removed but its id is kept reserved for cleanup
+	mainCtrl.wait_subs_clean(t, e2SubsId, 10)
+	cleanups := mainCtrl.c.registry.GetE2Cleanups()
+	assert.Equal(t, 1, len(cleanups))
+	assert.Equal(t, e2SubsId, cleanups[0].SubId)
+	assert.Equal(t, subsDeleteStateFailed, cleanups[0].State)
+
+	// Retry without waiting backoff delay
+	go mainCtrl.c.RetryDueE2Cleanups(context.Background(), time.Now().Add(e2CleanupMaxRetryDelay))
+
+	// E2t: Send receive SubsDelReq and send SubsDelResp
+	delreq, delmsg = e2termConn1.RecvSubsDelReq(t)
+	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
+
+	mainCtrl.wait_e2_cleanup_done(t, e2SubsId, 10)
+	assert.Equal(t, 0, len(mainCtrl.c.registry.GetE2Cleanups()))
+
+	xappConn1.TestMsgChanEmpty(t)
+	xappConn2.TestMsgChanEmpty(t)
+	e2termConn1.TestMsgChanEmpty(t)
+	mainCtrl.wait_registry_empty(t, 10)
+
+	mainCtrl.VerifyCounterValues(t)
+}
+
 //-----------------------------------------------------------------------------
 // TestSubDelReqSubDelFailRespInSubmgrOutofOrderIEs
 //
@@ -1867,7 +1961,7 @@ func TestSubDelReqSubDelFailRespInSubmgr(t *testing.T) {
 //     |              |   SubDelFail | (Out of Order IEs)
 //     |              |<-------------|
 //     |              |              |
-//     |   SubDelResp |              |
+//     |   SubDelFail |              |
 //     |<-------------|              |
 //     |              |              |
 //
@@ -1885,7 +1979,7 @@ func TestSubDelReqSubDelFailRespInSubmgrOutofOrderIEs(t *testing.T) {
 		Counter{cSubDelReqFromXapp, 1},
 		Counter{cSubDelReqToE2, 1},
 		Counter{cSubDelFailFromE2, 1},
-		Counter{cSubDelRespToXapp, 1},
+		Counter{cSubDelFailToXapp, 1},
 	})
 
 	// Subs Create
@@ -1901,8 +1995,8 @@ func TestSubDelReqSubDelFailRespInSubmgrOutofOrderIEs(t *testing.T) {
 	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
 	e2termConn1.SendSubsDelFail(t, delreq, delmsg)
 
-	// Xapp: Receive SubsDelResp
-	xappConn1.RecvSubsDelResp(t, deltrans)
+	// Xapp: Receive SubsDelFail
+	xappConn1.RecvSubsDelFail(t, deltrans)
 
 	// Wait that subs is cleaned
 	mainCtrl.wait_subs_clean(t, e2SubsId, 10)
@@ -2876,6 +2970,56 @@ func TestGetRestSubscriptions(t *testing.T) {
 	mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/restsubscriptions")
 }
 
+func TestGetSubscriptionsWithFilter(t *testing.T) {
+
+	params := xappConn1.GetRESTSubsReqReportParams(subReqCount)
+	restSubId := xappConn1.SendRESTSubsReq(t, params)
+
+	crereq, cremsg := e2termConn1.RecvSubsReq(t)
+	xappConn1.ExpectRESTNotification(t, restSubId)
+	e2termConn1.SendSubsResp(t, crereq, cremsg)
+	e2SubsId := xappConn1.WaitRESTNotification(t, restSubId)
+
+	// REST subscriptions
+	var restSubsMap map[string]map[string]interface{}
+	restSubsJson := mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/restsubscriptions?meid=RAN_NAME_1&state=active&limit=10&fields=Meid,Created")
+	assert.Nil(t, json.Unmarshal(restSubsJson, &restSubsMap))
+	assert.Equal(t, 1, len(restSubsMap))
+	assert.Equal(t, "RAN_NAME_1", restSubsMap[restSubId]["Meid"])
+	assert.Equal(t, 2, len(restSubsMap[restSubId]))
+
+	restSubsMap = nil
+	restSubsJson = mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/restsubscriptions?meid=RAN_NAME_2")
+	assert.Nil(t, json.Unmarshal(restSubsJson, &restSubsMap))
+	assert.Equal(t, 0, len(restSubsMap))
+
+	restSubsMap = nil
+	restSubsJson = mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/restsubscriptions?state=deleting")
+	assert.Nil(t, json.Unmarshal(restSubsJson, &restSubsMap))
+	assert.Equal(t, 0, len(restSubsMap))
+
+	// E2 subscriptions
+	var subsList []map[string]interface{}
+	subsJson := mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/subscriptions?meid=RAN_NAME_1&ranFunctionId=33&limit=10&fields=SubscriptionId")
+	assert.Nil(t, json.Unmarshal(subsJson, &subsList))
+	if assert.Equal(t, 1, len(subsList)) {
+		assert.Equal(t, float64(e2SubsId), subsList[0]["SubscriptionId"])
+		assert.Equal(t, 1, len(subsList[0]))
+	}
+
+	subsList = nil
+	subsJson = mainCtrl.SendGetRequest(t, "localhost:8080", "/ric/v1/subscriptions?ranFunctionId=1")
+	assert.Nil(t, json.Unmarshal(subsJson, &subsList))
+	assert.Equal(t, 0, len(subsList))
+
+	xappConn1.SendRESTSubsDelReq(t, &restSubId)
+	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
+	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
+
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyAllClean(t)
+}
+
 //-----------------------------------------------------------------------------
 // TestDelAllE2nodeSubsViaDebugIf
 //
@@ -3546,6 +3690,7 @@ func TestRESTSubReqRetransmission(t *testing.T) {
 
 	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
 		Counter{cRestSubReqFromXapp, 2},
+		Counter{cRestSubReqCollision, 1},
 		Counter{cRestSubRespToXapp, 2},
 		Counter{cSubReqToE2, 1},
 		Counter{cSubRespFromE2, 1},
@@ -4230,7 +4375,6 @@ func TestRESTSubDelReqRetransmission(t *testing.T) {
 //     | RESTSubDelReq   |              |
 //     |---------------->|              |
 //     |  RESTSubDelResp |              |
-//     |     unsuccess   |              |
 //     |<----------------|              |
 //     |                 |      SubResp |
 //     |                 |<-------------|
@@ -4249,8 +4393,7 @@ func TestRESTSubReqDelReq(t *testing.T) {
 		Counter{cSubReqToE2, 1},
 		Counter{cSubRespFromE2, 1},
 		Counter{cRestSubNotifToXapp, 1},
-		Counter{cRestSubDelReqFromXapp, 2},
-		Counter{cRestSubDelFailToXapp, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
 		Counter{cSubDelReqToE2, 1},
 		Counter{cSubDelRespFromE2, 1},
 		Counter{cRestSubDelRespToXapp, 1},
@@ -4261,19 +4404,16 @@ func TestRESTSubReqDelReq(t *testing.T) {
 	// Req
 	params := xappConn1.GetRESTSubsReqReportParams(subReqCount)
 	restSubId := xappConn1.SendRESTSubsReq(t, params)
+	crereq, cremsg := e2termConn1.RecvSubsReq(t)
 
-	// Del. This will fail as processing of the subscription
-	// is still ongoing in submgr. Deletion is not allowed before
-	// subscription creation has been completed.
+	// Del. Processing of the subscription is still ongoing in submgr.
+	// It is cancelled and subscription is deleted when it has ended.
+	// E2 subscription request already sent is completed
 	xappConn1.SendRESTSubsDelReq(t, &restSubId)
-	crereq, cremsg := e2termConn1.RecvSubsReq(t)
 	xappConn1.ExpectRESTNotification(t, restSubId)
 	e2termConn1.SendSubsResp(t, crereq, cremsg)
 	e2SubsId := xappConn1.WaitRESTNotification(t, restSubId)
 
-	// Retry del
-	xappConn1.SendRESTSubsDelReq(t, &restSubId)
-
 	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
 	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
 
@@ -4835,6 +4975,369 @@ func TestRESTSubReqSubFailRespInSubmgr(t *testing.T) {
 	mainCtrl.VerifyAllClean(t)
 }
 
+//-----------------------------------------------------------------------------
+// TestRESTSubReqRetryAfterResourceLimitFail
+//
+//   stub                             stub
+// +-------+        +---------+    +---------+
+// | xapp  |        | submgr  |    | e2term  |
+// +-------+        +---------+    +---------+
+//     |                 |              |
+//     | RESTSubReq      |              |
+//     |---------------->|              |
+//     |                 |              |
+//     |     RESTSubResp |              |
+//     |<----------------|              |
+//     |                 | SubReq       |
+//     |                 |------------->|
+//     |                 |              |
+//     |                 |      SubFail | function-resource-limit
+//     |                 |<-------------|
+//     |                 |              |
+//     |           [BACKOFF]            |
+//     |                 |              |
+//     |                 | SubReq       |
+//     |                 |------------->|
+//     |                 |              |
+//     |                 |      SubResp |
+//     |                 |<-------------|
+//     |                 |              |
+//     |       RESTNotif |              |
+//     |<----------------|              |
+//     |                 |              |
+//     |            [SUBS DELETE]       |
+//     |                 |              |
+//
+//-----------------------------------------------------------------------------
+
+func TestRESTSubReqRetryAfterResourceLimitFail(t *testing.T) {
+
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cRestSubReqFromXapp, 1},
+		Counter{cRestSubRespToXapp, 1},
+		Counter{cSubReqToE2, 2},
+		Counter{cSubFailFromE2, 1},
+		Counter{cSubReqBackoffRetry, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cRestSubNotifToXapp, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+		Counter{cRestSubDelRespToXapp, 1},
+	})
+
+	setTestConfig(t, func(config *testConfig) {
+		config.e2RetryPolicies = []E2RetryPolicy{
+			{CauseContent: e2ap.E2AP_CauseContent_RICrequest, CauseValue: e2ap.E2AP_CauseValue_RICrequest_function_resource_limit,
+				InitialBackoff_ms: 200, MaxBackoff_ms: 200, MaxAge_s: 10},
+		}
+	})
+
+	params := xappConn1.GetRESTSubsReqReportParams(subReqCount)
+	restSubId := xappConn1.SendRESTSubsReq(t, params)
+
+	crereq1, cremsg1 := e2termConn1.RecvSubsReq(t)
+	fparams1 := &teststube2ap.E2StubSubsFailParams{}
+	fparams1.Set(crereq1)
+	fparams1.SetCauseVal(0, 1, 5) // CauseRIC / function-resource-limit
+	e2termConn1.SendSubsFail(t, fparams1, cremsg1)
+
+	// Request is sent again after backoff
+	crereq2, cremsg2 := e2termConn1.RecvSubsReq(t)
+	xappConn1.ExpectRESTNotification(t, restSubId)
+	e2termConn1.SendSubsResp(t, crereq2, cremsg2)
+	e2SubsId := xappConn1.WaitRESTNotification(t, restSubId)
+	xapp.Logger.Debug("TEST: REST notification received e2SubsId=%v", e2SubsId)
+
+	deleteSubscription(t, xappConn1, e2termConn1, &restSubId)
+
+	// Wait that subs is cleaned
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyCounterValues(t)
+	mainCtrl.VerifyAllClean(t)
+}
+
+//-----------------------------------------------------------------------------
+// TestRESTSubReqLeaseExpiry
+//
+//   stub                             stub
+// +-------+        +---------+    +---------+
+// | xapp  |        | submgr  |    | e2term  |
+// +-------+        +---------+    +---------+
+//     |                 |              |
+//     |            [SUBS CREATE]       |
+//     |                 |              |
+//     |           [LEASE EXPIRY]       |
+//     |                 |              |
+//     |                 | SubDelReq    |
+//     |                 |------------->|
+//     |                 |              |
+//     |                 |   SubDelResp |
+//     |                 |<-------------|
+//     |                 |              |
+//
+//-----------------------------------------------------------------------------
+
+func TestRESTSubReqLeaseExpiry(t *testing.T) {
+
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cRestSubReqFromXapp, 1},
+		Counter{cRestSubRespToXapp, 1},
+		Counter{cSubReqToE2, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cRestSubNotifToXapp, 1},
+		Counter{cRestSubLeaseExpired, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+		Counter{cRestSubDelRespToXapp, 1},
+	})
+
+	restSubId, e2SubsId := createSubscription(t, xappConn1, e2termConn1, nil)
+
+	// Lease is renewed but not anymore before it expires
+	_, err := mainCtrl.c.registry.SetRESTSubscriptionLease(restSubId, 10*time.Second, time.Now())
+	assert.Nil(t, err)
+	leaseInfo, err := mainCtrl.c.RenewRESTSubscriptionLease(restSubId, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), leaseInfo.LeaseDuration_s)
+	mainCtrl.c.ExpireRESTSubscriptionLeases(time.Now())
+	mainCtrl.c.ExpireRESTSubscriptionLeases(leaseInfo.LeaseExpiry.Add(time.Second))
+
+	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
+	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
+
+	// Wait that subs is cleaned
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyCounterValues(t)
+	mainCtrl.VerifyAllClean(t)
+}
+
+//-----------------------------------------------------------------------------
+// TestRESTSubDelDueXappUndeploy
+//
+//   stub                             stub
+// +-------+        +---------+    +---------+
+// | xapp  |        | submgr  |    | e2term  |
+// +-------+        +---------+    +---------+
+//     |                 |              |
+//     |            [SUBS CREATE]       |
+//     |                 |              |
+//     |       [XAPP UNDEPLOYED]        |
+//     |                 |              |
+//     |                 | SubDelReq    |
+//     |                 |------------->|
+//     |                 |              |
+//     |                 |   SubDelResp |
+//     |                 |<-------------|
+//     |                 |              |
+//
+//-----------------------------------------------------------------------------
+
+func TestRESTSubDelDueXappUndeploy(t *testing.T) {
+
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cRestSubReqFromXapp, 1},
+		Counter{cRestSubRespToXapp, 1},
+		Counter{cSubReqToE2, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cRestSubNotifToXapp, 1},
+		Counter{cXappRemovalSubDel, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+		Counter{cRestSubDelRespToXapp, 1},
+	})
+
+	restSubId, e2SubsId := createSubscription(t, xappConn1, e2termConn1, nil)
+	xapp.Logger.Debug("TEST: REST subscription created restSubId=%v", restSubId)
+
+	// Other xApps are not affected
+	mainCtrl.c.HandleXappLifecycleEvent(XappLifecycleEvent{
+		EventType: XappLifecycleEventUndeployed,
+		XappName:  "xapp2",
+		Instances: []XappInstance{{Name: "xapp2", Ip: "localhost", Port: 13660}},
+	})
+	mainCtrl.c.HandleXappLifecycleEvent(XappLifecycleEvent{
+		EventType: XappLifecycleEventUndeployed,
+		XappName:  "xapp1",
+		Instances: []XappInstance{{Name: "xapp1", Ip: "localhost", Port: 13560}},
+	})
+
+	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
+	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
+
+	// Wait that subs is cleaned
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyCounterValues(t)
+	mainCtrl.VerifyAllClean(t)
+}
+
+//-----------------------------------------------------------------------------
+// TestRESTSubReqValidate
+//
+//   stub                             stub
+// +-------+        +---------+    +---------+
+// | xapp  |        | submgr  |    | e2term  |
+// +-------+        +---------+    +---------+
+//     |                 |              |
+//     |            [SUBS CREATE]       |
+//     |                 |              |
+//     | RESTSubValidate |              |
+//     |---------------->|              |
+//     |                 |              |
+//     | RESTSubValidate |              |
+//     | (invalid)       |              |
+//     |---------------->|              |
+//     |                 |              |
+//     |            [SUBS DELETE]       |
+//     |                 |              |
+//
+//-----------------------------------------------------------------------------
+
+func TestRESTSubReqValidate(t *testing.T) {
+
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cRestSubReqFromXapp, 1},
+		Counter{cRestSubRespToXapp, 1},
+		Counter{cSubReqToE2, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cRestSubNotifToXapp, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+		Counter{cRestSubDelRespToXapp, 1},
+	})
+
+	restSubId, e2SubsId := createSubscription(t, xappConn1, e2termConn1, nil)
+
+	toSubscriptionParams := func(params *teststube2ap.RESTSubsReqParams) *models.SubscriptionParams {
+		p := &models.SubscriptionParams{}
+		body, err := json.Marshal(params.SubsReqParams)
+		assert.Nil(t, err)
+		assert.Nil(t, json.Unmarshal(body, p))
+		return p
+	}
+
+	// Same request from another xApp would be merged
+	result := mainCtrl.c.ValidateRESTSubscriptionRequest(toSubscriptionParams(xappConn2.GetRESTSubsReqReportParams(1)), "")
+	assert.True(t, result.Valid)
+	assert.Equal(t, 0, len(result.Problems))
+	assert.Equal(t, 1, len(result.SubscriptionDetails))
+	assert.Equal(t, "report", result.SubscriptionDetails[0].ActionType)
+	assert.True(t, result.SubscriptionDetails[0].Mergeable)
+	assert.False(t, result.SubscriptionDetails[0].AlreadySubscribed)
+	assert.Equal(t, e2SubsId, result.SubscriptionDetails[0].SubscriptionId)
+
+	// Sharing directive of the request is honoured
+	result = mainCtrl.c.ValidateRESTSubscriptionRequest(toSubscriptionParams(xappConn2.GetRESTSubsReqReportParams(1)), "exclusive")
+	assert.True(t, result.Valid)
+	assert.False(t, result.SubscriptionDetails[0].Mergeable)
+	result = mainCtrl.c.ValidateRESTSubscriptionRequest(toSubscriptionParams(xappConn2.GetRESTSubsReqReportParams(1)), "unknown")
+	assert.False(t, result.Valid)
+	assert.Equal(t, "E2SubscriptionDirectives", result.Problems[0].Check)
+
+	// Same request from the same xApp
+	result = mainCtrl.c.ValidateRESTSubscriptionRequest(toSubscriptionParams(xappConn1.GetRESTSubsReqReportParams(1)), "")
+	assert.True(t, result.Valid)
+	assert.True(t, result.SubscriptionDetails[0].AlreadySubscribed)
+
+	// All problems are reported
+	params := xappConn2.GetRESTSubsReqReportParams(2)
+	params.SetE2SubscriptionDirectives(2, 20, true)
+	params.AppendActionToActionToBeSetupList(2, "policy", []int64{5678}, "continue", "w10ms")
+	result = mainCtrl.c.ValidateRESTSubscriptionRequest(toSubscriptionParams(params), "")
+	assert.False(t, result.Valid)
+	assert.Equal(t, 3, len(result.Problems))
+	assert.Equal(t, "E2SubscriptionDirectives", result.Problems[0].Check)
+	assert.Equal(t, "ActionTypes", result.Problems[1].Check)
+	assert.Equal(t, int64(1), *result.Problems[1].Detail)
+	assert.Equal(t, "ActionTypes", result.Problems[2].Check)
+	assert.Equal(t, int64(2), *result.Problems[2].Detail)
+	assert.False(t, result.SubscriptionDetails[0].Mergeable)
+
+	deleteSubscription(t, xappConn1, e2termConn1, &restSubId)
+
+	// Wait that subs is cleaned
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyCounterValues(t)
+	mainCtrl.VerifyAllClean(t)
+}
+
+//-----------------------------------------------------------------------------
+// TestRESTSubDelReqNotifyDeleteCompletion
+//
+//   stub                             stub
+// +-------+        +---------+    +---------+
+// | xapp  |        | submgr  |    | e2term  |
+// +-------+        +---------+    +---------+
+//     |                 |              |
+//     |            [SUBS CREATE]       |
+//     |                 |              |
+//     | RESTSubDelReq   |              |
+//     |---------------->|              |
+//     |                 |              |
+//     |  RESTSubDelResp |              |
+//     |<----------------|              |
+//     |                 | SubDelReq    |
+//     |                 |------------->|
+//     |                 |              |
+//     |                 |   SubDelResp |
+//     |                 |<-------------|
+//     |                 |              |
+//     |  RESTNotif      |              |
+//     |  (deleted)      |              |
+//     |<----------------|              |
+//
+//-----------------------------------------------------------------------------
+
+func TestRESTSubDelReqNotifyDeleteCompletion(t *testing.T) {
+
+	mainCtrl.CounterValuesToBeVeriefied(t, CountersToBeAdded{
+		Counter{cRestSubReqFromXapp, 1},
+		Counter{cRestSubRespToXapp, 1},
+		Counter{cSubReqToE2, 1},
+		Counter{cSubRespFromE2, 1},
+		Counter{cRestSubNotifToXapp, 1},
+		Counter{cRestSubDelReqFromXapp, 1},
+		Counter{cSubDelReqToE2, 1},
+		Counter{cSubDelRespFromE2, 1},
+		Counter{cRestSubDelRespToXapp, 1},
+		Counter{cRestSubDelNotifToXapp, 1},
+	})
+
+	params := xappConn1.GetRESTSubsReqReportParams(1)
+	restSubId, e2SubsId := createSubscription(t, xappConn1, e2termConn1, params)
+
+	// Notification is requested with NotifyDeleteCompletion in REST Subscription Request sent to port 8080
+	clientEndpoint := &models.SubscriptionParamsClientEndpoint{}
+	body, err := json.Marshal(params.SubsReqParams.ClientEndpoint)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(body, clientEndpoint))
+	restSubscription, err := mainCtrl.c.registry.GetRESTSubscription(restSubId, false)
+	assert.Nil(t, err)
+	restSubscription.deleteNotifyEndpoint = clientEndpoint
+
+	xappConn1.GetRESTSubsReqReportParams(1)
+	xappConn1.ExpectRESTNotificationOk(t, restSubId)
+	xappConn1.SendRESTSubsDelReq(t, &restSubId)
+	delreq, delmsg := e2termConn1.RecvSubsDelReq(t)
+
+	deletionInfo, err := mainCtrl.c.registry.GetRESTSubscriptionDeletionInfo(restSubId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deletionInfo.Instances))
+	assert.Equal(t, e2SubsId, deletionInfo.Instances[0].E2EventInstanceID)
+	assert.Equal(t, subsDeleteStateOngoing, deletionInfo.Instances[0].State)
+
+	e2termConn1.SendSubsDelResp(t, delreq, delmsg)
+	assert.Equal(t, e2SubsId, xappConn1.WaitRESTNotification(t, restSubId))
+
+	// Wait that subs is cleaned
+	waitSubsCleanup(t, e2SubsId, 10)
+	mainCtrl.VerifyCounterValues(t)
+	mainCtrl.VerifyAllClean(t)
+}
+
 //-----------------------------------------------------------------------------
 // TestRESTSubReqPartialResp
 //
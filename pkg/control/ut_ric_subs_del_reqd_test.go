@@ -1,6 +1,7 @@
 package control
 
 import (
+	"context"
 	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
 	"gerrit.o-ran-sc.org/r/ric-plt/submgr/pkg/teststub"
 	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
@@ -48,8 +49,8 @@ func initMock() *Control {
 	subReqMsg, _ := C1.e2ap.UnpackSubscriptionRequest(params.Payload)
 	subReqMsg1, _ := C1.e2ap.UnpackSubscriptionRequest(payload1)
 
-	trans := C1.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg.RequestId, params.Meid)
-	trans1 := C1.tracker.NewXappTransaction(xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg1.RequestId, params.Meid)
+	trans := C1.tracker.NewXappTransaction(context.Background(), xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg.RequestId, params.Meid)
+	trans1 := C1.tracker.NewXappTransaction(context.Background(), xapp.NewRmrEndpoint(params.Src), params.Xid, subReqMsg1.RequestId, params.Meid)
 
 	for _, acts := range subReqMsg.ActionSetups {
 		acts.ActionType = e2ap.E2AP_ActionTypeInsert
@@ -57,8 +58,8 @@ func initMock() *Control {
 	for _, acts := range subReqMsg1.ActionSetups {
 		acts.ActionType = e2ap.E2AP_ActionTypeInsert
 	}
-	_, _, _ = C1.registry.AssignToSubscription(trans, subReqMsg, C1.ResetTestFlag, C1, true)
-	_, _, _ = C1.registry.AssignToSubscription(trans1, subReqMsg1, C1.ResetTestFlag, C1, true)
+	_, _, _ = C1.registry.AssignToSubscription(context.Background(), trans, subReqMsg, C1.ResetTestFlag, C1, true, SubscriptionSharingDefault)
+	_, _, _ = C1.registry.AssignToSubscription(context.Background(), trans1, subReqMsg1, C1.ResetTestFlag, C1, true, SubscriptionSharingDefault)
 
 	controlObj := testingSubmgrControl{
 		RmrControl: teststub.RmrControl{},
@@ -152,6 +153,10 @@ func TestControl_handleE2TSubscriptionDeleteRequired(t *testing.T) {
 			}
 			c.e2IfState.NbIdMap[params.Meid.RanName] = "_CONNECTED"
 			c.handleE2TSubscriptionDeleteRequired(tt.args.params)
+			// Subscription is deleted in its event loop after handler has returned
+			for i := 0; i < 100 && c.registry.GetSubscription(1) != nil; i++ {
+				time.Sleep(100 * time.Millisecond)
+			}
 			subs, _ := c.registry.GetSubscriptionFirstMatch([]uint32{uint32(1)})
 			subs1, _ := c.registry.GetSubscriptionFirstMatch([]uint32{uint32(2)})
 			assert.Nil(t, subs)
@@ -0,0 +1,399 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+)
+
+//-----------------------------------------------------------------------------
+// xApp lifecycle events. When an xApp is undeployed, its REST subscriptions
+// and subscriptions it has made via RMR are deleted. Events are received
+// from app manager or, for testing, from a REST stand-in.
+//-----------------------------------------------------------------------------
+
+const (
+	XappLifecycleEventDeployed   = "deployed"
+	XappLifecycleEventUndeployed = "undeployed"
+	XappLifecycleEventDeleted    = "deleted"
+)
+
+const (
+	xappLifecycleListenerAppMgr = "appmgr"
+	xappLifecycleListenerRest   = "rest"
+)
+
+// Default Kubernetes service name prefix of xApps
+const xappServicePrefix = "service-ricxapp-"
+
+// Path where app manager sends xApp lifecycle events
+const appMgrCallbackPath = "/ric/v1/xapp_lifecycle_events"
+
+// Path where xApp lifecycle events can be sent in XappLifecycleEvent format for testing
+const xappLifecycleEventPath = "/ric/v1/xapp_lifecycle_event"
+
+// Interval of retrying registration to app manager
+var appMgrRegisterRetryInterval = 10 * time.Second
+
+// Interval of checking that app manager still has the registration. Registration
+// is lost e.g. when app manager is restarted without its database.
+var appMgrRegistrationCheckInterval = 60 * time.Second
+
+var xappLifecycleListenerType string
+var appMgrUrl string
+var xappLifecycleCallbackUrl string
+
+type XappInstance struct {
+	Name string
+	Ip   string // RMR service name of the instance
+	Port int64  // RMR port of the instance
+}
+
+type XappLifecycleEvent struct {
+	EventType string
+	XappName  string
+	Instances []XappInstance
+}
+
+type XappLifecycleHandler func(event XappLifecycleEvent)
+
+type XappLifecycleListener interface {
+	Start(handler XappLifecycleHandler) error
+}
+
+func NewXappLifecycleListener(listenerType string) XappLifecycleListener {
+	switch listenerType {
+	case xappLifecycleListenerAppMgr:
+		return &AppMgrLifecycleListener{AppMgrUrl: appMgrUrl, CallbackUrl: xappLifecycleCallbackUrl}
+	case xappLifecycleListenerRest:
+		return &RestXappLifecycleListener{}
+	case "":
+		return nil
+	default:
+		xapp.Logger.Error("Unknown xappLifecycleListener %s", listenerType)
+		return nil
+	}
+}
+
+//-------------------------------------------------------------------
+// RMR endpoint belongs to the xApp if it is an endpoint of an instance
+// of the xApp or if its host is the default RMR service name of the xApp
+//-------------------------------------------------------------------
+func (e *XappLifecycleEvent) MatchesRmrEndpoint(host string, port int64) bool {
+	for _, instance := range e.Instances {
+		if instance.Ip == host && (instance.Port == 0 || port == 0 || instance.Port == port) {
+			return true
+		}
+	}
+	return e.XappName != "" && strings.HasPrefix(host, xappServicePrefix+e.XappName+"-rmr.")
+}
+
+func splitRmrEndpoint(endpoint string) (string, int64) {
+	index := strings.LastIndex(endpoint, ":")
+	if index < 0 {
+		return endpoint, 0
+	}
+	port, err := strconv.ParseInt(endpoint[index+1:], 10, 64)
+	if err != nil {
+		return endpoint, 0
+	}
+	return endpoint[:index], port
+}
+
+//-------------------------------------------------------------------
+// AppMgrLifecycleListener registers to app manager to get xApp
+// lifecycle events to CallbackUrl
+//-------------------------------------------------------------------
+type AppMgrLifecycleListener struct {
+	AppMgrUrl   string
+	CallbackUrl string
+	handler     XappLifecycleHandler
+	client      http.Client
+}
+
+type appMgrSubscriptionData struct {
+	TargetUrl  string `json:"targetUrl"`
+	EventType  string `json:"eventType"`
+	MaxRetries int64  `json:"maxRetries"`
+	RetryTimer int64  `json:"retryTimer"`
+}
+
+type appMgrSubscriptionRequest struct {
+	Data appMgrSubscriptionData `json:"data"`
+}
+
+type appMgrSubscription struct {
+	Id   string                 `json:"id"`
+	Data appMgrSubscriptionData `json:"data"`
+}
+
+type appMgrXappInstance struct {
+	Name string `json:"name"`
+	Ip   string `json:"ip"`
+	Port int64  `json:"port"`
+}
+
+type appMgrXapp struct {
+	Name      string               `json:"name"`
+	Instances []appMgrXappInstance `json:"instances"`
+}
+
+type appMgrNotification struct {
+	Id        string       `json:"id"`
+	Version   int64        `json:"version"`
+	EventType string       `json:"eventType"`
+	XApps     []appMgrXapp `json:"xApps"`
+}
+
+func (l *AppMgrLifecycleListener) Start(handler XappLifecycleHandler) error {
+	l.handler = handler
+	l.client.Timeout = 5 * time.Second
+	xapp.Resource.InjectRoute(appMgrCallbackPath, l.CallbackHandler, "POST")
+	go l.maintainRegistration(nil)
+	return nil
+}
+
+//-------------------------------------------------------------------
+// Registers to app manager and registers again whenever app manager
+// does not have the registration anymore, e.g. after it has been
+// restarted. Runs until stop is closed, with nil stop forever.
+//-------------------------------------------------------------------
+func (l *AppMgrLifecycleListener) maintainRegistration(stop <-chan struct{}) {
+	for {
+		registered, err := l.IsRegistered()
+		if err == nil && registered == false {
+			err = l.Register()
+		}
+		interval := appMgrRegistrationCheckInterval
+		if err != nil {
+			xapp.Logger.Error("Registration to app manager failed: %s", err.Error())
+			interval = appMgrRegisterRetryInterval
+		}
+		select {
+		case <-time.After(interval):
+		case <-stop:
+			return
+		}
+	}
+}
+
+//-------------------------------------------------------------------
+// Registration is found by callback url from subscriptions of app manager
+//-------------------------------------------------------------------
+func (l *AppMgrLifecycleListener) IsRegistered() (bool, error) {
+	resp, err := l.client.Get(strings.TrimSuffix(l.AppMgrUrl, "/") + "/subscriptions")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, fmt.Errorf("app manager responded with status %v", resp.StatusCode)
+	}
+	subscriptions := []appMgrSubscription{}
+	if err := json.NewDecoder(resp.Body).Decode(&subscriptions); err != nil {
+		return false, err
+	}
+	for _, subscription := range subscriptions {
+		if subscription.Data.TargetUrl == l.CallbackUrl {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (l *AppMgrLifecycleListener) Register() error {
+	request := appMgrSubscriptionRequest{
+		Data: appMgrSubscriptionData{TargetUrl: l.CallbackUrl, EventType: "all", MaxRetries: 5, RetryTimer: 10},
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Post(strings.TrimSuffix(l.AppMgrUrl, "/")+"/subscriptions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("app manager responded with status %v", resp.StatusCode)
+	}
+	xapp.Logger.Info("Registered to app manager %s for xApp lifecycle events to %s", l.AppMgrUrl, l.CallbackUrl)
+	return nil
+}
+
+func (l *AppMgrLifecycleListener) CallbackHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		xapp.Logger.Error("AppMgrLifecycleListener reading body failed: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	notification := appMgrNotification{}
+	if err := json.Unmarshal(body, &notification); err != nil {
+		xapp.Logger.Error("AppMgrLifecycleListener json.Unmarshal error: %s", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	xapp.Logger.Debug("xApp lifecycle notification from app manager: %s", string(body))
+	for _, appMgrXapp := range notification.XApps {
+		event := XappLifecycleEvent{EventType: notification.EventType, XappName: appMgrXapp.Name}
+		for _, instance := range appMgrXapp.Instances {
+			event.Instances = append(event.Instances, XappInstance{Name: instance.Name, Ip: instance.Ip, Port: instance.Port})
+		}
+		if l.handler != nil {
+			l.handler(event)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+//-------------------------------------------------------------------
+// RestXappLifecycleListener is a stand-in for app manager. Events are
+// sent in XappLifecycleEvent format to xappLifecycleEventPath.
+//-------------------------------------------------------------------
+type RestXappLifecycleListener struct {
+	handler XappLifecycleHandler
+}
+
+func (l *RestXappLifecycleListener) Start(handler XappLifecycleHandler) error {
+	l.handler = handler
+	xapp.Resource.InjectRoute(xappLifecycleEventPath, l.EventHandler, "POST")
+	return nil
+}
+
+func (l *RestXappLifecycleListener) EventHandler(w http.ResponseWriter, r *http.Request) {
+	event := XappLifecycleEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.EventType == "" {
+		xapp.Logger.Error("RestXappLifecycleListener invalid event")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if l.handler != nil {
+		l.handler(event)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+//-------------------------------------------------------------------
+// Subscriptions made by the removed xApp via RMR
+//-------------------------------------------------------------------
+type RemovedXappRmrSubscription struct {
+	InstanceId uint32
+	Meid       string
+	Endpoint   string
+}
+
+//-------------------------------------------------------------------
+// Returns REST subscriptions and subscriptions made via RMR which
+// belong to the xApp of the event
+//-------------------------------------------------------------------
+func (r *Registry) GetXappSubscriptions(event *XappLifecycleEvent) ([]string, []RemovedXappRmrSubscription) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	restSubIds := []string{}
+	restInstanceIds := make(map[uint32]bool)
+	for restSubId, restSubscription := range r.restSubscriptions {
+		host, port := splitRmrEndpoint(restSubscription.xAppRmrEndPoint)
+		if restSubscription.xAppRmrEndPoint == "" {
+			host, port = XappRmrServiceName(restSubscription.xAppServiceName), 0
+		}
+		if event.MatchesRmrEndpoint(host, port) {
+			restSubIds = append(restSubIds, restSubId)
+			for _, instanceId := range restSubscription.InstanceIds {
+				restInstanceIds[instanceId] = true
+			}
+		}
+	}
+	sort.Strings(restSubIds)
+
+	rmrSubscriptions := []RemovedXappRmrSubscription{}
+	for subId, subs := range r.register {
+		if restInstanceIds[subId] {
+			continue
+		}
+		for _, endpoint := range subs.EpList.Endpoints {
+			if event.MatchesRmrEndpoint(endpoint.Addr, int64(endpoint.Port)) {
+				rmrSubscriptions = append(rmrSubscriptions, RemovedXappRmrSubscription{
+					InstanceId: subId,
+					Meid:       subs.Meid.RanName,
+					Endpoint:   endpoint.Addr + ":" + strconv.FormatUint(uint64(endpoint.Port), 10),
+				})
+			}
+		}
+	}
+	sort.Slice(rmrSubscriptions, func(i, j int) bool { return rmrSubscriptions[i].InstanceId < rmrSubscriptions[j].InstanceId })
+	return restSubIds, rmrSubscriptions
+}
+
+func (c *Control) HandleXappLifecycleEvent(event XappLifecycleEvent) {
+	xapp.Logger.Info("xApp lifecycle event %s for xApp %s", event.EventType, event.XappName)
+	switch event.EventType {
+	case XappLifecycleEventUndeployed, XappLifecycleEventDeleted:
+		c.DeleteXappSubscriptions(event)
+	default:
+		xapp.Logger.Debug("No action for xApp lifecycle event %s", event.EventType)
+	}
+}
+
+//-------------------------------------------------------------------
+// Deletes REST subscriptions and subscriptions made via RMR of an
+// xApp which has been removed
+//-------------------------------------------------------------------
+func (c *Control) DeleteXappSubscriptions(event XappLifecycleEvent) {
+
+	restSubIds, rmrSubscriptions := c.registry.GetXappSubscriptions(&event)
+	xapp.Logger.Info("Deleting %v REST subscriptions and %v RMR subscriptions of removed xApp %s", len(restSubIds), len(rmrSubscriptions), event.XappName)
+
+	for _, restSubId := range restSubIds {
+		c.UpdateCounter(cXappRemovalSubDel)
+		if done := c.registry.CancelRESTSubscriptionProcessing(restSubId); done != nil {
+			// Subscription can be deleted when cancelled processing has ended
+			go func(restSubId string) {
+				<-done
+				c.RESTSubscriptionDeleteHandler(restSubId)
+			}(restSubId)
+			continue
+		}
+		c.RESTSubscriptionDeleteHandler(restSubId)
+	}
+	if len(rmrSubscriptions) == 0 {
+		return
+	}
+	go func() {
+		for _, rmrSubscription := range rmrSubscriptions {
+			c.UpdateCounter(cXappRemovalSubDel)
+			xid := "xapp-removed-" + event.XappName
+			_, _, err := c.SubscriptionDeleteHandler(c.rootContext(), &xid, &rmrSubscription.Endpoint, &rmrSubscription.Meid, rmrSubscription.InstanceId, 0)
+			if err != nil {
+				xapp.Logger.Error("Deleting subscription %v of removed xApp %s failed: %s", rmrSubscription.InstanceId, event.XappName, err.Error())
+			}
+		}
+	}()
+}
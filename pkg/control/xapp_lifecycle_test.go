@@ -0,0 +1,227 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gerrit.o-ran-sc.org/r/ric-plt/e2ap/pkg/e2ap"
+	"gerrit.o-ran-sc.org/r/ric-plt/xapp-frame/pkg/xapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXappLifecycleEventMatchesRmrEndpoint(t *testing.T) {
+
+	event := XappLifecycleEvent{
+		EventType: XappLifecycleEventUndeployed,
+		XappName:  "ueec",
+		Instances: []XappInstance{{Name: "ueec-1", Ip: "10.0.0.1", Port: 4560}},
+	}
+	assert.True(t, event.MatchesRmrEndpoint("10.0.0.1", 4560))
+	assert.True(t, event.MatchesRmrEndpoint("10.0.0.1", 0))
+	assert.False(t, event.MatchesRmrEndpoint("10.0.0.1", 4561))
+	assert.True(t, event.MatchesRmrEndpoint("service-ricxapp-ueec-rmr.ricxapp", 4560))
+	assert.False(t, event.MatchesRmrEndpoint("service-ricxapp-ueec2-rmr.ricxapp", 4560))
+	assert.False(t, event.MatchesRmrEndpoint("10.0.0.2", 4560))
+
+	host, port := splitRmrEndpoint("service-ricxapp-ueec-rmr.ricxapp:4560")
+	assert.Equal(t, "service-ricxapp-ueec-rmr.ricxapp", host)
+	assert.Equal(t, int64(4560), port)
+}
+
+func TestGetXappSubscriptions(t *testing.T) {
+
+	registry := new(Registry)
+	registry.Initialize()
+
+	// REST subscriptions of two xApps
+	for i, xappName := range []string{"ueec", "ueec", "kpimon"} {
+		restSubId := "restSubId" + string(rune('1'+i))
+		xappServiceName := xappServicePrefix + xappName + "-http.ricxapp"
+		endpoint := XappRmrServiceName(xappServiceName) + ":4560"
+		meid := "RAN_NAME_1"
+		restSubs := registry.CreateRESTSubscription(&restSubId, &xappServiceName, &endpoint, &meid)
+		restSubs.AddE2InstanceId(uint32(i + 1))
+	}
+	// E2 subscriptions of the REST subscriptions and one made via RMR by ueec
+	for i, xappName := range []string{"ueec", "ueec", "kpimon", "ueec"} {
+		subs := &Subscription{registry: registry, Meid: &xapp.RMRMeid{RanName: "RAN_NAME_1"}, SubReqMsg: &e2ap.E2APSubscriptionRequest{}}
+		subs.ReqId.InstanceId = uint32(i + 1)
+		subs.EpList.AddEndpoint(&xapp.RmrEndpoint{Addr: xappServicePrefix + xappName + "-rmr.ricxapp", Port: 4560})
+		registry.addSubs(subs)
+	}
+
+	event := XappLifecycleEvent{EventType: XappLifecycleEventUndeployed, XappName: "ueec"}
+	restSubIds, rmrSubscriptions := registry.GetXappSubscriptions(&event)
+	assert.Equal(t, []string{"restSubId1", "restSubId2"}, restSubIds)
+	assert.Equal(t, []RemovedXappRmrSubscription{
+		{InstanceId: 4, Meid: "RAN_NAME_1", Endpoint: "service-ricxapp-ueec-rmr.ricxapp:4560"},
+	}, rmrSubscriptions)
+
+	event = XappLifecycleEvent{EventType: XappLifecycleEventUndeployed, XappName: "other"}
+	restSubIds, rmrSubscriptions = registry.GetXappSubscriptions(&event)
+	assert.Equal(t, 0, len(restSubIds))
+	assert.Equal(t, 0, len(rmrSubscriptions))
+}
+
+func TestAppMgrLifecycleListener(t *testing.T) {
+
+	registered := make(chan appMgrSubscriptionRequest, 1)
+	appMgr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ric/v1/subscriptions", r.URL.Path)
+		request := appMgrSubscriptionRequest{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&request))
+		registered <- request
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer appMgr.Close()
+
+	events := []XappLifecycleEvent{}
+	listener := &AppMgrLifecycleListener{AppMgrUrl: appMgr.URL + "/ric/v1", CallbackUrl: "http://submgr:8080" + appMgrCallbackPath}
+	listener.handler = func(event XappLifecycleEvent) { events = append(events, event) }
+	listener.client.Timeout = time.Second
+
+	assert.Nil(t, listener.Register())
+	request := <-registered
+	assert.Equal(t, "http://submgr:8080/ric/v1/xapp_lifecycle_events", request.Data.TargetUrl)
+	assert.Equal(t, "all", request.Data.EventType)
+
+	notification := `{"id":"1","version":1,"eventType":"undeployed","xApps":[{"name":"ueec","instances":[{"name":"ueec-1","ip":"service-ricxapp-ueec-rmr.ricxapp","port":4560}]}]}`
+	w := httptest.NewRecorder()
+	listener.CallbackHandler(w, httptest.NewRequest("POST", appMgrCallbackPath, strings.NewReader(notification)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []XappLifecycleEvent{{
+		EventType: XappLifecycleEventUndeployed,
+		XappName:  "ueec",
+		Instances: []XappInstance{{Name: "ueec-1", Ip: "service-ricxapp-ueec-rmr.ricxapp", Port: 4560}},
+	}}, events)
+
+	w = httptest.NewRecorder()
+	listener.CallbackHandler(w, httptest.NewRequest("POST", appMgrCallbackPath, strings.NewReader("{")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAppMgrLifecycleListenerReregistration(t *testing.T) {
+
+	origRetryInterval, origCheckInterval := appMgrRegisterRetryInterval, appMgrRegistrationCheckInterval
+	appMgrRegisterRetryInterval, appMgrRegistrationCheckInterval = 10*time.Millisecond, 10*time.Millisecond
+	defer func() {
+		appMgrRegisterRetryInterval, appMgrRegistrationCheckInterval = origRetryInterval, origCheckInterval
+	}()
+
+	var mutex sync.Mutex
+	available := false
+	subscriptions := []appMgrSubscription{}
+	registrations := 0
+	appMgr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if available == false {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == "GET" {
+			json.NewEncoder(w).Encode(subscriptions)
+			return
+		}
+		request := appMgrSubscriptionRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		subscriptions = append(subscriptions, appMgrSubscription{Id: strconv.Itoa(len(subscriptions)), Data: request.Data})
+		registrations++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer appMgr.Close()
+	getRegistrations := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return registrations
+	}
+	waitRegistrations := func(count int) bool {
+		for i := 0; i < 100 && getRegistrations() != count; i++ {
+			<-time.After(10 * time.Millisecond)
+		}
+		return getRegistrations() == count
+	}
+
+	listener := &AppMgrLifecycleListener{AppMgrUrl: appMgr.URL + "/ric/v1", CallbackUrl: "http://submgr:8080" + appMgrCallbackPath}
+	listener.client.Timeout = time.Second
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		listener.maintainRegistration(stop)
+		close(stopped)
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+
+	// Registered when app manager becomes available and not again while registration exists
+	<-time.After(50 * time.Millisecond)
+	assert.Equal(t, 0, getRegistrations())
+	mutex.Lock()
+	available = true
+	mutex.Unlock()
+	assert.True(t, waitRegistrations(1))
+	<-time.After(50 * time.Millisecond)
+	assert.Equal(t, 1, getRegistrations())
+
+	// Registered again when app manager has lost the registration
+	mutex.Lock()
+	subscriptions = []appMgrSubscription{}
+	mutex.Unlock()
+	assert.True(t, waitRegistrations(2))
+	registered, err := listener.IsRegistered()
+	assert.Nil(t, err)
+	assert.True(t, registered)
+}
+
+func TestAppMgrLifecycleListenerRegisterFailure(t *testing.T) {
+
+	appMgr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer appMgr.Close()
+
+	listener := &AppMgrLifecycleListener{AppMgrUrl: appMgr.URL + "/ric/v1", CallbackUrl: "http://submgr:8080" + appMgrCallbackPath}
+	assert.NotNil(t, listener.Register())
+}
+
+func TestRestXappLifecycleListener(t *testing.T) {
+
+	events := []XappLifecycleEvent{}
+	listener := &RestXappLifecycleListener{handler: func(event XappLifecycleEvent) { events = append(events, event) }}
+
+	w := httptest.NewRecorder()
+	listener.EventHandler(w, httptest.NewRequest("POST", xappLifecycleEventPath, strings.NewReader(`{"EventType":"undeployed","XappName":"ueec"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []XappLifecycleEvent{{EventType: XappLifecycleEventUndeployed, XappName: "ueec"}}, events)
+
+	w = httptest.NewRecorder()
+	listener.EventHandler(w, httptest.NewRequest("POST", xappLifecycleEventPath, strings.NewReader(`{"XappName":"ueec"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 1, len(events))
+}
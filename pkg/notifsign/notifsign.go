@@ -0,0 +1,137 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+// Package notifsign signs REST subscription notifications sent by Subscription
+// Manager and verifies them in xApps.
+//
+// Signature is HMAC-SHA256 calculated with the shared secret of the xApp over
+// the string "<timestamp>.<body>", where timestamp is Unix time in seconds
+// carried in TimestampHeader. Signature is carried in SignatureHeader as
+// "sha256=<hex>".
+package notifsign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Submgr-Signature"
+	TimestampHeader = "X-Submgr-Timestamp"
+	signaturePrefix = "sha256="
+)
+
+// Default maximum age of a notification accepted by verification
+const DefaultMaxAge = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("notifsign: signature or timestamp header missing")
+	ErrInvalidTimestamp = errors.New("notifsign: invalid timestamp")
+	ErrExpired          = errors.New("notifsign: timestamp outside of allowed window")
+	ErrInvalidSignature = errors.New("notifsign: invalid signature")
+)
+
+//-----------------------------------------------------------------------------
+// Sign returns signature of body for given timestamp
+//-----------------------------------------------------------------------------
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+//-----------------------------------------------------------------------------
+// SignRequest adds timestamp and signature headers to request
+//-----------------------------------------------------------------------------
+func SignRequest(req *http.Request, secret []byte, body []byte, now time.Time) {
+	timestamp := now.Unix()
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+}
+
+//-----------------------------------------------------------------------------
+// Verify checks signature of body. Timestamp must not differ from now more
+// than maxAge to prevent replay of old notifications.
+//-----------------------------------------------------------------------------
+func Verify(secret []byte, timestamp string, body []byte, signature string, maxAge time.Duration, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > maxAge || age < -maxAge {
+		return ErrExpired
+	}
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// VerifyRequest reads and verifies body of the request. Body is restored so
+// that the request can be still processed normally.
+//-----------------------------------------------------------------------------
+func VerifyRequest(req *http.Request, secret []byte, maxAge time.Duration) ([]byte, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	err := Verify(secret, req.Header.Get(TimestampHeader), body, req.Header.Get(SignatureHeader), maxAge, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+//-----------------------------------------------------------------------------
+// Handler rejects notifications which are not signed with the secret before
+// passing them to next handler
+//-----------------------------------------------------------------------------
+func Handler(secret []byte, maxAge time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := VerifyRequest(req, secret, maxAge); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,66 @@
+/*
+==================================================================================
+  Copyright (c) 2021 Nokia
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+==================================================================================
+*/
+
+package notifsign
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = []byte("test-secret")
+var testBody = []byte(`{"SubscriptionId":"2BRurcRqjg7Uq7X4ISlapbj1ghh"}`)
+
+func TestVerifySignedBody(t *testing.T) {
+	now := time.Now()
+	signature := Sign(testSecret, now.Unix(), testBody)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	assert.Nil(t, Verify(testSecret, timestamp, testBody, signature, DefaultMaxAge, now))
+	assert.Equal(t, ErrInvalidSignature, Verify([]byte("other-secret"), timestamp, testBody, signature, DefaultMaxAge, now))
+	assert.Equal(t, ErrInvalidSignature, Verify(testSecret, timestamp, []byte("{}"), signature, DefaultMaxAge, now))
+	assert.Equal(t, ErrExpired, Verify(testSecret, timestamp, testBody, signature, DefaultMaxAge, now.Add(10*time.Minute)))
+	assert.Equal(t, ErrInvalidTimestamp, Verify(testSecret, "abc", testBody, signature, DefaultMaxAge, now))
+	assert.Equal(t, ErrMissingSignature, Verify(testSecret, timestamp, testBody, "", DefaultMaxAge, now))
+}
+
+func TestHandler(t *testing.T) {
+	var received []byte
+	handler := Handler(testSecret, DefaultMaxAge, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received, _ = io.ReadAll(req.Body)
+	}))
+
+	req := httptest.NewRequest("POST", "/ric/v1/subscriptions/response", bytes.NewReader(testBody))
+	SignRequest(req, testSecret, testBody, time.Now())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, testBody, received)
+
+	req = httptest.NewRequest("POST", "/ric/v1/subscriptions/response", bytes.NewReader(testBody))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
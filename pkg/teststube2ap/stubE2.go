@@ -666,6 +666,39 @@ func (tc *E2Stub) RecvSubsDelResp(t *testing.T, trans *RmrTransactionId) {
 	}
 }
 
+//-----------------------------------------------------------------------------
+//
+//-----------------------------------------------------------------------------
+func (tc *E2Stub) RecvSubsDelFail(t *testing.T, trans *RmrTransactionId) {
+	tc.Debug("RecvSubsDelFail")
+	e2SubsDelFail := e2asnpacker.NewPackerSubscriptionDeleteFailure()
+
+	//---------------------------------
+	// xapp activity: Recv Subs Del Fail
+	//---------------------------------
+	msg := tc.WaitMsg(15)
+	if msg != nil {
+		if msg.Mtype != xapp.RICMessageTypes["RIC_SUB_DEL_FAILURE"] {
+			tc.TestError(t, "Received RIC_SUB_DEL_FAILURE wrong mtype expected %s got %s, error", "RIC_SUB_DEL_FAILURE", xapp.RicMessageTypeToName[msg.Mtype])
+			return
+		} else if trans != nil && msg.Xid != trans.xid {
+			tc.TestError(t, "Received RIC_SUB_DEL_FAILURE wrong xid expected %s got %s, error", trans.xid, msg.Xid)
+			return
+		} else {
+			packedData := &e2ap.PackedData{}
+			packedData.Buf = msg.Payload
+			unpackerr, resp := e2SubsDelFail.UnPack(packedData)
+			if unpackerr != nil {
+				tc.TestError(t, "RIC_SUB_DEL_FAILURE unpack failed err: %s", unpackerr.Error())
+			}
+			tc.Debug("Recv Subs Del Fail rmr: xid=%s subid=%d, asn: instanceid=%d", msg.Xid, msg.SubId, resp.RequestId.InstanceId)
+			return
+		}
+	} else {
+		tc.TestError(t, "Not Received msg within %d secs", 15)
+	}
+}
+
 //-----------------------------------------------------------------------------
 //
 //-----------------------------------------------------------------------------